@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+)
+
+// contractABIsBucket stores contract ABIs by lowercase address
+const contractABIsBucket = "CONTRACT_ABIS"
+
+// Sources of a stored ABI
+const (
+	abiSourceAdmin    = "admin"
+	abiSourceSourcify = "sourcify"
+	abiSourceExplorer = "explorer"
+)
+
+// contractABI is an ABI in the registry
+type contractABI struct {
+	Address   string          `json:"address"`
+	Source    string          `json:"source"` // admin, sourcify or explorer
+	Events    int             `json:"events"`
+	UpdatedAt int64           `json:"updatedAt"`
+	ABI       json.RawMessage `json:"abi,omitempty"`
+}
+
+// abiUpload is the body of PUT /admin/abis/:address
+type abiUpload struct {
+	ABI json.RawMessage `json:"abi" binding:"required"`
+}
+
+// abiRegistry decodes the events of contracts with a known ABI. ABIs are
+// registered through the admin API or, for contracts that emit logs without
+// one, fetched in the background from Sourcify and the configured explorer.
+type abiRegistry struct {
+	kv          nats.KeyValue // Bound in setupKeyValueStores
+	chainID     *big.Int
+	sourcify    string
+	explorer    string
+	explorerKey string
+	retry       time.Duration
+	client      *http.Client
+
+	mu      sync.RWMutex
+	abis    map[common.Address]*abi.ABI
+	misses  map[common.Address]time.Time // Unverified contracts and when to ask again
+	queued  map[common.Address]bool
+	fetches chan common.Address
+}
+
+// newABIRegistry returns an empty registry; fetching is enabled when a
+// Sourcify or explorer URL is configured
+func newABIRegistry(chainID *big.Int, sourcify, explorer, explorerKey string, retry time.Duration) *abiRegistry {
+	return &abiRegistry{
+		chainID:     chainID,
+		sourcify:    strings.TrimSuffix(sourcify, "/"),
+		explorer:    explorer,
+		explorerKey: explorerKey,
+		retry:       retry,
+		client:      &http.Client{Timeout: 15 * time.Second},
+		abis:        make(map[common.Address]*abi.ABI),
+		misses:      make(map[common.Address]time.Time),
+		queued:      make(map[common.Address]bool),
+		fetches:     make(chan common.Address, 256),
+	}
+}
+
+// fetching reports whether unknown contracts are looked up
+func (r *abiRegistry) fetching() bool {
+	return r.sourcify != "" || r.explorer != ""
+}
+
+// bind loads the stored ABIs from the key-value bucket
+func (r *abiRegistry) bind(kv nats.KeyValue) error {
+	r.kv = kv
+	keys, err := kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		entry, err := kv.Get(key)
+		if err != nil {
+			continue
+		}
+		var stored contractABI
+		if err := json.Unmarshal(entry.Value(), &stored); err != nil {
+			continue
+		}
+		parsed, err := abi.JSON(bytes.NewReader(stored.ABI))
+		if err != nil {
+			log.Printf("[ABIS] WARNING: Ignoring invalid stored ABI of %s: %v", stored.Address, err)
+			continue
+		}
+		r.abis[common.HexToAddress(stored.Address)] = &parsed
+	}
+	log.Printf("[ABIS] Loaded %d contract ABIs", len(r.abis))
+	return nil
+}
+
+// store validates an ABI and saves it in the registry
+func (r *abiRegistry) store(addr common.Address, source string, raw json.RawMessage) (contractABI, error) {
+	parsed, err := abi.JSON(bytes.NewReader(raw))
+	if err != nil {
+		return contractABI{}, fmt.Errorf("invalid ABI: %v", err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return contractABI{}, fmt.Errorf("invalid ABI: %v", err)
+	}
+	stored := contractABI{
+		Address:   strings.ToLower(addr.Hex()),
+		Source:    source,
+		Events:    len(parsed.Events),
+		UpdatedAt: time.Now().Unix(),
+		ABI:       compact.Bytes(),
+	}
+	data, _ := json.Marshal(stored)
+	if _, err := r.kv.Put(stored.Address, data); err != nil {
+		return contractABI{}, err
+	}
+
+	r.mu.Lock()
+	r.abis[addr] = &parsed
+	delete(r.misses, addr)
+	r.mu.Unlock()
+	return stored, nil
+}
+
+// lookup returns the ABI of a contract and queues a fetch when it is unknown
+func (r *abiRegistry) lookup(addr common.Address) *abi.ABI {
+	r.mu.RLock()
+	parsed, ok := r.abis[addr]
+	r.mu.RUnlock()
+	if ok || !r.fetching() {
+		return parsed
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queued[addr] || time.Now().Before(r.misses[addr]) {
+		return nil
+	}
+	select {
+	case r.fetches <- addr:
+		r.queued[addr] = true
+	default: // Queued again the next time the contract emits a log
+	}
+	return nil
+}
+
+// decode adds event, eventSignature and args to logs of contracts with a
+// known ABI
+func (r *abiRegistry) decode(logs []map[string]interface{}) {
+	for _, entry := range logs {
+		addr, ok := addressOf(entry["address"])
+		if !ok {
+			continue
+		}
+		contract := r.lookup(addr)
+		if contract == nil {
+			continue
+		}
+		event, args, err := decodeEvent(contract, entry)
+		if err != nil {
+			continue
+		}
+		entry["event"] = event.Name
+		entry["eventSignature"] = event.Sig
+		entry["args"] = args
+	}
+}
+
+// decodeEvent decodes the topics and data of a raw log
+func decodeEvent(contract *abi.ABI, entry map[string]interface{}) (*abi.Event, map[string]interface{}, error) {
+	rawTopics, _ := entry["topics"].([]interface{})
+	topics := make([]common.Hash, 0, len(rawTopics))
+	for _, topic := range rawTopics {
+		hex, _ := topic.(string)
+		topics = append(topics, common.HexToHash(hex))
+	}
+	if len(topics) == 0 {
+		return nil, nil, errors.New("anonymous log")
+	}
+	event, err := contract.EventByID(topics[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	data, _ := entry["data"].(string)
+	payload, err := hexutil.Decode(data)
+	if err != nil && data != "0x" {
+		return nil, nil, err
+	}
+
+	// Unnamed inputs are named by position so they don't overwrite each other
+	inputs := make(abi.Arguments, len(event.Inputs))
+	var indexed abi.Arguments
+	for i, input := range event.Inputs {
+		if input.Name == "" {
+			input.Name = fmt.Sprintf("arg%d", i)
+		}
+		inputs[i] = input
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	args := make(map[string]interface{}, len(inputs))
+	if err := inputs.UnpackIntoMap(args, payload); err != nil {
+		return nil, nil, err
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, topics[1:]); err != nil {
+		return nil, nil, err
+	}
+	for name, value := range args {
+		args[name] = jsonValue(value)
+	}
+	return event, args, nil
+}
+
+// jsonValue converts decoded values JSON can't carry losslessly: integers
+// become decimal strings, byte arrays hex strings
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return hexutil.Encode(v)
+	case common.Address, common.Hash, string, bool:
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return hexutil.Encode(b)
+		}
+		fallthrough
+	case reflect.Slice:
+		values := make([]interface{}, rv.Len())
+		for i := range values {
+			values[i] = jsonValue(rv.Index(i).Interface())
+		}
+		return values
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(value)
+	}
+	return value
+}
+
+// run fetches the ABIs of queued contracts until ctx is done
+func (r *abiRegistry) run(ctx context.Context) {
+	if !r.fetching() {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case addr := <-r.fetches:
+			source, raw, err := r.fetch(ctx, addr)
+			if err == nil && raw != nil && r.kv != nil {
+				_, err = r.store(addr, source, raw)
+			}
+
+			r.mu.Lock()
+			delete(r.queued, addr)
+			if err == nil && raw == nil {
+				r.misses[addr] = time.Now().Add(r.retry)
+			}
+			r.mu.Unlock()
+			switch {
+			case err != nil:
+				log.Printf("[ABIS] WARNING: Failed to fetch ABI of %s: %v", addr.Hex(), err)
+			case raw != nil:
+				log.Printf("[ABIS] Fetched ABI of %s from %s", addr.Hex(), source)
+			}
+		}
+	}
+}
+
+// fetch asks Sourcify, then the explorer, for the verified ABI of a contract.
+// A nil ABI without an error means the contract isn't verified.
+func (r *abiRegistry) fetch(ctx context.Context, addr common.Address) (string, json.RawMessage, error) {
+	var errs []error
+	if r.sourcify != "" {
+		raw, err := r.fetchSourcify(ctx, addr)
+		if raw != nil {
+			return abiSourceSourcify, raw, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sourcify: %v", err))
+		}
+	}
+	if r.explorer != "" {
+		raw, err := r.fetchExplorer(ctx, addr)
+		if raw != nil {
+			return abiSourceExplorer, raw, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("explorer: %v", err))
+		}
+	}
+	return "", nil, errors.Join(errs...)
+}
+
+// fetchSourcify reads GET /v2/contract/{chainId}/{address}?fields=abi
+func (r *abiRegistry) fetchSourcify(ctx context.Context, addr common.Address) (json.RawMessage, error) {
+	endpoint := fmt.Sprintf("%s/v2/contract/%s/%s?fields=abi", r.sourcify, r.chainID, addr.Hex())
+	body, status, err := r.get(ctx, endpoint)
+	if err != nil || status == http.StatusNotFound {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("returned HTTP %d", status)
+	}
+	var resp struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	if len(resp.ABI) == 0 || string(resp.ABI) == "null" {
+		return nil, nil
+	}
+	return resp.ABI, nil
+}
+
+// fetchExplorer reads an Etherscan or Blockscout compatible
+// ?module=contract&action=getabi endpoint
+func (r *abiRegistry) fetchExplorer(ctx context.Context, addr common.Address) (json.RawMessage, error) {
+	query := url.Values{"module": {"contract"}, "action": {"getabi"}, "address": {addr.Hex()}}
+	if r.explorerKey != "" {
+		query.Set("apikey", r.explorerKey)
+	}
+	separator := "?"
+	if strings.Contains(r.explorer, "?") {
+		separator = "&"
+	}
+	body, status, err := r.get(ctx, r.explorer+separator+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("returned HTTP %d", status)
+	}
+	var resp struct {
+		Status string `json:"status"`
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	if resp.Status != "1" {
+		if strings.Contains(strings.ToLower(resp.Result), "rate limit") {
+			return nil, errors.New(resp.Result)
+		}
+		return nil, nil // Not verified
+	}
+	return json.RawMessage(resp.Result), nil
+}
+
+// get performs a GET request and reads the body
+func (r *abiRegistry) get(ctx context.Context, endpoint string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	return body, resp.StatusCode, err
+}
+
+// abiAddress reads the :address parameter
+func abiAddress(c *gin.Context) (common.Address, bool) {
+	address := c.Param("address")
+	if !common.IsHexAddress(address) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid address %q", address)})
+		return common.Address{}, false
+	}
+	return common.HexToAddress(address), true
+}
+
+// Handle GET /admin/abis listing the registered contracts
+func (dt *SomniaStream) handleListABIs(c *gin.Context) {
+	keys, err := dt.abis.kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	contracts := make([]contractABI, 0, len(keys))
+	for _, key := range keys {
+		entry, err := dt.abis.kv.Get(key)
+		if err != nil {
+			continue
+		}
+		var stored contractABI
+		if err := json.Unmarshal(entry.Value(), &stored); err == nil {
+			stored.ABI = nil // Listed without the ABI itself
+			contracts = append(contracts, stored)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"contracts": contracts})
+}
+
+// Handle GET /admin/abis/:address
+func (dt *SomniaStream) handleGetABI(c *gin.Context) {
+	addr, ok := abiAddress(c)
+	if !ok {
+		return
+	}
+	entry, err := dt.abis.kv.Get(strings.ToLower(addr.Hex()))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown contract"})
+		return
+	}
+	var stored contractABI
+	if err := json.Unmarshal(entry.Value(), &stored); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stored)
+}
+
+// Handle PUT /admin/abis/:address {"abi": [...]}, replacing a fetched ABI
+func (dt *SomniaStream) handlePutABI(c *gin.Context) {
+	addr, ok := abiAddress(c)
+	if !ok {
+		return
+	}
+	var req abiUpload
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	stored, err := dt.abis.store(addr, abiSourceAdmin, req.ABI)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ABIS] Registered ABI of %s (%d events)", stored.Address, stored.Events)
+	c.JSON(http.StatusOK, stored)
+}
+
+// Handle DELETE /admin/abis/:address
+func (dt *SomniaStream) handleDeleteABI(c *gin.Context) {
+	addr, ok := abiAddress(c)
+	if !ok {
+		return
+	}
+	key := strings.ToLower(addr.Hex())
+	if _, err := dt.abis.kv.Get(key); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown contract"})
+		return
+	}
+	if err := dt.abis.kv.Delete(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Not fetched again until the retry interval passed
+	dt.abis.mu.Lock()
+	delete(dt.abis.abis, addr)
+	dt.abis.misses[addr] = time.Now().Add(dt.abis.retry)
+	dt.abis.mu.Unlock()
+
+	log.Printf("[ABIS] Removed ABI of %s", key)
+	c.Status(http.StatusNoContent)
+}
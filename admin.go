@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"somnia-stream/pkg/api"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// setupAdminRoutes registers the authenticated /admin API when an admin token or OIDC login is configured
+func (dt *SomniaStream) setupAdminRoutes() {
+	if dt.config().AdminToken == "" && !dt.oidcEnabled() {
+		log.Println("ADMIN_TOKEN and OIDC_ISSUER not set, admin API disabled")
+		return
+	}
+	dt.setupOIDCRoutes()
+
+	admin := api.Documented(&dt.adminAPI.RouterGroup, dt.openapi).Group("/admin")
+	adminOp := func(op api.Operation) api.Operation {
+		op.Tags = []string{"admin"}
+		op.Errors = mergeErrors(adminErrors, op.Errors)
+		op.Security = adminSecurity
+		return op
+	}
+	unknown := func(what string) map[int]string {
+		return map[int]string{http.StatusNotFound: "Unknown " + what}
+	}
+
+	monitors := admin.Group("", dt.requireAdmin("admin:monitors"))
+	monitors.GET("/monitors", adminOp(api.Operation{
+		Summary: "List monitors with their runtime state",
+		Response: struct {
+			Monitors []monitor.Status `json:"monitors"`
+		}{},
+	}), dt.handleListMonitors)
+	monitors.POST("/monitors/:name/pause", adminOp(api.Operation{
+		Summary:  "Pause a monitor",
+		Response: monitor.Status{},
+		Errors:   unknown("monitor"),
+	}), dt.handlePauseMonitor)
+	monitors.POST("/monitors/:name/resume", adminOp(api.Operation{
+		Summary:  "Resume a monitor",
+		Response: monitor.Status{},
+		Errors:   unknown("monitor"),
+	}), dt.handleResumeMonitor)
+	monitors.PATCH("/monitors/:name", adminOp(api.Operation{
+		Summary:  "Change the interval or paused state of a monitor",
+		Body:     monitorUpdate{},
+		Response: monitor.Status{},
+		Errors:   mergeErrors(unknown("monitor"), map[int]string{http.StatusBadRequest: "Invalid interval"}),
+	}), dt.handleUpdateMonitor)
+
+	config := admin.Group("", dt.requireAdmin("admin:config"))
+	config.POST("/config/reload", adminOp(api.Operation{
+		Summary:     "Reload the configuration from the environment and .env",
+		Description: "Settings that need a restart keep their current value until then.",
+		Response: struct {
+			Reloaded bool     `json:"reloaded"`
+			Changed  []string `json:"changed"`
+		}{},
+	}), dt.handleReloadConfig)
+
+	derived := admin.Group("", dt.requireAdmin("admin:streams"))
+	derived.GET("/streams", adminOp(api.Operation{Summary: "List derived streams"}), dt.handleListDerivedStreams)
+	derived.POST("/streams", adminOp(api.Operation{
+		Summary: "Declare a derived stream",
+		Body:    streams.DerivedSpec{},
+		Status:  http.StatusCreated,
+		Errors:  map[int]string{http.StatusBadRequest: "Invalid definition"},
+	}), dt.handleCreateStream)
+	derived.DELETE("/streams/:name", adminOp(api.Operation{
+		Summary: "Delete a derived stream",
+		Errors:  unknown("stream"),
+	}), dt.handleDeleteStream)
+	derived.DELETE("/streams/:name/messages", adminOp(api.Operation{
+		Summary: "Purge stored messages of a stream",
+		Params: []api.Param{
+			{Name: "before_seq", In: "query", Type: "integer", Description: "Purge messages before this sequence"},
+			{Name: "keep", In: "query", Type: "integer", Description: "Keep the newest messages"},
+		},
+		Errors: mergeErrors(unknown("stream"), map[int]string{http.StatusBadRequest: "Invalid purge parameters"}),
+	}), dt.handlePurgeStream)
+
+	clients := admin.Group("", dt.requireAdmin("admin:clients"))
+	clients.GET("/clients", adminOp(api.Operation{
+		Summary: "List connected streaming clients",
+		Response: struct {
+			Count   int          `json:"count"`
+			Clients []clientInfo `json:"clients"`
+		}{},
+	}), dt.handleListClients)
+	clients.DELETE("/clients/:id", adminOp(api.Operation{
+		Summary: "Disconnect a streaming client",
+		Errors:  unknown("client"),
+	}), dt.handleKickClient)
+
+	keys := admin.Group("", dt.requireAdmin("admin:keys"))
+	keys.GET("/keys", adminOp(api.Operation{
+		Summary: "List API keys",
+		Response: struct {
+			Keys []apiKey `json:"keys"`
+		}{},
+	}), dt.handleListAPIKeys)
+	keys.POST("/keys", adminOp(api.Operation{
+		Summary:     "Create an API key",
+		Description: "The plaintext key is only returned in this response.",
+		Body:        apiKeyRequest{},
+		Response: struct {
+			Key    string `json:"key"`
+			APIKey apiKey `json:"apiKey"`
+		}{},
+		Status: http.StatusCreated,
+		Errors: map[int]string{http.StatusBadRequest: "Missing name or unknown scope"},
+	}), dt.handleCreateAPIKey)
+	keys.PATCH("/keys/:id", adminOp(api.Operation{
+		Summary:  "Rename, re-scope, disable or enable an API key",
+		Body:     apiKeyUpdate{},
+		Response: apiKey{},
+		Errors:   mergeErrors(unknown("API key"), map[int]string{http.StatusBadRequest: "Unknown scope"}),
+	}), dt.handleUpdateAPIKey)
+	keys.DELETE("/keys/:id", adminOp(api.Operation{
+		Summary: "Revoke an API key",
+		Errors:  unknown("API key"),
+	}), dt.handleDeleteAPIKey)
+
+	usage := admin.Group("", dt.requireAdmin("admin:usage"))
+	usage.GET("/usage", adminOp(api.Operation{Summary: "Per API key usage of the current interval"}), dt.handleUsage)
+
+	dlq := admin.Group("", dt.requireAdmin("admin:dlq"))
+	dlq.GET("/dlq", adminOp(api.Operation{
+		Summary: "List dead-lettered and spooled messages",
+		Params:  []api.Param{{Name: "limit", In: "query", Type: "integer", Description: "Maximum messages, default 100"}},
+	}), dt.handleListDLQ)
+	dlq.POST("/dlq/redrive", adminOp(api.Operation{
+		Summary: "Re-publish dead-lettered messages to their original subjects",
+		Response: struct {
+			Redriven int `json:"redriven"`
+		}{},
+	}), dt.handleRedriveDLQ)
+
+	abis := admin.Group("", dt.requireAdmin("admin:abis"))
+	abis.GET("/abis", adminOp(api.Operation{
+		Summary: "List contracts with a registered ABI",
+		Response: struct {
+			Contracts []contractABI `json:"contracts"`
+		}{},
+	}), dt.handleListABIs)
+	abis.GET("/abis/:address", adminOp(api.Operation{
+		Summary:  "Get the ABI of a contract",
+		Response: contractABI{},
+		Errors:   mergeErrors(unknown("contract"), map[int]string{http.StatusBadRequest: "Invalid address"}),
+	}), dt.handleGetABI)
+	abis.PUT("/abis/:address", adminOp(api.Operation{
+		Summary:     "Register the ABI of a contract",
+		Description: "Replaces a fetched ABI; events of the contract are decoded on the logs stream from then on.",
+		Body:        abiUpload{},
+		Response:    contractABI{},
+		Errors:      map[int]string{http.StatusBadRequest: "Invalid address or ABI"},
+	}), dt.handlePutABI)
+	abis.DELETE("/abis/:address", adminOp(api.Operation{
+		Summary: "Remove the ABI of a contract",
+		Errors:  mergeErrors(unknown("contract"), map[int]string{http.StatusBadRequest: "Invalid address"}),
+	}), dt.handleDeleteABI)
+
+	state := admin.Group("", dt.requireAdmin("admin:state"))
+	state.GET("/state-reads", adminOp(api.Operation{
+		Summary: "List the registered state reads",
+		Response: struct {
+			Reads []stateRead `json:"reads"`
+		}{},
+	}), dt.handleListStateReads)
+	state.PUT("/state-reads/:name", adminOp(api.Operation{
+		Summary:     "Register a state read",
+		Description: "Calls the view method through Multicall3 every block (or every N blocks) and publishes the result on eth.state.<name>. Replaces a read with the same name.",
+		Body:        stateRead{},
+		Response:    stateRead{},
+		Errors:      map[int]string{http.StatusBadRequest: "Invalid name, address, method, arguments or return types"},
+	}), dt.handlePutStateRead)
+	state.DELETE("/state-reads/:name", adminOp(api.Operation{
+		Summary: "Remove a state read",
+		Errors:  unknown("state read"),
+	}), dt.handleDeleteStateRead)
+
+	// Fault injection is only routable when CHAOS was enabled at startup
+	if dt.chaos != nil {
+		chaos := admin.Group("", dt.requireAdmin("admin:chaos"))
+		chaos.GET("/chaos", adminOp(api.Operation{Summary: "Active faults and injection counts", Response: chaosStatus{}}), dt.handleGetChaos)
+		chaos.PUT("/chaos", adminOp(api.Operation{
+			Summary:     "Inject RPC timeouts, malformed payloads and delayed blocks",
+			Description: "Replaces the active faults. Rates are between 0 and 1; durations use Go syntax such as 10s.",
+			Body:        chaosFaults{},
+			Response:    chaosStatus{},
+			Errors:      map[int]string{http.StatusBadRequest: "Invalid rate, duration or unknown stream"},
+		}), dt.handleSetChaos)
+		chaos.DELETE("/chaos", adminOp(api.Operation{Summary: "Clear the active faults", Response: chaosStatus{}}), dt.handleClearChaos)
+		chaos.POST("/chaos/nats-disconnect", adminOp(api.Operation{
+			Summary: "Drop the NATS connection so the client reconnects",
+			Response: struct {
+				Closed int `json:"closed"`
+			}{},
+		}), dt.handleChaosNATSDisconnect)
+	}
+}
+
+// requireAdmin checks the admin bearer token (Authorization: Bearer <token> or
+// X-Admin-Token), a signed-in OIDC session, or an API key carrying the scope
+func (dt *SomniaStream) requireAdmin(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.GetHeader("X-Admin-Token")
+		}
+
+		adminToken := dt.config().AdminToken
+		if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+			c.Next()
+			return
+		}
+		if user, ok := dt.sessionUser(c); ok && dt.userAllowed(user) {
+			c.Set("adminUser", user)
+			c.Next()
+			return
+		}
+		if key := requestCredential(c); strings.HasPrefix(key, apiKeyPrefix) {
+			if status, message := dt.authenticateAPIKey(c, key); status != http.StatusOK {
+				c.AbortWithStatusJSON(status, gin.H{"error": message})
+				return
+			}
+			if record, _ := requestKey(c); !record.hasScope(scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing scope " + scope})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// Send browsers through the login flow
+		if dt.oidcEnabled() && c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), "text/html") {
+			c.Redirect(http.StatusFound, "/auth/login?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+			c.Abort()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	}
+}
+
+// List all monitors with their runtime state
+func (dt *SomniaStream) handleListMonitors(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"monitors": dt.monitors.List()})
+}
+
+func (dt *SomniaStream) handlePauseMonitor(c *gin.Context) {
+	if err := dt.monitors.Pause(c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	dt.respondMonitor(c)
+}
+
+func (dt *SomniaStream) handleResumeMonitor(c *gin.Context) {
+	if err := dt.monitors.Resume(c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	dt.respondMonitor(c)
+}
+
+// monitorUpdate is the body of PATCH /admin/monitors/:name
+type monitorUpdate struct {
+	Interval string `json:"interval"`
+	Paused   *bool  `json:"paused"`
+}
+
+// Handle PATCH /admin/monitors/:name {"interval": "1s", "paused": false}
+func (dt *SomniaStream) handleUpdateMonitor(c *gin.Context) {
+	var req monitorUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	if _, ok := dt.monitors.Status(name); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown monitor"})
+		return
+	}
+
+	if req.Interval != "" {
+		interval, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval"})
+			return
+		}
+		if err := dt.monitors.SetInterval(name, interval); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Paused != nil {
+		if *req.Paused {
+			_ = dt.monitors.Pause(name)
+		} else {
+			_ = dt.monitors.Resume(name)
+		}
+	}
+
+	dt.respondMonitor(c)
+}
+
+func (dt *SomniaStream) respondMonitor(c *gin.Context) {
+	status, ok := dt.monitors.Status(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown monitor"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// gasSpikeDetector keeps a rolling window of gas price samples and flags
+// prices that deviate from the window mean by a configurable multiple
+type gasSpikeDetector struct {
+	mu         sync.Mutex
+	samples    []float64
+	window     int
+	multiplier float64
+	minSamples int
+}
+
+// gasWindowStats summarises the rolling baseline at the time of a check
+type gasWindowStats struct {
+	Samples int     `json:"samples"`
+	Mean    float64 `json:"mean"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	StdDev  float64 `json:"stdDev"`
+}
+
+func newGasSpikeDetector(window int, multiplier float64, minSamples int) *gasSpikeDetector {
+	if window <= 0 {
+		window = 20
+	}
+	if multiplier <= 1 {
+		multiplier = 2.0
+	}
+	if minSamples <= 0 || minSamples > window {
+		minSamples = window
+	}
+	return &gasSpikeDetector{
+		samples:    make([]float64, 0, window),
+		window:     window,
+		multiplier: multiplier,
+		minSamples: minSamples,
+	}
+}
+
+// observe records a new gas price (in gwei) and returns the direction of the
+// deviation ("spike", "drop" or "" if none) together with the baseline stats
+// computed before the sample was added and the multiplier it was checked with
+func (d *gasSpikeDetector) observe(gwei float64) (string, gasWindowStats, float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := d.stats()
+	kind := ""
+	if stats.Samples >= d.minSamples && stats.Mean > 0 {
+		switch {
+		case gwei >= stats.Mean*d.multiplier:
+			kind = "spike"
+		case gwei <= stats.Mean/d.multiplier:
+			kind = "drop"
+		}
+	}
+
+	d.samples = append(d.samples, gwei)
+	if len(d.samples) > d.window {
+		d.samples = d.samples[len(d.samples)-d.window:]
+	}
+
+	return kind, stats, d.multiplier
+}
+
+// reconfigure applies new detection parameters while keeping the collected samples
+func (d *gasSpikeDetector) reconfigure(window int, multiplier float64, minSamples int) {
+	fresh := newGasSpikeDetector(window, multiplier, minSamples)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.window = fresh.window
+	d.multiplier = fresh.multiplier
+	d.minSamples = fresh.minSamples
+	if len(d.samples) > d.window {
+		d.samples = d.samples[len(d.samples)-d.window:]
+	}
+}
+
+// stats must be called with the lock held
+func (d *gasSpikeDetector) stats() gasWindowStats {
+	stats := gasWindowStats{Samples: len(d.samples)}
+	if len(d.samples) == 0 {
+		return stats
+	}
+
+	stats.Min, stats.Max = d.samples[0], d.samples[0]
+	var sum float64
+	for _, s := range d.samples {
+		sum += s
+		stats.Min = math.Min(stats.Min, s)
+		stats.Max = math.Max(stats.Max, s)
+	}
+	stats.Mean = sum / float64(len(d.samples))
+
+	var variance float64
+	for _, s := range d.samples {
+		variance += (s - stats.Mean) * (s - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(d.samples)))
+
+	return stats
+}
+
+// Check the latest gas price against the rolling baseline and publish an alert
+func (dt *SomniaStream) checkGasSpike(gasPrice *big.Int) error {
+	gwei := weiToGwei(gasPrice)
+
+	kind, stats, multiplier := dt.gasSpike.observe(gwei)
+	if kind == "" {
+		return nil
+	}
+
+	deviation := gwei / stats.Mean
+	log.Printf("[GAS] ⚠️ Gas price %s detected: %.4f gwei (%.2fx baseline %.4f gwei)", kind, gwei, deviation, stats.Mean)
+
+	alert := map[string]interface{}{
+		"type":       kind,
+		"gasPrice":   gasPrice.String(),
+		"gwei":       gwei,
+		"baseline":   stats.Mean,
+		"deviation":  deviation,
+		"multiplier": multiplier,
+		"window":     stats,
+		"timestamp":  time.Now().Unix(),
+	}
+
+	data, _ := json.Marshal(alert)
+	err := dt.publish("eth.alerts.gas", data)
+	return err
+}
+
+// whaleDetector flags transactions whose native value meets a threshold, and
+// ERC-20 transfers whose amount meets the threshold of their token
+type whaleDetector struct {
+	mu          sync.Mutex
+	threshold   *big.Int
+	tokens      map[common.Address]*big.Rat // In token units, scaled by the token's decimals when checked
+	seenPending map[string]time.Time
+}
+
+// newWhaleDetector parses a threshold expressed in ether units (e.g. "10000"
+// or "0.5") and token thresholds in token units by token address
+func newWhaleDetector(threshold string, tokenThresholds map[string]string) (*whaleDetector, error) {
+	value, ok := new(big.Float).SetString(threshold)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("cannot parse %q as a native amount", threshold)
+	}
+	wei, _ := new(big.Float).Mul(value, big.NewFloat(1e18)).Int(nil)
+
+	tokens := make(map[common.Address]*big.Rat, len(tokenThresholds))
+	for address, amount := range tokenThresholds {
+		units, ok := new(big.Rat).SetString(amount)
+		if !ok || units.Sign() <= 0 {
+			return nil, fmt.Errorf("cannot parse %q as an amount of token %s", amount, address)
+		}
+		tokens[common.HexToAddress(address)] = units
+	}
+
+	return &whaleDetector{
+		threshold:   wei,
+		tokens:      tokens,
+		seenPending: make(map[string]time.Time),
+	}, nil
+}
+
+func (w *whaleDetector) isWhale(value *big.Int) bool {
+	threshold := w.thresholdWei()
+	return value != nil && threshold.Sign() > 0 && value.Cmp(threshold) >= 0
+}
+
+func (w *whaleDetector) thresholdWei() *big.Int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.threshold
+}
+
+// tokenThreshold returns the threshold of a token in its smallest unit, or
+// nil when the token has none
+func (w *whaleDetector) tokenThreshold(token common.Address, decimals uint8) *big.Int {
+	w.mu.Lock()
+	units := w.tokens[token]
+	w.mu.Unlock()
+	if units == nil {
+		return nil
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled := new(big.Rat).Mul(units, new(big.Rat).SetInt(scale))
+	return new(big.Int).Quo(scaled.Num(), scaled.Denom())
+}
+
+// hasTokenThresholds reports whether any token has a threshold
+func (w *whaleDetector) hasTokenThresholds() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.tokens) > 0
+}
+
+// setThresholds replaces the native threshold, parsed from ether units, and
+// the token thresholds
+func (w *whaleDetector) setThresholds(threshold string, tokenThresholds map[string]string) error {
+	parsed, err := newWhaleDetector(threshold, tokenThresholds)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.threshold = parsed.threshold
+	w.tokens = parsed.tokens
+	w.mu.Unlock()
+	return nil
+}
+
+// markPending reports whether a pending hash is new, so the same pending
+// transaction is only alerted once while it sits in the mempool
+func (w *whaleDetector) markPending(hash string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.seenPending[hash]; ok {
+		return false
+	}
+	w.seenPending[hash] = time.Now()
+	return true
+}
+
+// cleanup forgets alerted pending hashes that have been around long enough
+// to be mined or dropped, once a minute until ctx is done
+func (w *whaleDetector) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			for hash, seen := range w.seenPending {
+				if time.Since(seen) > 10*time.Minute {
+					delete(w.seenPending, hash)
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Publish whale alerts for confirmed transactions in a block
+func (dt *SomniaStream) checkWhaleTransactions(block *types.Block) {
+	for _, tx := range block.Transactions() {
+		if !dt.whales.isWhale(tx.Value()) {
+			continue
+		}
+
+		alert := map[string]interface{}{
+			"status":      "confirmed",
+			"hash":        tx.Hash().Hex(),
+			"from":        nil,
+			"to":          tx.To(),
+			"value":       tx.Value().String(),
+			"threshold":   dt.whales.thresholdWei().String(),
+			"blockNumber": block.NumberU64(),
+			"blockHash":   block.Hash().Hex(),
+			"timestamp":   time.Now().Unix(),
+		}
+		if from, err := types.Sender(dt.signer, tx); err == nil {
+			alert["from"] = from.Hex()
+		}
+		if err := dt.publishWhaleAlert(alert); err != nil {
+			log.Printf("[WHALE] ERROR: Failed to publish whale alert for %s: %v", tx.Hash().Hex(), err)
+		}
+	}
+}
+
+// Publish whale alerts for pending transactions not alerted before
+func (dt *SomniaStream) checkWhalePending(pendingTxs []map[string]interface{}) {
+	for _, tx := range pendingTxs {
+		hash, _ := tx["hash"].(string)
+		rawValue, _ := tx["value"].(string)
+		value, err := hexutil.DecodeBig(rawValue)
+		if hash == "" || err != nil || !dt.whales.isWhale(value) {
+			continue
+		}
+		if !dt.whales.markPending(hash) {
+			continue
+		}
+
+		alert := map[string]interface{}{
+			"status":    "pending",
+			"hash":      hash,
+			"from":      tx["from"],
+			"to":        tx["to"],
+			"value":     value.String(),
+			"threshold": dt.whales.thresholdWei().String(),
+			"timestamp": time.Now().Unix(),
+		}
+		if err := dt.publishWhaleAlert(alert); err != nil {
+			log.Printf("[WHALE] ERROR: Failed to publish whale alert for %s: %v", hash, err)
+		}
+	}
+}
+
+// Publish whale alerts for ERC-20 transfers of tokens with a threshold. The
+// amount is scaled by the token's decimals, so tokens whose metadata isn't
+// resolved yet are skipped.
+func (dt *SomniaStream) checkWhaleTokenTransfers(logs []map[string]interface{}) {
+	if dt.tokens == nil || !dt.whales.hasTokenThresholds() {
+		return
+	}
+	for _, entry := range logs {
+		topics, _ := entry["topics"].([]interface{})
+		if tokenStandard(topics) != "erc20" || len(topics) != 3 {
+			continue
+		}
+		if topic, _ := topics[0].(string); common.HexToHash(topic) != topicTransfer {
+			continue
+		}
+		token, ok := addressOf(entry["address"])
+		if !ok {
+			continue
+		}
+		meta := dt.tokens.lookup(token)
+		if meta == nil || meta.Decimals == nil {
+			continue
+		}
+		threshold := dt.whales.tokenThreshold(token, *meta.Decimals)
+		data, _ := entry["data"].(string)
+		raw, err := hexutil.Decode(data)
+		if threshold == nil || err != nil || len(raw) != 32 {
+			continue
+		}
+		value := new(big.Int).SetBytes(raw)
+		if value.Cmp(threshold) < 0 {
+			continue
+		}
+
+		from, _ := topics[1].(string)
+		to, _ := topics[2].(string)
+		alert := map[string]interface{}{
+			"status":      "confirmed",
+			"hash":        entry["transactionHash"],
+			"from":        common.HexToAddress(from).Hex(),
+			"to":          common.HexToAddress(to).Hex(),
+			"value":       value.String(),
+			"threshold":   threshold.String(),
+			"token":       token.Hex(),
+			"symbol":      meta.Symbol,
+			"decimals":    *meta.Decimals,
+			"blockNumber": nil,
+			"blockHash":   entry["blockHash"],
+			"timestamp":   time.Now().Unix(),
+		}
+		if number, _ := entry["blockNumber"].(string); number != "" {
+			if n, err := hexutil.DecodeUint64(number); err == nil {
+				alert["blockNumber"] = n
+			}
+		}
+		if err := dt.publishWhaleAlert(alert); err != nil {
+			log.Printf("[WHALE] ERROR: Failed to publish whale alert for %v: %v", entry["transactionHash"], err)
+		}
+	}
+}
+
+func (dt *SomniaStream) publishWhaleAlert(alert map[string]interface{}) error {
+	log.Printf("[WHALE] 🐋 %s transaction %s moving %s wei", alert["status"], alert["hash"], alert["value"])
+
+	data, _ := json.Marshal(alert)
+	err := dt.publish("eth.alerts.whale", data)
+	return err
+}
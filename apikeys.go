@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+)
+
+// apiKeysBucket stores API keys by the SHA-256 of the key, so plaintext keys never hit NATS
+const apiKeysBucket = "API_KEYS"
+
+// apiKeyPrefix marks generated keys so they are easy to spot in logs and configs
+const apiKeyPrefix = "ss_"
+
+// apiKeyContextKey is the gin context key holding the authenticated *apiKey
+const apiKeyContextKey = "apiKey"
+
+// apiKey is the stored record of an API key
+type apiKey struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes,omitempty"` // read:* when empty
+	CreatedAt int64    `json:"createdAt"`
+	Disabled  bool     `json:"disabled,omitempty"`
+}
+
+// hashAPIKey returns the KV key of an API key; the first 16 characters double as its public ID
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Look up the stored record of a presented API key
+func (dt *SomniaStream) lookupAPIKey(key string) (*apiKey, error) {
+	entry, err := dt.apiKeys.Get(hashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var record apiKey
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Authenticate a request by API key, returning the HTTP status and message on failure
+func (dt *SomniaStream) authenticateAPIKey(c *gin.Context, key string) (int, string) {
+	record, err := dt.lookupAPIKey(key)
+	if err != nil {
+		if !errors.Is(err, nats.ErrKeyNotFound) {
+			log.Printf("[AUTH] ERROR: Failed to look up API key: %v", err)
+		}
+		return http.StatusUnauthorized, "invalid API key"
+	}
+	if record.Disabled {
+		return http.StatusForbidden, "API key disabled"
+	}
+
+	c.Set(apiKeyContextKey, record)
+	return http.StatusOK, ""
+}
+
+// Find the KV key of an API key by its public ID
+func (dt *SomniaStream) findAPIKey(id string) (string, *apiKey, error) {
+	hashes, err := dt.apiKeys.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return "", nil, err
+	}
+	for _, hash := range hashes {
+		if !strings.HasPrefix(hash, id) {
+			continue
+		}
+		entry, err := dt.apiKeys.Get(hash)
+		if err != nil {
+			continue
+		}
+		var record apiKey
+		if err := json.Unmarshal(entry.Value(), &record); err == nil && record.ID == id {
+			return hash, &record, nil
+		}
+	}
+	return "", nil, nats.ErrKeyNotFound
+}
+
+// apiKeyRequest is the body of POST /admin/keys
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// apiKeyUpdate is the body of PATCH /admin/keys/:id
+type apiKeyUpdate struct {
+	Name     string    `json:"name"`
+	Scopes   *[]string `json:"scopes"`
+	Disabled *bool     `json:"disabled"`
+}
+
+// Handle POST /admin/keys {"name": "...", "scopes": ["read:blocks"]}; the
+// plaintext key is only returned here
+func (dt *SomniaStream) handleCreateAPIKey(c *gin.Context) {
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if err := validateScopes(req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+	hash := hashAPIKey(key)
+
+	record := apiKey{
+		ID:        hash[:16],
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now().Unix(),
+	}
+	data, _ := json.Marshal(record)
+	if _, err := dt.apiKeys.Create(hash, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[AUTH] Created API key %s (%s)", record.ID, record.Name)
+	c.JSON(http.StatusCreated, gin.H{"key": key, "apiKey": record})
+}
+
+// Handle GET /admin/keys
+func (dt *SomniaStream) handleListAPIKeys(c *gin.Context) {
+	hashes, err := dt.apiKeys.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	keys := make([]apiKey, 0, len(hashes))
+	for _, hash := range hashes {
+		entry, err := dt.apiKeys.Get(hash)
+		if err != nil {
+			continue
+		}
+		var record apiKey
+		if err := json.Unmarshal(entry.Value(), &record); err == nil {
+			keys = append(keys, record)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// Handle PATCH /admin/keys/:id {"disabled": true, "scopes": [...]}
+func (dt *SomniaStream) handleUpdateAPIKey(c *gin.Context) {
+	var req apiKeyUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Scopes != nil {
+		if err := validateScopes(*req.Scopes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	hash, record, err := dt.findAPIKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown API key"})
+		return
+	}
+	if req.Name != "" {
+		record.Name = req.Name
+	}
+	if req.Scopes != nil {
+		record.Scopes = *req.Scopes
+	}
+	if req.Disabled != nil {
+		record.Disabled = *req.Disabled
+	}
+
+	data, _ := json.Marshal(record)
+	if _, err := dt.apiKeys.Put(hash, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// Handle DELETE /admin/keys/:id revoking an API key
+func (dt *SomniaStream) handleDeleteAPIKey(c *gin.Context) {
+	hash, record, err := dt.findAPIKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown API key"})
+		return
+	}
+	if err := dt.apiKeys.Delete(hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[AUTH] Revoked API key %s (%s)", record.ID, record.Name)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"somnia-stream/pkg/streams"
+)
+
+// archiveSegment is the span of messages one archive file holds
+const archiveSegment = time.Hour
+
+// messageArchive is the cold store of ARCHIVE_STREAMS. Messages are kept in
+// hourly gzipped NDJSON segments, <stream>/<date>/<hour>.ndjson.gz, in the
+// export file format, either under ARCHIVE_DIR or in ARCHIVE_S3_BUCKET.
+type messageArchive struct {
+	dir      string
+	s3       *s3Client
+	prefix   string            // Namespace directory, empty without SUBJECT_NAMESPACE
+	subjects map[string]string // Archived stream names by subject
+}
+
+// newMessageArchive returns the archive of ARCHIVE_STREAMS, or nil when none
+// are archived. Derived streams must be restored first.
+func (dt *SomniaStream) newMessageArchive() *messageArchive {
+	cfg := dt.config()
+	if len(cfg.ArchiveStreams) == 0 {
+		return nil
+	}
+	archive := &messageArchive{
+		dir:      cfg.ArchiveDir,
+		s3:       newS3Client(cfg, cfg.ArchiveS3Bucket, cfg.ArchiveS3Prefix),
+		subjects: make(map[string]string),
+	}
+	if dt.ns != "" {
+		archive.prefix = string(dt.ns) + "/"
+	}
+	for _, name := range cfg.ArchiveStreams {
+		subject, ok := dt.streams.lookup(name)
+		if !ok {
+			log.Printf("[ARCHIVE] WARNING: Not archiving unknown stream %q", name)
+			continue
+		}
+		archive.subjects[subject] = name
+	}
+	return archive
+}
+
+// applyHotRetention shortens the max age of the JetStream streams holding
+// built-in ARCHIVE_STREAMS to ARCHIVE_HOT_RETENTION, keeping at least a
+// completed hour and two archive passes so nothing leaves unarchived
+func (dt *SomniaStream) applyHotRetention(specs []streams.Spec) {
+	cfg := dt.config()
+	if cfg.ArchiveHotRetention <= 0 {
+		return
+	}
+	retention := cfg.ArchiveHotRetention
+	if floor := archiveSegment + 2*cfg.ArchiveInterval; retention < floor {
+		log.Printf("[ARCHIVE] WARNING: ARCHIVE_HOT_RETENTION raised from %s to %s", retention, floor)
+		retention = floor
+	}
+	archived := make(map[string]bool)
+	for _, name := range cfg.ArchiveStreams {
+		if subject, ok := streams.LookupBuiltin(name); ok {
+			archived[subject] = true
+		}
+	}
+	for i, spec := range specs {
+		for _, subject := range spec.Subjects {
+			if archived[subject] {
+				specs[i].MaxAge = retention
+				log.Printf("[ARCHIVE] Keeping %s in JetStream for %s", spec.Name, retention)
+				break
+			}
+		}
+	}
+}
+
+// segmentKey returns the key of the segment starting at an hour
+func (a *messageArchive) segmentKey(name string, hour time.Time) string {
+	hour = hour.UTC()
+	return fmt.Sprintf("%s%s/%s/%02d.ndjson.gz", a.prefix, name, hour.Format("2006-01-02"), hour.Hour())
+}
+
+// write stores a segment, overwriting an earlier attempt
+func (a *messageArchive) write(ctx context.Context, key string, msgs []historyMessage) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	for _, msg := range msgs {
+		if err := encoder.Encode(newDumpRecord(msg)); err != nil {
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if a.s3 != nil {
+		return a.s3.put(ctx, key, "application/gzip", buf.Bytes())
+	}
+	return writeFileAtomic(filepath.Join(a.dir, filepath.FromSlash(key)), buf.Bytes())
+}
+
+// readSegment returns the messages of a segment, none when it doesn't exist
+func (a *messageArchive) readSegment(ctx context.Context, key string) ([]historyMessage, error) {
+	var data []byte
+	var err error
+	if a.s3 != nil {
+		data, err = a.s3.get(ctx, key)
+		if errors.Is(err, errS3NotFound) {
+			return nil, nil
+		}
+	} else {
+		data, err = os.ReadFile(filepath.Join(a.dir, filepath.FromSlash(key)))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("segment %s: %v", key, err)
+	}
+	var msgs []historyMessage
+	lines := bufio.NewReader(gz)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record dumpRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				return msgs, fmt.Errorf("segment %s: %v", key, err)
+			}
+			msgs = append(msgs, historyMessage{
+				Subject:   record.Subject,
+				Seq:       record.Seq,
+				Published: record.Time,
+				Header:    record.Headers,
+				Data:      record.payload(),
+			})
+		}
+		if errors.Is(err, io.EOF) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, fmt.Errorf("segment %s: %v", key, err)
+		}
+	}
+}
+
+// read returns the archived messages of a subject published between since
+// and until, none when the subject isn't archived
+func (a *messageArchive) read(subject string, since, until time.Time, limit int) ([]historyMessage, error) {
+	name, ok := a.subjects[subject]
+	if !ok {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var msgs []historyMessage
+	for hour := since.Truncate(archiveSegment); hour.Before(until) && len(msgs) < limit; hour = hour.Add(archiveSegment) {
+		segment, err := a.readSegment(ctx, a.segmentKey(name, hour))
+		if err != nil {
+			return msgs, err
+		}
+		for _, msg := range segment {
+			if !msg.Published.Before(since) && msg.Published.Before(until) && len(msgs) < limit {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// Archive the completed hours of every ARCHIVE_STREAMS stream every
+// ARCHIVE_INTERVAL until ctx is done. Progress is kept in the monitor
+// checkpoints as archive.<stream>, so a restart continues where it stopped.
+func (dt *SomniaStream) runArchive(ctx context.Context) {
+	if dt.archive == nil {
+		return
+	}
+	ticker := time.NewTicker(max(dt.config().ArchiveInterval, time.Minute))
+	defer ticker.Stop()
+	for {
+		for subject, name := range dt.archive.subjects {
+			if err := dt.archiveStream(ctx, name, subject); err != nil {
+				log.Printf("[ARCHIVE] ERROR: Archiving %s failed: %v", name, err)
+				dt.publishSystemEvent("archive_failed", severityError, err.Error(), map[string]interface{}{"stream": name})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveStream writes the segments of a stream's completed hours that
+// haven't been archived yet
+func (dt *SomniaStream) archiveStream(ctx context.Context, name, subject string) error {
+	cursorName := "archive." + name
+	hot := dt.hotWindowStart(subject).Truncate(archiveSegment)
+	if hot.IsZero() {
+		return fmt.Errorf("no JetStream stream holds %s", subject)
+	}
+	next := time.Unix(int64(dt.cursors.load(cursorName)), 0)
+	if next.Before(hot) {
+		if next.Unix() > 0 {
+			log.Printf("[ARCHIVE] WARNING: %s messages before %s left JetStream unarchived", name, hot.UTC().Format(time.RFC3339))
+		}
+		next = hot
+	}
+
+	for !next.Add(archiveSegment).After(time.Now()) && ctx.Err() == nil {
+		// A failed read leaves the cursor at the hour, so it's retried
+		msgs, err := dt.readStreamRangeAll(subject, next, next.Add(archiveSegment))
+		if err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			key := dt.archive.segmentKey(name, next)
+			if err := dt.archive.write(ctx, key, msgs); err != nil {
+				return err
+			}
+			log.Printf("[ARCHIVE] Archived %d %s messages to %s", len(msgs), name, path.Base(key))
+		}
+		next = next.Add(archiveSegment)
+		dt.cursors.set(cursorName, uint64(next.Unix()))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Extract the credential from X-API-Key, an Authorization bearer token, or the
+// api_key/access_token query parameters (EventSource cannot send headers)
+func requestCredential(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token := c.Query("access_token"); token != "" {
+		return token
+	}
+	return c.Query("api_key")
+}
+
+// requireAuth authenticates requests with a bearer JWT or an API key when
+// either is configured, and lets everything through otherwise
+func (dt *SomniaStream) requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKeys, jwts := dt.config().APIKeyAuth, dt.jwtEnabled()
+		if !apiKeys && !jwts {
+			c.Next()
+			return
+		}
+
+		credential := requestCredential(c)
+		if credential == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "credentials required"})
+			return
+		}
+
+		if jwts && looksLikeJWT(credential) {
+			claims, err := dt.validateJWT(credential)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
+				return
+			}
+			c.Set(jwtClaimsContextKey, claims)
+			c.Next()
+			return
+		}
+
+		if !apiKeys {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "bearer token required"})
+			return
+		}
+		if status, message := dt.authenticateAPIKey(c, credential); status != http.StatusOK {
+			c.AbortWithStatusJSON(status, gin.H{"error": message})
+			return
+		}
+		if key, ok := requestKey(c); ok {
+			dt.usage.request(key)
+		}
+		c.Next()
+	}
+}
+
+// streamAllowed reports whether the authenticated caller may read a stream.
+// API keys are limited by their read scopes, JWTs by their streams claim when
+// it is present.
+func (dt *SomniaStream) streamAllowed(c *gin.Context, stream string) bool {
+	if key, ok := requestKey(c); ok {
+		subject, _ := dt.streams.lookup(stream)
+		return key.allowsStream(stream, subject)
+	}
+
+	value, ok := c.Get(jwtClaimsContextKey)
+	if !ok {
+		return true
+	}
+	claims := value.(jwt.MapClaims)
+	if _, present := claims[dt.config().JWTStreamsClaim]; !present {
+		return true
+	}
+
+	for _, allowed := range jwtStreams(claims, dt.config().JWTStreamsClaim) {
+		if allowed == "*" || allowed == stream {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// selectorGetEthBalance is Multicall3's getEthBalance(address)
+var selectorGetEthBalance = crypto.Keccak256([]byte("getEthBalance(address)"))[:4]
+
+// balanceTouch lists the watched addresses a block's transactions sent
+// from or to, with the transaction hashes
+type balanceTouch struct {
+	block uint64
+	txs   map[common.Address][]string
+}
+
+// balanceEntry is the last balance read of a watched address
+type balanceEntry struct {
+	balance *big.Int
+	block   uint64
+}
+
+// balanceWatcher publishes native balance changes of the addresses in
+// BALANCE_WATCHLIST. Balances are read after every block with a transaction
+// from or to a watched address, and for every address on the balances
+// monitor's interval so internal transfers are caught too.
+type balanceWatcher struct {
+	mu       sync.Mutex
+	balances map[common.Address]balanceEntry
+	touches  chan balanceTouch
+}
+
+func newBalanceWatcher() *balanceWatcher {
+	return &balanceWatcher{
+		balances: make(map[common.Address]balanceEntry),
+		touches:  make(chan balanceTouch, 64),
+	}
+}
+
+// observeBalances queues a balance read of the watched addresses touched by a
+// block; publishing the block never waits on it
+func (dt *SomniaStream) observeBalances(block *types.Block) {
+	watchlist := dt.config().BalanceWatchlist
+	if len(watchlist) == 0 {
+		return
+	}
+	watched := make(map[common.Address]bool, len(watchlist))
+	for _, address := range watchlist {
+		watched[common.HexToAddress(address)] = true
+	}
+
+	touch := balanceTouch{block: block.NumberU64(), txs: make(map[common.Address][]string)}
+	for _, tx := range block.Transactions() {
+		hash := tx.Hash().Hex()
+		if to := tx.To(); to != nil && watched[*to] {
+			touch.txs[*to] = append(touch.txs[*to], hash)
+		}
+		if from, err := types.Sender(dt.signer, tx); err == nil && watched[from] {
+			touch.txs[from] = append(touch.txs[from], hash)
+		}
+	}
+	if len(touch.txs) == 0 {
+		return
+	}
+	select {
+	case dt.balances.touches <- touch:
+	default:
+		log.Printf("[BALANCES] WARNING: Balance reads falling behind, skipping block %d (the next poll catches up)", touch.block)
+	}
+}
+
+// runBalanceReads reads balances after the blocks queued by observeBalances
+// until ctx is done
+func (dt *SomniaStream) runBalanceReads(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case touch := <-dt.balances.touches:
+			addresses := make([]common.Address, 0, len(touch.txs))
+			for addr := range touch.txs {
+				addresses = append(addresses, addr)
+			}
+			if err := dt.checkBalances(ctx, addresses, touch.block, "block", touch.txs); err != nil {
+				log.Printf("[BALANCES] WARNING: Failed to read balances at block %d: %v", touch.block, err)
+			}
+		}
+	}
+}
+
+// Monitor the balances of every watched address on an interval
+func (dt *SomniaStream) monitorBalances(ctx context.Context) {
+	dt.runMonitor(ctx, "balances", func() error {
+		watchlist := dt.config().BalanceWatchlist
+		if len(watchlist) == 0 {
+			return nil
+		}
+		addresses := make([]common.Address, 0, len(watchlist))
+		for _, address := range watchlist {
+			addresses = append(addresses, common.HexToAddress(address))
+		}
+		head, err := dt.ethClient.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		return dt.checkBalances(ctx, addresses, head, "poll", nil)
+	})
+}
+
+// checkBalances reads balances at a block and publishes an eth.balances event
+// for every address whose balance changed since its last read. The first read
+// of an address only records its balance; reads older than the last one are
+// ignored so a slow block read can't undo a newer poll.
+func (dt *SomniaStream) checkBalances(ctx context.Context, addresses []common.Address, block uint64, trigger string, txs map[common.Address][]string) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	balances, err := dt.readBalances(ctx, addresses, block)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[common.Address]string)
+	for name, address := range dt.config().BalanceWatchlist {
+		names[common.HexToAddress(address)] = name
+	}
+
+	for i, addr := range addresses {
+		balance := balances[i]
+		if balance == nil {
+			continue
+		}
+		dt.balances.mu.Lock()
+		previous, seen := dt.balances.balances[addr]
+		stale := seen && previous.block > block
+		if !stale {
+			dt.balances.balances[addr] = balanceEntry{balance: balance, block: block}
+		}
+		dt.balances.mu.Unlock()
+		if !seen || stale || previous.balance.Cmp(balance) == 0 {
+			continue
+		}
+
+		event := map[string]interface{}{
+			"address":     strings.ToLower(addr.Hex()),
+			"name":        names[addr],
+			"balance":     balance.String(),
+			"previous":    previous.balance.String(),
+			"delta":       new(big.Int).Sub(balance, previous.balance).String(),
+			"blockNumber": block,
+			"trigger":     trigger,
+			"timestamp":   time.Now().Unix(),
+		}
+		if hashes := txs[addr]; len(hashes) > 0 {
+			event["txHashes"] = hashes
+		}
+		log.Printf("[BALANCES] %s (%s) balance changed by %s wei", names[addr], addr.Hex(), event["delta"])
+		data, _ := json.Marshal(event)
+		if err := dt.publish("eth.balances", data); err != nil {
+			log.Printf("[BALANCES] ERROR: Failed to publish balance change of %s: %v", addr.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// readBalances reads native balances at a block through Multicall3's
+// getEthBalance when MULTICALL_ADDRESS is set, and one eth_getBalance per
+// address otherwise. Balances that couldn't be read are nil.
+func (dt *SomniaStream) readBalances(ctx context.Context, addresses []common.Address, block uint64) ([]*big.Int, error) {
+	at := new(big.Int).SetUint64(block)
+	balances := make([]*big.Int, len(addresses))
+
+	if multicall := dt.config().MulticallAddress; common.IsHexAddress(multicall) {
+		target := common.HexToAddress(multicall)
+		calls := make([]multicallCall, len(addresses))
+		for i, addr := range addresses {
+			data := append(append([]byte{}, selectorGetEthBalance...), common.LeftPadBytes(addr.Bytes(), 32)...)
+			calls[i] = multicallCall{Target: target, AllowFailure: true, CallData: data}
+		}
+		results := make([][]byte, len(calls))
+		if err := aggregate3(ctx, dt.ethClient, target, at, calls, results); err == nil {
+			for i, out := range results {
+				if len(out) == 32 {
+					balances[i] = new(big.Int).SetBytes(out)
+				}
+			}
+			return balances, nil
+		}
+	}
+
+	for i, addr := range addresses {
+		balance, err := dt.ethClient.BalanceAt(ctx, addr, at)
+		if err != nil {
+			return nil, err
+		}
+		balances[i] = balance
+	}
+	return balances, nil
+}
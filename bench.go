@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/client"
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// benchGrace is how long before the end messages stop being counted, so
+// those still in flight aren't reported as dropped
+const benchGrace = 2 * time.Second
+
+const benchUsage = `Usage: somnia-stream bench [flags]
+
+Open many synthetic SSE consumers against a running instance and report
+delivery latency percentiles and drop rates.
+
+Latency is measured from the JetStream publish time with --nats, and from the
+first consumer to receive each message otherwise (fan-out latency). Only
+messages published after every consumer connected and more than 2s before the
+end are counted.
+
+Examples:
+  somnia-stream bench --clients=500 --stream=blocks
+  somnia-stream bench --clients=200 --stream=pending --duration=5m --nats
+
+Flags:
+`
+
+// benchMessage is one stream message and when each consumer received it
+type benchMessage struct {
+	published time.Time // JetStream publish time, zero without --nats
+	arrivals  []time.Time
+}
+
+// reference is the time latencies of the message are measured from
+func (m *benchMessage) reference() time.Time {
+	if !m.published.IsZero() {
+		return m.published
+	}
+	first := m.arrivals[0]
+	for _, at := range m.arrivals[1:] {
+		if at.Before(first) {
+			first = at
+		}
+	}
+	return first
+}
+
+// benchRun collects what the consumers observed
+type benchRun struct {
+	mu         sync.Mutex
+	messages   map[uint64]*benchMessage
+	receiving  map[int]bool // Consumers that received at least one message
+	reconnects int
+	dropped    uint64 // Reported by the server in slow consumer notices
+	errors     map[string]int
+}
+
+func (r *benchRun) message(id uint64) *benchMessage {
+	m := r.messages[id]
+	if m == nil {
+		m = &benchMessage{}
+		r.messages[id] = m
+	}
+	return m
+}
+
+func (r *benchRun) arrived(consumer int, id uint64, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.message(id)
+	m.arrivals = append(m.arrivals, at)
+	r.receiving[consumer] = true
+}
+
+func (r *benchRun) published(id uint64, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.message(id).published = at
+}
+
+func (r *benchRun) failed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reconnects++
+	r.errors[err.Error()]++
+}
+
+// benchReport is the result printed at the end, also as JSON with --format=json
+type benchReport struct {
+	Server       string             `json:"server"`
+	Stream       string             `json:"stream"`
+	Clients      int                `json:"clients"`
+	Receiving    int                `json:"receiving"`
+	Duration     string             `json:"duration"`
+	LatencyFrom  string             `json:"latencyFrom"` // publish or first-arrival
+	Messages     int                `json:"messages"`
+	Expected     int                `json:"expected"`
+	Delivered    int                `json:"delivered"`
+	DropRate     float64            `json:"dropRate"`
+	ServerDrops  uint64             `json:"serverDropped"`
+	Reconnects   int                `json:"reconnects"`
+	DeliveriesPS float64            `json:"deliveriesPerSecond"`
+	LatencyMs    map[string]float64 `json:"latencyMs"`
+	Errors       map[string]int     `json:"errors,omitempty"`
+}
+
+// runBench implements the bench subcommand and returns the process exit code
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), benchUsage)
+		fs.PrintDefaults()
+	}
+	server := fs.String("server", envOr("SOMNIA_STREAM_URL", "http://localhost:8080"), "URL of the instance under test (SOMNIA_STREAM_URL)")
+	apiKey := fs.String("api-key", os.Getenv("SOMNIA_API_KEY"), "API key (SOMNIA_API_KEY)")
+	token := fs.String("token", os.Getenv("SOMNIA_TOKEN"), "JWT bearer token (SOMNIA_TOKEN)")
+	clients := fs.Int("clients", 100, "number of concurrent consumers")
+	stream := fs.String("stream", "blocks", "stream to consume")
+	detail := fs.String("detail", "", "block detail level on the blocks stream: header, hashes or full")
+	duration := fs.Duration("duration", time.Minute, "how long to measure after every consumer connected")
+	ramp := fs.Duration("ramp", 5*time.Second, "spread the consumer connections over this long")
+	direct := fs.Bool("nats", false, "measure latency from the JetStream publish time, read from NATS_URL with the NATS_* settings")
+	format := fs.String("format", "text", "report format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	if *clients <= 0 || *duration <= benchGrace {
+		fmt.Fprintf(os.Stderr, "--clients must be positive and --duration longer than %s\n", benchGrace)
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected text or json\n", *format)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *ramp+*duration)
+	defer cancel()
+
+	run := &benchRun{messages: make(map[uint64]*benchMessage), receiving: make(map[int]bool), errors: make(map[string]int)}
+	var wg sync.WaitGroup
+	if *direct {
+		subject, err := benchSubject(*stream, *detail)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+			return 2
+		}
+		nc, err := benchReference(subject, run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+			return 1
+		}
+		defer nc.Close()
+	}
+
+	// One transport for every consumer, without a per-host connection cap
+	hc := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, MaxIdleConnsPerHost: *clients}}
+	fmt.Fprintf(os.Stderr, "Connecting %d consumers to %s/sse/%s over %s...\n", *clients, strings.TrimRight(*server, "/"), *stream, *ramp)
+	started := time.Now()
+	for i := 0; i < *clients; i++ {
+		wg.Add(1)
+		go func(consumer int) {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(*ramp * time.Duration(consumer) / time.Duration(*clients)):
+			}
+			c := client.New(*server, client.WithAPIKey(*apiKey), client.WithToken(*token), client.WithHTTPClient(hc))
+			_ = c.Subscribe(ctx, *stream, client.SubscribeOptions{
+				Detail: *detail,
+				OnNotice: func(n client.Notice) {
+					run.mu.Lock()
+					run.dropped += n.Dropped
+					run.mu.Unlock()
+				},
+				OnReconnect: func(err error, _ time.Duration) { run.failed(err) },
+			}, func(event client.Event) error {
+				if event.ID > 0 {
+					run.arrived(consumer, event.ID, time.Now())
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	window := [2]time.Time{started.Add(*ramp), time.Now().Add(-benchGrace)}
+	report := run.report(window, *direct)
+	report.Server, report.Stream, report.Clients = *server, *stream, *clients
+	report.Duration = window[1].Sub(window[0]).Round(time.Second).String()
+	if *format == "json" {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		report.print()
+	}
+	if report.Delivered == 0 {
+		return 1
+	}
+	return 0
+}
+
+// report summarizes the messages whose reference time falls in the window
+func (r *benchRun) report(window [2]time.Time, fromPublish bool) benchReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := benchReport{
+		Receiving:   len(r.receiving),
+		LatencyFrom: "first-arrival",
+		ServerDrops: r.dropped,
+		Reconnects:  r.reconnects,
+		LatencyMs:   map[string]float64{},
+		Errors:      r.errors,
+	}
+	if fromPublish {
+		report.LatencyFrom = "publish"
+	}
+
+	var latencies []time.Duration
+	for _, m := range r.messages {
+		if fromPublish && m.published.IsZero() {
+			continue // Published before the reference subscription started
+		}
+		ref := m.reference()
+		if ref.Before(window[0]) || ref.After(window[1]) {
+			continue
+		}
+		report.Messages++
+		report.Delivered += len(m.arrivals)
+		for _, at := range m.arrivals {
+			latency := at.Sub(ref)
+			if latency < 0 {
+				latency = 0 // Clock skew between this host and the NATS server
+			}
+			latencies = append(latencies, latency)
+		}
+	}
+	report.Expected = report.Messages * report.Receiving
+	if report.Expected > 0 {
+		report.DropRate = 1 - float64(report.Delivered)/float64(report.Expected)
+	}
+	if seconds := window[1].Sub(window[0]).Seconds(); seconds > 0 {
+		report.DeliveriesPS = float64(report.Delivered) / seconds
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if len(latencies) > 0 {
+		for _, p := range []struct {
+			name  string
+			value float64
+		}{{"p50", 0.50}, {"p90", 0.90}, {"p99", 0.99}, {"max", 1}} {
+			idx := int(p.value * float64(len(latencies)-1))
+			report.LatencyMs[p.name] = float64(latencies[idx].Microseconds()/100) / 10
+		}
+	}
+	return report
+}
+
+func (b benchReport) print() {
+	fmt.Printf("Benchmark of %s/sse/%s with %d consumers over %s\n\n", strings.TrimRight(b.Server, "/"), b.Stream, b.Clients, b.Duration)
+	fmt.Printf("Consumers   %d receiving, %d without messages, %d reconnects\n", b.Receiving, b.Clients-b.Receiving, b.Reconnects)
+	fmt.Printf("Messages    %d published, %d of %d deliveries (%.1f/s)\n", b.Messages, b.Delivered, b.Expected, b.DeliveriesPS)
+	fmt.Printf("Drop rate   %.2f%%, %d dropped by the server's overflow policy\n", b.DropRate*100, b.ServerDrops)
+	if len(b.LatencyMs) > 0 {
+		fmt.Printf("Latency     p50 %.1fms  p90 %.1fms  p99 %.1fms  max %.1fms (from %s)\n", b.LatencyMs["p50"], b.LatencyMs["p90"], b.LatencyMs["p99"], b.LatencyMs["max"], b.LatencyFrom)
+	} else {
+		fmt.Printf("Latency     no messages in the measurement window\n")
+	}
+	if len(b.Errors) > 0 {
+		fmt.Printf("\nErrors\n")
+		for message, count := range b.Errors {
+			fmt.Printf("  %5d  %s\n", count, message)
+		}
+	}
+}
+
+// benchSubject resolves the NATS subject consumers of a stream receive
+func benchSubject(stream, detail string) (string, error) {
+	if detail != "" && stream == "blocks" {
+		subject, ok := monitor.BlockDetailSubjects[detail]
+		if !ok {
+			return "", fmt.Errorf("detail must be one of header, hashes, full")
+		}
+		return subject, nil
+	}
+	if subject, ok := streams.LookupBuiltin(stream); ok {
+		return subject, nil
+	}
+	if streams.NamePattern.MatchString(stream) {
+		return streams.DerivedSubjectPrefix + stream, nil
+	}
+	return "", fmt.Errorf("unknown stream %q", stream)
+}
+
+// benchReference records the JetStream publish time of every new message
+func benchReference(subject string, run *benchRun) (*nats.Conn, error) {
+	_ = godotenv.Load()
+	cfg := config.Load()
+	opts, err := natsOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := nats.Connect(cfg.NATSUrl, append(opts, nats.Name("somnia-stream-bench"))...)
+	if err != nil {
+		return nil, fmt.Errorf("connect to NATS at %s: %v", cfg.NATSUrl, err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	ns, err := cliNamespace(context.Background(), cfg)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	subject = ns.Subject(subject)
+	_, err = js.Subscribe(subject, func(msg *nats.Msg) {
+		if meta, err := msg.Metadata(); err == nil {
+			run.published(meta.Sequence.Stream, meta.Timestamp)
+		}
+	}, nats.OrderedConsumer(), nats.DeliverNew())
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("subscribe to %s: %v", subject, err)
+	}
+	return nc, nil
+}
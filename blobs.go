@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Publish the blob gas usage, blob base fee and blob transactions of an
+// EIP-4844 block on eth.blobs. Blocks without blob gas fields, i.e. of
+// networks that haven't adopted blob transactions, are skipped.
+func (dt *SomniaStream) publishBlobs(block *types.Block) {
+	blobGasUsed, excessBlobGas := block.BlobGasUsed(), block.ExcessBlobGas()
+	if blobGasUsed == nil || excessBlobGas == nil {
+		return
+	}
+
+	blobCount := 0
+	var txs []map[string]interface{}
+	for _, tx := range block.Transactions() {
+		if tx.Type() != types.BlobTxType {
+			continue
+		}
+		hashes := tx.BlobHashes()
+		blobCount += len(hashes)
+		entry := map[string]interface{}{
+			"hash":                tx.Hash().Hex(),
+			"from":                nil,
+			"to":                  tx.To(),
+			"blobCount":           len(hashes),
+			"blobGas":             tx.BlobGas(),
+			"maxFeePerBlobGas":    tx.BlobGasFeeCap().String(),
+			"blobVersionedHashes": hashes,
+		}
+		if from, err := types.Sender(dt.signer, tx); err == nil {
+			entry["from"] = from.Hex()
+		}
+		txs = append(txs, entry)
+	}
+
+	payload := map[string]interface{}{
+		"blockNumber":   block.NumberU64(),
+		"blockHash":     block.Hash().Hex(),
+		"blobGasUsed":   *blobGasUsed,
+		"excessBlobGas": *excessBlobGas,
+		"blobBaseFee":   eip4844.CalcBlobFee(*excessBlobGas).String(),
+		"blobCount":     blobCount,
+		"targetBlobGas": params.BlobTxTargetBlobGasPerBlock,
+		"maxBlobGas":    params.MaxBlobGasPerBlock,
+		"utilization":   float64(*blobGasUsed) / float64(params.MaxBlobGasPerBlock),
+		"transactions":  txs,
+		"timestamp":     time.Now().Unix(),
+	}
+	data, _ := json.Marshal(payload)
+	if err := dt.publish("eth.blobs", data); err != nil {
+		log.Printf("[BLOBS] ERROR: Failed to publish blob data of block %d: %v", block.NumberU64(), err)
+	}
+}
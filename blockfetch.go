@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// wantReceipts reports whether the receipts of a block are needed by the
+// failed transaction or base fee streams
+func (dt *SomniaStream) wantReceipts(block *types.Block) bool {
+	cfg := dt.config()
+	return (cfg.TrackFailedTxs || cfg.TrackBaseFee) && len(block.Transactions()) > 0
+}
+
+// blockByNumber returns a block from the block cache or the RPC endpoint
+func (dt *SomniaStream) blockByNumber(ctx context.Context, number uint64) (*types.Block, error) {
+	if block, ok := dt.blocks.get(number); ok {
+		return block, nil
+	}
+	block, err := dt.ethClient.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, err
+	}
+	dt.blocks.add(number, block)
+	return block, nil
+}
+
+// forgetBlock evicts a block that turned out to be non-canonical, and its
+// receipts, from the caches
+func (dt *SomniaStream) forgetBlock(number uint64) {
+	block, ok := dt.blocks.get(number)
+	if !ok {
+		return
+	}
+	dt.blocks.remove(number)
+	for _, tx := range block.Transactions() {
+		dt.receipts.remove(tx.Hash())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// paceWindow is the number of head observations the block interval is
+// estimated over
+const paceWindow = 32
+
+// headObservation is a head block number and when it was first seen
+type headObservation struct {
+	number uint64
+	seenAt time.Time
+}
+
+// blockPacer estimates the chain's block interval from how fast the head
+// advances in wall-clock time. Block timestamps only have second resolution,
+// so they can't measure sub-second blocks.
+type blockPacer struct {
+	mu    sync.Mutex
+	heads []headObservation
+}
+
+// observe records the current head and returns the estimated block interval,
+// or 0 until the head has advanced twice. A head that stops advancing
+// stretches the estimate, so polling loosens while the chain stalls.
+func (p *blockPacer) observe(number uint64, now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n := len(p.heads); n == 0 || number > p.heads[n-1].number {
+		p.heads = append(p.heads, headObservation{number: number, seenAt: now})
+		if len(p.heads) > paceWindow {
+			p.heads = p.heads[len(p.heads)-paceWindow:]
+		}
+	} else if number < p.heads[n-1].number {
+		p.heads = []headObservation{{number: number, seenAt: now}} // Reorg or endpoint switch
+	}
+	if len(p.heads) < 3 {
+		return 0
+	}
+
+	first, last := p.heads[0], p.heads[len(p.heads)-1]
+	interval := last.seenAt.Sub(first.seenAt) / time.Duration(last.number-first.number)
+	return max(interval, now.Sub(last.seenAt))
+}
+
+// paceBlocks adapts the blocks monitor's interval to the observed block
+// interval: it polls twice per block, between ADAPTIVE_POLL_MIN and the
+// configured BLOCKS_POLL_INTERVAL, so no block waits long for its poll and a
+// slow chain isn't polled faster than configured
+func (dt *SomniaStream) paceBlocks(head uint64) {
+	cfg := dt.config()
+	if !cfg.AdaptivePolling {
+		return
+	}
+	blockTime := dt.pacer.observe(head, time.Now())
+	if blockTime == 0 {
+		return
+	}
+
+	target := max(blockTime/2, cfg.AdaptivePollMin, 10*time.Millisecond)
+	if ceiling := dt.pollInterval("blocks"); target > ceiling {
+		target = ceiling
+	}
+	status, ok := dt.monitors.Status("blocks")
+	if !ok {
+		return
+	}
+	current, err := time.ParseDuration(status.Interval)
+	if err != nil {
+		return
+	}
+	// Ignore small changes so the ticker isn't reset on every poll
+	if diff := target - current; diff > -current/5 && diff < current/5 {
+		return
+	}
+	log.Printf("[BLOCKS] Observed block interval %s, polling every %s", blockTime.Round(time.Millisecond), target)
+	if err := dt.monitors.SetInterval("blocks", target); err != nil {
+		log.Printf("[BLOCKS] WARNING: Failed to adapt poll interval: %v", err)
+	}
+}
+
+// Keep a newHeads subscription alive that ticks the blocks monitor as soon as
+// a block is announced, with polling as the fallback while it is down
+func (dt *SomniaStream) runHeadSubscription(ctx context.Context) {
+	endpoint := dt.pendingSubscriptionEndpoint()
+	if endpoint == "" {
+		return
+	}
+
+	backoff := time.Second
+	for {
+		err := dt.subscribeNewHeads(ctx, endpoint)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[BLOCKS] newHeads subscription unavailable (%v), polling and retrying in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// Subscribe to newHeads and trigger the blocks monitor on every head
+func (dt *SomniaStream) subscribeNewHeads(ctx context.Context, endpoint string) error {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	heads := make(chan json.RawMessage, 64)
+	sub, err := client.EthSubscribe(ctx, heads, "newHeads")
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	log.Printf("[BLOCKS] ✅ Subscribed to newHeads on %s", endpoint)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case <-heads:
+			if dt.config().BlockSubscription {
+				dt.monitors.Trigger("blocks")
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// errCircuitOpen is returned for RPC requests made while the breaker is open
+var errCircuitOpen = errors.New("RPC circuit breaker is open")
+
+// circuitBreaker stops RPC traffic after repeated failures. Once the cooldown
+// has passed a single half-open request probes the endpoint: success closes
+// the circuit, failure opens it for another cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int // Consecutive failed requests
+	openedAt  time.Time
+	threshold int // Failures that open the circuit (0 = disabled)
+	cooldown  time.Duration
+	onChange  func(from, to string, failures int)
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{state: circuitClosed, threshold: threshold, cooldown: cooldown}
+}
+
+// reconfigure applies new settings on configuration reload
+func (b *circuitBreaker) reconfigure(threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	b.threshold, b.cooldown = threshold, cooldown
+	b.mu.Unlock()
+}
+
+// allow reports whether a request may be sent, moving an open circuit to
+// half-open once the cooldown has passed
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	if b.threshold <= 0 || b.state == circuitClosed {
+		b.mu.Unlock()
+		return true
+	}
+	if b.state == circuitHalfOpen || time.Since(b.openedAt) < b.cooldown {
+		b.mu.Unlock()
+		return false // Only one probe at a time
+	}
+	b.transition(circuitHalfOpen)
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	b.failures = 0
+	if b.state != circuitClosed {
+		b.transition(circuitClosed)
+		return
+	}
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	b.failures++
+	if b.threshold > 0 && (b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.threshold)) {
+		b.openedAt = time.Now()
+		b.transition(circuitOpen)
+		return
+	}
+	b.mu.Unlock()
+}
+
+// transition changes state and notifies outside the lock; must be called with mu held
+func (b *circuitBreaker) transition(to string) {
+	from, failures, onChange := b.state, b.failures, b.onChange
+	b.state = to
+	b.mu.Unlock()
+
+	if to == circuitOpen {
+		log.Printf("[RPC] Circuit breaker %s -> %s after %d consecutive failures", from, to, failures)
+	} else {
+		log.Printf("[RPC] Circuit breaker %s -> %s", from, to)
+	}
+	if onChange != nil {
+		onChange(from, to, failures)
+	}
+}
+
+// status returns the current state and whether monitors should pause
+func (b *circuitBreaker) status() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.state != circuitClosed
+}
+
+// dueForProbe reports whether an open circuit has cooled down
+func (b *circuitBreaker) dueForProbe() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == circuitOpen && time.Since(b.openedAt) >= b.cooldown
+}
+
+// rpcBreakerChanged publishes circuit breaker transitions on somnia.system
+func (dt *SomniaStream) rpcBreakerChanged(from, to string, failures int) {
+	fields := map[string]interface{}{"from": from, "to": to, "failures": failures}
+	switch to {
+	case circuitOpen:
+		dt.publishSystemEvent("rpc_circuit_open", severityError, "RPC circuit breaker opened, monitors paused", fields)
+	case circuitHalfOpen:
+		dt.publishSystemEvent("rpc_circuit_half_open", severityWarning, "probing RPC endpoint", fields)
+	case circuitClosed:
+		dt.publishSystemEvent("rpc_circuit_closed", severityInfo, "RPC circuit breaker closed, monitors resumed", fields)
+	}
+}
+
+// probeRPC sends the half-open probe once an open circuit has cooled down,
+// since paused monitors generate no traffic of their own
+func (dt *SomniaStream) probeRPC(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !dt.rpcRetry.breaker.dueForProbe() {
+				continue
+			}
+			probeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			var blockNumber string
+			if err := dt.rpcClient.CallContext(probeCtx, &blockNumber, "eth_blockNumber"); err != nil {
+				log.Printf("[RPC] Half-open probe failed: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// bridgeMaxBlockRange bounds the blocks scanned per tick so a watcher that
+// fell behind catches up in steps instead of one huge eth_getLogs
+const bridgeMaxBlockRange = 500
+
+// bridgeEvent describes how a bridge protocol's event maps onto a deposit
+// (assets leaving this network) or a withdrawal (assets arriving on it).
+// Field names refer to the event inputs; an empty token means the bridge
+// contract is the token itself, as with OFTs and warp routes.
+type bridgeEvent struct {
+	protocol  string
+	direction string // "deposit" or "withdrawal"
+	signature string // Inputs as "[indexed ]type name"
+	amount    string
+	chain     string // Destination of deposits, source of withdrawals
+	sender    string
+	recipient string
+	token     string
+}
+
+// bridgeEvents are the deposit and withdrawal events of supported protocols
+var bridgeEvents = []bridgeEvent{
+	{
+		protocol: "layerzero", direction: "deposit",
+		signature: "OFTSent(indexed bytes32 guid, uint32 dstEid, indexed address fromAddress, uint256 amountSentLD, uint256 amountReceivedLD)",
+		amount:    "amountSentLD", chain: "dstEid", sender: "fromAddress",
+	},
+	{
+		protocol: "layerzero", direction: "withdrawal",
+		signature: "OFTReceived(indexed bytes32 guid, uint32 srcEid, indexed address toAddress, uint256 amountReceivedLD)",
+		amount:    "amountReceivedLD", chain: "srcEid", recipient: "toAddress",
+	},
+	{
+		protocol: "hyperlane", direction: "deposit",
+		signature: "SentTransferRemote(indexed uint32 destination, indexed bytes32 recipient, uint256 amount)",
+		amount:    "amount", chain: "destination", recipient: "recipient",
+	},
+	{
+		protocol: "hyperlane", direction: "withdrawal",
+		signature: "ReceivedTransferRemote(indexed uint32 origin, indexed bytes32 recipient, uint256 amount)",
+		amount:    "amount", chain: "origin", recipient: "recipient",
+	},
+	{
+		protocol: "axelar", direction: "deposit",
+		signature: "TokenSent(indexed address sender, string destinationChain, string destinationAddress, string symbol, uint256 amount)",
+		amount:    "amount", chain: "destinationChain", sender: "sender", recipient: "destinationAddress", token: "symbol",
+	},
+	{
+		protocol: "across", direction: "deposit",
+		signature: "V3FundsDeposited(address inputToken, address outputToken, uint256 inputAmount, uint256 outputAmount, indexed uint256 destinationChainId, indexed uint32 depositId, uint32 quoteTimestamp, uint32 fillDeadline, uint32 exclusivityDeadline, indexed address depositor, address recipient, address exclusiveRelayer, bytes message)",
+		amount:    "inputAmount", chain: "destinationChainId", sender: "depositor", recipient: "recipient", token: "inputToken",
+	},
+	{
+		protocol: "across", direction: "withdrawal",
+		signature: "FilledV3Relay(address inputToken, address outputToken, uint256 inputAmount, uint256 outputAmount, uint256 repaymentChainId, indexed uint256 originChainId, indexed uint32 depositId, uint32 fillDeadline, uint32 exclusivityDeadline, address exclusiveRelayer, indexed address relayer, address depositor, address recipient, bytes message, (address updatedRecipient, bytes updatedMessage, uint256 updatedOutputAmount, uint8 fillType) relayExecutionInfo)",
+		amount:    "outputAmount", chain: "originChainId", sender: "depositor", recipient: "recipient", token: "outputToken",
+	},
+}
+
+// bridgeABI holds the events of bridgeEvents, bridgeEventsByID maps their
+// topics back to the descriptions
+var bridgeABI, bridgeEventsByID = func() (*abi.ABI, map[common.Hash]bridgeEvent) {
+	parsed := &abi.ABI{Events: make(map[string]abi.Event)}
+	byID := make(map[common.Hash]bridgeEvent)
+	for _, def := range bridgeEvents {
+		event, err := parseEventSignature(def.signature)
+		if err != nil {
+			panic(err)
+		}
+		parsed.Events[event.Name] = event
+		byID[event.ID] = def
+	}
+	return parsed, byID
+}()
+
+// parseEventSignature builds an event from a signature such as
+// Transfer(indexed address from, indexed address to, uint256 value)
+func parseEventSignature(signature string) (abi.Event, error) {
+	open := strings.IndexByte(signature, '(')
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return abi.Event{}, fmt.Errorf("invalid event signature %q", signature)
+	}
+	name := signature[:open]
+	params, err := splitTopLevel(signature[open+1 : len(signature)-1])
+	if err != nil {
+		return abi.Event{}, fmt.Errorf("invalid event signature %q: %v", signature, err)
+	}
+
+	var inputs abi.Arguments
+	for _, param := range params {
+		indexed := strings.HasPrefix(param, "indexed ")
+		param = strings.TrimSpace(strings.TrimPrefix(param, "indexed "))
+
+		// The name follows the type; tuple types contain spaces themselves
+		typeText, argName := param, ""
+		if i := strings.LastIndexAny(param, " )"); i >= 0 && param[i] == ' ' {
+			typeText, argName = strings.TrimSpace(param[:i]), param[i+1:]
+		}
+		if typeText == "" {
+			return abi.Event{}, fmt.Errorf("invalid event signature %q: empty parameter", signature)
+		}
+		typ, err := parseABIType(typeText)
+		if err != nil {
+			return abi.Event{}, fmt.Errorf("invalid event signature %q: %v", signature, err)
+		}
+		inputs = append(inputs, abi.Argument{Name: argName, Type: typ, Indexed: indexed})
+	}
+	return abi.NewEvent(name, name, false, inputs), nil
+}
+
+// parseABIType parses a type, including tuples written as
+// (type name, ...) with an optional array suffix
+func parseABIType(text string) (abi.Type, error) {
+	if !strings.HasPrefix(text, "(") {
+		return abi.NewType(text, "", nil)
+	}
+	end := strings.LastIndexByte(text, ')')
+	params, err := splitTopLevel(text[1:end])
+	if err != nil {
+		return abi.Type{}, err
+	}
+	var components []abi.ArgumentMarshaling
+	for i, param := range params {
+		fields := strings.Fields(param)
+		component := abi.ArgumentMarshaling{Name: fmt.Sprintf("arg%d", i), Type: fields[0]}
+		if len(fields) > 1 {
+			component.Name = fields[len(fields)-1]
+		}
+		if strings.HasPrefix(fields[0], "(") {
+			return abi.Type{}, fmt.Errorf("nested tuples are not supported")
+		}
+		components = append(components, component)
+	}
+	return abi.NewType("tuple"+text[end+1:], "", components)
+}
+
+// splitTopLevel splits a parameter list on commas outside parentheses
+func splitTopLevel(list string) ([]string, error) {
+	var params []string
+	depth, start := 0, 0
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+	if last := strings.TrimSpace(list[start:]); last != "" {
+		params = append(params, last)
+	}
+	return params, nil
+}
+
+// Monitor registered bridge contracts for deposits and withdrawals
+func (dt *SomniaStream) monitorBridges(ctx context.Context) {
+	dt.runCheckpointed(ctx, "bridge", dt.publishBridgeEvents)
+}
+
+// Publish the deposits and withdrawals of the bridge contracts in
+// BRIDGE_CONTRACTS since the last scanned block
+func (dt *SomniaStream) publishBridgeEvents(lastBlock *uint64) error {
+	bridges := dt.config().BridgeContracts
+	if len(bridges) == 0 {
+		return nil
+	}
+	names := make(map[common.Address]string, len(bridges))
+	addresses := make([]common.Address, 0, len(bridges))
+	for name, address := range bridges {
+		addr := common.HexToAddress(address)
+		names[addr] = name
+		addresses = append(addresses, addr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	head, err := dt.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	if *lastBlock == 0 && head > 0 {
+		*lastBlock = head - 1 // Start with the current block, not the chain's history
+	}
+	if head <= *lastBlock {
+		return nil
+	}
+	from := *lastBlock + 1
+	to := from + bridgeMaxBlockRange - 1
+	if to > head {
+		to = head
+	}
+
+	topics := make([]common.Hash, 0, len(bridgeEventsByID))
+	for id := range bridgeEventsByID {
+		topics = append(topics, id)
+	}
+	logs, err := dt.primary.GetLogs(ctx, map[string]interface{}{
+		"address": addresses,
+		"topics":  [][]common.Hash{topics},
+	}, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range logs {
+		if removed, _ := entry["removed"].(bool); removed {
+			continue
+		}
+		addr, _ := addressOf(entry["address"])
+		event, args, err := decodeEvent(bridgeABI, entry)
+		if err != nil {
+			log.Printf("[BRIDGE] WARNING: Failed to decode log of %s in tx %v: %v", addr.Hex(), entry["transactionHash"], err)
+			continue
+		}
+		def := bridgeEventsByID[event.ID]
+		payload := dt.bridgePayload(def, event, args, entry)
+		payload["bridge"] = names[addr]
+		payload["contract"] = strings.ToLower(addr.Hex())
+
+		log.Printf("[BRIDGE] %s %s of %v on %s (%s)", def.protocol, def.direction, payload["amount"], names[addr], entry["transactionHash"])
+		data, _ := json.Marshal(payload)
+		if err := dt.publish("eth.bridge."+def.direction, data); err != nil {
+			log.Printf("[BRIDGE] ERROR: Failed to publish %s of tx %v: %v", def.direction, entry["transactionHash"], err)
+		}
+	}
+	*lastBlock = to
+	return nil
+}
+
+// bridgePayload builds the eth.bridge.* payload of a decoded event
+func (dt *SomniaStream) bridgePayload(def bridgeEvent, event *abi.Event, args map[string]interface{}, entry map[string]interface{}) map[string]interface{} {
+	payload := map[string]interface{}{
+		"type":        def.direction,
+		"protocol":    def.protocol,
+		"event":       event.Name,
+		"amount":      args[def.amount],
+		"args":        args,
+		"blockNumber": entry["blockNumber"],
+		"txHash":      entry["transactionHash"],
+		"logIndex":    entry["logIndex"],
+		"timestamp":   time.Now().Unix(),
+	}
+	chainField := "destinationChain"
+	if def.direction == "withdrawal" {
+		chainField = "sourceChain"
+	}
+	payload[chainField] = args[def.chain]
+	if def.sender != "" {
+		payload["sender"] = args[def.sender]
+	}
+	if def.recipient != "" {
+		payload["recipient"] = bridgeRecipient(args[def.recipient])
+	}
+
+	// Tokens are addresses, except Axelar's gateway which sends by symbol
+	token := entry["address"]
+	if def.token != "" {
+		token = args[def.token]
+	}
+	if addr, ok := addressOf(token); ok {
+		payload["token"] = strings.ToLower(addr.Hex())
+		if dt.tokens != nil {
+			if meta := dt.tokens.lookup(addr); meta != nil && meta.known() {
+				payload["symbol"] = meta.Symbol
+				if meta.Decimals != nil {
+					payload["decimals"] = *meta.Decimals
+				}
+			}
+		}
+	} else if symbol, ok := token.(string); ok {
+		payload["symbol"] = symbol
+	}
+	return payload
+}
+
+// bridgeRecipient renders a bytes32 recipient holding a left-padded EVM
+// address as that address; other recipients are kept as they are
+func bridgeRecipient(value interface{}) interface{} {
+	hex, ok := value.(string)
+	if !ok || len(hex) != 66 || !strings.HasPrefix(hex, "0x"+strings.Repeat("0", 24)) {
+		return value
+	}
+	return "0x" + hex[26:]
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/time/rate"
+)
+
+// callRequest is the body of POST /call, the call object of eth_call plus
+// the block to call at
+type callRequest struct {
+	From  string `json:"from,omitempty"`
+	To    string `json:"to"`
+	Data  string `json:"data,omitempty"`
+	Value string `json:"value,omitempty"` // Hex quantity in wei
+	Gas   string `json:"gas,omitempty"`   // Hex quantity
+	Block string `json:"block,omitempty"` // Block number (decimal or hex) or tag, default latest
+}
+
+// callResponse is the result of POST /call
+type callResponse struct {
+	Result      string `json:"result"`
+	BlockNumber uint64 `json:"blockNumber,omitempty"` // Block the call ran at, unless called at a tag other than latest
+	Cached      bool   `json:"cached"`
+}
+
+// callArgs validates a request and returns the eth_call call object
+func (r *callRequest) callArgs() (map[string]interface{}, error) {
+	if !common.IsHexAddress(r.To) {
+		return nil, fmt.Errorf("invalid to address %q", r.To)
+	}
+	args := map[string]interface{}{"to": common.HexToAddress(r.To)}
+	if r.From != "" {
+		if !common.IsHexAddress(r.From) {
+			return nil, fmt.Errorf("invalid from address %q", r.From)
+		}
+		args["from"] = common.HexToAddress(r.From)
+	}
+	if r.Data != "" {
+		data, err := hexutil.Decode(r.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %v", err)
+		}
+		args["data"] = hexutil.Bytes(data)
+	}
+	if r.Value != "" {
+		value, err := hexutil.DecodeBig(r.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		args["value"] = (*hexutil.Big)(value)
+	}
+	if r.Gas != "" {
+		gas, err := hexutil.DecodeUint64(r.Gas)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gas: %v", err)
+		}
+		args["gas"] = hexutil.Uint64(gas)
+	}
+	return args, nil
+}
+
+// cacheKey identifies a call independently of how its fields were written
+func (r *callRequest) cacheKey(block uint64) string {
+	normalize := func(hex string) string { return strings.ToLower(strings.TrimPrefix(hex, "0x")) }
+	return fmt.Sprintf("%d|%s|%s|%s|%s|%s", block, normalize(r.From), normalize(r.To), normalize(r.Data), normalize(r.Value), normalize(r.Gas))
+}
+
+// parseCallBlock returns the block number of a block parameter, or the tag
+// to pass through when it isn't a number. latest is returned as a tag too.
+func parseCallBlock(block string) (uint64, string, error) {
+	switch block {
+	case "", "latest":
+		return 0, "latest", nil
+	case "pending", "safe", "finalized", "earliest":
+		return 0, block, nil
+	}
+	if strings.HasPrefix(block, "0x") {
+		number, err := hexutil.DecodeUint64(block)
+		return number, "", err
+	}
+	number, err := strconv.ParseUint(block, 10, 64)
+	return number, "", err
+}
+
+// callCacheEntry is a cached eth_call result
+type callCacheEntry struct {
+	result hexutil.Bytes
+	block  uint64
+}
+
+// callCache caches eth_call results by block number and call; results of a
+// numbered block never change, so entries only leave when the cache is full
+type callCache struct {
+	mu      sync.Mutex
+	entries map[string]callCacheEntry
+}
+
+func newCallCache() *callCache {
+	return &callCache{entries: make(map[string]callCacheEntry)}
+}
+
+func (c *callCache) get(key string) (hexutil.Bytes, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	return entry.result, ok
+}
+
+// store caches a result, evicting entries of older blocks (or any entry)
+// when the cache holds maxEntries
+func (c *callCache) store(key string, block uint64, result hexutil.Bytes, maxEntries int) {
+	if maxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxEntries {
+		for cached, entry := range c.entries {
+			if entry.block < block {
+				delete(c.entries, cached)
+			}
+		}
+	}
+	for cached := range c.entries {
+		if len(c.entries) < maxEntries {
+			break
+		}
+		delete(c.entries, cached)
+	}
+	c.entries[key] = callCacheEntry{result: result, block: block}
+}
+
+// callerID identifies the caller of a request for per-caller limits: the API
+// key, the JWT subject, or the client IP of unauthenticated requests
+func callerID(c *gin.Context) string {
+	if key, ok := requestKey(c); ok {
+		return "key:" + key.ID
+	}
+	if value, ok := c.Get(jwtClaimsContextKey); ok {
+		if subject, _ := value.(jwt.MapClaims)["sub"].(string); subject != "" {
+			return "jwt:" + subject
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// rateLimitCalls rejects calls and simulations above CALL_RATE_LIMIT per
+// caller with 429 and a Retry-After header
+func (dt *SomniaStream) rateLimitCalls() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := dt.config()
+		if cfg.CallRateLimit <= 0 {
+			c.Next()
+			return
+		}
+
+		limiter := dt.callLimits.get(callerID(c), rate.Limit(cfg.CallRateLimit), max(cfg.CallRateBurst, 1))
+		reservation := limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "call rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Handle POST /call proxying a read-only eth_call. Calls at latest run at the
+// current head so their results can be cached by block number like calls at
+// an explicit block.
+func (dt *SomniaStream) handleCall(c *gin.Context) {
+	var req callRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	args, err := req.callArgs()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	number, tag, err := parseCallBlock(req.Block)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid block %q", req.Block)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	cacheSize := dt.config().CallCacheSize
+	if tag == "latest" && cacheSize > 0 {
+		head, err := dt.ethClient.BlockNumber(ctx)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "node unavailable: " + err.Error()})
+			return
+		}
+		number, tag = head, ""
+	}
+	cacheable := tag == "" && cacheSize > 0
+	key := req.cacheKey(number)
+	if cacheable {
+		if result, ok := dt.callCache.get(key); ok {
+			c.JSON(http.StatusOK, callResponse{Result: result.String(), BlockNumber: number, Cached: true})
+			return
+		}
+	}
+
+	blockArg := tag
+	if tag == "" {
+		blockArg = hexutil.EncodeUint64(number)
+	}
+	var result hexutil.Bytes
+	if err := dt.rpcClient.CallContext(ctx, &result, "eth_call", args, blockArg); err != nil {
+		// Reverts and invalid calls come back as JSON-RPC errors, anything
+		// else means the node couldn't be reached
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "node unavailable: " + err.Error()})
+			return
+		}
+		response := gin.H{"error": rpcErr.Error(), "code": rpcErr.ErrorCode()}
+		var dataErr rpc.DataError
+		if errors.As(err, &dataErr) && dataErr.ErrorData() != nil {
+			response["data"] = dataErr.ErrorData()
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if cacheable {
+		dt.callCache.store(key, number, result, cacheSize)
+	}
+	c.JSON(http.StatusOK, callResponse{Result: result.String(), BlockNumber: number, Cached: false})
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// chainMonitors are the monitors that can run against an additional network
+var chainMonitors = map[string]func(*chainMonitor, *SomniaStream) error{
+	"blocks":   (*chainMonitor).publishLatestBlock,
+	"gasPrice": (*chainMonitor).publishGasPrice,
+	"network":  (*chainMonitor).publishNetworkStats,
+}
+
+// chainMonitor watches an additional network with its own RPC connection and
+// publishes to subjects prefixed with the network name
+type chainMonitor struct {
+	name      string
+	endpoint  string
+	monitors  []string
+	rpcClient *rpc.Client
+	ethClient *ethclient.Client
+	rpcRetry  *rpcRetryTransport
+
+	mu        sync.Mutex
+	chainID   *big.Int // Resolved on the first block, so the node may start later
+	signer    types.Signer
+	lastBlock uint64
+}
+
+// newChainMonitors connects to every network configured in CHAINS
+func newChainMonitors(cfg *config.Config, telemetry *rpcTelemetry) ([]*chainMonitor, error) {
+	seen := map[string]bool{cfg.ChainName: true}
+	var chains []*chainMonitor
+	for _, chain := range cfg.Chains {
+		if err := streams.ValidateChainName(chain.Name); err != nil {
+			return nil, err
+		}
+		if seen[chain.Name] {
+			return nil, fmt.Errorf("chain %q is configured twice", chain.Name)
+		}
+		seen[chain.Name] = true
+		for _, name := range chain.Monitors {
+			if _, ok := chainMonitors[name]; !ok {
+				return nil, fmt.Errorf("unknown monitor %q for chain %s, expected blocks, gasPrice or network", name, chain.Name)
+			}
+		}
+
+		transport := newRPCRetryTransport(rpcRetryPolicyFromConfig(cfg), newCircuitBreaker(cfg.RPCBreakerThreshold, cfg.RPCBreakerCooldown), telemetry.forEndpoint(chain.RPCEndpoint))
+		rpcClient, err := dialRPC(chain.RPCEndpoint, transport)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to RPC of chain %s: %v", chain.Name, err)
+		}
+		chains = append(chains, &chainMonitor{
+			name:      chain.Name,
+			endpoint:  endpointHost(chain.RPCEndpoint),
+			monitors:  chain.Monitors,
+			rpcClient: rpcClient,
+			ethClient: ethclient.NewClient(rpcClient),
+			rpcRetry:  transport,
+		})
+		log.Printf("[CHAINS] Monitoring %s on %s (%s)", chain.Name, endpointHost(chain.RPCEndpoint), strings.Join(chain.Monitors, ", "))
+	}
+	return chains, nil
+}
+
+// reloadChains keeps the networks, endpoints and streams of the running
+// configuration and takes the reloadable poll intervals and disabled monitors
+// from the new one
+func reloadChains(previous, next []config.Chain) []config.Chain {
+	updated := make(map[string]config.Chain, len(next))
+	for _, chain := range next {
+		updated[chain.Name] = chain
+	}
+
+	reloaded := make([]config.Chain, len(previous))
+	for i, chain := range previous {
+		reloaded[i] = chain
+		update, ok := updated[chain.Name]
+		if !ok {
+			log.Printf("⚠️ Chain %s was removed, restart required to apply it", chain.Name)
+			continue
+		}
+		delete(updated, chain.Name)
+		if update.RPCEndpoint != chain.RPCEndpoint || !reflect.DeepEqual(update.Monitors, chain.Monitors) ||
+			update.Retention != chain.Retention || update.MaxMsgs != chain.MaxMsgs || update.OnDisk != chain.OnDisk {
+			log.Printf("⚠️ Chain %s changed, restart required to apply it", chain.Name)
+		}
+		reloaded[i].PollIntervals = update.PollIntervals
+		reloaded[i].DisabledMonitors = update.DisabledMonitors
+	}
+	for name := range updated {
+		log.Printf("⚠️ Chain %s was added, restart required to apply it", name)
+	}
+	return reloaded
+}
+
+// chain returns the additional network with the given name
+func (dt *SomniaStream) chain(name string) (*chainMonitor, bool) {
+	for _, chain := range dt.chains {
+		if chain.name == name {
+			return chain, true
+		}
+	}
+	return nil, false
+}
+
+// chainMonitorName names the monitor of an additional network in the
+// registry, e.g. testnet.blocks
+func chainMonitorName(chain, monitor string) string {
+	return chain + "." + monitor
+}
+
+// splitMonitorName returns the network and base name of a registered monitor;
+// the network is empty for monitors of RPC_ENDPOINT
+func splitMonitorName(name string) (string, string) {
+	if chain, monitor, ok := strings.Cut(name, "."); ok {
+		return chain, monitor
+	}
+	return "", name
+}
+
+// registerChainMonitors adds the monitors of every additional network to the registry
+func (dt *SomniaStream) registerChainMonitors() {
+	for _, chain := range dt.chains {
+		for _, monitor := range chain.monitors {
+			name, tick := chainMonitorName(chain.name, monitor), chainMonitors[monitor]
+			chain := chain
+			dt.monitors.Register(name, func(ctx context.Context) {
+				dt.runMonitor(ctx, name, func() error { return tick(chain, dt) })
+			})
+		}
+	}
+}
+
+// resolveChainID fetches the chain ID of the network once
+func (cm *chainMonitor) resolveChainID(ctx context.Context) (*big.Int, types.Signer, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.chainID == nil {
+		chainID, err := cm.ethClient.ChainID(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch chain ID: %v", err)
+		}
+		cm.chainID, cm.signer = chainID, types.LatestSignerForChainID(chainID)
+	}
+	return cm.chainID, cm.signer, nil
+}
+
+// publishLatestBlock publishes new blocks at every configured detail level
+func (cm *chainMonitor) publishLatestBlock(dt *SomniaStream) error {
+	ctx := context.Background()
+	chainID, signer, err := cm.resolveChainID(ctx)
+	if err != nil {
+		return err
+	}
+	block, err := cm.ethClient.BlockByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch latest block: %v", err)
+	}
+
+	cm.mu.Lock()
+	isNew := block.NumberU64() > cm.lastBlock
+	if isNew {
+		cm.lastBlock = block.NumberU64()
+	}
+	cm.mu.Unlock()
+	if !isNew {
+		return nil
+	}
+
+	header, transactions := monitor.BlockPayload(block, signer)
+	dt.selectors.annotate(transactions)
+	publisher := monitor.PublisherFunc(func(subject string, data []byte) error {
+		return dt.publishFor(chainID, subject, data)
+	})
+	if err := monitor.PublishBlockDetailLevels(publisher, dt.config().BlockDetailLevels, streams.ChainSubject(cm.name, ""), header, transactions); err != nil {
+		return err
+	}
+	log.Printf("[CHAINS] %s: published block #%d", cm.name, block.NumberU64())
+	return nil
+}
+
+// publishGasPrice publishes the suggested gas price
+func (cm *chainMonitor) publishGasPrice(dt *SomniaStream) error {
+	ctx := context.Background()
+	chainID, _, err := cm.resolveChainID(ctx)
+	if err != nil {
+		return err
+	}
+	gasPrice, err := cm.ethClient.SuggestGasPrice(ctx)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(monitor.GasPricePayload(gasPrice))
+	return dt.publishFor(chainID, streams.ChainSubject(cm.name, "eth.gasPrice"), data)
+}
+
+// publishNetworkStats publishes the network statistics
+func (cm *chainMonitor) publishNetworkStats(dt *SomniaStream) error {
+	chainID, _, err := cm.resolveChainID(context.Background())
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(monitor.NetworkStats(cm.rpcClient))
+	return dt.publishFor(chainID, streams.ChainSubject(cm.name, "eth.network"), data)
+}
+
+// chainStatus is one network in GET /chains
+type chainStatus struct {
+	Name      string   `json:"name"`
+	Endpoint  string   `json:"endpoint"` // Host only, endpoints often carry API keys
+	Primary   bool     `json:"primary,omitempty"`
+	Streams   []string `json:"streams"`
+	Head      uint64   `json:"head,omitempty"`
+	Circuit   string   `json:"circuit"`
+	Monitors  []string `json:"monitors"`
+	Retention string   `json:"retention,omitempty"` // Max age of the chain's JetStream stream
+	SSEPrefix string   `json:"ssePrefix"`
+}
+
+// Handle GET /chains listing the monitored networks
+func (dt *SomniaStream) handleListChains(c *gin.Context) {
+	primaryCircuit, _ := dt.rpcRetry.breaker.status()
+	primary := chainStatus{
+		Name:      dt.config().ChainName,
+		Endpoint:  dt.telemetry.endpoint,
+		Primary:   true,
+		Streams:   streamNames(),
+		Circuit:   primaryCircuit,
+		Monitors:  []string{},
+		SSEPrefix: "/sse/" + dt.config().ChainName + "/",
+	}
+	for _, status := range dt.monitors.List() {
+		if chain, _ := splitMonitorName(status.Name); chain == "" {
+			primary.Monitors = append(primary.Monitors, status.Name)
+		}
+	}
+
+	chains := []chainStatus{primary}
+	for _, chain := range dt.chains {
+		circuit, _ := chain.rpcRetry.breaker.status()
+		chain.mu.Lock()
+		head := chain.lastBlock
+		chain.mu.Unlock()
+		retention := 24 * time.Hour
+		if cfg, ok := dt.config().Chain(chain.name); ok && cfg.Retention > 0 {
+			retention = cfg.Retention
+		}
+		chains = append(chains, chainStatus{
+			Name:      chain.name,
+			Endpoint:  chain.endpoint,
+			Streams:   streams.ChainBuiltin,
+			Head:      head,
+			Circuit:   circuit,
+			Monitors:  chain.monitors,
+			Retention: retention.String(),
+			SSEPrefix: "/sse/" + chain.name + "/",
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"chains": chains})
+}
+
+// Handle GET /sse/:network/:name. gin routes the network segment under the
+// wildcard name of /sse/:stream.
+func (dt *SomniaStream) handleChainSSEStream(c *gin.Context) {
+	network, stream := c.Param("stream"), c.Param("name")
+	if network == dt.config().ChainName {
+		dt.serveSSE(c, "", stream)
+		return
+	}
+	if _, ok := dt.chain(network); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown network %q", network)})
+		return
+	}
+	dt.serveSSE(c, network, stream)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultChaosRPCHang is how long an injected RPC timeout hangs when the
+// attempt has no earlier deadline
+const defaultChaosRPCHang = 10 * time.Second
+
+// chaosFaults is the fault configuration set through PUT /admin/chaos
+type chaosFaults struct {
+	RPCTimeoutRate   float64  `json:"rpcTimeoutRate"`             // Share of RPC attempts that hang and time out (0-1)
+	RPCTimeoutAfter  string   `json:"rpcTimeoutAfter,omitempty"`  // How long an injected timeout hangs, default 10s or the attempt timeout
+	MalformedRate    float64  `json:"malformedRate"`              // Share of published messages that are truncated (0-1)
+	MalformedStreams []string `json:"malformedStreams,omitempty"` // Streams whose messages may be truncated, all when empty
+	BlockDelay       string   `json:"blockDelay,omitempty"`       // Hold every new block this long before publishing it
+	Duration         string   `json:"duration,omitempty"`         // Clear the faults after this long, never when empty
+}
+
+// chaosState is the parsed, active form of chaosFaults
+type chaosState struct {
+	faults            chaosFaults
+	rpcTimeoutAfter   time.Duration
+	malformedSubjects map[string]bool
+	blockDelay        time.Duration
+	expires           time.Time
+}
+
+// chaosInjector injects RPC timeouts, NATS disconnects, malformed payloads
+// and delayed blocks on demand. It only exists when CHAOS is enabled; the
+// hooks are no-ops on a nil injector.
+type chaosInjector struct {
+	state atomic.Pointer[chaosState]
+
+	mu    sync.Mutex
+	conns []net.Conn // NATS connections opened through the dialer
+
+	rpcTimeouts     atomic.Uint64
+	malformed       atomic.Uint64
+	delayedBlocks   atomic.Uint64
+	natsDisconnects atomic.Uint64
+}
+
+func newChaosInjector() *chaosInjector {
+	return &chaosInjector{}
+}
+
+// active returns the current faults, or nil when none are set or they expired
+func (ch *chaosInjector) active() *chaosState {
+	if ch == nil {
+		return nil
+	}
+	state := ch.state.Load()
+	if state == nil || (!state.expires.IsZero() && time.Now().After(state.expires)) {
+		return nil
+	}
+	return state
+}
+
+// Dial opens NATS connections and remembers them so they can be dropped
+func (ch *chaosInjector) Dial(network, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{Timeout: 10 * time.Second}).Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	ch.mu.Lock()
+	ch.conns = append(ch.conns, conn)
+	ch.mu.Unlock()
+	return conn, nil
+}
+
+// disconnectNATS closes the NATS connections under the client, which then
+// reconnects like after a network failure
+func (ch *chaosInjector) disconnectNATS() int {
+	ch.mu.Lock()
+	conns := ch.conns
+	ch.conns = nil
+	ch.mu.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	ch.natsDisconnects.Add(1)
+	return len(conns)
+}
+
+// chaosTransport fails a share of RPC attempts with a timeout
+type chaosTransport struct {
+	chaos *chaosInjector
+	next  http.RoundTripper
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	state := t.chaos.active()
+	if state == nil || rand.Float64() >= state.faults.RPCTimeoutRate {
+		return t.next.RoundTrip(req)
+	}
+
+	t.chaos.rpcTimeouts.Add(1)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	timer := time.NewTimer(state.rpcTimeoutAfter)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("chaos: injected RPC timeout after %s", state.rpcTimeoutAfter)
+	}
+}
+
+// corrupt truncates a share of published payloads mid-document
+func (ch *chaosInjector) corrupt(subject string, data []byte) []byte {
+	state := ch.active()
+	if state == nil || len(data) < 2 || rand.Float64() >= state.faults.MalformedRate {
+		return data
+	}
+	if len(state.malformedSubjects) > 0 && !state.malformedSubjects[subject] {
+		return data
+	}
+	ch.malformed.Add(1)
+	return append([]byte(nil), data[:1+rand.Intn(len(data)-1)]...)
+}
+
+// delayBlock holds a new block back before it is published
+func (ch *chaosInjector) delayBlock(ctx context.Context) {
+	state := ch.active()
+	if state == nil || state.blockDelay <= 0 {
+		return
+	}
+	ch.delayedBlocks.Add(1)
+	select {
+	case <-ctx.Done():
+	case <-time.After(state.blockDelay):
+	}
+}
+
+// parseChaosFaults validates a fault configuration
+func (dt *SomniaStream) parseChaosFaults(faults chaosFaults) (*chaosState, error) {
+	if faults.RPCTimeoutRate < 0 || faults.RPCTimeoutRate > 1 || faults.MalformedRate < 0 || faults.MalformedRate > 1 {
+		return nil, errors.New("rates must be between 0 and 1")
+	}
+	state := &chaosState{faults: faults, rpcTimeoutAfter: defaultChaosRPCHang}
+	if attemptTimeout := dt.config().RPCAttemptTimeout; attemptTimeout > 0 {
+		state.rpcTimeoutAfter = attemptTimeout
+	}
+
+	var duration time.Duration
+	for name, d := range map[string]struct {
+		value  string
+		target *time.Duration
+	}{
+		"rpcTimeoutAfter": {faults.RPCTimeoutAfter, &state.rpcTimeoutAfter},
+		"blockDelay":      {faults.BlockDelay, &state.blockDelay},
+		"duration":        {faults.Duration, &duration},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", name, d.value)
+		}
+		*d.target = parsed
+	}
+	if duration > 0 {
+		state.expires = time.Now().Add(duration)
+	}
+
+	if len(faults.MalformedStreams) > 0 {
+		state.malformedSubjects = make(map[string]bool, len(faults.MalformedStreams))
+		for _, name := range faults.MalformedStreams {
+			subject, ok := dt.streams.lookup(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown stream %q", name)
+			}
+			state.malformedSubjects[subject] = true
+		}
+	}
+	return state, nil
+}
+
+// chaosStatus is the response of the chaos endpoints
+type chaosStatus struct {
+	Active    bool         `json:"active"`
+	Faults    *chaosFaults `json:"faults,omitempty"`
+	ExpiresAt int64        `json:"expiresAt,omitempty"`
+	Injected  struct {
+		RPCTimeouts     uint64 `json:"rpcTimeouts"`
+		Malformed       uint64 `json:"malformed"`
+		DelayedBlocks   uint64 `json:"delayedBlocks"`
+		NATSDisconnects uint64 `json:"natsDisconnects"`
+	} `json:"injected"`
+}
+
+func (dt *SomniaStream) chaosStatus() chaosStatus {
+	var status chaosStatus
+	if state := dt.chaos.active(); state != nil {
+		status.Active = true
+		status.Faults = &state.faults
+		if !state.expires.IsZero() {
+			status.ExpiresAt = state.expires.Unix()
+		}
+	}
+	status.Injected.RPCTimeouts = dt.chaos.rpcTimeouts.Load()
+	status.Injected.Malformed = dt.chaos.malformed.Load()
+	status.Injected.DelayedBlocks = dt.chaos.delayedBlocks.Load()
+	status.Injected.NATSDisconnects = dt.chaos.natsDisconnects.Load()
+	return status
+}
+
+// Handle GET /admin/chaos
+func (dt *SomniaStream) handleGetChaos(c *gin.Context) {
+	c.JSON(http.StatusOK, dt.chaosStatus())
+}
+
+// Handle PUT /admin/chaos {"rpcTimeoutRate": 0.2, "blockDelay": "10s", "duration": "5m"}
+func (dt *SomniaStream) handleSetChaos(c *gin.Context) {
+	var faults chaosFaults
+	if err := c.ShouldBindJSON(&faults); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	state, err := dt.parseChaosFaults(faults)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dt.chaos.state.Store(state)
+	log.Printf("[CHAOS] Injecting faults: %+v", faults)
+	dt.publishSystemEvent("chaos_enabled", severityWarning, "fault injection enabled", map[string]interface{}{"faults": faults})
+	c.JSON(http.StatusOK, dt.chaosStatus())
+}
+
+// Handle DELETE /admin/chaos
+func (dt *SomniaStream) handleClearChaos(c *gin.Context) {
+	dt.chaos.state.Store(nil)
+	log.Printf("[CHAOS] Faults cleared")
+	dt.publishSystemEvent("chaos_cleared", severityInfo, "fault injection cleared", nil)
+	c.JSON(http.StatusOK, dt.chaosStatus())
+}
+
+// Handle POST /admin/chaos/nats-disconnect
+func (dt *SomniaStream) handleChaosNATSDisconnect(c *gin.Context) {
+	closed := dt.chaos.disconnectNATS()
+	log.Printf("[CHAOS] Dropped %d NATS connection(s)", closed)
+	c.JSON(http.StatusOK, gin.H{"closed": closed})
+}
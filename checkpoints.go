@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// monitorCheckpointsBucket is the key-value bucket of monitor cursors
+const monitorCheckpointsBucket = "MONITOR_CHECKPOINTS"
+
+// checkpointStore keeps the last block every block-driven monitor processed,
+// so a restart resumes where it stopped instead of at the head. Cursors are
+// updated in memory on every tick and written to the MONITOR_CHECKPOINTS
+// bucket every CHECKPOINT_INTERVAL and on shutdown.
+type checkpointStore struct {
+	kv nats.KeyValue // Bound in setupKeyValueStores
+
+	mu      sync.Mutex
+	cursors map[string]uint64
+	dirty   map[string]bool
+}
+
+func newCheckpointStore() *checkpointStore {
+	return &checkpointStore{cursors: make(map[string]uint64), dirty: make(map[string]bool)}
+}
+
+// bind loads the stored cursors from the key-value bucket
+func (c *checkpointStore) bind(kv nats.KeyValue) error {
+	c.kv = kv
+	keys, err := kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		entry, err := kv.Get(key)
+		if err != nil {
+			continue
+		}
+		if block, err := strconv.ParseUint(string(entry.Value()), 10, 64); err == nil {
+			c.cursors[key] = block
+		}
+	}
+	log.Printf("[CHECKPOINT] Loaded %d monitor checkpoints", len(c.cursors))
+	return nil
+}
+
+// load returns the last block a monitor processed before the restart, or 0
+// to start at the head
+func (c *checkpointStore) load(name string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cursors[name]
+}
+
+// set records the last block a monitor processed
+func (c *checkpointStore) set(name string, block uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if block == 0 || c.cursors[name] == block {
+		return
+	}
+	c.cursors[name] = block
+	c.dirty[name] = true
+}
+
+// flush writes the changed cursors to the bucket
+func (c *checkpointStore) flush() {
+	if c.kv == nil {
+		return
+	}
+	c.mu.Lock()
+	changed := make(map[string]uint64, len(c.dirty))
+	for name := range c.dirty {
+		changed[name] = c.cursors[name]
+	}
+	c.dirty = make(map[string]bool)
+	c.mu.Unlock()
+
+	for name, block := range changed {
+		if _, err := c.kv.Put(name, []byte(strconv.FormatUint(block, 10))); err != nil {
+			log.Printf("[CHECKPOINT] WARNING: Failed to save checkpoint of %s: %v", name, err)
+			c.mu.Lock()
+			c.dirty[name] = true
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Flush the monitor checkpoints every CHECKPOINT_INTERVAL until ctx is done
+func (dt *SomniaStream) runCheckpoints(ctx context.Context) {
+	ticker := time.NewTicker(max(dt.config().CheckpointInterval, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dt.cursors.flush()
+		}
+	}
+}
+
+// runCheckpointed runs a monitor whose progress is a block cursor, resuming
+// from its checkpoint when CHECKPOINTS is on and recording the cursor after
+// every tick. A checkpoint ahead of the chain, e.g. of a restarted devnet, is
+// discarded.
+func (dt *SomniaStream) runCheckpointed(ctx context.Context, name string, tick func(lastBlock *uint64) error) {
+	var lastBlock uint64
+	if dt.config().Checkpoints {
+		lastBlock = dt.cursors.load(name)
+	}
+	restored := lastBlock > 0
+	dt.runMonitor(ctx, name, func() error {
+		if restored {
+			headCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			head, err := dt.ethClient.BlockNumber(headCtx)
+			cancel()
+			if err != nil {
+				return err
+			}
+			restored = false
+			if lastBlock > head {
+				log.Printf("[CHECKPOINT] WARNING: Checkpoint of %s monitor (block %d) is ahead of the chain (block %d), starting at the head", name, lastBlock, head)
+				lastBlock = 0
+			} else {
+				log.Printf("[CHECKPOINT] Resuming %s monitor after block %d", name, lastBlock)
+			}
+		}
+		err := tick(&lastBlock)
+		dt.cursors.set(name, lastBlock)
+		return err
+	})
+}
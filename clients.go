@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientConn is a single streaming (SSE/WS) connection
+type clientConn struct {
+	id          string
+	transport   string
+	stream      string
+	streams     []string // Streams the connection counts against, one entry per subscription
+	subject     string
+	filters     map[string]string
+	remoteAddr  string
+	userAgent   string
+	clientCert  string
+	connectedAt time.Time
+	delivered   atomic.Uint64
+	dropped     atomic.Uint64
+	gaps        atomic.Uint64 // Unrecoverable sequence gaps
+	cancel      context.CancelFunc
+
+	// Usage metering for API key clients
+	key       *apiKey
+	meter     *usageMeter
+	meteredAt time.Time
+}
+
+// clientInfo is the JSON view of a connection returned by GET /admin/clients
+type clientInfo struct {
+	ID          string            `json:"id"`
+	Transport   string            `json:"transport"`
+	Stream      string            `json:"stream"`
+	Subject     string            `json:"subject"`
+	Filters     map[string]string `json:"filters,omitempty"`
+	KeyID       string            `json:"keyId,omitempty"`
+	RemoteAddr  string            `json:"remoteAddr"`
+	UserAgent   string            `json:"userAgent,omitempty"`
+	ClientCert  string            `json:"clientCert,omitempty"`
+	ConnectedAt int64             `json:"connectedAt"`
+	Connected   string            `json:"connected"`
+	Delivered   uint64            `json:"delivered"`
+	Dropped     uint64            `json:"dropped"`
+	Gaps        uint64            `json:"gaps"`
+}
+
+func (cc *clientConn) info() clientInfo {
+	var keyID string
+	if cc.key != nil {
+		keyID = cc.key.ID
+	}
+	return clientInfo{
+		ID:          cc.id,
+		Transport:   cc.transport,
+		Stream:      cc.stream,
+		Subject:     cc.subject,
+		Filters:     cc.filters,
+		KeyID:       keyID,
+		RemoteAddr:  cc.remoteAddr,
+		UserAgent:   cc.userAgent,
+		ClientCert:  cc.clientCert,
+		ConnectedAt: cc.connectedAt.Unix(),
+		Connected:   time.Since(cc.connectedAt).Round(time.Second).String(),
+		Delivered:   cc.delivered.Load(),
+		Dropped:     cc.dropped.Load(),
+		Gaps:        cc.gaps.Load(),
+	}
+}
+
+// recordDelivery counts a message written to the client
+func (cc *clientConn) recordDelivery(bytes int) {
+	cc.delivered.Add(1)
+	if cc.key != nil {
+		cc.meter.delivered(cc.key, bytes)
+	}
+}
+
+// clientRegistry tracks the active streaming connections
+type clientRegistry struct {
+	mu        sync.Mutex
+	nextID    uint64
+	clients   map[string]*clientConn
+	perStream map[string]int
+	perIP     map[string]int
+	usage     *usageMeter
+	slow      map[string]uint64 // Slow-consumer events by overflow policy
+}
+
+func newClientRegistry(usage *usageMeter) *clientRegistry {
+	return &clientRegistry{
+		clients:   make(map[string]*clientConn),
+		perStream: make(map[string]int),
+		perIP:     make(map[string]int),
+		usage:     usage,
+		slow:      make(map[string]uint64),
+	}
+}
+
+// connectionLimits caps concurrent streaming connections; zero means unlimited
+type connectionLimits struct {
+	total     int
+	perStream int
+	perIP     int
+}
+
+// connectionRetryAfter is suggested to clients rejected by a connection limit
+const connectionRetryAfter = 5 * time.Second
+
+// errConnectionLimit is returned by connect when a connection limit is reached
+type errConnectionLimit struct {
+	scope string
+	limit int
+}
+
+func (e *errConnectionLimit) Error() string {
+	return fmt.Sprintf("too many connections (%s limit of %d reached)", e.scope, e.limit)
+}
+
+// connectionLimits returns the configured connection limits
+func (dt *SomniaStream) connectionLimits() connectionLimits {
+	cfg := dt.config()
+	return connectionLimits{
+		total:     cfg.MaxConnections,
+		perStream: cfg.MaxConnectionsPerStream,
+		perIP:     cfg.MaxConnectionsPerIP,
+	}
+}
+
+// recordSlowConsumer counts a client falling behind under an overflow policy
+func (r *clientRegistry) recordSlowConsumer(policy string) {
+	r.mu.Lock()
+	r.slow[policy]++
+	r.mu.Unlock()
+}
+
+// slowConsumers returns the slow-consumer event counts since startup
+func (r *clientRegistry) slowConsumers() map[string]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]uint64, len(r.slow))
+	for policy, n := range r.slow {
+		counts[policy] = n
+	}
+	return counts
+}
+
+// connect registers a streaming connection and returns it with a context that
+// is cancelled when the client disconnects or is kicked through the admin API.
+// It fails with *errConnectionLimit when the connection would exceed a limit.
+func (r *clientRegistry) connect(c *gin.Context, transport, stream, subject string, limits connectionLimits) (*clientConn, context.Context, error) {
+	return r.connectStreams(c, transport, stream, subject, []string{stream}, limits)
+}
+
+// connectStreams registers a connection named stream that counts against the
+// per-stream limit of each of counted, e.g. the streams of a merged feed
+func (r *clientRegistry) connectStreams(c *gin.Context, transport, stream, subject string, counted []string, limits connectionLimits) (*clientConn, context.Context, error) {
+	filters := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		if len(values) > 0 {
+			filters[key] = values[0]
+		}
+	}
+	remoteAddr := c.ClientIP()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if limits.total > 0 && len(r.clients) >= limits.total {
+		return nil, nil, &errConnectionLimit{scope: "global", limit: limits.total}
+	}
+	for _, name := range counted {
+		if limits.perStream > 0 && r.perStream[name] >= limits.perStream {
+			return nil, nil, &errConnectionLimit{scope: "per-stream", limit: limits.perStream}
+		}
+	}
+	if limits.perIP > 0 && r.perIP[remoteAddr] >= limits.perIP {
+		return nil, nil, &errConnectionLimit{scope: "per-IP", limit: limits.perIP}
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	r.nextID++
+	cc := &clientConn{
+		id:          fmt.Sprintf("c%d", r.nextID),
+		transport:   transport,
+		stream:      stream,
+		subject:     subject,
+		filters:     filters,
+		remoteAddr:  remoteAddr,
+		userAgent:   c.Request.UserAgent(),
+		clientCert:  clientCertSubject(c.Request),
+		connectedAt: time.Now(),
+		cancel:      cancel,
+		meter:       r.usage,
+	}
+	if key, ok := requestKey(c); ok {
+		cc.key = key
+		cc.meteredAt = cc.connectedAt
+	}
+	r.clients[cc.id] = cc
+	for _, name := range counted {
+		cc.streams = append(cc.streams, name)
+		r.perStream[name]++
+	}
+	r.perIP[remoteAddr]++
+
+	return cc, ctx, nil
+}
+
+// join counts an open connection against the per-stream limit of one more
+// stream, e.g. for a WebSocket subscription, failing with *errConnectionLimit
+// when the stream is at its limit
+func (r *clientRegistry) join(cc *clientConn, stream string, limits connectionLimits) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if limits.perStream > 0 && r.perStream[stream] >= limits.perStream {
+		return &errConnectionLimit{scope: "per-stream", limit: limits.perStream}
+	}
+	cc.streams = append(cc.streams, stream)
+	r.perStream[stream]++
+	return nil
+}
+
+// leave stops counting a connection against a stream it joined
+func (r *clientRegistry) leave(cc *clientConn, stream string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, name := range cc.streams {
+		if name == stream {
+			cc.streams = append(cc.streams[:i], cc.streams[i+1:]...)
+			decrement(r.perStream, stream)
+			return
+		}
+	}
+}
+
+func (r *clientRegistry) disconnect(cc *clientConn) {
+	r.mu.Lock()
+	delete(r.clients, cc.id)
+	for _, name := range cc.streams {
+		decrement(r.perStream, name)
+	}
+	decrement(r.perIP, cc.remoteAddr)
+	if cc.key != nil {
+		r.usage.connected(cc.key, time.Since(cc.meteredAt))
+	}
+	r.mu.Unlock()
+	cc.cancel()
+}
+
+// decrement lowers a connection count, removing it at zero
+func decrement(counts map[string]int, key string) {
+	if counts[key] <= 1 {
+		delete(counts, key)
+		return
+	}
+	counts[key]--
+}
+
+// chargeConnectTime meters the connect time of open API key connections since the last charge
+func (r *clientRegistry) chargeConnectTime() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, cc := range r.clients {
+		if cc.key == nil {
+			continue
+		}
+		r.usage.connected(cc.key, now.Sub(cc.meteredAt))
+		cc.meteredAt = now
+	}
+}
+
+// kick closes a connection by ID
+func (r *clientRegistry) kick(id string) bool {
+	r.mu.Lock()
+	cc, ok := r.clients[id]
+	r.mu.Unlock()
+	if ok {
+		cc.cancel()
+	}
+	return ok
+}
+
+// list returns the active connections, oldest first
+func (r *clientRegistry) list() []clientInfo {
+	r.mu.Lock()
+	clients := make([]clientInfo, 0, len(r.clients))
+	for _, cc := range r.clients {
+		clients = append(clients, cc.info())
+	}
+	r.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ConnectedAt < clients[j].ConnectedAt })
+	return clients
+}
+
+// Handle GET /admin/clients
+func (dt *SomniaStream) handleListClients(c *gin.Context) {
+	clients := dt.clients.list()
+	c.JSON(http.StatusOK, gin.H{"count": len(clients), "clients": clients, "slowConsumers": dt.clients.slowConsumers()})
+}
+
+// Handle DELETE /admin/clients/:id disconnecting a streaming client
+func (dt *SomniaStream) handleKickClient(c *gin.Context) {
+	id := c.Param("id")
+	if !dt.clients.kick(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown client"})
+		return
+	}
+	dt.publishSystemEvent("client_dropped", severityWarning, "streaming client "+id+" dropped: kicked", map[string]interface{}{
+		"client": id,
+		"reason": "kicked",
+	})
+	c.Status(http.StatusNoContent)
+}
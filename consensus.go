@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// consensusMaxBlockRange bounds the headers fetched per tick
+const consensusMaxBlockRange = 500
+
+// consensusBatchSize is the number of headers requested per batch call
+const consensusBatchSize = 100
+
+// consensusHeader is the part of a block header consensus stats use
+type consensusHeader struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Hash      common.Hash    `json:"hash"`
+	Miner     common.Address `json:"miner"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+}
+
+// Monitor block proposers, validator participation and missed slots
+func (dt *SomniaStream) monitorConsensus(ctx context.Context) {
+	dt.runCheckpointed(ctx, "consensus", func(lastBlock *uint64) error {
+		return dt.publishConsensusStats(ctx, lastBlock)
+	})
+}
+
+// Publish the proposer of every block since the last tick on eth.consensus,
+// with per-proposer counts, the participation of the validators in
+// CONSENSUS_VALIDATORS and the slots missed according to CONSENSUS_SLOT_TIME
+func (dt *SomniaStream) publishConsensusStats(ctx context.Context, lastBlock *uint64) error {
+	cfg := dt.config()
+	if !cfg.ConsensusStats {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	head, err := dt.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	if *lastBlock == 0 && head > 0 {
+		*lastBlock = head - 1 // Start with the current block, not the chain's history
+	}
+	if head <= *lastBlock {
+		return nil
+	}
+	from := *lastBlock + 1
+	to := head
+	if to-from >= consensusMaxBlockRange {
+		to = from + consensusMaxBlockRange - 1
+	}
+
+	headers, err := dt.fetchConsensusHeaders(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[common.Address]string, len(cfg.ConsensusValidators))
+	for name, address := range cfg.ConsensusValidators {
+		names[common.HexToAddress(address)] = name
+	}
+	counts := make(map[common.Address]int)
+	blocks := make([]map[string]interface{}, len(headers))
+	missed := uint64(0)
+	var maxGap uint64
+	for i, header := range headers {
+		counts[header.Miner]++
+		blocks[i] = map[string]interface{}{
+			"number":    uint64(header.Number),
+			"hash":      header.Hash.Hex(),
+			"proposer":  strings.ToLower(header.Miner.Hex()),
+			"timestamp": uint64(header.Timestamp),
+		}
+		if name, ok := names[header.Miner]; ok {
+			blocks[i]["validator"] = name
+		}
+		if i > 0 && header.Timestamp > headers[i-1].Timestamp {
+			gap := uint64(header.Timestamp - headers[i-1].Timestamp)
+			maxGap = max(maxGap, gap)
+			// Timestamps have second resolution, so only slots of a second
+			// or more can be counted
+			if slot := uint64(cfg.ConsensusSlotTime / time.Second); slot > 0 && gap > slot {
+				missed += gap/slot - 1
+			}
+		}
+	}
+
+	proposers := make([]map[string]interface{}, 0, len(counts))
+	for miner, count := range counts {
+		proposer := map[string]interface{}{
+			"address": strings.ToLower(miner.Hex()),
+			"blocks":  count,
+			"share":   float64(count) / float64(len(headers)),
+		}
+		if name, ok := names[miner]; ok {
+			proposer["validator"] = name
+		}
+		proposers = append(proposers, proposer)
+	}
+	sort.Slice(proposers, func(i, j int) bool { return proposers[i]["blocks"].(int) > proposers[j]["blocks"].(int) })
+
+	payload := map[string]interface{}{
+		"fromBlock":   from,
+		"toBlock":     to,
+		"blockCount":  len(headers),
+		"blocks":      blocks,
+		"proposers":   proposers,
+		"maxBlockGap": maxGap,
+		"timestamp":   time.Now().Unix(),
+	}
+	if len(headers) > 1 {
+		span := headers[len(headers)-1].Timestamp - headers[0].Timestamp
+		payload["avgBlockTime"] = float64(span) / float64(len(headers)-1)
+	}
+	if cfg.ConsensusSlotTime >= time.Second {
+		payload["missedSlots"] = missed
+	}
+	if len(names) > 0 {
+		var absent []string
+		for addr, name := range names {
+			if counts[addr] == 0 {
+				absent = append(absent, name)
+			}
+		}
+		sort.Strings(absent)
+		payload["validators"] = len(names)
+		payload["participation"] = float64(len(names)-len(absent)) / float64(len(names))
+		payload["absent"] = absent
+	}
+
+	data, _ := json.Marshal(payload)
+	if err := dt.publish("eth.consensus", data); err != nil {
+		log.Printf("[CONSENSUS] ERROR: Failed to publish consensus stats of blocks %d-%d: %v", from, to, err)
+		return err
+	}
+	*lastBlock = to
+	return nil
+}
+
+// fetchConsensusHeaders fetches the headers of a block range with batched
+// eth_getBlockByNumber calls
+func (dt *SomniaStream) fetchConsensusHeaders(ctx context.Context, from, to uint64) ([]consensusHeader, error) {
+	headers := make([]consensusHeader, 0, to-from+1)
+	for start := from; start <= to; start += consensusBatchSize {
+		end := start + consensusBatchSize - 1
+		if end > to {
+			end = to
+		}
+		batch := make([]rpc.BatchElem, 0, end-start+1)
+		results := make([]*consensusHeader, end-start+1)
+		for n := start; n <= end; n++ {
+			results[n-start] = new(consensusHeader)
+			batch = append(batch, rpc.BatchElem{
+				Method: "eth_getBlockByNumber",
+				Args:   []interface{}{hexutil.EncodeUint64(n), false},
+				Result: results[n-start],
+			})
+		}
+		if err := dt.rpcClient.BatchCallContext(ctx, batch); err != nil {
+			return nil, err
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return nil, fmt.Errorf("fetching block %d: %w", start+uint64(i), elem.Error)
+			}
+			headers = append(headers, *results[i])
+		}
+	}
+	return headers, nil
+}
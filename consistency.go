@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"somnia-stream/pkg/streams"
+)
+
+// Outcomes of a consistency check
+const (
+	consistencyMatch       = "match"
+	consistencyMismatch    = "mismatch"
+	consistencyUnavailable = "unavailable" // The verifier failed or doesn't have the block yet
+)
+
+// consistencyChecker verifies blocks from the active RPC endpoint against a
+// second provider before they are published
+type consistencyChecker struct {
+	endpoint string
+	client   *ethclient.Client
+	checks   *prometheus.CounterVec
+
+	mu          sync.Mutex
+	lastAlerted uint64 // Block number of the last mismatch alert, so withheld blocks alert once
+}
+
+// newConsistencyChecker connects to the verifier endpoint; consistency checks
+// are disabled when endpoint is empty
+func newConsistencyChecker(endpoint string, registry *prometheus.Registry) (*consistencyChecker, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	client, err := dialPeerRPC(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "somnia_consistency_checks_total",
+		Help: "Block hash checks against the verifier RPC endpoint by result.",
+	}, []string{"result"})
+	registry.MustRegister(checks)
+
+	return &consistencyChecker{
+		endpoint: endpointHost(endpoint),
+		client:   ethclient.NewClient(client),
+		checks:   checks,
+	}, nil
+}
+
+// alertOnce reports whether a mismatch at number hasn't been alerted yet
+func (c *consistencyChecker) alertOnce(number uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastAlerted == number {
+		return false
+	}
+	c.lastAlerted = number
+	return true
+}
+
+// verifyBlock compares a block with the verifier's block at the same height
+// and flags mismatches on eth.alerts.consistency. It reports whether the
+// block may be published: mismatched blocks are withheld in strict mode, and
+// blocks the verifier can't confirm are always published.
+func (dt *SomniaStream) verifyBlock(block *types.Block) bool {
+	checker := dt.verifier
+	if checker == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	header, err := checker.client.HeaderByNumber(ctx, block.Number())
+	cancel()
+	if err != nil {
+		checker.checks.WithLabelValues(consistencyUnavailable).Inc()
+		if errors.Is(err, ethereum.NotFound) {
+			log.Printf("[CONSISTENCY] Verifier has no block #%d yet, publishing unverified", block.NumberU64())
+		} else {
+			log.Printf("[CONSISTENCY] WARNING: Verifier unavailable for block #%d, publishing unverified: %v", block.NumberU64(), err)
+		}
+		return true
+	}
+
+	if header.Hash() == block.Hash() {
+		checker.checks.WithLabelValues(consistencyMatch).Inc()
+		return true
+	}
+	checker.checks.WithLabelValues(consistencyMismatch).Inc()
+
+	strict := dt.config().ConsistencyStrict
+	action := "published"
+	if strict {
+		action = "withheld"
+	}
+	log.Printf("[CONSISTENCY] ⚠️ Block #%d hash mismatch: %s has %s, %s has %s (%s)",
+		block.NumberU64(), dt.telemetry.endpoint, block.Hash().Hex(), checker.endpoint, header.Hash().Hex(), action)
+
+	if checker.alertOnce(block.NumberU64()) {
+		alert := map[string]interface{}{
+			"type":               "block_hash_mismatch",
+			"number":             block.Number().String(),
+			"hash":               block.Hash().Hex(),
+			"parentHash":         block.ParentHash().Hex(),
+			"endpoint":           dt.telemetry.endpoint,
+			"verifierHash":       header.Hash().Hex(),
+			"verifierParentHash": header.ParentHash.Hex(),
+			"verifierEndpoint":   checker.endpoint,
+			"action":             action,
+			"timestamp":          time.Now().Unix(),
+		}
+		data, _ := json.Marshal(alert)
+		if err := dt.publish(streams.ConsistencySubject, data); err != nil {
+			log.Printf("[CONSISTENCY] ERROR: Failed to publish consistency alert: %v", err)
+		}
+	}
+	return !strict
+}
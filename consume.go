@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+)
+
+// pullConsumerIdle is how long a pull consumer may go without a fetch before
+// its subscription is released. The consumer itself is kept by the server for
+// DELIVERY_CONSUMER_TTL, so the next fetch rebinds it.
+const pullConsumerIdle = 5 * time.Minute
+
+// pullConsumer is a bound pull consumer of /consume and the messages it
+// fetched that are waiting for an ack
+type pullConsumer struct {
+	sub     *nats.Subscription
+	pending *ackSession
+	usedAt  time.Time
+}
+
+// pullConsumers are the bound pull consumers by durable name
+type pullConsumers struct {
+	mu        sync.Mutex
+	consumers map[string]*pullConsumer
+}
+
+func newPullConsumers() *pullConsumers {
+	return &pullConsumers{consumers: make(map[string]*pullConsumer)}
+}
+
+// bind returns the pull consumer of durable, subscribing on first use
+func (p *pullConsumers) bind(durable string, subscribe func() (*nats.Subscription, error)) (*pullConsumer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pc, ok := p.consumers[durable]; ok {
+		pc.usedAt = time.Now()
+		return pc, nil
+	}
+	sub, err := subscribe()
+	if err != nil {
+		return nil, err
+	}
+	pc := &pullConsumer{
+		sub:     sub,
+		pending: &ackSession{durable: durable, pending: make(map[uint64]*nats.Msg)},
+		usedAt:  time.Now(),
+	}
+	p.consumers[durable] = pc
+	return pc, nil
+}
+
+func (p *pullConsumers) get(durable string) (*pullConsumer, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc, ok := p.consumers[durable]
+	return pc, ok
+}
+
+// unbind releases the subscription of a pull consumer. Its unacknowledged
+// messages are redelivered after DELIVERY_ACK_WAIT.
+func (p *pullConsumers) unbind(durable string) {
+	p.mu.Lock()
+	pc, ok := p.consumers[durable]
+	delete(p.consumers, durable)
+	p.mu.Unlock()
+	if ok {
+		pc.sub.Unsubscribe()
+	}
+}
+
+// cleanup releases the pull consumers idle for pullConsumerIdle until ctx is done
+func (p *pullConsumers) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var idle []string
+			p.mu.Lock()
+			for durable, pc := range p.consumers {
+				if time.Since(pc.usedAt) > pullConsumerIdle {
+					idle = append(idle, durable)
+				}
+			}
+			p.mu.Unlock()
+			for _, durable := range idle {
+				p.unbind(durable)
+			}
+		}
+	}
+}
+
+// consumeRequest is the body of POST /consume/{stream}; every field is optional
+type consumeRequest struct {
+	Consumer  string `json:"consumer,omitempty"`  // Consumer name, "default" when empty
+	Batch     int    `json:"batch,omitempty"`     // Messages to return, 100 by default and at most CONSUME_MAX_BATCH
+	Wait      string `json:"wait,omitempty"`      // How long to wait for messages, e.g. "5s"; at most CONSUME_MAX_WAIT
+	StartSeq  uint64 `json:"startSeq,omitempty"`  // First stream sequence of a new consumer, every stored message when 0
+	Fields    string `json:"fields,omitempty"`    // Comma separated (dotted) fields to keep of every message
+	Transform string `json:"transform,omitempty"` // JMESPath-style expression applied to every message; messages it maps to null are acknowledged and left out
+}
+
+// consumedMessage is a message fetched from a pull consumer
+type consumedMessage struct {
+	ID        uint64          `json:"id"` // Stream sequence, acknowledged through POST /consume/{stream}/ack
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+	Delivered uint64          `json:"delivered"` // Delivery attempts, above 1 for redeliveries
+	Timestamp int64           `json:"timestamp"`
+}
+
+// consumeResponse is the result of POST /consume/{stream}
+type consumeResponse struct {
+	Consumer string            `json:"consumer"`
+	Messages []consumedMessage `json:"messages"`
+	Pending  uint64            `json:"pending"` // Stored messages not yet fetched
+	Unacked  int               `json:"unacked"` // Fetched messages waiting for an ack
+}
+
+// consumeAckRequest is the body of POST /consume/{stream}/ack
+type consumeAckRequest struct {
+	Consumer string   `json:"consumer,omitempty"` // Consumer name, "default" when empty
+	IDs      []uint64 `json:"ids,omitempty"`      // Message IDs to acknowledge
+	UpTo     uint64   `json:"upTo,omitempty"`     // Acknowledge every fetched message up to this ID
+	Nak      []uint64 `json:"nak,omitempty"`      // Message IDs to redeliver right away
+}
+
+// consumeAckResponse is the result of POST /consume/{stream}/ack
+type consumeAckResponse struct {
+	Acked   int `json:"acked"`
+	Naked   int `json:"naked"`
+	Unacked int `json:"unacked"`
+}
+
+// pullConsumerName resolves the stream and consumer of a /consume request to
+// the JetStream subject and the caller's durable name, writing the error
+// response when it fails
+func (dt *SomniaStream) pullConsumerName(c *gin.Context, consumer string) (string, string, bool) {
+	stream := c.Param("stream")
+	subject, ok := dt.streams.lookup(stream)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown stream %q", stream)})
+		return "", "", false
+	}
+	if !dt.streamAllowed(c, stream) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("access to stream %q denied", stream)})
+		return "", "", false
+	}
+	if !consumerNamePattern.MatchString(consumer) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "consumer must be 1-64 letters, digits, '-' or '_'"})
+		return "", "", false
+	}
+	subject = dt.ns.Subject(subject)
+	return subject, durableConsumerName("pull", callerID(c), subject, consumer), true
+}
+
+// Handle POST /consume/:stream, fetching a batch of stored messages from the
+// caller's durable pull consumer of the stream. Fetched messages stay pending
+// until acknowledged through POST /consume/:stream/ack and are redelivered
+// after DELIVERY_ACK_WAIT otherwise.
+func (dt *SomniaStream) handleConsume(c *gin.Context) {
+	var req consumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Consumer == "" {
+		req.Consumer = "default"
+	}
+	cfg := dt.config()
+	batch := req.Batch
+	if batch <= 0 {
+		batch = 100
+	}
+	batch = min(batch, max(cfg.ConsumeMaxBatch, 1))
+	wait := 5 * time.Second
+	if req.Wait != "" {
+		d, err := time.ParseDuration(req.Wait)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wait must be a positive duration such as 5s"})
+			return
+		}
+		wait = d
+	}
+	if cfg.ConsumeMaxWait > 0 && wait > cfg.ConsumeMaxWait {
+		wait = cfg.ConsumeMaxWait
+	}
+
+	shape, err := newMessageShape(req.Fields, req.Transform)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subject, durable, ok := dt.pullConsumerName(c, req.Consumer)
+	if !ok {
+		return
+	}
+	pc, err := dt.pulls.bind(durable, func() (*nats.Subscription, error) {
+		consumer := nats.ConsumerConfig{Durable: durable, DeliverPolicy: nats.DeliverAllPolicy}
+		if req.StartSeq > 0 {
+			consumer.DeliverPolicy = nats.DeliverByStartSequencePolicy
+			consumer.OptStartSeq = req.StartSeq
+		}
+		streamName, err := dt.ensureDurable(subject, consumer)
+		if err != nil {
+			return nil, err
+		}
+		return dt.js.PullSubscribe(subject, durable, nats.Bind(streamName, durable), nats.ManualAck())
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	msgs, err := pc.sub.Fetch(batch, nats.MaxWait(wait))
+	if err != nil && !errors.Is(err, nats.ErrTimeout) {
+		if errors.Is(err, nats.ErrConsumerDeleted) || errors.Is(err, nats.ErrConsumerNotFound) {
+			dt.pulls.unbind(durable) // Expired after DELIVERY_CONSUMER_TTL; the next call recreates it
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := consumeResponse{Consumer: req.Consumer, Messages: make([]consumedMessage, 0, len(msgs))}
+	for _, msg := range msgs {
+		meta, err := msg.Metadata()
+		if err != nil {
+			log.Printf("WARNING: Skipping message without JetStream metadata on %s: %v", subject, err)
+			continue
+		}
+		data, ok := shape.apply(msg.Data)
+		if !ok {
+			msg.Ack() // Skipped on purpose, never redelivered
+			continue
+		}
+		pc.pending.track(meta.Sequence.Stream, msg)
+		if !json.Valid(data) {
+			data, _ = json.Marshal(string(msg.Data))
+		}
+		resp.Messages = append(resp.Messages, consumedMessage{
+			ID:        meta.Sequence.Stream,
+			Subject:   msg.Subject,
+			Data:      data,
+			Delivered: meta.NumDelivered,
+			Timestamp: meta.Timestamp.Unix(),
+		})
+		resp.Pending = meta.NumPending
+	}
+	resp.Unacked = pc.pending.unacked()
+	c.JSON(http.StatusOK, resp)
+}
+
+// Handle POST /consume/:stream/ack, acknowledging or releasing messages
+// fetched from the caller's pull consumer
+func (dt *SomniaStream) handleConsumeAck(c *gin.Context) {
+	var req consumeAckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Consumer == "" {
+		req.Consumer = "default"
+	}
+	if len(req.IDs) == 0 && req.UpTo == 0 && len(req.Nak) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids, upTo or nak is required"})
+		return
+	}
+	_, durable, ok := dt.pullConsumerName(c, req.Consumer)
+	if !ok {
+		return
+	}
+	pc, ok := dt.pulls.get(durable)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("consumer %q has no fetched messages; unacknowledged messages are redelivered by the next fetch", req.Consumer)})
+		return
+	}
+	naked := pc.pending.nak(req.Nak)
+	acked, unacked := pc.pending.ack(req.IDs, req.UpTo)
+	c.JSON(http.StatusOK, consumeAckResponse{Acked: acked, Naked: naked, Unacked: unacked})
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"somnia-stream/pkg/api"
+)
+
+// corsMiddleware applies CORS_ALLOWED_ORIGINS, following configuration reloads
+func (dt *SomniaStream) corsMiddleware() gin.HandlerFunc {
+	return api.CORS(func() []string {
+		return dt.config().CORSAllowedOrigins
+	})
+}
+
+// wsAllowedOrigins returns WS_ALLOWED_ORIGINS, or CORS_ALLOWED_ORIGINS when unset
+func (dt *SomniaStream) wsAllowedOrigins() []string {
+	cfg := dt.config()
+	if len(cfg.WSAllowedOrigins) == 0 {
+		return cfg.CORSAllowedOrigins
+	}
+	return cfg.WSAllowedOrigins
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardFiles is the single-page dashboard served at /
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// setupDashboard serves the dashboard page at / and its assets under
+// /dashboard. DASHBOARD is checked per request so a reload can turn it off.
+func (dt *SomniaStream) setupDashboard() {
+	assets, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err) // The directory is embedded at build time
+	}
+	files := http.FileServer(http.FS(assets))
+
+	enabled := func(c *gin.Context) {
+		if !dt.config().Dashboard {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "dashboard disabled"})
+			return
+		}
+		c.Next()
+	}
+
+	dt.router.GET("/", enabled, func(c *gin.Context) {
+		c.FileFromFS("/", http.FS(assets))
+	})
+	dt.router.GET("/dashboard/*filepath", enabled, func(c *gin.Context) {
+		c.Request.URL.Path = c.Param("filepath")
+		files.ServeHTTP(c.Writer, c.Request)
+	})
+}
@@ -0,0 +1,273 @@
+// SomniaStream dashboard: live blocks, gas price, pending transactions and
+// stream health, driven by the public SSE and health endpoints.
+(() => {
+    const MAX_BLOCKS = 15;
+    const MAX_PENDING = 60;
+    const MAX_GAS_POINTS = 120;
+    const HEALTH_INTERVAL = 10000;
+
+    const state = {
+        apiKey: localStorage.getItem('somnia.apiKey') || '',
+        sources: new Map(),
+        gas: [],
+        lastBlock: null,
+    };
+
+    const $ = (id) => document.getElementById(id);
+
+    // Credentials: EventSource can't set headers, so the key travels as ?api_key=
+    function withKey(path) {
+        if (!state.apiKey) {
+            return path;
+        }
+        const sep = path.includes('?') ? '&' : '?';
+        return `${path}${sep}api_key=${encodeURIComponent(state.apiKey)}`;
+    }
+
+    function fetchJSON(path) {
+        const headers = state.apiKey ? { 'X-API-Key': state.apiKey } : {};
+        return fetch(path, { headers }).then((res) => res.json().then((body) => ({ ok: res.ok, status: res.status, body })));
+    }
+
+    function setStreamStatus(stream, status) {
+        document.querySelectorAll(`.stream-status[data-stream="${stream}"]`).forEach((el) => {
+            el.textContent = status;
+            el.className = `stream-status ${status}`;
+        });
+    }
+
+    // subscribe opens an SSE stream; EventSource reconnects on its own and
+    // resumes with Last-Event-ID
+    function subscribe(stream, path, onData) {
+        const previous = state.sources.get(stream);
+        if (previous) {
+            previous.close();
+        }
+        const source = new EventSource(withKey(path));
+        source.onopen = () => setStreamStatus(stream, 'live');
+        source.onerror = () => setStreamStatus(stream, source.readyState === EventSource.CLOSED ? 'error' : 'connecting');
+        source.onmessage = (event) => {
+            try {
+                onData(JSON.parse(event.data));
+            } catch (err) {
+                console.error(`Bad ${stream} event`, err);
+            }
+        };
+        source.addEventListener('notice', () => setStreamStatus(stream, 'lagging'));
+        state.sources.set(stream, source);
+    }
+
+    // Formatting
+    const short = (hash) => (hash ? `${hash.slice(0, 10)}…${hash.slice(-6)}` : '–');
+    const gwei = (wei) => (wei ? (Number(wei) / 1e9).toFixed(2) : '–');
+    const fromHex = (hex) => (hex ? parseInt(hex, 16) : 0);
+
+    function age(timestamp) {
+        const seconds = Math.max(0, Math.round(Date.now() / 1000 - timestamp));
+        return seconds < 60 ? `${seconds}s` : `${Math.floor(seconds / 60)}m`;
+    }
+
+    function hexEther(hex) {
+        if (!hex) {
+            return '0';
+        }
+        const value = Number(BigInt(hex) / 10n ** 12n) / 1e6;
+        return value.toLocaleString(undefined, { maximumFractionDigits: 4 });
+    }
+
+    function cell(row, text) {
+        const td = document.createElement('td');
+        td.textContent = text;
+        row.appendChild(td);
+    }
+
+    // Blocks
+    function onBlock(block) {
+        $('stat-head').textContent = `#${Number(block.number).toLocaleString()}`;
+        if (state.lastBlock && block.timestamp > state.lastBlock.timestamp) {
+            $('stat-blocktime').textContent = `${block.timestamp - state.lastBlock.timestamp}s`;
+        }
+        state.lastBlock = block;
+
+        const row = document.createElement('tr');
+        row.className = 'fresh';
+        row.dataset.timestamp = block.timestamp;
+        cell(row, Number(block.number).toLocaleString());
+        cell(row, short(block.hash));
+        cell(row, block.txCount);
+        cell(row, block.gasLimit ? `${((block.gasUsed / block.gasLimit) * 100).toFixed(1)}%` : '–');
+        cell(row, block.baseFeePerGas ? `${gwei(block.baseFeePerGas)} gwei` : '–');
+        cell(row, age(block.timestamp));
+
+        const body = $('blocks-body');
+        body.prepend(row);
+        while (body.children.length > MAX_BLOCKS) {
+            body.lastChild.remove();
+        }
+    }
+
+    function refreshAges() {
+        document.querySelectorAll('#blocks-body tr').forEach((row) => {
+            row.lastChild.textContent = age(Number(row.dataset.timestamp));
+        });
+    }
+
+    // Gas price
+    function onGasPrice(sample) {
+        $('stat-gas').textContent = `${sample.gwei.toFixed(2)} gwei`;
+        state.gas.push({ at: sample.timestamp, value: sample.gwei });
+        if (state.gas.length > MAX_GAS_POINTS) {
+            state.gas.shift();
+        }
+        drawGasChart();
+    }
+
+    // Seed the chart with the median of the last hour, when the key may read history
+    function loadGasHistory() {
+        fetchJSON('/gas/history?window=1h&interval=1m&percentiles=50').then(({ ok, body }) => {
+            if (!ok || !body.series) {
+                return;
+            }
+            const history = body.series.map((bucket) => ({ at: bucket.start, value: bucket.percentiles.p50 }));
+            state.gas = history.concat(state.gas).slice(-MAX_GAS_POINTS);
+            drawGasChart();
+        }).catch(() => {});
+    }
+
+    function drawGasChart() {
+        const canvas = $('gas-chart');
+        const ratio = window.devicePixelRatio || 1;
+        const width = canvas.clientWidth;
+        const height = canvas.clientHeight;
+        canvas.width = width * ratio;
+        canvas.height = height * ratio;
+
+        const ctx = canvas.getContext('2d');
+        ctx.scale(ratio, ratio);
+        ctx.clearRect(0, 0, width, height);
+        if (state.gas.length < 2) {
+            return;
+        }
+
+        const values = state.gas.map((p) => p.value);
+        let min = Math.min(...values);
+        let max = Math.max(...values);
+        if (max === min) {
+            min -= 1;
+            max += 1;
+        }
+        const pad = { left: 48, right: 8, top: 10, bottom: 20 };
+        const x = (i) => pad.left + (i / (state.gas.length - 1)) * (width - pad.left - pad.right);
+        const y = (v) => pad.top + (1 - (v - min) / (max - min)) * (height - pad.top - pad.bottom);
+
+        ctx.strokeStyle = '#262b45';
+        ctx.fillStyle = '#8a90ad';
+        ctx.font = '11px sans-serif';
+        for (let i = 0; i <= 4; i++) {
+            const v = min + ((max - min) * i) / 4;
+            ctx.beginPath();
+            ctx.moveTo(pad.left, y(v));
+            ctx.lineTo(width - pad.right, y(v));
+            ctx.stroke();
+            ctx.fillText(v.toFixed(2), 4, y(v) + 4);
+        }
+
+        ctx.strokeStyle = '#7c8cff';
+        ctx.lineWidth = 2;
+        ctx.beginPath();
+        state.gas.forEach((p, i) => (i === 0 ? ctx.moveTo(x(i), y(p.value)) : ctx.lineTo(x(i), y(p.value))));
+        ctx.stroke();
+    }
+
+    // Pending transactions
+    function onPending(delta) {
+        $('stat-pending').textContent = Number(delta.count).toLocaleString();
+
+        const feed = $('pending-feed');
+        (delta.removed || []).slice(0, 10).forEach((hash) => {
+            const item = document.createElement('li');
+            item.className = 'removed';
+            item.textContent = `${short(hash)} left the pool`;
+            feed.prepend(item);
+        });
+        (delta.transactions || []).forEach((tx) => {
+            const item = document.createElement('li');
+            const hash = document.createElement('code');
+            hash.textContent = short(tx.hash);
+            const detail = document.createElement('span');
+            detail.className = 'muted';
+            detail.textContent = `${hexEther(tx.value)} · nonce ${fromHex(tx.nonce)}`;
+            item.append(hash, detail);
+            feed.prepend(item);
+        });
+        while (feed.children.length > MAX_PENDING) {
+            feed.lastChild.remove();
+        }
+    }
+
+    // Health
+    function componentDetail(name, component) {
+        switch (name) {
+        case 'rpc':
+            return component.head ? `head ${component.head}, ${component.latency}` : component.error || '';
+        case 'jetstream':
+            return component.streams ? `${component.streams} streams` : component.error || '';
+        case 'monitors':
+            return Object.keys(component.monitors || {}).join(', ');
+        default:
+            return component.server || component.error || '';
+        }
+    }
+
+    function loadHealth() {
+        fetch('/health').then((res) => res.json()).then((health) => {
+            const badge = $('health-status');
+            badge.textContent = health.status;
+            badge.className = `badge ${health.status === 'ok' ? 'ok' : health.status}`;
+
+            const list = $('health-components');
+            list.replaceChildren();
+            Object.entries(health.components || {}).forEach(([name, component]) => {
+                const item = document.createElement('li');
+                const label = document.createElement('span');
+                label.textContent = name;
+                const detail = document.createElement('span');
+                detail.className = 'detail';
+                detail.textContent = componentDetail(name, component);
+                const status = document.createElement('span');
+                status.className = `badge ${component.status === 'ok' ? 'ok' : component.status}`;
+                status.textContent = component.status;
+                item.append(label, detail, status);
+                list.appendChild(item);
+            });
+        }).catch(() => {
+            $('health-status').textContent = 'unreachable';
+            $('health-status').className = 'badge down';
+        });
+    }
+
+    function connect() {
+        subscribe('blocks', '/sse/blocks?detail=header', onBlock);
+        subscribe('gasPrice', '/sse/gasPrice', onGasPrice);
+        subscribe('pending', '/sse/pending', onPending);
+        loadGasHistory();
+    }
+
+    $('api-key').value = state.apiKey;
+    $('auth-form').addEventListener('submit', (event) => {
+        event.preventDefault();
+        state.apiKey = $('api-key').value.trim();
+        localStorage.setItem('somnia.apiKey', state.apiKey);
+        connect();
+    });
+
+    fetch('/version').then((res) => res.json()).then((info) => {
+        $('version').textContent = info.version;
+    }).catch(() => {});
+
+    connect();
+    loadHealth();
+    setInterval(loadHealth, HEALTH_INTERVAL);
+    setInterval(refreshAges, 1000);
+    window.addEventListener('resize', drawGasChart);
+})();
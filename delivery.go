@@ -0,0 +1,484 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"golang.org/x/time/rate"
+
+	"somnia-stream/pkg/api"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// slowNoticeInterval limits how often a lagging client is sent a notice event
+const slowNoticeInterval = 5 * time.Second
+
+// defaultDeliveryPolicies conflates streams where only the latest value matters
+var defaultDeliveryPolicies = map[string]string{
+	"network":      api.Conflate,
+	"gasPrice":     api.Conflate,
+	"fees":         api.Conflate,
+	"throughput":   api.Conflate,
+	"pending-full": api.Conflate,
+}
+
+// newClientQueue builds a queue with the configured rate limit and the overflow policy of a stream
+func (dt *SomniaStream) newClientQueue(stream string) *api.Queue {
+	cfg := dt.config()
+
+	policy := cfg.ClientOverflowPolicy
+	if p, ok := defaultDeliveryPolicies[stream]; ok {
+		policy = p
+	}
+	if p, ok := cfg.ClientOverflowPolicies[stream]; ok {
+		policy = p
+	}
+
+	var limiter *rate.Limiter
+	if cfg.ClientRateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(cfg.ClientRateLimit), max(cfg.ClientRateBurst, 1))
+	}
+	return api.NewQueue(cfg.ClientQueueSize, policy, limiter)
+}
+
+// slowConsumerNotice records that a client lost messages to its overflow
+// policy, publishes the event on somnia.clients.slow and returns the notice
+// sent to the client
+func (dt *SomniaStream) slowConsumerNotice(cc *clientConn, policy string, dropped uint64) []byte {
+	dt.clients.recordSlowConsumer(policy)
+
+	notice := map[string]interface{}{
+		"type":      "slow_consumer",
+		"policy":    policy,
+		"dropped":   dropped,
+		"timestamp": time.Now().Unix(),
+	}
+	data, _ := json.Marshal(notice)
+
+	event := map[string]interface{}{
+		"client":       cc.id,
+		"stream":       cc.stream,
+		"remoteAddr":   cc.remoteAddr,
+		"policy":       policy,
+		"dropped":      dropped,
+		"totalDropped": cc.dropped.Load(),
+		"timestamp":    time.Now().Unix(),
+	}
+	if cc.key != nil {
+		event["keyId"] = cc.key.ID
+	}
+	payload, _ := json.Marshal(event)
+	payload = withChainID(payload, dt.chainID)
+	if err := dt.natsConn.Publish(dt.ns.Subject(streams.SlowConsumerSubject), payload); err != nil {
+		log.Printf("ERROR: Failed to publish slow consumer event: %v", err)
+	}
+	return data
+}
+
+// messageShape is the server-side reshaping a client asked for: the fields
+// projection, then the transform expression
+type messageShape struct {
+	fields    []string
+	transform *streams.Transform
+}
+
+// newMessageShape parses a comma separated field list and a transform
+// expression, either of which may be empty
+func newMessageShape(fields, transform string) (messageShape, error) {
+	compiled, err := streams.CompileTransform(transform)
+	if err != nil {
+		return messageShape{}, err
+	}
+	return messageShape{fields: streams.ParseFields(fields), transform: compiled}, nil
+}
+
+// apply reshapes a message. It reports false when the transform yields null,
+// so the message is skipped.
+func (s messageShape) apply(data []byte) ([]byte, bool) {
+	return s.transform.ApplyJSON(streams.ProjectJSON(data, s.fields))
+}
+
+// gapDetector follows the sequences an ordered consumer delivers to one
+// client. The ordered consumer recreates itself after the last delivered
+// stream sequence whenever it sees a consumer sequence gap, e.g. after a NATS
+// reconnect; the detector spots the recoveries that resumed later than that
+// because the missed messages were already removed from the stream, as well
+// as Last-Event-ID resumes older than the stored messages.
+type gapDetector struct {
+	lastStream   uint64
+	lastConsumer uint64
+}
+
+// detectGap records a delivered message and returns the gap notice for the
+// stream sequences lost before it, or nil
+func (dt *SomniaStream) detectGap(d *gapDetector, meta *nats.MsgMetadata) []byte {
+	stream, consumer := meta.Sequence.Stream, meta.Sequence.Consumer
+	recreated := consumer <= d.lastConsumer || (d.lastConsumer == 0 && d.lastStream > 0) // Recreated or resumed
+	from := d.lastStream + 1
+	d.lastStream, d.lastConsumer = stream, consumer
+	if !recreated || stream <= from {
+		return nil
+	}
+
+	// Other subjects of the stream fill most jumps; only messages removed
+	// from the stream are lost
+	info, err := dt.js.StreamInfo(meta.Stream)
+	if err != nil || info.State.FirstSeq <= from {
+		return nil
+	}
+	to := stream - 1
+	if info.State.FirstSeq <= to {
+		to = info.State.FirstSeq - 1
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      "gap",
+		"from":      from,
+		"to":        to,
+		"timestamp": time.Now().Unix(),
+	})
+	return data
+}
+
+// Delivery modes of the streaming endpoints. Event IDs are JetStream stream
+// sequences, so at-least-once clients that skip IDs they already processed
+// get effectively exactly-once processing.
+const (
+	deliveryAtMostOnce  = "at-most-once"  // Ordered ephemeral consumer, messages count as delivered when received from NATS
+	deliveryAtLeastOnce = "at-least-once" // Durable consumer, messages are redelivered until the client acks them
+)
+
+// consumerNamePattern restricts client-chosen consumer names to characters
+// allowed in JetStream durable names
+var consumerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ackSession is a connected at-least-once client and its unacknowledged messages
+type ackSession struct {
+	mu      sync.Mutex
+	durable string
+	pending map[uint64]*nats.Msg // By stream sequence
+}
+
+func (s *ackSession) track(seq uint64, msg *nats.Msg) {
+	s.mu.Lock()
+	s.pending[seq] = msg
+	s.mu.Unlock()
+}
+
+// ack acknowledges the pending messages listed in ids or up to upTo and
+// returns how many were acknowledged and how many are still pending
+func (s *ackSession) ack(ids []uint64, upTo uint64) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acked := 0
+	ackSeq := func(seq uint64) {
+		if msg, ok := s.pending[seq]; ok {
+			if err := msg.Ack(); err == nil {
+				acked++
+			}
+			delete(s.pending, seq)
+		}
+	}
+	for _, seq := range ids {
+		ackSeq(seq)
+	}
+	if upTo > 0 {
+		for seq := range s.pending {
+			if seq <= upTo {
+				ackSeq(seq)
+			}
+		}
+	}
+	return acked, len(s.pending)
+}
+
+// unacked returns how many tracked messages wait for an ack
+func (s *ackSession) unacked() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// nak asks for immediate redelivery of the pending messages listed in ids and
+// returns how many were released
+func (s *ackSession) nak(ids []uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	naked := 0
+	for _, seq := range ids {
+		if msg, ok := s.pending[seq]; ok {
+			if err := msg.Nak(); err == nil {
+				naked++
+			}
+			delete(s.pending, seq)
+		}
+	}
+	return naked
+}
+
+// ackSessions are the connected at-least-once clients by caller, subject and consumer name
+type ackSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*ackSession
+}
+
+func newAckSessions() *ackSessions {
+	return &ackSessions{sessions: make(map[string]*ackSession)}
+}
+
+// open registers a session, failing when the caller already streams with the consumer
+func (a *ackSessions) open(key, durable string) (*ackSession, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.sessions[key]; ok {
+		return nil, errConsumerConnected
+	}
+	session := &ackSession{durable: durable, pending: make(map[uint64]*nats.Msg)}
+	a.sessions[key] = session
+	return session, nil
+}
+
+func (a *ackSessions) close(key string) {
+	a.mu.Lock()
+	delete(a.sessions, key)
+	a.mu.Unlock()
+}
+
+func (a *ackSessions) get(key string) (*ackSession, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	session, ok := a.sessions[key]
+	return session, ok
+}
+
+var errConsumerConnected = errors.New("consumer is already connected")
+
+// ackSessionKey identifies the consumer of a subject of a caller
+func ackSessionKey(caller, subject, consumer string) string {
+	return caller + "\x00" + subject + "\x00" + consumer
+}
+
+// headerAckToken returns the ack token of an anonymous at-least-once stream
+const headerAckToken = "Somnia-Ack-Token"
+
+// ackTokenPattern requires client-chosen ack tokens to be hard to guess
+var ackTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{22,64}$`)
+
+// anonymousCaller reports whether a callerID is a client address rather than
+// an API key or JWT subject
+func anonymousCaller(caller string) bool {
+	return strings.HasPrefix(caller, "ip:")
+}
+
+// ackToken validates the ack token an anonymous client resumes with, or
+// generates one for a new client
+func ackToken(token string) (string, error) {
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(buf), nil
+	}
+	if !ackTokenPattern.MatchString(token) {
+		return "", errors.New("ackToken must be 22-64 letters, digits, '-' or '_'")
+	}
+	return token, nil
+}
+
+// groupCaller returns the principal whose queue group a caller joins: its API
+// key or JWT subject, or the group token anonymous callers must share, since
+// workers on different hosts have different addresses
+func groupCaller(caller, token string) (string, error) {
+	if !anonymousCaller(caller) {
+		return caller, nil
+	}
+	if token == "" {
+		return "", errGroupTokenRequired
+	}
+	if !ackTokenPattern.MatchString(token) {
+		return "", errors.New("groupToken must be 22-64 letters, digits, '-' or '_'")
+	}
+	return "token:" + token, nil
+}
+
+var errGroupTokenRequired = errors.New("groupToken is required without an API key or JWT")
+
+// streamSubject returns the subject of a stream of a network, "" for RPC_ENDPOINT
+func (dt *SomniaStream) streamSubject(network, stream string) (string, bool) {
+	if network != "" {
+		return streams.LookupChain(network, stream)
+	}
+	return dt.streams.lookup(stream)
+}
+
+// blockDetailSubject returns the blocks subject of a detail level of a network
+func blockDetailSubject(network, detail string) (string, bool) {
+	subject, ok := monitor.BlockDetailSubjects[detail]
+	if ok && network != "" {
+		subject = streams.ChainSubject(network, subject)
+	}
+	return subject, ok
+}
+
+// deliveryMode returns the delivery mode of a request: ?delivery=, else the
+// stream's DELIVERY_MODES entry, else DELIVERY_MODE
+func (dt *SomniaStream) deliveryMode(c *gin.Context, stream string) (string, error) {
+	cfg := dt.config()
+	mode := cfg.DeliveryMode
+	if m, ok := cfg.DeliveryModes[stream]; ok {
+		mode = m
+	}
+	if m := c.Query("delivery"); m != "" {
+		mode = m
+	}
+	switch mode {
+	case "", deliveryAtMostOnce:
+		return deliveryAtMostOnce, nil
+	case deliveryAtLeastOnce:
+		return mode, nil
+	}
+	return "", fmt.Errorf("delivery must be %s or %s", deliveryAtMostOnce, deliveryAtLeastOnce)
+}
+
+// durableConsumerName derives the JetStream durable name of a caller's
+// consumer of a subject, so callers can't bind each other's consumers. kind
+// keeps the push consumers of the SSE endpoints ("sse") and of /ws ("ws")
+// apart from the pull consumers of /consume ("pull").
+func durableConsumerName(kind, caller, subject, consumer string) string {
+	sum := sha256.Sum256([]byte(caller + "\x00" + subject))
+	return kind + "_" + consumer + "_" + hex.EncodeToString(sum[:6])
+}
+
+// ensureDurable creates the durable consumer described by consumer on first
+// use and returns the name of the stream storing subject. Messages are
+// acknowledged explicitly and redelivered after DELIVERY_ACK_WAIT, and
+// consumers unused for DELIVERY_CONSUMER_TTL are removed by the server.
+func (dt *SomniaStream) ensureDurable(subject string, consumer nats.ConsumerConfig) (string, error) {
+	streamName, err := dt.js.StreamNameBySubject(subject)
+	if err != nil {
+		return "", fmt.Errorf("no JetStream stream stores %s", subject)
+	}
+	_, err = dt.js.ConsumerInfo(streamName, consumer.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		cfg := dt.config()
+		consumer.FilterSubject = subject
+		consumer.AckPolicy = nats.AckExplicitPolicy
+		consumer.AckWait = cfg.DeliveryAckWait
+		consumer.MaxAckPending = cfg.DeliveryMaxAckPending
+		consumer.InactiveThreshold = cfg.DeliveryConsumerTTL
+		if _, err := dt.js.AddConsumer(streamName, &consumer); err != nil {
+			return "", err
+		}
+		log.Printf("Created durable consumer %s on %s", consumer.Durable, subject)
+	} else if err != nil {
+		return "", err
+	}
+	return streamName, nil
+}
+
+// subscribeDurable binds the durable push consumer of an at-least-once
+// client, creating it on first use to start after startSeq (or at new messages)
+func (dt *SomniaStream) subscribeDurable(subject, durable string, startSeq uint64, handler nats.MsgHandler) (*nats.Subscription, error) {
+	consumer := nats.ConsumerConfig{
+		Durable:        durable,
+		DeliverSubject: nats.NewInbox(),
+		DeliverPolicy:  nats.DeliverNewPolicy,
+	}
+	if startSeq > 0 {
+		consumer.DeliverPolicy = nats.DeliverByStartSequencePolicy
+		consumer.OptStartSeq = startSeq
+	}
+	streamName, err := dt.ensureDurable(subject, consumer)
+	if err != nil {
+		return nil, err
+	}
+	return dt.js.Subscribe(subject, handler, nats.Bind(streamName, durable), nats.ManualAck())
+}
+
+// subscribeGroup joins a queue group on the durable push consumer its
+// members share, creating it on first use to start at new messages. Each
+// message goes to one member, which acknowledges it on receipt; messages in
+// flight to a member that leaves are redelivered to the others after
+// DELIVERY_ACK_WAIT.
+func (dt *SomniaStream) subscribeGroup(subject, durable, group string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	streamName, err := dt.ensureDurable(subject, nats.ConsumerConfig{
+		Durable:        durable,
+		DeliverSubject: nats.NewInbox(),
+		DeliverGroup:   group,
+		DeliverPolicy:  nats.DeliverNewPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dt.js.QueueSubscribe(subject, group, handler, nats.Bind(streamName, durable), nats.ManualAck())
+}
+
+// ackRequest is the body of POST /sse/ack
+type ackRequest struct {
+	Stream   string   `json:"stream"`             // Stream of the connection, as in /sse/{stream}
+	Network  string   `json:"network,omitempty"`  // Network of /sse/{network}/{name} connections
+	Detail   string   `json:"detail,omitempty"`   // Block detail level of the connection, blocks stream only
+	Consumer string   `json:"consumer"`           // Consumer name of the connected stream, "default" when empty
+	AckToken string   `json:"ackToken,omitempty"` // Token of the connection, required from anonymous callers
+	IDs      []uint64 `json:"ids,omitempty"`      // Event IDs to acknowledge
+	UpTo     uint64   `json:"upTo,omitempty"`     // Acknowledge every delivered event up to this ID
+}
+
+// ackResponse is the result of POST /sse/ack
+type ackResponse struct {
+	Acked   int `json:"acked"`
+	Pending int `json:"pending"`
+}
+
+// Handle POST /sse/ack acknowledging events of an at-least-once stream; the
+// stream must still be connected
+func (dt *SomniaStream) handleAck(c *gin.Context) {
+	var req ackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Consumer == "" {
+		req.Consumer = "default"
+	}
+	if len(req.IDs) == 0 && req.UpTo == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids or upTo is required"})
+		return
+	}
+	subject, ok := dt.streamSubject(req.Network, req.Stream)
+	if ok && req.Detail != "" && req.Stream == "blocks" {
+		subject, ok = blockDetailSubject(req.Network, req.Detail)
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown stream %q", req.Stream)})
+		return
+	}
+	caller := callerID(c)
+	if anonymousCaller(caller) {
+		if req.AckToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "ackToken is required without an API key or JWT"})
+			return
+		}
+		caller = "token:" + req.AckToken
+	}
+	session, ok := dt.acks.get(ackSessionKey(caller, subject, req.Consumer))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("consumer %q is not connected; unacknowledged events are redelivered on reconnect", req.Consumer)})
+		return
+	}
+	acked, pending := session.ack(req.IDs, req.UpTo)
+	c.JSON(http.StatusOK, ackResponse{Acked: acked, Pending: pending})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// publishPolicy returns the publish retry and spool settings of a configuration
+func publishPolicy(cfg *config.Config, ns streams.Namespace) monitor.PublishPolicy {
+	return monitor.PublishPolicy{
+		Retries:  cfg.PublishRetries,
+		Backoff:  cfg.PublishRetryBackoff,
+		SpoolDir: cfg.DLQSpoolDir,
+		DLQ:      ns.Subject(streams.DLQSubject),
+	}
+}
+
+// publish publishes to JetStream with retries, dead-lettering payloads that
+// still fail; the error is returned so the calling monitor records it
+func (dt *SomniaStream) publish(subject string, data []byte) error {
+	return dt.publishFor(dt.chainID, subject, data)
+}
+
+// publishFor publishes a payload of the given network on the namespaced
+// subject, adding the chain ID to the payload
+func (dt *SomniaStream) publishFor(chainID *big.Int, subject string, data []byte) error {
+	data, ok, err := dt.hooks.apply(subject, data)
+	if err != nil {
+		log.Printf("[HOOKS] ERROR: %v", err)
+		return err
+	}
+	if !ok {
+		return nil // Dropped by its publish hook
+	}
+	data = withChainID(data, chainID)
+	return dt.publisher.Publish(dt.ns.Subject(subject), dt.chaos.corrupt(subject, data))
+}
+
+// withChainID adds a top-level chainId to a JSON object payload that doesn't
+// carry one yet; other payloads are returned unchanged
+func withChainID(data []byte, chainID *big.Int) []byte {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if chainID == nil || len(trimmed) < 2 || trimmed[0] != '{' {
+		return data
+	}
+	// Only parse payloads that mention chainId, e.g. network stats or nested transactions
+	if bytes.Contains(trimmed, []byte(`"chainId"`)) {
+		var existing struct {
+			ChainID json.RawMessage `json:"chainId"`
+		}
+		if err := json.Unmarshal(trimmed, &existing); err != nil || existing.ChainID != nil {
+			return data
+		}
+	}
+
+	body := bytes.TrimLeft(trimmed[1:], " \t\r\n")
+	out := make([]byte, 0, len(trimmed)+32)
+	out = append(out, `{"chainId":`...)
+	out = chainID.Append(out, 10)
+	if body[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, body...)
+}
+
+// Handle GET /admin/dlq listing dead-lettered messages
+func (dt *SomniaStream) handleListDLQ(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	info, err := dt.js.StreamInfo(dt.ns.Stream(streams.DLQStream))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	messages := make([]gin.H, 0, min(limit, int(info.State.Msgs)))
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq && len(messages) < limit; seq++ {
+		raw, err := dt.js.GetMsg(dt.ns.Stream(streams.DLQStream), seq)
+		if err != nil {
+			continue // Deleted after a partial re-drive
+		}
+		failedAt, _ := strconv.ParseInt(raw.Header.Get(monitor.HeaderFailedAt), 10, 64)
+		attempts, _ := strconv.Atoi(raw.Header.Get(monitor.HeaderAttempts))
+		messages = append(messages, gin.H{
+			"seq":      raw.Sequence,
+			"subject":  raw.Header.Get(monitor.HeaderOriginalSubject),
+			"error":    raw.Header.Get(monitor.HeaderPublishError),
+			"failedAt": failedAt,
+			"attempts": attempts,
+			"bytes":    len(raw.Data),
+		})
+	}
+
+	spooled, err := dt.publisher.Spooled()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":    info.State.Msgs,
+		"messages": messages,
+		"spooled":  len(spooled),
+	})
+}
+
+// Handle POST /admin/dlq/redrive re-publishing dead-lettered and spooled
+// messages to their original subjects. Re-driven messages are removed; the
+// first failure stops the run.
+func (dt *SomniaStream) handleRedriveDLQ(c *gin.Context) {
+	redriven, err := dt.publisher.RedriveSpool()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "redriven": redriven})
+		return
+	}
+
+	info, err := dt.js.StreamInfo(dt.ns.Stream(streams.DLQStream))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "redriven": redriven})
+		return
+	}
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq; seq++ {
+		raw, err := dt.js.GetMsg(dt.ns.Stream(streams.DLQStream), seq)
+		if err != nil {
+			continue
+		}
+		subject := raw.Header.Get(monitor.HeaderOriginalSubject)
+		if _, err := dt.js.Publish(subject, raw.Data); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("re-drive to %s failed: %v", subject, err), "redriven": redriven})
+			return
+		}
+		if err := dt.js.DeleteMsg(dt.ns.Stream(streams.DLQStream), seq); err != nil {
+			log.Printf("[DLQ] Failed to delete re-driven message %d: %v", seq, err)
+		}
+		redriven++
+	}
+
+	log.Printf("[DLQ] Re-drove %d messages", redriven)
+	c.JSON(http.StatusOK, gin.H{"redriven": redriven})
+}
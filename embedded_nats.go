@@ -0,0 +1,69 @@
+//go:build embeddednats
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/config"
+)
+
+// startEmbeddedNATS runs an in-process NATS server with JetStream and returns
+// the connect options for it together with a shutdown function
+func startEmbeddedNATS(cfg *config.Config) ([]nats.Option, func(), error) {
+	opts := &server.Options{
+		ServerName: "somnia-stream",
+		JetStream:  true,
+		StoreDir:   cfg.EmbeddedNATSDataDir,
+		DontListen: cfg.EmbeddedNATSAddr == "",
+		NoSigs:     true,
+	}
+
+	// Optionally accept external clients (nats CLI, other services)
+	if cfg.EmbeddedNATSAddr != "" {
+		host, port, err := net.SplitHostPort(cfg.EmbeddedNATSAddr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid EMBEDDED_NATS_ADDR: %v", err)
+		}
+		opts.Host = host
+		if opts.Port, err = strconv.Atoi(port); err != nil {
+			return nil, nil, fmt.Errorf("invalid EMBEDDED_NATS_ADDR port: %v", err)
+		}
+		opts.Authorization = cfg.NATSToken
+	}
+
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create embedded NATS server: %v", err)
+	}
+	go ns.Start()
+
+	if !ns.ReadyForConnections(10 * time.Second) {
+		ns.Shutdown()
+		return nil, nil, errors.New("embedded NATS server did not become ready")
+	}
+
+	if cfg.EmbeddedNATSAddr != "" {
+		log.Printf("Embedded NATS server listening on %s (store: %s)", cfg.EmbeddedNATSAddr, cfg.EmbeddedNATSDataDir)
+	} else {
+		log.Printf("Embedded NATS server running in-process (store: %s)", cfg.EmbeddedNATSDataDir)
+	}
+
+	shutdown := func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	}
+	connect := []nats.Option{nats.Name("devtool"), nats.InProcessServer(ns)}
+	if opts.Authorization != "" {
+		connect = append(connect, nats.Token(opts.Authorization)) // The server asks every client for it
+	}
+	return connect, shutdown, nil
+}
@@ -0,0 +1,17 @@
+//go:build !embeddednats
+
+package main
+
+import (
+	"errors"
+
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/config"
+)
+
+// startEmbeddedNATS is unavailable unless the binary is built with
+// -tags embeddednats, which links the NATS server into the binary
+func startEmbeddedNATS(cfg *config.Config) ([]nats.Option, func(), error) {
+	return nil, nil, errors.New("embedded NATS requires a build with -tags embeddednats")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/streams"
+)
+
+// exportContentTypes are the content types of the snapshot formats
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv",
+	"ndjson": "application/x-ndjson",
+}
+
+// Run every configured export on its schedule until ctx is done. Each
+// snapshot covers the messages published since the previous one; the first
+// covers one interval.
+func (dt *SomniaStream) runExports(ctx context.Context) {
+	cfg := dt.config()
+	s3 := newS3Client(cfg, cfg.ExportS3Bucket, cfg.ExportS3Prefix)
+	for _, export := range cfg.Exports {
+		subject, ok := dt.streams.lookup(export.Stream)
+		if !ok {
+			log.Printf("[EXPORTS] WARNING: Export %s skipped, unknown stream %q", export.Name, export.Stream)
+			continue
+		}
+		log.Printf("[EXPORTS] Exporting %s every %s as %s", export.Stream, export.Interval, export.Format)
+		go dt.runExport(ctx, export, subject, s3)
+	}
+}
+
+// runExport writes the snapshots of one export
+func (dt *SomniaStream) runExport(ctx context.Context, export config.Export, subject string, s3 *s3Client) {
+	ticker := time.NewTicker(export.Interval)
+	defer ticker.Stop()
+	since := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case until := <-ticker.C:
+			if err := dt.exportSnapshot(ctx, export, subject, s3, since, until); err != nil {
+				log.Printf("[EXPORTS] ERROR: Export %s failed: %v", export.Name, err)
+				dt.publishSystemEvent("export_failed", severityError, err.Error(), map[string]interface{}{"export": export.Name})
+				continue // Retried with a longer window on the next tick
+			}
+			since = until
+		}
+	}
+}
+
+// exportSnapshot writes the messages published between since and until to
+// EXPORT_DIR and EXPORT_S3_BUCKET
+func (dt *SomniaStream) exportSnapshot(ctx context.Context, export config.Export, subject string, s3 *s3Client, since, until time.Time) error {
+	msgs, err := dt.readStreamRange(subject, since, until, maxHistoryMessages)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", export.Stream, err)
+	}
+	if len(msgs) == maxHistoryMessages {
+		log.Printf("[EXPORTS] WARNING: Export %s truncated to %d messages, shorten its interval", export.Name, maxHistoryMessages)
+	}
+	rows := make([]exportRow, 0, len(msgs))
+	fields := streams.ParseFields(export.Fields)
+	for _, msg := range msgs {
+		rows = append(rows, exportRow{seq: msg.Seq, published: msg.Published, data: streams.ProjectJSON(msg.Data, fields)})
+	}
+	if len(rows) == 0 {
+		log.Printf("[EXPORTS] No %s messages since %s, nothing exported", export.Stream, since.UTC().Format(time.RFC3339))
+		return nil
+	}
+
+	var body []byte
+	if export.Format == "ndjson" {
+		body = exportNDJSON(rows)
+	} else if body, err = exportCSV(rows); err != nil {
+		return err
+	}
+
+	file := fmt.Sprintf("%s-%s.%s", export.Name, until.UTC().Format("20060102T150405Z"), export.Format)
+	cfg := dt.config()
+	if cfg.ExportDir != "" {
+		if err := writeFileAtomic(filepath.Join(cfg.ExportDir, file), body); err != nil {
+			return err
+		}
+	}
+	if s3 != nil {
+		if err := s3.put(ctx, file, exportContentTypes[export.Format], body); err != nil {
+			return err
+		}
+	}
+	log.Printf("[EXPORTS] Exported %d %s messages to %s", len(rows), export.Stream, file)
+	return nil
+}
+
+// exportRow is one exported message
+type exportRow struct {
+	seq       uint64
+	published time.Time
+	data      []byte
+}
+
+// exportNDJSON writes one message per line, as published
+func exportNDJSON(rows []exportRow) []byte {
+	var out bytes.Buffer
+	for _, row := range rows {
+		out.Write(bytes.TrimSpace(row.data))
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// exportCSV writes one message per row. Nested objects are flattened into
+// dotted columns, arrays are written as JSON and the columns are the union of
+// every message's fields after seq and published.
+func exportCSV(rows []exportRow) ([]byte, error) {
+	records := make([]map[string]string, len(rows))
+	columns := map[string]bool{}
+	for i, row := range rows {
+		decoder := json.NewDecoder(bytes.NewReader(row.data))
+		decoder.UseNumber()
+		var payload interface{}
+		if err := decoder.Decode(&payload); err != nil {
+			payload = string(row.data)
+		}
+		records[i] = make(map[string]string)
+		flattenCSV(records[i], "", payload)
+		for column := range records[i] {
+			columns[column] = true
+		}
+	}
+	header := make([]string, 0, len(columns)+2)
+	for column := range columns {
+		header = append(header, column)
+	}
+	sort.Strings(header)
+	header = append([]string{"seq", "published"}, header...)
+
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		record := []string{strconv.FormatUint(row.seq, 10), row.published.UTC().Format(time.RFC3339Nano)}
+		for _, column := range header[2:] {
+			record = append(record, records[i][column])
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return out.Bytes(), w.Error()
+}
+
+// flattenCSV adds the cells of a value under a dotted column prefix; a value
+// that isn't an object goes in a "value" column
+func flattenCSV(cells map[string]string, prefix string, value interface{}) {
+	column := prefix
+	if column == "" {
+		column = "value"
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenCSV(cells, key, field)
+		}
+	case []interface{}:
+		data, _ := json.Marshal(v)
+		cells[column] = string(data)
+	case nil:
+		cells[column] = ""
+	case string:
+		cells[column] = v
+	default:
+		cells[column] = fmt.Sprint(v)
+	}
+}
+
+// writeFileAtomic writes a file through a temporary file in the same
+// directory, so readers never see a partial snapshot
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Reward percentiles requested from eth_feeHistory for the slow/standard/fast tiers
+var feeTierPercentiles = []float64{10, 50, 90}
+
+// Monitor fee history and publish fee suggestions
+func (dt *SomniaStream) monitorFeeSuggestions(ctx context.Context) {
+	dt.runMonitor(ctx, "fees", dt.publishFeeSuggestions)
+}
+
+// Publish percentile-based EIP-1559 fee recommendations derived from eth_feeHistory
+func (dt *SomniaStream) publishFeeSuggestions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	history, err := dt.ethClient.FeeHistory(ctx, uint64(dt.config().FeeHistoryBlocks), nil, feeTierPercentiles)
+	if err != nil {
+		log.Printf("[FEES] ERROR: Failed to fetch fee history: %v", err)
+		return err
+	}
+	if len(history.BaseFee) == 0 {
+		return fmt.Errorf("fee history returned no base fees")
+	}
+
+	// The last entry is the base fee of the next (not yet produced) block
+	nextBaseFee := history.BaseFee[len(history.BaseFee)-1]
+
+	tiers := map[string]interface{}{}
+	for i, name := range []string{"slow", "standard", "fast"} {
+		priorityFee := medianReward(history.Reward, i)
+		// Leave headroom for the base fee doubling over the next blocks
+		maxFee := new(big.Int).Add(new(big.Int).Mul(nextBaseFee, big.NewInt(2)), priorityFee)
+
+		tiers[name] = map[string]interface{}{
+			"percentile":           feeTierPercentiles[i],
+			"maxPriorityFeePerGas": priorityFee.String(),
+			"maxFeePerGas":         maxFee.String(),
+			"maxFeePerGasGwei":     weiToGwei(maxFee),
+		}
+	}
+
+	var avgGasUsedRatio float64
+	for _, ratio := range history.GasUsedRatio {
+		avgGasUsedRatio += ratio
+	}
+	if len(history.GasUsedRatio) > 0 {
+		avgGasUsedRatio /= float64(len(history.GasUsedRatio))
+	}
+
+	suggestions := map[string]interface{}{
+		"baseFeePerGas":   nextBaseFee.String(),
+		"baseFeeGwei":     weiToGwei(nextBaseFee),
+		"oldestBlock":     history.OldestBlock.String(),
+		"blockCount":      len(history.GasUsedRatio),
+		"gasUsedRatioAvg": avgGasUsedRatio,
+		"slow":            tiers["slow"],
+		"standard":        tiers["standard"],
+		"fast":            tiers["fast"],
+		"timestamp":       time.Now().Unix(),
+	}
+
+	data, _ := json.Marshal(suggestions)
+	err = dt.publish("eth.fees.suggestions", data)
+	return err
+}
+
+// Median of the reward at index i across all blocks in the fee history
+func medianReward(rewards [][]*big.Int, i int) *big.Int {
+	values := make([]*big.Int, 0, len(rewards))
+	for _, blockRewards := range rewards {
+		if i < len(blockRewards) && blockRewards[i] != nil {
+			values = append(values, blockRewards[i])
+		}
+	}
+	if len(values) == 0 {
+		return big.NewInt(0)
+	}
+
+	sort.Slice(values, func(a, b int) bool { return values[a].Cmp(values[b]) < 0 })
+	return new(big.Int).Set(values[len(values)/2])
+}
+
+// Convert a wei amount to gwei as a float for display purposes
+func weiToGwei(wei *big.Int) float64 {
+	gwei, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e9)).Float64()
+	return gwei
+}
+
+// Publish the base fee of a block with effective priority fee statistics taken
+// from its receipts (or derived from the transactions if receipts are missing)
+func (dt *SomniaStream) publishBaseFee(block *types.Block, receipts []*types.Receipt) error {
+	baseFee := block.BaseFee()
+
+	tips := make([]*big.Int, 0, len(block.Transactions()))
+	if len(receipts) == len(block.Transactions()) && len(receipts) > 0 {
+		for _, receipt := range receipts {
+			if receipt.EffectiveGasPrice == nil {
+				continue
+			}
+			tip := new(big.Int).Sub(receipt.EffectiveGasPrice, baseFee)
+			if tip.Sign() < 0 {
+				tip.SetInt64(0)
+			}
+			tips = append(tips, tip)
+		}
+	} else {
+		for _, tx := range block.Transactions() {
+			if tip, err := tx.EffectiveGasTip(baseFee); err == nil {
+				tips = append(tips, tip)
+			}
+		}
+	}
+
+	series := map[string]interface{}{
+		"blockNumber":   block.NumberU64(),
+		"blockHash":     block.Hash().Hex(),
+		"baseFeePerGas": baseFee.String(),
+		"baseFeeGwei":   weiToGwei(baseFee),
+		"gasUsed":       block.GasUsed(),
+		"gasLimit":      block.GasLimit(),
+		"txCount":       len(block.Transactions()),
+		"blockTime":     block.Time(),
+		"timestamp":     time.Now().Unix(),
+	}
+
+	if len(tips) > 0 {
+		sort.Slice(tips, func(a, b int) bool { return tips[a].Cmp(tips[b]) < 0 })
+		sum := new(big.Int)
+		for _, tip := range tips {
+			sum.Add(sum, tip)
+		}
+		series["priorityFee"] = map[string]interface{}{
+			"min":    tips[0].String(),
+			"median": tips[len(tips)/2].String(),
+			"max":    tips[len(tips)-1].String(),
+			"avg":    new(big.Int).Div(sum, big.NewInt(int64(len(tips)))).String(),
+		}
+	}
+
+	data, _ := json.Marshal(series)
+	err := dt.publish("eth.fees.basefee", data)
+	return err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gasHistorySources maps the ?source= parameter to a subject and the gwei field to read
+var gasHistorySources = map[string]struct {
+	subject string
+	field   string
+}{
+	"gasPrice": {subject: "eth.gasPrice", field: "gwei"},
+	"basefee":  {subject: "eth.fees.basefee", field: "baseFeeGwei"},
+}
+
+// Handle GET /gas/history?window=1h&percentiles=25,50,95[&interval=5m][&source=gasPrice|basefee]
+func (dt *SomniaStream) handleGasHistory(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "1h"))
+	if err != nil || window <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window"})
+		return
+	}
+
+	percentiles, err := parsePercentiles(c.DefaultQuery("percentiles", "25,50,95"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var interval time.Duration
+	if raw := c.Query("interval"); raw != "" {
+		interval, err = time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval"})
+			return
+		}
+	}
+
+	sourceName := c.DefaultQuery("source", "gasPrice")
+	source, ok := gasHistorySources[sourceName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown source, expected gasPrice or basefee"})
+		return
+	}
+
+	since := time.Now().Add(-window)
+	msgs, err := dt.readStreamHistory(source.subject, since, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	type sample struct {
+		at    time.Time
+		value float64
+	}
+	samples := make([]sample, 0, len(msgs))
+	for _, msg := range msgs {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			continue
+		}
+		value, ok := payload[source.field].(float64)
+		if !ok {
+			continue
+		}
+		samples = append(samples, sample{at: msg.Published, value: value})
+	}
+
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = s.value
+	}
+
+	response := gin.H{
+		"source":      sourceName,
+		"window":      window.String(),
+		"from":        since.Unix(),
+		"to":          time.Now().Unix(),
+		"samples":     len(samples),
+		"unit":        "gwei",
+		"percentiles": computePercentiles(values, percentiles),
+	}
+
+	if interval > 0 {
+		var series []gin.H
+		for start := since.Truncate(interval); start.Before(time.Now()); start = start.Add(interval) {
+			var bucket []float64
+			for _, s := range samples {
+				if !s.at.Before(start) && s.at.Before(start.Add(interval)) {
+					bucket = append(bucket, s.value)
+				}
+			}
+			if len(bucket) == 0 {
+				continue
+			}
+			series = append(series, gin.H{
+				"start":       start.Unix(),
+				"samples":     len(bucket),
+				"percentiles": computePercentiles(bucket, percentiles),
+			})
+		}
+		response["interval"] = interval.String()
+		response["series"] = series
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// parsePercentiles parses a list like "25,50,95"
+func parsePercentiles(value string) ([]float64, error) {
+	var percentiles []float64
+	for _, part := range strings.Split(value, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q, expected values between 0 and 100", part)
+		}
+		percentiles = append(percentiles, p)
+	}
+	return percentiles, nil
+}
+
+// computePercentiles returns linearly interpolated percentiles keyed like "p50"
+func computePercentiles(values []float64, percentiles []float64) map[string]float64 {
+	result := make(map[string]float64, len(percentiles))
+	if len(values) == 0 {
+		return result
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	for _, p := range percentiles {
+		rank := p / 100 * float64(len(sorted)-1)
+		lower, upper := int(math.Floor(rank)), int(math.Ceil(rank))
+		value := sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+		result["p"+strconv.FormatFloat(p, 'f', -1, 64)] = value
+	}
+	return result
+}
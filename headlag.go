@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"somnia-stream/pkg/streams"
+)
+
+// rpcPeer is an RPC endpoint queried only to compare head blocks
+type rpcPeer struct {
+	endpoint string // Host, as used in metric labels
+	client   *rpc.Client
+}
+
+// endpointHead is the head block reported by one endpoint
+type endpointHead struct {
+	Endpoint  string  `json:"endpoint"`
+	Active    bool    `json:"active"`
+	Head      uint64  `json:"head,omitempty"`
+	Lag       uint64  `json:"lag"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// headLagMonitor compares the head block of the active RPC endpoint with its
+// peers and remembers whether the active endpoint is lagging
+type headLagMonitor struct {
+	peers []rpcPeer
+
+	mu      sync.Mutex
+	lagging bool
+
+	head *prometheus.GaugeVec
+	lag  *prometheus.GaugeVec
+}
+
+// newHeadLagMonitor connects to the peer endpoints. Peers that can't be dialed
+// are skipped so a broken peer never prevents startup.
+func newHeadLagMonitor(endpoints []string, registry *prometheus.Registry) *headLagMonitor {
+	m := &headLagMonitor{
+		head: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "somnia_rpc_head_block",
+			Help: "Latest block number reported by each RPC endpoint.",
+		}, []string{"endpoint", "active"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "somnia_rpc_head_lag_blocks",
+			Help: "Blocks each RPC endpoint is behind the highest reported head.",
+		}, []string{"endpoint", "active"}),
+	}
+	registry.MustRegister(m.head, m.lag)
+
+	for _, endpoint := range endpoints {
+		client, err := dialPeerRPC(endpoint)
+		if err != nil {
+			log.Printf("[HEADLAG] WARNING: Skipping RPC peer %s: %v", endpointHost(endpoint), err)
+			continue
+		}
+		m.peers = append(m.peers, rpcPeer{endpoint: endpointHost(endpoint), client: client})
+	}
+	return m
+}
+
+// dialPeerRPC connects to a secondary RPC endpoint. Peers bypass the retry
+// transport and circuit breaker so they never affect the active endpoint.
+func dialPeerRPC(endpoint string) (*rpc.Client, error) {
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return rpc.DialOptions(context.Background(), endpoint, rpc.WithHTTPClient(&http.Client{Timeout: 10 * time.Second}))
+	}
+	return rpc.Dial(endpoint)
+}
+
+// setLagging records the lag state and reports whether it changed
+func (m *headLagMonitor) setLagging(lagging bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := m.lagging != lagging
+	m.lagging = lagging
+	return changed
+}
+
+// fetchHead returns the head block reported by a client
+func fetchHead(ctx context.Context, client *rpc.Client, endpoint string, active bool) endpointHead {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result := endpointHead{Endpoint: endpoint, Active: active}
+	start := time.Now()
+	var head hexutil.Uint64
+	err := client.CallContext(ctx, &head, "eth_blockNumber")
+	result.LatencyMs = millis(time.Since(start))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Head = uint64(head)
+	return result
+}
+
+// Periodically compare the head blocks of the active endpoint and its peers
+func (dt *SomniaStream) runHeadLag(ctx context.Context) {
+	if len(dt.headLag.peers) == 0 {
+		return
+	}
+	log.Printf("[HEADLAG] Comparing head blocks with %d RPC peers", len(dt.headLag.peers))
+
+	ticker := time.NewTicker(dt.config().HeadLagInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dt.compareHeads(ctx)
+		}
+	}
+}
+
+// compareHeads queries every endpoint concurrently, publishes the heads and
+// lag on somnia.rpc.headlag and raises a system event when the active
+// endpoint falls more than HEAD_LAG_THRESHOLD blocks behind its peers
+func (dt *SomniaStream) compareHeads(ctx context.Context) {
+	heads := make([]endpointHead, len(dt.headLag.peers)+1)
+	var wg sync.WaitGroup
+	wg.Add(len(heads))
+	go func() {
+		defer wg.Done()
+		heads[0] = fetchHead(ctx, dt.rpcClient, dt.telemetry.endpoint, true)
+	}()
+	for i, peer := range dt.headLag.peers {
+		go func(i int, peer rpcPeer) {
+			defer wg.Done()
+			heads[i+1] = fetchHead(ctx, peer.client, peer.endpoint, false)
+		}(i, peer)
+	}
+	wg.Wait()
+
+	var highest, lowest uint64
+	for _, h := range heads {
+		if h.Error != "" {
+			continue
+		}
+		if h.Head > highest {
+			highest = h.Head
+		}
+		if lowest == 0 || h.Head < lowest {
+			lowest = h.Head
+		}
+	}
+	if highest == 0 {
+		log.Printf("[HEADLAG] ERROR: No endpoint reported a head block")
+		return
+	}
+	for i := range heads {
+		h := &heads[i]
+		active := fmt.Sprint(h.Active)
+		if h.Error != "" {
+			dt.headLag.head.DeleteLabelValues(h.Endpoint, active)
+			dt.headLag.lag.DeleteLabelValues(h.Endpoint, active)
+			continue
+		}
+		h.Lag = highest - h.Head
+		dt.headLag.head.WithLabelValues(h.Endpoint, active).Set(float64(h.Head))
+		dt.headLag.lag.WithLabelValues(h.Endpoint, active).Set(float64(h.Lag))
+	}
+
+	activeHead := heads[0]
+	event := map[string]interface{}{
+		"endpoints":  heads,
+		"highest":    highest,
+		"divergence": highest - lowest,
+		"activeLag":  activeHead.Lag,
+		"timestamp":  time.Now().Unix(),
+	}
+	data, _ := json.Marshal(event)
+	if err := dt.publish(streams.HeadLagSubject, data); err != nil {
+		log.Printf("[HEADLAG] ERROR: Failed to publish head lag: %v", err)
+	}
+
+	threshold := dt.config().HeadLagThreshold
+	if activeHead.Error != "" || threshold <= 0 {
+		return
+	}
+	lagging := activeHead.Lag > uint64(threshold)
+	if !dt.headLag.setLagging(lagging) {
+		return
+	}
+	fields := map[string]interface{}{
+		"endpoint": activeHead.Endpoint,
+		"head":     activeHead.Head,
+		"highest":  highest,
+		"lag":      activeHead.Lag,
+	}
+	if lagging {
+		log.Printf("[HEADLAG] Active RPC endpoint is %d blocks behind its peers (head %d, highest %d)", activeHead.Lag, activeHead.Head, highest)
+		dt.publishSystemEvent("rpc_head_lag", severityWarning, fmt.Sprintf("active RPC endpoint is %d blocks behind its peers", activeHead.Lag), fields)
+	} else {
+		log.Printf("[HEADLAG] Active RPC endpoint caught up with its peers")
+		dt.publishSystemEvent("rpc_head_lag_recovered", severityInfo, "active RPC endpoint caught up with its peers", fields)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/streams"
+)
+
+// healthCheckTimeout bounds the RPC and JetStream calls made by GET /health
+const healthCheckTimeout = 5 * time.Second
+
+// Component states reported by GET /health
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// Handle GET /health reporting RPC, NATS, JetStream and monitor status. The
+// response is 503 when any component is not ok.
+func (dt *SomniaStream) handleHealth(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	components := gin.H{
+		"rpc":       dt.rpcHealth(ctx),
+		"nats":      dt.natsHealth(),
+		"jetstream": dt.jetStreamHealth(ctx),
+		"monitors":  dt.monitorHealth(),
+	}
+	if len(dt.plugins) > 0 {
+		components["plugins"] = dt.pluginHealth()
+	}
+
+	status, code := healthOK, http.StatusOK
+	for _, component := range components {
+		if component.(gin.H)["status"] != healthOK {
+			status, code = healthDegraded, http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status":     status,
+		"components": components,
+		"timestamp":  time.Now().Unix(),
+	})
+}
+
+// rpcHealth checks that the RPC endpoint answers and that its head is recent
+func (dt *SomniaStream) rpcHealth(ctx context.Context) gin.H {
+	circuit, _ := dt.rpcRetry.breaker.status()
+	start := time.Now()
+	header, err := dt.ethClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return gin.H{"status": healthDown, "error": err.Error(), "circuit": circuit}
+	}
+
+	headAge := time.Since(time.Unix(int64(header.Time), 0))
+	result := gin.H{
+		"status":  healthOK,
+		"head":    header.Number.Uint64(),
+		"headAge": headAge.Round(time.Millisecond).String(),
+		"latency": time.Since(start).Round(time.Millisecond).String(),
+		"circuit": circuit,
+	}
+	if maxAge := dt.config().HealthMaxHeadAge; maxAge > 0 && headAge > maxAge {
+		result["status"] = healthDegraded
+		result["error"] = "chain head is older than " + maxAge.String()
+	}
+	return result
+}
+
+// natsHealth reports the NATS connection state
+func (dt *SomniaStream) natsHealth() gin.H {
+	if !dt.natsConn.IsConnected() {
+		return gin.H{"status": healthDown, "state": dt.natsConn.Status().String()}
+	}
+	return gin.H{"status": healthOK, "server": dt.natsConn.ConnectedUrlRedacted()}
+}
+
+// jetStreamHealth checks that every built-in stream exists
+func (dt *SomniaStream) jetStreamHealth(ctx context.Context) gin.H {
+	specs := dt.ns.Specs(streams.Specs(dt.config().RollupRetention))
+	var missing []string
+	for _, spec := range specs {
+		if _, err := dt.js.StreamInfo(spec.Name, nats.Context(ctx)); err != nil {
+			missing = append(missing, spec.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return gin.H{"status": healthDown, "missing": missing}
+	}
+	return gin.H{"status": healthOK, "streams": len(specs)}
+}
+
+// monitorHealth reports the last successful run of every monitor. A running
+// monitor is stale when it hasn't succeeded within three poll intervals.
+func (dt *SomniaStream) monitorHealth() gin.H {
+	status := healthOK
+	monitors := gin.H{}
+	for _, m := range dt.monitors.List() {
+		state := healthOK
+		interval, _ := time.ParseDuration(m.Interval)
+		staleAfter := max(3*interval, 30*time.Second)
+		switch {
+		case m.Paused:
+			state = "paused"
+		case m.Runs == 0:
+			state = "starting"
+		case m.LastSuccess == 0 || time.Since(time.Unix(m.LastSuccess, 0)) > staleAfter:
+			state = "stale"
+			status = healthDegraded
+		}
+
+		entry := gin.H{"status": state}
+		if m.LastSuccess != 0 {
+			entry["lastSuccess"] = m.LastSuccess
+		}
+		if m.LastError != "" {
+			entry["lastError"] = m.LastError
+		}
+		monitors[m.Name] = entry
+	}
+	return gin.H{"status": status, "monitors": monitors}
+}
+
+// pluginHealth reports the Health of every plugin monitor
+func (dt *SomniaStream) pluginHealth() gin.H {
+	status := healthOK
+	plugins := gin.H{}
+	for _, plugin := range dt.plugins {
+		if err := plugin.instance.Health(); err != nil {
+			status = healthDegraded
+			plugins[plugin.name] = gin.H{"status": healthDegraded, "error": err.Error()}
+			continue
+		}
+		plugins[plugin.name] = gin.H{"status": healthOK}
+	}
+	return gin.H{"status": status, "plugins": plugins}
+}
+
+// readiness records the startup milestones /readyz waits for
+type readiness struct {
+	jetStream  atomic.Bool // Streams, KV buckets and derived streams are set up
+	firstBlock atomic.Bool // A block has been fetched from RPC and published
+}
+
+// Handle GET /healthz: the process is alive and serving HTTP
+func (dt *SomniaStream) handleLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Handle GET /readyz: JetStream is initialized, NATS is connected and the
+// first block has been published. Returns 503 until then.
+func (dt *SomniaStream) handleReadiness(c *gin.Context) {
+	checks := gin.H{
+		"jetstream":  dt.ready.jetStream.Load(),
+		"nats":       dt.natsConn.IsConnected(),
+		"firstBlock": dt.ready.firstBlock.Load(),
+	}
+	for _, ok := range checks {
+		if !ok.(bool) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "checks": checks})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
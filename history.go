@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// maxHistoryMessages caps how many stored messages a single history read returns
+const maxHistoryMessages = 50000
+
+// historyMessage is a stored message read from JetStream or the archive
+type historyMessage struct {
+	Subject   string // Without the subject namespace
+	Seq       uint64
+	Published time.Time
+	Header    nats.Header
+	Data      []byte
+}
+
+// Read stored messages on a subject published since the given time. Messages
+// older than what JetStream still holds are read from the archive when the
+// subject is archived.
+func (dt *SomniaStream) readStreamHistory(subject string, since time.Time, limit int) ([]historyMessage, error) {
+	if limit <= 0 || limit > maxHistoryMessages {
+		limit = maxHistoryMessages
+	}
+
+	var msgs []historyMessage
+	if hot := dt.hotWindowStart(subject); dt.archive != nil && since.Before(hot) {
+		archived, err := dt.archive.read(subject, since, hot, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archived %s messages: %v", subject, err)
+		}
+		msgs = archived
+		if len(msgs) >= limit {
+			return msgs[:limit], nil
+		}
+	}
+	stored, err := dt.readStreamRange(subject, since, time.Time{}, limit-len(msgs))
+	return append(msgs, stored...), err
+}
+
+// hotWindowStart returns the publish time of the oldest message JetStream
+// still holds in the stream of a subject, or now when it is empty
+func (dt *SomniaStream) hotWindowStart(subject string) time.Time {
+	name, err := dt.js.StreamNameBySubject(dt.ns.Subject(subject))
+	if err != nil {
+		return time.Time{}
+	}
+	info, err := dt.js.StreamInfo(name)
+	if err != nil {
+		return time.Time{}
+	}
+	if info.State.Msgs == 0 {
+		return time.Now()
+	}
+	return info.State.FirstTime
+}
+
+// readStreamRangeAll reads every stored message on a subject published
+// between since and until, in pages of maxHistoryMessages
+func (dt *SomniaStream) readStreamRangeAll(subject string, since, until time.Time) ([]historyMessage, error) {
+	var msgs []historyMessage
+	for {
+		page, err := dt.readStreamRange(subject, since, until, maxHistoryMessages)
+		if err != nil {
+			return nil, err
+		}
+		// Pages resume at the publish time of the last message, so messages
+		// sharing it are read again
+		added := 0
+		for _, msg := range page {
+			if len(msgs) == 0 || msg.Seq > msgs[len(msgs)-1].Seq {
+				msgs = append(msgs, msg)
+				added++
+			}
+		}
+		if len(page) < maxHistoryMessages {
+			return msgs, nil
+		}
+		if added == 0 {
+			return nil, fmt.Errorf("more than %d %s messages published at %s", maxHistoryMessages, subject, since.UTC().Format(time.RFC3339Nano))
+		}
+		since = msgs[len(msgs)-1].Published
+	}
+}
+
+// Read stored messages on a subject published between since and until (no
+// end when zero) from JetStream, using a short-lived ordered consumer so no
+// server-side state is left behind
+func (dt *SomniaStream) readStreamRange(subject string, since, until time.Time, limit int) ([]historyMessage, error) {
+	sub, err := dt.js.SubscribeSync(dt.ns.Subject(subject), nats.OrderedConsumer(), nats.StartTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	var msgs []historyMessage
+	for len(msgs) < limit {
+		msg, err := sub.NextMsg(2 * time.Second)
+		if err == nats.ErrTimeout {
+			break // Nothing stored in the requested range
+		}
+		if err != nil {
+			return msgs, err
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			break
+		}
+		if !until.IsZero() && !meta.Timestamp.Before(until) {
+			break
+		}
+		msgs = append(msgs, historyMessage{
+			Subject:   dt.ns.TrimSubject(msg.Subject),
+			Seq:       meta.Sequence.Stream,
+			Published: meta.Timestamp,
+			Header:    msg.Header,
+			Data:      msg.Data,
+		})
+		if meta.NumPending == 0 {
+			break
+		}
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	wasmapi "github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"somnia-stream/pkg/config"
+)
+
+// wasmPagesPerMB is the number of 64 KiB WebAssembly memory pages in a MiB
+const wasmPagesPerMB = 16
+
+// wasmInstantiateTimeout bounds starting a module instance, which runs its
+// _initialize export
+const wasmInstantiateTimeout = 10 * time.Second
+
+// publishHooks runs the WebAssembly modules of PUBLISH_WASM_HOOKS over
+// messages before they are published, so deployments can enrich or filter
+// payloads without a custom build. Modules run in wazero with WASI but no
+// files, environment, real clock or network, and with PUBLISH_WASM_MEMORY_MB
+// of memory and PUBLISH_WASM_TIMEOUT per message.
+type publishHooks struct {
+	mu      sync.RWMutex // Held for reading while a message is in a module
+	runtime wazero.Runtime
+	hooks   map[string]*wasmHook // By subject
+}
+
+func newPublishHooks() *publishHooks {
+	return &publishHooks{hooks: make(map[string]*wasmHook)}
+}
+
+// wasmHook is the module of one stream. Its instance handles one message at
+// a time and is replaced after a trap or timeout.
+type wasmHook struct {
+	stream   string
+	timeout  time.Duration
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+
+	mu       sync.Mutex
+	instance wasmapi.Module // Nil until the next message after a failure
+}
+
+// loadPublishHooks compiles the modules of PUBLISH_WASM_HOOKS into a new
+// runtime, replacing the loaded ones. Nothing changes when a module doesn't
+// load; no modules remove every hook.
+func (dt *SomniaStream) loadPublishHooks(cfg *config.Config) error {
+	ctx := context.Background()
+	hooks := make(map[string]*wasmHook)
+	var runtime wazero.Runtime
+	if len(cfg.PublishWasmHooks) > 0 {
+		runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+			WithMemoryLimitPages(uint32(max(cfg.PublishWasmMemoryMB, 1)*wasmPagesPerMB)).
+			WithCloseOnContextDone(true))
+		if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+			runtime.Close(ctx)
+			return fmt.Errorf("failed to start the WASM runtime: %v", err)
+		}
+		for name, file := range cfg.PublishWasmHooks {
+			subject, ok := dt.streams.lookup(name)
+			if !ok {
+				runtime.Close(ctx)
+				return fmt.Errorf("publish hook for unknown stream %q", name)
+			}
+			hook, err := compileWasmHook(ctx, runtime, name, file, cfg.PublishWasmTimeout)
+			if err != nil {
+				runtime.Close(ctx)
+				return fmt.Errorf("publish hook for %s: %v", name, err)
+			}
+			hooks[subject] = hook
+		}
+		log.Printf("[HOOKS] Loaded %d WASM publish hooks", len(hooks))
+	}
+
+	// Swapping waits for the messages in the replaced modules
+	dt.hooks.mu.Lock()
+	previous := dt.hooks.runtime
+	dt.hooks.runtime, dt.hooks.hooks = runtime, hooks
+	dt.hooks.mu.Unlock()
+	if previous != nil {
+		previous.Close(ctx)
+	}
+	return nil
+}
+
+// compileWasmHook compiles a module file and starts its first instance, so
+// broken modules are reported when they load rather than on the first message
+func compileWasmHook(ctx context.Context, runtime wazero.Runtime, stream, file string, timeout time.Duration) (*wasmHook, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := runtime.CompileModule(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	exports := compiled.ExportedFunctions()
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok || exports["alloc"] == nil || exports["transform"] == nil {
+		return nil, fmt.Errorf("%s must export memory, alloc and transform", file)
+	}
+	hook := &wasmHook{stream: stream, timeout: timeout, runtime: runtime, compiled: compiled}
+	if err := hook.instantiate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return hook, nil
+}
+
+// apply runs the hook of a subject over a payload. It reports false when the
+// module drops the message, and an error when the module fails on it.
+func (h *publishHooks) apply(subject string, data []byte) ([]byte, bool, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	hook := h.hooks[subject]
+	if hook == nil {
+		return data, true, nil
+	}
+	transformed, err := hook.run(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("publish hook for %s: %v", hook.stream, err)
+	}
+	return transformed, transformed != nil, nil
+}
+
+// instantiate starts a fresh module instance
+func (w *wasmHook) instantiate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), wasmInstantiateTimeout)
+	defer cancel()
+	instance, err := w.runtime.InstantiateModule(ctx, w.compiled, wazero.NewModuleConfig().
+		WithName(""). // Every hook and restart gets its own anonymous instance
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return err
+	}
+	w.instance = instance
+	return nil
+}
+
+// run passes a message through the module, returning nil when it's dropped
+func (w *wasmHook) run(data []byte) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.instance == nil {
+		if err := w.instantiate(); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	transformed, err := w.call(ctx, data)
+	if err != nil {
+		// A trap or timeout may leave the instance in any state
+		w.instance.Close(context.Background())
+		w.instance = nil
+	}
+	return transformed, err
+}
+
+// call copies a message into the instance with alloc(len) and hands it to
+// transform(ptr, len), which returns the result as ptr<<32 | len, or 0 to
+// drop the message
+func (w *wasmHook) call(ctx context.Context, data []byte) ([]byte, error) {
+	results, err := w.instance.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(results[0])
+	if !w.instance.Memory().Write(ptr, data) {
+		return nil, errors.New("alloc returned a buffer outside memory")
+	}
+	results, err = w.instance.ExportedFunction("transform").Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if results[0] == 0 {
+		return nil, nil
+	}
+	out, ok := w.instance.Memory().Read(uint32(results[0]>>32), uint32(results[0]))
+	if !ok {
+		return nil, errors.New("transform returned a result outside memory")
+	}
+	if !json.Valid(out) {
+		return nil, errors.New("transform returned invalid JSON")
+	}
+	return bytes.Clone(out), nil // out is a view of the instance's memory
+}
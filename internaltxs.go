@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// traceFrame is a call of a callTracer trace
+type traceFrame struct {
+	Type    string       `json:"type"`
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Value   string       `json:"value"`
+	GasUsed string       `json:"gasUsed"`
+	Input   string       `json:"input"`
+	Error   string       `json:"error"`
+	Calls   []traceFrame `json:"calls"`
+}
+
+// internalTxs flattens the subcalls of a transaction's call tree into
+// internal transactions. Nothing below a STATICCALL can move value or change
+// state, so those subtrees are left out. traceAddress is the path of child
+// indexes from the top level call, as in Parity-style traces.
+func internalTxs(txHash string, frame traceFrame, traceAddress []int, txs []map[string]interface{}) []map[string]interface{} {
+	for i, call := range frame.Calls {
+		if call.Type == "STATICCALL" {
+			continue
+		}
+		address := append(append([]int{}, traceAddress...), i)
+		value := "0"
+		if v, err := hexutil.DecodeBig(call.Value); err == nil {
+			value = v.String()
+		}
+		tx := map[string]interface{}{
+			"txHash":       txHash,
+			"type":         strings.ToLower(call.Type),
+			"from":         call.From,
+			"to":           call.To,
+			"value":        value,
+			"depth":        len(address),
+			"traceAddress": address,
+			"success":      call.Error == "",
+		}
+		if gasUsed, err := hexutil.DecodeUint64(call.GasUsed); err == nil {
+			tx["gasUsed"] = gasUsed
+		}
+		if len(call.Input) >= 10 && !strings.HasPrefix(call.Type, "CREATE") {
+			tx["methodId"] = strings.ToLower(call.Input[:10])
+		}
+		if call.Error != "" {
+			tx["error"] = call.Error
+		}
+		txs = append(txs, tx)
+		txs = internalTxs(txHash, call, address, txs)
+	}
+	return txs
+}
+
+// publishInternalTxs publishes the internal transactions of a block's
+// callTracer traces on eth.tx.internal
+func (dt *SomniaStream) publishInternalTxs(number uint64, traces []blockTrace, limit int) error {
+	var txs []map[string]interface{}
+	for _, trace := range traces {
+		var frame traceFrame
+		if err := json.Unmarshal(trace.Result, &frame); err != nil {
+			log.Printf("[INTERNAL] WARNING: Failed to decode trace of %s: %v", trace.TxHash, err)
+			continue
+		}
+		txs = internalTxs(trace.TxHash, frame, nil, txs)
+	}
+	if len(txs) == 0 {
+		return nil
+	}
+	dt.names.annotate(txs, "from", "to")
+	dt.selectors.annotate(txs)
+
+	base := map[string]interface{}{
+		"blockNumber": number,
+		"count":       len(txs),
+		"timestamp":   time.Now().Unix(),
+	}
+	if err := dt.publishCapped("eth.tx.internal", base, "internal", txs, limit); err != nil {
+		log.Printf("[INTERNAL] ERROR: Failed to publish internal transactions of block %d: %v", number, err)
+		return err
+	}
+	log.Printf("[INTERNAL] Published %d internal transactions of block %d", len(txs), number)
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jwtClaimsContextKey is the gin context key holding validated jwt.MapClaims
+const jwtClaimsContextKey = "jwtClaims"
+
+// jwksMinRefresh rate-limits JWKS refetches triggered by unknown key IDs
+const jwksMinRefresh = time.Minute
+
+// jwksCache holds the public keys of the configured JWKS endpoint by key ID
+type jwksCache struct {
+	mu        sync.Mutex
+	url       string
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{url: url, keys: make(map[string]interface{})}
+}
+
+// key returns the public key for a key ID, refreshing the set when it is
+// stale or the ID is unknown (e.g. after the identity provider rotated keys)
+func (j *jwksCache) key(kid string, maxAge time.Duration) (interface{}, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, ok := j.keys[kid]
+	stale := time.Since(j.fetchedAt) > maxAge
+	if ok && !stale {
+		return key, nil
+	}
+	if stale || time.Since(j.fetchedAt) > jwksMinRefresh {
+		if err := j.refresh(); err != nil {
+			if ok {
+				log.Printf("[AUTH] JWKS refresh failed, using cached keys: %v", err)
+				return key, nil
+			}
+			return nil, err
+		}
+		if key, ok = j.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refresh downloads and parses the key set; must be called with mu held
+func (j *jwksCache) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	log.Printf("[AUTH] Loaded %d signing keys from %s", len(keys), j.url)
+	return nil
+}
+
+// jwtEnabled reports whether JWT validation is configured
+func (dt *SomniaStream) jwtEnabled() bool {
+	cfg := dt.config()
+	return cfg.JWTJWKSURL != "" || cfg.JWTSecret != ""
+}
+
+// looksLikeJWT distinguishes compact JWTs from opaque API keys
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Validate a bearer JWT against the configured key source, issuer and audience
+func (dt *SomniaStream) validateJWT(token string) (jwt.MapClaims, error) {
+	cfg := dt.config()
+
+	methods := []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+	if cfg.JWTSecret != "" {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			return []byte(cfg.JWTSecret), nil
+		}
+		if dt.jwks == nil {
+			return nil, errors.New("no JWKS endpoint configured")
+		}
+		kid, _ := t.Header["kid"].(string)
+		return dt.jwks.key(kid, cfg.JWTJWKSRefresh)
+	}, jwt.WithValidMethods(methods))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.JWTIssuer != "" && !claims.VerifyIssuer(cfg.JWTIssuer, true) {
+		return nil, errors.New("unexpected issuer")
+	}
+	if cfg.JWTAudience != "" && !claims.VerifyAudience(cfg.JWTAudience, true) {
+		return nil, errors.New("unexpected audience")
+	}
+	return claims, nil
+}
+
+// jwtStreams returns the streams a token may access from the configured claim,
+// given either as a JSON array or a space separated string; "*" allows all
+func jwtStreams(claims jwt.MapClaims, claim string) []string {
+	switch v := claims[claim].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		streams := make([]string, 0, len(v))
+		for _, s := range v {
+			if name, ok := s.(string); ok {
+				streams = append(streams, name)
+			}
+		}
+		return streams
+	}
+	return nil
+}
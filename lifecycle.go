@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Transaction lifecycle states published on eth.tx.lifecycle
+const (
+	txStateSeen      = "seen"
+	txStateMined     = "mined"
+	txStateFinalized = "finalized"
+	txStateDropped   = "dropped"
+)
+
+// maxTrackedTxs bounds the lifecycle tracker so a flooded mempool cannot grow it forever
+const maxTrackedTxs = 50000
+
+// trackedTx is the lifecycle state of a single transaction
+type trackedTx struct {
+	Hash        string    `json:"hash"`
+	State       string    `json:"state"`
+	From        string    `json:"from,omitempty"`
+	Nonce       string    `json:"nonce,omitempty"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+	BlockNumber uint64    `json:"blockNumber,omitempty"`
+	BlockHash   string    `json:"blockHash,omitempty"`
+	MinedAt     time.Time `json:"minedAt,omitempty"`
+}
+
+// txLifecycleTracker correlates pending transactions with their inclusion in blocks
+type txLifecycleTracker struct {
+	mu            sync.Mutex
+	txs           map[string]*trackedTx
+	finalityDepth uint64
+	dropTimeout   time.Duration
+}
+
+func newTxLifecycleTracker(finalityDepth int, dropTimeout time.Duration) *txLifecycleTracker {
+	if finalityDepth < 0 {
+		finalityDepth = 0
+	}
+	if dropTimeout <= 0 {
+		dropTimeout = 5 * time.Minute
+	}
+	return &txLifecycleTracker{
+		txs:           make(map[string]*trackedTx),
+		finalityDepth: uint64(finalityDepth),
+		dropTimeout:   dropTimeout,
+	}
+}
+
+// reconfigure applies new finality depth and drop timeout values
+func (t *txLifecycleTracker) reconfigure(finalityDepth int, dropTimeout time.Duration) {
+	fresh := newTxLifecycleTracker(finalityDepth, dropTimeout)
+
+	t.mu.Lock()
+	t.finalityDepth = fresh.finalityDepth
+	t.dropTimeout = fresh.dropTimeout
+	t.mu.Unlock()
+}
+
+// depth returns the number of confirmations after which a transaction is final
+func (t *txLifecycleTracker) depth() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finalityDepth
+}
+
+// enroll starts tracking a hash and reports whether it was not tracked before
+func (t *txLifecycleTracker) enroll(hash, from, nonce string) (*trackedTx, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if tx, ok := t.txs[hash]; ok {
+		tx.LastSeen = now
+		return tx, false
+	}
+	if len(t.txs) >= maxTrackedTxs {
+		return nil, false
+	}
+
+	tx := &trackedTx{
+		Hash:      hash,
+		State:     txStateSeen,
+		From:      from,
+		Nonce:     nonce,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	t.txs[hash] = tx
+	return tx, true
+}
+
+// touch marks tracked transactions as still pending
+func (t *txLifecycleTracker) touch(hashes []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, hash := range hashes {
+		if tx, ok := t.txs[hash]; ok && tx.State == txStateSeen {
+			tx.LastSeen = now
+		}
+	}
+}
+
+// get returns a copy of the tracked state for a hash
+func (t *txLifecycleTracker) get(hash string) (trackedTx, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, ok := t.txs[hash]
+	if !ok {
+		return trackedTx{}, false
+	}
+	return *tx, true
+}
+
+// pendingFrom returns copies of the transactions of a sender still pending
+func (t *txLifecycleTracker) pendingFrom(from string) []trackedTx {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var pending []trackedTx
+	for _, tx := range t.txs {
+		if tx.State == txStateSeen && strings.EqualFold(tx.From, from) {
+			pending = append(pending, *tx)
+		}
+	}
+	return pending
+}
+
+// Record pending transactions and publish a "seen" event for new ones
+func (dt *SomniaStream) trackPendingLifecycle(pendingTxs []map[string]interface{}) {
+	for _, pending := range pendingTxs {
+		hash, _ := pending["hash"].(string)
+		if hash == "" {
+			continue
+		}
+		from, _ := pending["from"].(string)
+		nonce, _ := pending["nonce"].(string)
+
+		if tx, isNew := dt.lifecycle.enroll(hash, from, nonce); isNew {
+			dt.publishLifecycleEvent(*tx, nil)
+		}
+	}
+}
+
+// Advance tracked transactions with a newly observed block: mark included
+// transactions as mined, finalize deep enough ones and expire dropped ones
+func (dt *SomniaStream) trackBlockLifecycle(block *types.Block) {
+	head := block.NumberU64()
+	now := time.Now()
+	var events []trackedTx
+	var inclusion []time.Duration
+
+	dt.lifecycle.mu.Lock()
+	for _, tx := range block.Transactions() {
+		tracked, ok := dt.lifecycle.txs[tx.Hash().Hex()]
+		if !ok || tracked.State != txStateSeen {
+			continue
+		}
+		tracked.State = txStateMined
+		tracked.BlockNumber = head
+		tracked.BlockHash = block.Hash().Hex()
+		tracked.MinedAt = now
+		events = append(events, *tracked)
+		inclusion = append(inclusion, now.Sub(tracked.FirstSeen))
+	}
+
+	for hash, tracked := range dt.lifecycle.txs {
+		switch {
+		case tracked.State == txStateMined && head >= tracked.BlockNumber+dt.lifecycle.finalityDepth:
+			tracked.State = txStateFinalized
+			events = append(events, *tracked)
+			inclusion = append(inclusion, tracked.MinedAt.Sub(tracked.FirstSeen))
+			delete(dt.lifecycle.txs, hash)
+		case tracked.State == txStateSeen && now.Sub(tracked.LastSeen) > dt.lifecycle.dropTimeout:
+			tracked.State = txStateDropped
+			events = append(events, *tracked)
+			inclusion = append(inclusion, 0)
+			delete(dt.lifecycle.txs, hash)
+		}
+	}
+	dt.lifecycle.mu.Unlock()
+
+	for i, event := range events {
+		var extra map[string]interface{}
+		if event.State == txStateMined || event.State == txStateFinalized {
+			extra = map[string]interface{}{
+				"timeToInclusionMs": inclusion[i].Milliseconds(),
+				"confirmations":     head - event.BlockNumber + 1,
+			}
+		}
+		dt.publishLifecycleEvent(event, extra)
+	}
+}
+
+func (dt *SomniaStream) publishLifecycleEvent(tx trackedTx, extra map[string]interface{}) {
+	event := map[string]interface{}{
+		"hash":      tx.Hash,
+		"state":     tx.State,
+		"from":      tx.From,
+		"nonce":     tx.Nonce,
+		"firstSeen": tx.FirstSeen.Unix(),
+		"timestamp": time.Now().Unix(),
+	}
+	if tx.BlockNumber > 0 {
+		event["blockNumber"] = tx.BlockNumber
+		event["blockHash"] = tx.BlockHash
+	}
+	for k, v := range extra {
+		event[k] = v
+	}
+
+	data, _ := json.Marshal(event)
+	if err := dt.publish("eth.tx.lifecycle", data); err != nil {
+		log.Printf("[LIFECYCLE] ERROR: Failed to publish %s event for %s: %v", tx.State, tx.Hash, err)
+	}
+
+	status := tx.State
+	if status == txStateSeen {
+		status = txStatusPending
+	}
+	stored := map[string]interface{}{
+		"status":         status,
+		"lifecycleState": tx.State,
+		"firstSeen":      tx.FirstSeen.Unix(),
+	}
+	if tx.BlockNumber > 0 {
+		stored["blockNumber"] = tx.BlockNumber
+		stored["blockHash"] = tx.BlockHash
+	}
+	dt.updateTxStatus(tx.Hash, stored)
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"somnia-stream/pkg/monitor"
+)
+
+// Publish a payload whose list field may exceed limit, with OVERFLOW_MODE;
+// see monitor.PublishCapped
+func (dt *SomniaStream) publishCapped(subject string, base map[string]interface{}, field string, items []map[string]interface{}, limit int) error {
+	return monitor.PublishCapped(monitor.PublisherFunc(dt.publish), subject, base, field, items, limit, dt.config().OverflowMode)
+}
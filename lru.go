@@ -0,0 +1,84 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruEntry is a cached key and value
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// lruCache is a size-bounded map that evicts its least recently used entry
+// when full. A nil cache (size 0) caches nothing.
+type lruCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Most recently used first
+	entries map[K]*list.Element
+}
+
+// newLRUCache returns a cache of up to size entries, or nil when size <= 0
+func newLRUCache[K comparable, V any](size int) *lruCache[K, V] {
+	if size <= 0 {
+		return nil
+	}
+	return &lruCache[K, V]{size: size, order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+func (c *lruCache[K, V]) add(key K, value V) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (c *lruCache[K, V]) remove(key K) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+func (c *lruCache[K, V]) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
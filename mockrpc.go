@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/mockchain"
+)
+
+// startMockRPC serves a synthetic chain on MOCK_RPC_ADDR and points the RPC
+// endpoints of cfg at it. The returned function stops the chain and server.
+func startMockRPC(cfg *config.Config) (func(), error) {
+	chain, err := mockchain.New(mockchain.Options{
+		ChainID:       int64(cfg.MockChainID),
+		BlockInterval: cfg.MockBlockInterval,
+		TxsPerBlock:   cfg.MockTxsPerBlock,
+		LogsPerTx:     cfg.MockLogsPerTx,
+		FailureRate:   cfg.MockFailureRate,
+		Seed:          int64(cfg.MockSeed),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock chain settings: %v", err)
+	}
+	handler, err := chain.Handler()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", cfg.MockRPCAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for mock RPC on %s: %v", cfg.MockRPCAddr, err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[MOCK] RPC server stopped: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go chain.Run(ctx)
+
+	// Real providers would disagree with every synthetic block
+	if len(cfg.RPCPeerEndpoints) > 0 || cfg.ConsistencyEndpoint != "" {
+		log.Printf("[MOCK] Ignoring RPC_PEER_ENDPOINTS and CONSISTENCY_RPC_ENDPOINT in mock mode")
+	}
+	addr := listener.Addr().String()
+	cfg.RPCEndpoint = "http://" + addr
+	cfg.PendingWSEndpoint = "ws://" + addr
+	cfg.RPCPeerEndpoints = nil
+	cfg.ConsistencyEndpoint = ""
+	log.Printf("[MOCK] Serving a synthetic %s on %s", chain, addr)
+
+	return func() {
+		cancel()
+		shutdownCtx, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		_ = server.Shutdown(shutdownCtx)
+	}, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/monitor"
+)
+
+// pollInterval returns the configured tick interval for a monitor; monitors
+// of additional networks fall back to the interval of their base monitor
+func (dt *SomniaStream) pollInterval(name string) time.Duration {
+	cfg := dt.config()
+	chainName, name := splitMonitorName(name)
+	if chain, ok := cfg.Chain(chainName); ok {
+		if interval, ok := chain.PollIntervals[name]; ok && interval > 0 {
+			return interval
+		}
+	}
+	if interval, ok := cfg.PollIntervals[name]; ok && interval > 0 {
+		return interval
+	}
+	if interval, ok := config.DefaultPollIntervals[name]; ok {
+		return interval
+	}
+	return 10 * time.Second
+}
+
+// monitorDisabled reports whether a monitor was turned off in the configuration
+func (dt *SomniaStream) monitorDisabled(name string) bool {
+	cfg := dt.config()
+	for _, disabled := range cfg.DisabledMonitors {
+		if strings.EqualFold(disabled, name) {
+			return true
+		}
+	}
+	chainName, base := splitMonitorName(name)
+	if chain, ok := cfg.Chain(chainName); ok {
+		for _, disabled := range chain.DisabledMonitors {
+			if strings.EqualFold(disabled, base) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Run a monitor tick function on its configured interval until ctx is done,
+// honouring runtime pause/resume and interval changes from the admin API
+func (dt *SomniaStream) runMonitor(ctx context.Context, name string, tick func() error) {
+	dt.monitors.Run(ctx, name, dt.pollInterval(name), tick)
+}
+
+// applyMonitorConfig seeds monitor intervals and paused flags from the configuration
+func (dt *SomniaStream) applyMonitorConfig() {
+	for _, status := range dt.monitors.List() {
+		dt.monitors.Configure(status.Name, dt.pollInterval(status.Name), dt.monitorDisabled(status.Name))
+	}
+}
+
+// monitorSkipped pauses the monitors of a network while its RPC circuit is
+// open; the breaker probes on its own
+func (dt *SomniaStream) monitorSkipped(name string) bool {
+	breaker := dt.rpcRetry.breaker
+	if chainName, _ := splitMonitorName(name); chainName != "" {
+		if chain, ok := dt.chain(chainName); ok {
+			breaker = chain.rpcRetry.breaker
+		}
+	}
+	_, rpcDown := breaker.status()
+	return rpcDown
+}
+
+// Only failure/recovery transitions go to somnia.system, not every failed tick
+func (dt *SomniaStream) monitorFailed(name string, err error) {
+	dt.publishSystemEvent("monitor_error", severityError, err.Error(), map[string]interface{}{"monitor": name})
+}
+
+func (dt *SomniaStream) monitorRecovered(name string) {
+	dt.publishSystemEvent("monitor_recovered", severityInfo, name+" monitor recovered", map[string]interface{}{"monitor": name})
+}
+
+// chainOptions returns the settings of the block, pending and log monitors
+func chainOptions(cfg *config.Config) monitor.Options {
+	return monitor.Options{
+		BlockDetailLevels:       cfg.BlockDetailLevels,
+		BlockCatchupMax:         cfg.BlockCatchupMax,
+		BlockFetchWorkers:       cfg.BlockFetchWorkers,
+		BackfillMaxGap:          cfg.CheckpointMaxGap,
+		LogsChunkSize:           cfg.LogsChunkSize,
+		LogsMaxPerMessage:       cfg.LogsMaxPerMessage,
+		PendingMaxTxs:           cfg.PendingMaxTxs,
+		PendingSnapshotInterval: pendingSnapshotInterval(cfg),
+		PendingHydrateWorkers:   cfg.PendingHydrateWorkers,
+		OverflowMode:            cfg.OverflowMode,
+	}
+}
+
+// pendingSnapshotInterval returns PENDING_SNAPSHOT_INTERVAL, or the resync
+// interval when it is 0 in subscription mode
+func pendingSnapshotInterval(cfg *config.Config) time.Duration {
+	if cfg.PendingSnapshotInterval <= 0 && cfg.PendingSubscription {
+		return monitor.PendingSubscriptionResync
+	}
+	return cfg.PendingSnapshotInterval
+}
+
+// Resolve the WebSocket endpoint used for pending transaction and newHeads
+// subscriptions
+func (dt *SomniaStream) pendingSubscriptionEndpoint() string {
+	if dt.config().PendingWSEndpoint != "" {
+		return dt.config().PendingWSEndpoint
+	}
+	if strings.HasPrefix(dt.config().RPCEndpoint, "ws://") || strings.HasPrefix(dt.config().RPCEndpoint, "wss://") {
+		return dt.config().RPCEndpoint
+	}
+	return ""
+}
+
+// chainHooks feeds what the chain monitors publish to the enrichment,
+// alerting and tracking features
+func (dt *SomniaStream) chainHooks() monitor.Hooks {
+	return monitor.Hooks{
+		BlockByNumber: dt.blockByNumber,
+		Receipts: func(ctx context.Context, block *types.Block) ([]*types.Receipt, error) {
+			if !dt.wantReceipts(block) {
+				return nil, nil
+			}
+			return dt.fetchReceipts(ctx, block)
+		},
+		Head: func(block *types.Block) bool {
+			dt.paceBlocks(block.NumberU64())
+			if !dt.verifyBlock(block) {
+				return false // Retried on the next poll until the providers agree
+			}
+			dt.blocks.add(block.NumberU64(), block)
+			dt.chaos.delayBlock(context.Background())
+			return true
+		},
+		Transactions: func(txs []map[string]interface{}) {
+			dt.names.annotate(txs, "from", "to")
+			dt.selectors.annotate(txs)
+		},
+		Logs: func(logs []map[string]interface{}) {
+			dt.names.annotate(logs, "address")
+			dt.abis.decode(logs)
+			dt.tokens.annotate(logs)
+			dt.checkWhaleTokenTransfers(logs)
+		},
+		Block: dt.observeBlock,
+		Pending: func(txs []map[string]interface{}) {
+			dt.checkWhalePending(txs)
+			dt.trackPendingLifecycle(txs)
+		},
+		Pool:     dt.lifecycle.touch,
+		GasPrice: dt.checkGasSpike,
+	}
+}
+
+// observeBlock feeds a published block to the per-block streams and trackers
+func (dt *SomniaStream) observeBlock(block *types.Block, receipts []*types.Receipt) {
+	dt.ready.firstBlock.Store(true)
+
+	dt.throughput.observe(block)
+	dt.observeRollups(block)
+	dt.checkWhaleTransactions(block)
+	dt.publishBlobs(block)
+	dt.publishAlternativeBlocks(block)
+	dt.observeBalances(block)
+	dt.queueStateReads(block.NumberU64())
+	dt.trackBlockLifecycle(block)
+
+	// Receipts are shared by the failed transaction and base fee streams
+	if dt.config().TrackFailedTxs && receipts != nil {
+		if err := dt.publishFailedTransactions(block, receipts); err != nil {
+			log.Printf("[BLOCKS] ERROR: Failed to process failed transactions: %v", err)
+		}
+	}
+	if dt.config().TrackBaseFee && block.BaseFee() != nil {
+		if err := dt.publishBaseFee(block, receipts); err != nil {
+			log.Printf("[BLOCKS] ERROR: Failed to publish base fee: %v", err)
+		}
+	}
+}
+
+func (dt *SomniaStream) monitorRPC(ctx context.Context) {
+	log.Println("Starting comprehensive RPC monitoring...")
+
+	// Start multiple monitoring goroutines for different data types
+	dt.monitors.Register("blocks", dt.monitorBlocks)
+	dt.monitors.Register("pending", dt.monitorPendingTransactions)
+	dt.monitors.Register("logs", dt.monitorLogs)
+	dt.monitors.Register("network", dt.monitorNetworkStats)
+	dt.monitors.Register("gasPrice", dt.monitorGasPrice)
+	dt.monitors.Register("fees", dt.monitorFeeSuggestions)
+	dt.monitors.Register("throughput", dt.monitorThroughput)
+	dt.monitors.Register("bridge", dt.monitorBridges)
+	dt.monitors.Register("pools", dt.monitorPools)
+	dt.monitors.Register("balances", dt.monitorBalances)
+	dt.monitors.Register("nonces", dt.monitorNonces)
+	dt.monitors.Register("traces", dt.monitorTraces)
+	dt.monitors.Register("consensus", dt.monitorConsensus)
+	dt.registerChainMonitors()
+	dt.registerPlugins()
+	dt.applyMonitorConfig()
+	dt.monitors.StartAll(ctx)
+
+	// Keep the main monitoring goroutine alive
+	<-ctx.Done()
+	log.Println("RPC monitoring stopped")
+}
+
+// Monitor new blocks
+func (dt *SomniaStream) monitorBlocks(ctx context.Context) {
+	// Poll as soon as a block is announced when the endpoint supports newHeads
+	go dt.runHeadSubscription(ctx)
+
+	backfill := true
+	dt.runCheckpointed(ctx, "blocks", func(lastBlockNumber *uint64) error {
+		// Blocks missed while the service was down are published first
+		if backfill && *lastBlockNumber > 0 {
+			dt.primary.Backfill(ctx, lastBlockNumber, func(block uint64) {
+				dt.cursors.set("blocks", block)
+			})
+		}
+		backfill = false
+		return dt.primary.PublishLatestBlock(lastBlockNumber)
+	})
+}
+
+// Monitor pending transactions
+func (dt *SomniaStream) monitorPendingTransactions(ctx context.Context) {
+	// Prefer a newPendingTransactions subscription when the endpoint supports it
+	if dt.config().PendingSubscription {
+		if dt.config().PendingSnapshotInterval <= 0 {
+			log.Printf("[PENDING] PENDING_SNAPSHOT_INTERVAL must be positive with PENDING_SUBSCRIPTION, resyncing every %s", monitor.PendingSubscriptionResync)
+		}
+		if endpoint := dt.pendingSubscriptionEndpoint(); endpoint != "" {
+			go dt.primary.SubscribePending(ctx, endpoint, func() bool { return dt.monitors.Paused("pending") })
+		} else {
+			log.Printf("[PENDING] No WebSocket endpoint configured, using eth_pendingTransactions polling")
+		}
+	}
+
+	dt.runMonitor(ctx, "pending", dt.primary.PublishPending)
+}
+
+// Monitor logs (events)
+func (dt *SomniaStream) monitorLogs(ctx context.Context) {
+	dt.runCheckpointed(ctx, "logs", dt.primary.PublishLogs)
+}
+
+// Monitor network statistics
+func (dt *SomniaStream) monitorNetworkStats(ctx context.Context) {
+	dt.runMonitor(ctx, "network", dt.primary.PublishNetworkStats)
+}
+
+// Monitor gas price
+func (dt *SomniaStream) monitorGasPrice(ctx context.Context) {
+	dt.runMonitor(ctx, "gasPrice", dt.primary.PublishGasPrice)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/api"
+)
+
+// maxMergedStreams caps how many streams one /sse connection may merge
+const maxMergedStreams = 16
+
+// mergedEvent is an event of the merged /sse feed
+type mergedEvent struct {
+	Stream string          `json:"stream"`
+	ID     uint64          `json:"id"` // JetStream stream sequence, for deduplication
+	Data   json.RawMessage `json:"data"`
+}
+
+// Handle GET /sse?streams=blocks,gasPrice,logs, merging several streams into
+// one connection. Each event names the stream it came from. Sequences are per
+// JetStream stream, so the merged feed has no event IDs and starts at new
+// messages after a reconnect.
+func (dt *SomniaStream) handleMergedSSE(c *gin.Context) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(c.Query("streams"), ",") {
+		if name = strings.TrimSpace(name); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "streams is required, e.g. ?streams=blocks,gasPrice,logs"})
+		return
+	}
+	if len(names) > maxMergedStreams {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at most " + strconv.Itoa(maxMergedStreams) + " streams can be merged"})
+		return
+	}
+
+	shape, err := newMessageShape(c.Query("fields"), c.Query("transform"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subjects := make([]string, len(names))
+	for i, name := range names {
+		subject, ok := dt.streams.lookup(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown stream %q", name)})
+			return
+		}
+		if !dt.streamAllowed(c, name) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("access to stream %q denied", name)})
+			return
+		}
+		subjects[i] = subject
+	}
+
+	stream := strings.Join(names, ",")
+	client, ctx, err := dt.clients.connectStreams(c, "sse", stream, strings.Join(subjects, ","), names, dt.connectionLimits())
+	if err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(connectionRetryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer dt.clients.disconnect(client)
+
+	// One queue for all streams, so the overflow policy is the default one
+	queue := dt.newClientQueue("")
+	for i, name := range names {
+		handler := func(msg *nats.Msg) {
+			data, ok := shape.apply(msg.Data)
+			if !ok {
+				return
+			}
+			event := mergedEvent{Stream: name, Data: data}
+			if meta, err := msg.Metadata(); err == nil {
+				event.ID = meta.Sequence.Stream
+			}
+			if !json.Valid(event.Data) {
+				event.Data, _ = json.Marshal(string(msg.Data))
+			}
+			wrapped, _ := json.Marshal(event)
+			if dropped := queue.Push(api.Message{Subject: msg.Subject, Data: wrapped}); dropped > 0 {
+				client.dropped.Add(uint64(dropped))
+			}
+		}
+		sub, err := dt.js.Subscribe(dt.ns.Subject(subjects[i]), handler, nats.DeliverNew(), nats.OrderedConsumer())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer sub.Unsubscribe()
+	}
+
+	dt.writeEvents(ctx, c, client, queue, stream)
+}
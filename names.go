@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Selectors of the ENS registry and resolver methods used for reverse records
+var (
+	selectorResolver = crypto.Keccak256([]byte("resolver(bytes32)"))[:4]
+	selectorName     = crypto.Keccak256([]byte("name(bytes32)"))[:4]
+	selectorAddr     = crypto.Keccak256([]byte("addr(bytes32)"))[:4]
+)
+
+// nameLookupQueue bounds the addresses waiting for resolution; addresses that
+// don't fit are queued again the next time they are seen
+const nameLookupQueue = 1024
+
+// namehash computes the ENS node of a name (EIP-137)
+func namehash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// nameEntry is a cached reverse record; an empty name caches a miss
+type nameEntry struct {
+	name    string
+	expires time.Time
+}
+
+// nameResolver resolves addresses to names through the reverse records of an
+// ENS-compatible registry. Lookups run in the background so publishing never
+// waits on them: an address is annotated once its name is cached.
+type nameResolver struct {
+	registry   common.Address
+	client     *ethclient.Client
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	cache   map[common.Address]nameEntry
+	queued  map[common.Address]bool
+	lookups chan common.Address
+}
+
+// newNameResolver returns a resolver for the registry at NAME_REGISTRY, or nil
+// when name resolution is disabled
+func newNameResolver(registry string, client *ethclient.Client, ttl time.Duration, maxEntries int) (*nameResolver, error) {
+	if registry == "" {
+		return nil, nil
+	}
+	if !common.IsHexAddress(registry) {
+		return nil, fmt.Errorf("invalid name registry address %q", registry)
+	}
+	return &nameResolver{
+		registry:   common.HexToAddress(registry),
+		client:     client,
+		ttl:        ttl,
+		maxEntries: max(maxEntries, 1),
+		cache:      make(map[common.Address]nameEntry),
+		queued:     make(map[common.Address]bool),
+		lookups:    make(chan common.Address, nameLookupQueue),
+	}, nil
+}
+
+// run resolves queued addresses until ctx is done
+func (r *nameResolver) run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case addr := <-r.lookups:
+			lookupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			name, err := r.reverse(lookupCtx, addr)
+			cancel()
+
+			r.mu.Lock()
+			delete(r.queued, addr)
+			if err == nil {
+				r.store(addr, name)
+			}
+			r.mu.Unlock()
+			if err != nil {
+				log.Printf("[NAMES] WARNING: Failed to resolve %s: %v", addr.Hex(), err)
+			}
+		}
+	}
+}
+
+// store caches a name, evicting expired entries (or any entry) when full.
+// The caller holds r.mu.
+func (r *nameResolver) store(addr common.Address, name string) {
+	now := time.Now()
+	if len(r.cache) >= r.maxEntries {
+		for cached, entry := range r.cache {
+			if now.After(entry.expires) {
+				delete(r.cache, cached)
+			}
+		}
+	}
+	if len(r.cache) >= r.maxEntries {
+		for cached := range r.cache {
+			delete(r.cache, cached)
+			break
+		}
+	}
+	r.cache[addr] = nameEntry{name: name, expires: now.Add(r.ttl)}
+}
+
+// lookup returns the cached name of an address and queues a lookup when the
+// address wasn't resolved yet or its entry expired
+func (r *nameResolver) lookup(addr common.Address) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.cache[addr]
+	if ok && time.Now().Before(entry.expires) {
+		return entry.name
+	}
+	if !r.queued[addr] {
+		select {
+		case r.lookups <- addr:
+			r.queued[addr] = true
+		default:
+		}
+	}
+	return entry.name // Serve an expired name until it is refreshed
+}
+
+// annotate adds <field>Name next to every address field of the payloads whose
+// name is known, e.g. fromName and toName
+func (r *nameResolver) annotate(items []map[string]interface{}, fields ...string) {
+	if r == nil {
+		return
+	}
+	for _, item := range items {
+		for _, field := range fields {
+			addr, ok := addressOf(item[field])
+			if !ok {
+				continue
+			}
+			if name := r.lookup(addr); name != "" {
+				item[field+"Name"] = name
+			}
+		}
+	}
+}
+
+// addressOf reads an address from a payload field
+func addressOf(value interface{}) (common.Address, bool) {
+	switch v := value.(type) {
+	case common.Address:
+		return v, true
+	case *common.Address:
+		if v != nil {
+			return *v, true
+		}
+	case string:
+		if common.IsHexAddress(v) {
+			return common.HexToAddress(v), true
+		}
+	}
+	return common.Address{}, false
+}
+
+// reverse resolves the reverse record of an address and verifies that the name
+// resolves back to it, so nobody can claim a name they don't own
+func (r *nameResolver) reverse(ctx context.Context, addr common.Address) (string, error) {
+	node := namehash(strings.ToLower(addr.Hex()[2:]) + ".addr.reverse")
+	resolver, err := r.resolverOf(ctx, node)
+	if err != nil || resolver == (common.Address{}) {
+		return "", err
+	}
+	out, err := r.call(ctx, resolver, selectorName, node)
+	if err != nil {
+		return "", nil // Resolvers without name() have no reverse record
+	}
+	name, err := unpackString(out)
+	if err != nil || name == "" {
+		return "", nil
+	}
+
+	forward := namehash(name)
+	resolver, err = r.resolverOf(ctx, forward)
+	if err != nil || resolver == (common.Address{}) {
+		return "", err
+	}
+	out, err = r.call(ctx, resolver, selectorAddr, forward)
+	if err != nil || len(out) < 32 || common.BytesToAddress(out[12:32]) != addr {
+		return "", nil
+	}
+	return name, nil
+}
+
+// resolverOf returns the resolver the registry has for a node
+func (r *nameResolver) resolverOf(ctx context.Context, node common.Hash) (common.Address, error) {
+	out, err := r.call(ctx, r.registry, selectorResolver, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(out) < 32 {
+		return common.Address{}, nil
+	}
+	return common.BytesToAddress(out[12:32]), nil
+}
+
+// call calls a contract method taking a single bytes32 node
+func (r *nameResolver) call(ctx context.Context, to common.Address, selector []byte, node common.Hash) ([]byte, error) {
+	data := append(append([]byte{}, selector...), node.Bytes()...)
+	return r.client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+}
+
+// unpackString decodes an ABI encoded string return value
+func unpackString(out []byte) (string, error) {
+	stringType, _ := abi.NewType("string", "", nil)
+	values, err := abi.Arguments{{Type: stringType}}.Unpack(out)
+	if err != nil {
+		return "", err
+	}
+	name, _ := values[0].(string)
+	return name, nil
+}
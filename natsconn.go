@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/config"
+)
+
+// natsOptions builds the NATS connection options: TLS (custom CA and client
+// certificate), then exactly one of credentials file, NKey seed or token auth
+func natsOptions(cfg *config.Config) ([]nats.Option, error) {
+	opts := []nats.Option{nats.Name("devtool")}
+
+	if cfg.NATSTLS || cfg.NATSTLSCAFile != "" || cfg.NATSTLSCertFile != "" {
+		opts = append(opts, nats.Secure(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if cfg.NATSTLSCAFile != "" {
+		opts = append(opts, nats.RootCAs(cfg.NATSTLSCAFile))
+	}
+	if cfg.NATSTLSCertFile != "" {
+		opts = append(opts, nats.ClientCert(cfg.NATSTLSCertFile, cfg.NATSTLSKeyFile))
+	}
+
+	switch {
+	case cfg.NATSCredsFile != "":
+		// Synadia Cloud / NGS and operator-mode clusters
+		opts = append(opts, nats.UserCredentials(cfg.NATSCredsFile))
+	case cfg.NATSNKeySeedFile != "":
+		nkey, err := nats.NkeyOptionFromSeed(cfg.NATSNKeySeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load NKey seed: %v", err)
+		}
+		opts = append(opts, nkey)
+	case cfg.NATSToken != "":
+		opts = append(opts, nats.Token(cfg.NATSToken))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Stuck transaction alert types published on eth.alerts.stuck-tx
+const (
+	stuckAlertStuck    = "stuck"     // The next nonce has been pending too long
+	stuckAlertGap      = "nonce_gap" // Later nonces are pending but the next one is missing
+	stuckAlertResolved = "resolved"  // The blocking nonce was mined
+)
+
+// nonceState is what the nonce monitor remembers about a watched address
+type nonceState struct {
+	next    uint64    // Next expected nonce, i.e. the confirmed transaction count
+	since   time.Time // When transactions started waiting on next (zero while none are)
+	alerted string    // Alert type raised for next, if any
+}
+
+// nonceWatcher tracks the next expected nonce of the addresses in
+// NONCE_WATCHLIST
+type nonceWatcher struct {
+	mu        sync.Mutex
+	addresses map[common.Address]*nonceState
+}
+
+func newNonceWatcher() *nonceWatcher {
+	return &nonceWatcher{addresses: make(map[common.Address]*nonceState)}
+}
+
+// Monitor the nonces of watched addresses for gaps and stuck transactions
+func (dt *SomniaStream) monitorNonces(ctx context.Context) {
+	dt.runMonitor(ctx, "nonces", func() error {
+		return dt.checkNonces(ctx)
+	})
+}
+
+// checkNonces compares the confirmed and pending nonces of every watched
+// address. A transaction is stuck when the address has pending transactions
+// but its confirmed nonce hasn't advanced for STUCK_TX_AGE, and a gap when
+// later nonces are pending while the next one is missing from the mempool.
+// Each condition is alerted once per blocking nonce, and resolved once mined.
+func (dt *SomniaStream) checkNonces(ctx context.Context) error {
+	cfg := dt.config()
+	watched := make(map[common.Address]string, len(cfg.NonceWatchlist))
+	for name, address := range cfg.NonceWatchlist {
+		watched[common.HexToAddress(address)] = name
+	}
+	dt.nonces.mu.Lock()
+	for addr := range dt.nonces.addresses {
+		if _, ok := watched[addr]; !ok {
+			delete(dt.nonces.addresses, addr) // Removed on reload
+		}
+	}
+	dt.nonces.mu.Unlock()
+
+	var failed error
+	for addr, name := range watched {
+		readCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		next, err := dt.ethClient.NonceAt(readCtx, addr, nil)
+		if err == nil {
+			var pendingNonce uint64
+			pendingNonce, err = dt.ethClient.PendingNonceAt(readCtx, addr)
+			if err == nil {
+				dt.checkNonce(addr, name, next, pendingNonce, cfg.StuckTxAge)
+			}
+		}
+		cancel()
+		if err != nil {
+			log.Printf("[NONCES] WARNING: Failed to read nonces of %s (%s): %v", name, addr.Hex(), err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// checkNonce evaluates one address and publishes alerts on state changes
+func (dt *SomniaStream) checkNonce(addr common.Address, name string, next, pendingNonce uint64, stuckAge time.Duration) {
+	now := time.Now()
+	dt.nonces.mu.Lock()
+	state, ok := dt.nonces.addresses[addr]
+	if !ok {
+		state = &nonceState{next: next}
+		dt.nonces.addresses[addr] = state
+	}
+	resolved, previous := "", state.next
+	if next != state.next {
+		resolved = state.alerted
+		state.next, state.since, state.alerted = next, time.Time{}, ""
+	}
+	alerted := state.alerted
+	dt.nonces.mu.Unlock()
+
+	alert := map[string]interface{}{
+		"address":       strings.ToLower(addr.Hex()),
+		"name":          name,
+		"nextNonce":     next,
+		"pendingNonce":  pendingNonce,
+		"blockingNonce": next,
+		"timestamp":     now.Unix(),
+	}
+	if resolved != "" {
+		alert["type"] = stuckAlertResolved
+		alert["blockingNonce"] = previous
+		alert["resolves"] = resolved
+		dt.publishStuckTxAlert(alert)
+		return
+	}
+
+	// Pending transactions of the address the mempool monitor has seen
+	pending := dt.lifecycle.pendingFrom(addr.Hex())
+	queued := make(map[uint64]bool)
+	var highest uint64
+	var blocking *trackedTx
+	for i, tx := range pending {
+		nonce, err := hexutil.DecodeUint64(tx.Nonce)
+		if err != nil || nonce < next {
+			continue
+		}
+		if nonce == next {
+			if blocking == nil || tx.FirstSeen.Before(blocking.FirstSeen) {
+				blocking = &pending[i]
+			}
+			continue
+		}
+		queued[nonce] = true
+		highest = max(highest, nonce)
+	}
+	alert["queued"] = len(queued)
+
+	// A freshly sent nonce may show up after its successors, so both
+	// conditions must last STUCK_TX_AGE
+	dt.nonces.mu.Lock()
+	switch {
+	case blocking == nil && len(queued) == 0 && pendingNonce <= next:
+		state.since = time.Time{}
+	case state.since.IsZero():
+		state.since = now
+	}
+	since := state.since
+	dt.nonces.mu.Unlock()
+	overdue := !since.IsZero() && stuckAge > 0 && now.Sub(since) >= stuckAge
+	kind := ""
+	switch {
+	case !overdue:
+	case blocking == nil && len(queued) > 0:
+		kind = stuckAlertGap
+		var missing []uint64
+		for nonce := next; nonce < highest && len(missing) < 100; nonce++ {
+			if !queued[nonce] {
+				missing = append(missing, nonce)
+			}
+		}
+		alert["missingNonces"] = missing
+	case blocking != nil || pendingNonce > next:
+		kind = stuckAlertStuck
+		alert["stuckFor"] = int64(now.Sub(since).Seconds())
+		if blocking != nil {
+			alert["blockingTx"] = blocking.Hash
+			alert["pendingFor"] = int64(now.Sub(blocking.FirstSeen).Seconds())
+		}
+	}
+	if kind == "" || kind == alerted {
+		return
+	}
+
+	dt.nonces.mu.Lock()
+	state.alerted = kind
+	dt.nonces.mu.Unlock()
+	alert["type"] = kind
+	dt.publishStuckTxAlert(alert)
+}
+
+func (dt *SomniaStream) publishStuckTxAlert(alert map[string]interface{}) {
+	log.Printf("[NONCES] ⚠️ %s for %s (%s) at nonce %v", alert["type"], alert["name"], alert["address"], alert["blockingNonce"])
+
+	data, _ := json.Marshal(alert)
+	if err := dt.publish("eth.alerts.stuck-tx", data); err != nil {
+		log.Printf("[NONCES] ERROR: Failed to publish stuck transaction alert for %s: %v", alert["address"], err)
+	}
+}
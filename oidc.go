@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"somnia-stream/pkg/api"
+)
+
+// Cookies used by the OIDC login flow
+const (
+	sessionCookie    = "somnia_session"
+	oidcStateCookie  = "somnia_oidc_state"
+	oidcStateTimeout = 10 * time.Minute
+)
+
+// oidcProvider holds the discovered endpoints of the OIDC issuer
+type oidcProvider struct {
+	mu                    sync.Mutex
+	issuer                string
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwks                  *jwksCache
+	sessionKey            []byte
+}
+
+func newOIDCProvider(issuer, sessionSecret string) *oidcProvider {
+	key := []byte(sessionSecret)
+	if len(key) == 0 {
+		// Sessions won't survive a restart without SESSION_SECRET
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &oidcProvider{issuer: strings.TrimSuffix(issuer, "/"), sessionKey: key}
+}
+
+// discover loads the provider metadata from /.well-known/openid-configuration once
+func (p *oidcProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tokenEndpoint != "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery returned %s", resp.Status)
+	}
+
+	var meta struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return err
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return errors.New("discovery document is missing endpoints")
+	}
+
+	p.issuer = strings.TrimSuffix(meta.Issuer, "/")
+	p.authorizationEndpoint = meta.AuthorizationEndpoint
+	p.tokenEndpoint = meta.TokenEndpoint
+	p.jwks = newJWKSCache(meta.JWKSURI)
+	log.Printf("[AUTH] OIDC provider %s discovered", p.issuer)
+	return nil
+}
+
+// sign returns value.signature using the session key
+func (p *oidcProvider) sign(value string) string {
+	mac := hmac.New(sha256.New, p.sessionKey)
+	mac.Write([]byte(value))
+	return value + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a signed value and returns the payload
+func (p *oidcProvider) verify(signed string) (string, bool) {
+	i := strings.LastIndex(signed, ".")
+	if i < 0 {
+		return "", false
+	}
+	value := signed[:i]
+	return value, hmac.Equal([]byte(p.sign(value)), []byte(signed))
+}
+
+// oidcEnabled reports whether admin routes accept OIDC sessions
+func (dt *SomniaStream) oidcEnabled() bool {
+	return dt.oidc != nil
+}
+
+// sessionUser returns the signed-in user of a valid session cookie
+func (dt *SomniaStream) sessionUser(c *gin.Context) (string, bool) {
+	if dt.oidc == nil {
+		return "", false
+	}
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil {
+		return "", false
+	}
+	value, ok := dt.oidc.verify(string(raw))
+	if !ok {
+		return "", false
+	}
+
+	user, expiry, ok := strings.Cut(value, "|")
+	if !ok {
+		return "", false
+	}
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", false
+	}
+	return user, true
+}
+
+// userAllowed checks the signed-in user against OIDC_ALLOWED_USERS and OIDC_ALLOWED_DOMAINS
+func (dt *SomniaStream) userAllowed(email string) bool {
+	cfg := dt.config()
+	if len(cfg.OIDCAllowedUsers) == 0 && len(cfg.OIDCAllowedDomains) == 0 {
+		return true
+	}
+	for _, user := range cfg.OIDCAllowedUsers {
+		if strings.EqualFold(user, email) {
+			return true
+		}
+	}
+	if _, domain, ok := strings.Cut(email, "@"); ok {
+		for _, allowed := range cfg.OIDCAllowedDomains {
+			if strings.EqualFold(allowed, domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setupOIDCRoutes registers the login flow when OIDC_ISSUER is configured
+func (dt *SomniaStream) setupOIDCRoutes() {
+	if dt.oidc == nil {
+		return
+	}
+	auth := api.Documented(&dt.adminAPI.RouterGroup, dt.openapi).Group("/auth")
+	auth.GET("/login", api.Operation{
+		Summary: "Start the OIDC login flow",
+		Tags:    []string{"auth"},
+		Params:  []api.Param{{Name: "next", In: "query", Description: "Local path to return to after login"}},
+		Status:  http.StatusFound,
+	}, dt.handleOIDCLogin)
+	auth.GET("/callback", api.Operation{
+		Summary: "OIDC redirect target setting the session cookie",
+		Tags:    []string{"auth"},
+		Status:  http.StatusFound,
+		Errors:  map[int]string{http.StatusUnauthorized: "Login failed or was denied"},
+	}, dt.handleOIDCCallback)
+	auth.GET("/logout", api.Operation{Summary: "Clear the session cookie", Tags: []string{"auth"}}, dt.handleOIDCLogout)
+	auth.GET("/me", api.Operation{
+		Summary:  "The signed-in user",
+		Tags:     []string{"auth"},
+		Errors:   map[int]string{http.StatusUnauthorized: "Not signed in"},
+		Security: []string{securitySession},
+	}, func(c *gin.Context) {
+		user, ok := dt.sessionUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "not signed in"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user": user})
+	})
+}
+
+// Handle GET /auth/login redirecting to the provider (authorization code flow with PKCE)
+func (dt *SomniaStream) handleOIDCLogin(c *gin.Context) {
+	if err := dt.oidc.discover(c.Request.Context()); err != nil {
+		log.Printf("[AUTH] ERROR: OIDC discovery failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+
+	random := make([]byte, 48)
+	_, _ = rand.Read(random)
+	state := hex.EncodeToString(random[:16])
+	nonce := hex.EncodeToString(random[16:32])
+	verifier := base64.RawURLEncoding.EncodeToString(random[32:]) + hex.EncodeToString(random[:16])
+	challenge := sha256.Sum256([]byte(verifier))
+
+	// Only same-origin paths may be used as the post-login destination
+	next := c.Query("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/admin/monitors"
+	}
+
+	flow := strings.Join([]string{state, nonce, verifier, next, strconv.FormatInt(time.Now().Add(oidcStateTimeout).Unix(), 10)}, "|")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, base64.RawURLEncoding.EncodeToString([]byte(dt.oidc.sign(flow))), int(oidcStateTimeout.Seconds()), "/auth", "", c.Request.TLS != nil, true)
+
+	cfg := dt.config()
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.OIDCClientID},
+		"redirect_uri":          {cfg.OIDCRedirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	c.Redirect(http.StatusFound, dt.oidc.authorizationEndpoint+"?"+query.Encode())
+}
+
+// Handle GET /auth/callback exchanging the code and starting a session
+func (dt *SomniaStream) handleOIDCCallback(c *gin.Context) {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login flow expired, start again at /auth/login"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/auth", "", c.Request.TLS != nil, true)
+
+	raw, _ := base64.RawURLEncoding.DecodeString(cookie)
+	flow, ok := dt.oidc.verify(string(raw))
+	parts := strings.Split(flow, "|")
+	if !ok || len(parts) != 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid login state"})
+		return
+	}
+	state, nonce, verifier, next := parts[0], parts[1], parts[2], parts[3]
+	if exp, _ := strconv.ParseInt(parts[4], 10, 64); time.Now().Unix() > exp || c.Query("state") != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid login state"})
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errParam, "description": c.Query("error_description")})
+		return
+	}
+
+	if err := dt.oidc.discover(c.Request.Context()); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+	idToken, err := dt.exchangeOIDCCode(c.Request.Context(), c.Query("code"), verifier)
+	if err != nil {
+		log.Printf("[AUTH] ERROR: OIDC code exchange failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "code exchange failed"})
+		return
+	}
+
+	claims, err := dt.validateIDToken(idToken, nonce)
+	if err != nil {
+		log.Printf("[AUTH] ERROR: Invalid ID token: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid ID token"})
+		return
+	}
+
+	user, _ := claims["email"].(string)
+	if user == "" {
+		user, _ = claims["sub"].(string)
+	}
+	if !dt.userAllowed(user) {
+		log.Printf("[AUTH] Rejected OIDC login for %s", user)
+		c.JSON(http.StatusForbidden, gin.H{"error": "user not allowed"})
+		return
+	}
+
+	ttl := dt.config().SessionTTL
+	session := dt.oidc.sign(fmt.Sprintf("%s|%d", user, time.Now().Add(ttl).Unix()))
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, base64.RawURLEncoding.EncodeToString([]byte(session)), int(ttl.Seconds()), "/", "", c.Request.TLS != nil, true)
+
+	log.Printf("[AUTH] %s signed in via OIDC", user)
+	c.Redirect(http.StatusFound, next)
+}
+
+func (dt *SomniaStream) handleOIDCLogout(c *gin.Context) {
+	c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{"signedOut": true})
+}
+
+// Exchange an authorization code for an ID token at the token endpoint
+func (dt *SomniaStream) exchangeOIDCCode(ctx context.Context, code, verifier string) (string, error) {
+	cfg := dt.config()
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg.OIDCRedirectURL},
+		"client_id":     {cfg.OIDCClientID},
+		"client_secret": {cfg.OIDCClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dt.oidc.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return "", fmt.Errorf("token endpoint returned %s %s", resp.Status, token.Error)
+	}
+	return token.IDToken, nil
+}
+
+// Validate the signature, issuer, audience and nonce of an ID token
+func (dt *SomniaStream) validateIDToken(idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return dt.oidc.jwks.key(kid, time.Hour)
+	}, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != dt.oidc.issuer {
+		return nil, errors.New("unexpected issuer")
+	}
+	if !claims.VerifyAudience(dt.config().OIDCClientID, true) {
+		return nil, errors.New("unexpected audience")
+	}
+	if claimed, _ := claims["nonce"].(string); claimed != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	return claims, nil
+}
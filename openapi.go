@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+
+	"somnia-stream/pkg/api"
+	"somnia-stream/pkg/streams"
+)
+
+// Security schemes referenced by documented routes
+const (
+	securityAPIKey  = "apiKey"     // X-API-Key header
+	securityBearer  = "bearerAuth" // JWT, or the admin token on /admin
+	securityAdmin   = "adminToken" // X-Admin-Token header
+	securitySession = "session"    // OIDC session cookie
+)
+
+// Errors shared by the documented routes
+var (
+	authErrors = map[int]string{
+		http.StatusUnauthorized:    "Missing or invalid credentials",
+		http.StatusForbidden:       "Credentials lack the required scope",
+		http.StatusTooManyRequests: "Rate limit exceeded",
+	}
+	adminErrors = map[int]string{
+		http.StatusUnauthorized: "Missing or invalid admin credentials",
+	}
+)
+
+// publicSecurity and adminSecurity are the accepted credentials of each API
+var (
+	publicSecurity = []string{securityAPIKey, securityBearer}
+	adminSecurity  = []string{securityBearer, securityAdmin, securitySession, securityAPIKey}
+)
+
+// newAPISpec returns the OpenAPI document that routes are added to as they
+// are registered
+func newAPISpec() *api.Spec {
+	spec := api.NewSpec("SomniaStream API", version,
+		"Real-time Somnia blockchain data over Server-Sent Events, backed by NATS JetStream. "+
+			"Admin routes are served on ADMIN_LISTEN when it is set.")
+	spec.SecuritySchemes[securityAPIKey] = map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"}
+	spec.SecuritySchemes[securityBearer] = map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+	spec.SecuritySchemes[securityAdmin] = map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Admin-Token"}
+	spec.SecuritySchemes[securitySession] = map[string]interface{}{"type": "apiKey", "in": "cookie", "name": sessionCookie}
+	return spec
+}
+
+// streamNames lists the built-in stream names and aliases; derived streams
+// are added at runtime, so the names document rather than restrict :stream
+func streamNames() []string {
+	names := make([]string, 0, len(streams.Builtin)+len(streams.Aliases))
+	for _, entry := range streams.Builtin {
+		names = append(names, entry.Name)
+	}
+	for alias := range streams.Aliases {
+		names = append(names, alias)
+	}
+	return names
+}
+
+// streamListResponse documents the response of GET /streams
+type streamListResponse struct {
+	Streams   map[string]string `json:"streams"` // Name to "subject - description (kind)"
+	Usage     map[string]string `json:"usage"`
+	JetStream string            `json:"jetstream"`
+}
+
+// mergeErrors combines documented error responses
+func mergeErrors(sets ...map[int]string) map[int]string {
+	merged := make(map[int]string)
+	for _, set := range sets {
+		for code, description := range set {
+			merged[code] = description
+		}
+	}
+	return merged
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Export file formats
+const (
+	formatNDJSON  = "ndjson"
+	formatParquet = "parquet"
+)
+
+// parquetBatch is the number of rows read from a Parquet file at once
+const parquetBatch = 256
+
+// transferFormat resolves the --format of export and import, falling back to
+// the extension of the file
+func transferFormat(format, file string) (string, error) {
+	switch strings.ToLower(format) {
+	case formatNDJSON, formatParquet:
+		return strings.ToLower(format), nil
+	case "":
+		if strings.EqualFold(filepath.Ext(file), ".parquet") {
+			return formatParquet, nil
+		}
+		return formatNDJSON, nil
+	}
+	return "", fmt.Errorf("unknown format %q, use %s or %s", format, formatNDJSON, formatParquet)
+}
+
+// parquetRecord is one row of a Parquet export file. Payloads and headers are
+// JSON columns so query engines such as DuckDB can unpack them. The optional
+// columns are strings since empty strings are written as nulls.
+type parquetRecord struct {
+	Subject string    `parquet:"subject,dict"` // Without the subject namespace
+	Seq     uint64    `parquet:"seq,delta"`
+	Time    time.Time `parquet:"time,timestamp(nanosecond)"`
+	Headers string    `parquet:"headers,optional,json"`
+	Data    string    `parquet:"data,optional,json"`
+	DataRaw string    `parquet:"data_raw,optional"` // Payloads that aren't JSON
+}
+
+// recordWriter writes the records of an export file
+type recordWriter interface {
+	Write(record dumpRecord) error
+	Close() error // Flushes the records; the underlying writer stays open
+}
+
+// newRecordWriter returns a writer of export records in format
+func newRecordWriter(format string, w io.Writer) recordWriter {
+	if format == formatParquet {
+		return &parquetWriter{w: parquet.NewGenericWriter[parquetRecord](w, parquet.Compression(&parquet.Zstd))}
+	}
+	bw := bufio.NewWriter(w)
+	return &ndjsonWriter{bw: bw, encoder: json.NewEncoder(bw)}
+}
+
+type ndjsonWriter struct {
+	bw      *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(record dumpRecord) error {
+	return n.encoder.Encode(record)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.bw.Flush()
+}
+
+type parquetWriter struct {
+	w *parquet.GenericWriter[parquetRecord]
+}
+
+func (p *parquetWriter) Write(record dumpRecord) error {
+	row := parquetRecord{
+		Subject: record.Subject,
+		Seq:     record.Seq,
+		Time:    record.Time,
+		Data:    string(record.Data),
+		DataRaw: string(record.DataBase64),
+	}
+	if len(record.Headers) > 0 {
+		headers, _ := json.Marshal(record.Headers)
+		row.Headers = string(headers)
+	}
+	_, err := p.w.Write([]parquetRecord{row})
+	return err
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
+
+// recordReader reads the records of an export file; Read returns io.EOF
+// after the last one
+type recordReader interface {
+	Read() (dumpRecord, error)
+	Close() error
+}
+
+// newRecordReader returns a reader of the export file r in format. Parquet
+// files are read from their footer, so they can't be read from stdin.
+func newRecordReader(format string, r io.Reader) (recordReader, error) {
+	if format != formatParquet {
+		return &ndjsonReader{br: bufio.NewReader(r)}, nil
+	}
+	file, ok := r.(*os.File)
+	if !ok || file == os.Stdin {
+		return nil, errors.New("Parquet files can't be imported from stdin")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pf, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range []string{"subject", "seq", "time"} {
+		if _, ok := pf.Schema().Lookup(column); !ok {
+			return nil, fmt.Errorf("not an export file, no %s column", column)
+		}
+	}
+	return &parquetReader{r: parquet.NewGenericReader[parquetRecord](file)}, nil
+}
+
+type ndjsonReader struct {
+	br   *bufio.Reader
+	line int
+}
+
+func (n *ndjsonReader) Read() (dumpRecord, error) {
+	for {
+		n.line++
+		raw, err := n.br.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			var record dumpRecord
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return record, fmt.Errorf("line %d: %v", n.line, err)
+			}
+			return record, nil
+		}
+		if err != nil {
+			return dumpRecord{}, err
+		}
+	}
+}
+
+func (n *ndjsonReader) Close() error {
+	return nil
+}
+
+type parquetReader struct {
+	r    *parquet.GenericReader[parquetRecord]
+	rows []parquetRecord
+	next int
+}
+
+func (p *parquetReader) Read() (dumpRecord, error) {
+	if p.next == len(p.rows) {
+		p.rows = p.rows[:cap(p.rows)]
+		if len(p.rows) == 0 {
+			p.rows = make([]parquetRecord, parquetBatch)
+		}
+		n, err := p.r.Read(p.rows)
+		p.rows, p.next = p.rows[:n], 0
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return dumpRecord{}, err
+		}
+	}
+	row := p.rows[p.next]
+	p.next++
+
+	record := dumpRecord{
+		Subject: row.Subject,
+		Seq:     row.Seq,
+		Time:    row.Time,
+	}
+	if row.DataRaw != "" {
+		record.DataBase64 = []byte(row.DataRaw)
+	} else if row.Data != "" {
+		record.Data = json.RawMessage(row.Data)
+	}
+	if row.Headers != "" {
+		if err := json.Unmarshal([]byte(row.Headers), &record.Headers); err != nil {
+			return record, fmt.Errorf("message %d: headers: %v", row.Seq, err)
+		}
+	}
+	return record, nil
+}
+
+func (p *parquetReader) Close() error {
+	return p.r.Close()
+}
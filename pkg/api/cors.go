@@ -0,0 +1,72 @@
+// Package api provides the HTTP building blocks of the streaming API: the
+// CORS and WebSocket origin policy, listeners, Server-Sent Events framing,
+// the per-client delivery queue sitting between NATS and a connection, and
+// the OpenAPI document built from the registered routes.
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/cors"
+)
+
+// OriginAllowed matches an Origin header against allowed origin patterns.
+// Patterns may use * wildcards, e.g. https://*.example.com or http://localhost:*,
+// and a lone * allows every origin.
+func OriginAllowed(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS answers preflight requests and sets CORS headers for origins matching
+// the patterns returned by allowed. The patterns are fetched on every request
+// so they can follow configuration reloads.
+func CORS(allowed func() []string) gin.HandlerFunc {
+	handler := cors.New(cors.Options{
+		AllowOriginFunc: func(origin string) bool {
+			return OriginAllowed(allowed(), origin)
+		},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key", "Cache-Control", "Last-Event-ID", "X-Requested-With"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})
+
+	return func(c *gin.Context) {
+		handler.HandlerFunc(c.Writer, c.Request)
+		if c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != "" {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CheckOrigin returns a WebSocket upgrader origin check: requests without an
+// Origin header (non-browser clients) and same-host origins are accepted,
+// others must match the patterns returned by allowed
+func CheckOrigin(allowed func() []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return OriginAllowed(allowed(), origin)
+	}
+}
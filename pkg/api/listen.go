@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// UnixSocketMode is applied to Unix domain sockets so only the owner and group can connect
+const UnixSocketMode = 0o660
+
+// Listen opens a TCP address or, with a unix: prefix, a Unix domain socket,
+// and reports whether it is a Unix socket
+func Listen(addr string) (net.Listener, bool, error) {
+	path, unix := strings.CutPrefix(addr, "unix:")
+	if !unix {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to listen on %s: %v", addr, err)
+		}
+		return ln, false, nil
+	}
+
+	// Remove a socket left behind by an unclean shutdown
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	if err := os.Chmod(path, UnixSocketMode); err != nil {
+		ln.Close()
+		return nil, true, fmt.Errorf("failed to set permissions on %s: %v", path, err)
+	}
+	return ln, true, nil
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Operation documents one route in the OpenAPI specification. It is declared
+// next to the route registration (see Routes) so the two can't drift apart.
+type Operation struct {
+	Path        string // Documented path when it names a wildcard differently than the route
+	Summary     string
+	Description string
+	Tags        []string
+	Params      []Param
+	Body        interface{}    // Example value whose type describes the JSON request body
+	Response    interface{}    // Example value whose type describes the JSON response
+	Status      int            // Success status, 200 when zero
+	Errors      map[int]string // Error responses by status code
+	Stream      bool           // Responds with text/event-stream
+	Security    []string       // Accepted security schemes, see Spec.SecuritySchemes
+}
+
+// Param is a path, query or header parameter
+type Param struct {
+	Name        string
+	In          string // path, query or header
+	Description string
+	Required    bool
+	Type        string   // JSON schema type, string when empty
+	Enum        []string // Allowed values
+}
+
+// Spec accumulates documented routes into an OpenAPI 3 document
+type Spec struct {
+	Title           string
+	Version         string
+	Description     string
+	SecuritySchemes map[string]interface{}
+
+	mu    sync.Mutex
+	paths map[string]map[string]Operation
+}
+
+// NewSpec returns an empty specification
+func NewSpec(title, version, description string) *Spec {
+	return &Spec{
+		Title:           title,
+		Version:         version,
+		Description:     description,
+		SecuritySchemes: make(map[string]interface{}),
+		paths:           make(map[string]map[string]Operation),
+	}
+}
+
+// Add documents a route. Gin path parameters (:name, *path) are converted to
+// OpenAPI templates, and path parameters missing from op.Params are added.
+func (s *Spec) Add(method, route string, op Operation) {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			if !hasParam(op.Params, name, "path") {
+				op.Params = append(op.Params, Param{Name: name, In: "path", Required: true})
+			}
+		}
+	}
+	path := strings.Join(segments, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paths[path] == nil {
+		s.paths[path] = make(map[string]Operation)
+	}
+	s.paths[path][strings.ToLower(method)] = op
+}
+
+func hasParam(params []Param, name, in string) bool {
+	for _, p := range params {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+// Document returns the OpenAPI 3 document
+func (s *Spec) Document() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paths := make(map[string]interface{}, len(s.paths))
+	for path, methods := range s.paths {
+		item := make(map[string]interface{}, len(methods))
+		for method, op := range methods {
+			item[method] = operationObject(method, path, op)
+		}
+		paths[path] = item
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       s.Title,
+			"version":     s.Version,
+			"description": s.Description,
+		},
+		"paths": paths,
+	}
+	if len(s.SecuritySchemes) > 0 {
+		doc["components"] = map[string]interface{}{"securitySchemes": s.SecuritySchemes}
+	}
+	return doc
+}
+
+// operationObject renders one operation
+func operationObject(method, path string, op Operation) map[string]interface{} {
+	object := map[string]interface{}{
+		"operationId": operationID(method, path),
+		"summary":     op.Summary,
+	}
+	if op.Description != "" {
+		object["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		object["tags"] = op.Tags
+	}
+
+	if len(op.Params) > 0 {
+		params := make([]interface{}, len(op.Params))
+		for i, p := range op.Params {
+			schema := map[string]interface{}{"type": "string"}
+			if p.Type != "" {
+				schema["type"] = p.Type
+			}
+			if len(p.Enum) > 0 {
+				schema["enum"] = p.Enum
+			}
+			param := map[string]interface{}{
+				"name":     p.Name,
+				"in":       p.In,
+				"required": p.Required || p.In == "path",
+				"schema":   schema,
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params[i] = param
+		}
+		object["parameters"] = params
+	}
+
+	if op.Body != nil {
+		object["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": Schema(reflect.TypeOf(op.Body))},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.Stream:
+		success["content"] = map[string]interface{}{
+			"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		}
+	case op.Response != nil:
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": Schema(reflect.TypeOf(op.Response))},
+		}
+	}
+	responses := map[string]interface{}{strconv.Itoa(status): success}
+	errorSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}
+	for code, description := range op.Errors {
+		responses[strconv.Itoa(code)] = map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": errorSchema},
+			},
+		}
+	}
+	object["responses"] = responses
+
+	if len(op.Security) > 0 {
+		security := make([]interface{}, len(op.Security))
+		for i, scheme := range op.Security {
+			security[i] = map[string]interface{}{scheme: []string{}}
+		}
+		object["security"] = security
+	}
+	return object
+}
+
+// operationID derives a stable ID such as getTxHash from the method and path
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Schema derives a JSON schema from a Go type using its json struct tags.
+// Types with custom text marshalling are strings; types with custom JSON
+// marshalling are left unconstrained.
+func Schema(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	if t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler) {
+		return map[string]interface{}{"type": "string"}
+	}
+	if t.Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return Schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": Schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": Schema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		structFields(t, properties)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structFields adds the JSON fields of a struct, flattening embedded structs
+func structFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			structFields(field.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = Schema(field.Type)
+	}
+}
+
+// ServeSpec serves the document as JSON
+func (s *Spec) ServeSpec(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Document())
+}
+
+// Routes registers routes on a gin group and documents them in a Spec
+type Routes struct {
+	group *gin.RouterGroup
+	spec  *Spec
+}
+
+// Documented wraps a router group so every route registered on it is added
+// to spec
+func Documented(group *gin.RouterGroup, spec *Spec) Routes {
+	return Routes{group: group, spec: spec}
+}
+
+// Group returns a documented sub-group
+func (r Routes) Group(path string, handlers ...gin.HandlerFunc) Routes {
+	return Routes{group: r.group.Group(path, handlers...), spec: r.spec}
+}
+
+// Handle registers and documents a route
+func (r Routes) Handle(method, path string, op Operation, handlers ...gin.HandlerFunc) {
+	documented := path
+	if op.Path != "" {
+		documented = op.Path
+	}
+	r.spec.Add(method, strings.TrimSuffix(r.group.BasePath(), "/")+documented, op)
+	r.group.Handle(method, path, handlers...)
+}
+
+// GET registers and documents a GET route
+func (r Routes) GET(path string, op Operation, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodGet, path, op, handlers...)
+}
+
+// POST registers and documents a POST route
+func (r Routes) POST(path string, op Operation, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPost, path, op, handlers...)
+}
+
+// PUT registers and documents a PUT route
+func (r Routes) PUT(path string, op Operation, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPut, path, op, handlers...)
+}
+
+// PATCH registers and documents a PATCH route
+func (r Routes) PATCH(path string, op Operation, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPatch, path, op, handlers...)
+}
+
+// DELETE registers and documents a DELETE route
+func (r Routes) DELETE(path string, op Operation, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodDelete, path, op, handlers...)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Overflow policies applied when a client falls behind its delivery rate
+const (
+	DropOldest = "drop-oldest" // Keep a bounded backlog, discarding the oldest messages first
+	Conflate   = "conflate"    // Keep only the latest message per subject, for snapshot-like streams
+	Disconnect = "disconnect"  // Close the connection once the backlog is full
+)
+
+// ErrSlowConsumer is returned by Next once a disconnect-policy queue overflowed
+var ErrSlowConsumer = errors.New("slow consumer")
+
+// Message is a message waiting for delivery
+type Message struct {
+	Subject string
+	Seq     uint64 // JetStream stream sequence, sent as the SSE event ID
+	Data    []byte
+	Event   string // SSE event name of a notice, empty for stream messages
+}
+
+// Queue buffers messages for one streaming client between the NATS callback
+// and the connection writer, applying a rate limit and an overflow policy
+type Queue struct {
+	mu         sync.Mutex
+	items      []Message
+	size       int
+	policy     string
+	overflowed bool
+	notify     chan struct{}
+	limiter    *rate.Limiter
+}
+
+// NewQueue returns a queue holding up to size messages. Unknown policies fall
+// back to DropOldest; limiter may be nil for unlimited delivery.
+func NewQueue(size int, policy string, limiter *rate.Limiter) *Queue {
+	if policy != Conflate && policy != Disconnect {
+		policy = DropOldest
+	}
+	return &Queue{
+		size:    max(size, 1),
+		policy:  policy,
+		notify:  make(chan struct{}, 1),
+		limiter: limiter,
+	}
+}
+
+// Policy returns the overflow policy of the queue
+func (q *Queue) Policy() string {
+	return q.policy
+}
+
+// Push enqueues a message and reports how many queued messages were discarded to make room
+func (q *Queue) Push(msg Message) int {
+	q.mu.Lock()
+	dropped := 0
+	replaced := false
+	if q.policy == Conflate {
+		// Replace the pending message of the same subject in place
+		for i := range q.items {
+			if q.items[i].Subject == msg.Subject && q.items[i].Event == msg.Event {
+				q.items[i] = msg
+				dropped, replaced = 1, true
+				break
+			}
+		}
+	}
+	if !replaced {
+		switch {
+		case len(q.items) < q.size:
+			q.items = append(q.items, msg)
+		case q.policy == Disconnect:
+			q.overflowed = true
+			dropped = 1
+		default:
+			dropped = len(q.items) - q.size + 1
+			q.items = append(q.items[dropped:], msg)
+		}
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// Next blocks until a message may be delivered under the rate limit. It fails
+// with ErrSlowConsumer once a disconnect-policy queue overflowed, or with the
+// context error when ctx is done.
+func (q *Queue) Next(ctx context.Context) (Message, error) {
+	for {
+		q.mu.Lock()
+		empty, overflowed := len(q.items) == 0, q.overflowed
+		q.mu.Unlock()
+
+		if overflowed {
+			return Message{}, ErrSlowConsumer
+		}
+		if empty {
+			select {
+			case <-ctx.Done():
+				return Message{}, ctx.Err()
+			case <-q.notify:
+				continue
+			}
+		}
+
+		// Wait for a token before taking the message so conflation keeps
+		// replacing it with fresher data in the meantime
+		if q.limiter != nil {
+			if err := q.limiter.Wait(ctx); err != nil {
+				return Message{}, err
+			}
+		}
+
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.mu.Unlock()
+			continue
+		}
+		msg := q.items[0]
+		q.items[0] = Message{}
+		q.items = q.items[1:]
+		q.mu.Unlock()
+		return msg, nil
+	}
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WriteSSE writes and flushes one SSE frame. The write deadline turns a client
+// that stopped reading into a write error, so its subscription is released.
+func WriteSSE(w http.ResponseWriter, timeout time.Duration, format string, args ...interface{}) error {
+	rc := http.NewResponseController(w)
+	if timeout > 0 {
+		_ = rc.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	if _, err := fmt.Fprintf(w, format, args...); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// swaggerUIVersion pins the Swagger UI assets loaded by the explorer page
+const swaggerUIVersion = "5.17.14"
+
+// SwaggerUI serves an interactive API explorer for the document at specURL.
+// The page is embedded in the binary; the Swagger UI assets load from a CDN.
+func SwaggerUI(specURL string) gin.HandlerFunc {
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>SomniaStream API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "%[2]s", dom_id: "#swagger-ui", deepLinking: true });
+  </script>
+</body>
+</html>
+`, swaggerUIVersion, html.EscapeString(specURL))
+
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	}
+}
@@ -0,0 +1,223 @@
+// Package client is a Go client for the SomniaStream HTTP API.
+//
+// It subscribes to streams over SSE with automatic reconnects, resuming after
+// the last received event, decodes payloads into typed Block, PendingBatch and
+// LogBatch values, and wraps the transaction status and gas history
+// endpoints. Services with access to the NATS server can consume the same
+// streams directly from JetStream with ConsumeJetStream.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to one SomniaStream server
+type Client struct {
+	baseURL    string
+	apiKey     string
+	token      string
+	http       *http.Client
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey authenticates with an API key (X-API-Key)
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithToken authenticates with a JWT bearer token
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient replaces the HTTP client. Its Timeout must be zero, or
+// streams are cut off after it.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithReconnectBackoff sets the delay before the first reconnect attempt,
+// doubled on each failure up to max
+func WithReconnectBackoff(min, max time.Duration) Option {
+	return func(c *Client) { c.minBackoff, c.maxBackoff = min, max }
+}
+
+// New returns a client for a server such as "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		http:       &http.Client{},
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is returned for non-2xx responses
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if any
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("somnia-stream: %d %s", e.StatusCode, e.Message)
+}
+
+// temporary reports whether the request may succeed when retried
+func (e *APIError) temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// newRequest builds an authenticated request for a path and query
+func (c *Client) newRequest(ctx context.Context, path string, query url.Values) (*http.Request, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do sends a request and returns the response, or an *APIError for non-2xx
+// responses
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024)); json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return nil, apiErr
+}
+
+// getJSON decodes the JSON response of a GET request into v
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	req, err := c.newRequest(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Streams returns the streams available to the caller with their descriptions
+func (c *Client) Streams(ctx context.Context) (map[string]string, error) {
+	var resp struct {
+		Streams map[string]string `json:"streams"`
+	}
+	if err := c.getJSON(ctx, "/streams", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Streams, nil
+}
+
+// TxStatus returns the latest known state of a transaction. Unknown
+// transactions fail with an *APIError with status 404.
+func (c *Client) TxStatus(ctx context.Context, hash string) (*TxStatus, error) {
+	var status TxStatus
+	if err := c.getJSON(ctx, "/tx/"+url.PathEscape(hash), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GasHistoryQuery selects the gas history window. Zero fields use the server
+// defaults: a 1h window, percentiles 25,50,95, no series and source gasPrice.
+type GasHistoryQuery struct {
+	Window      time.Duration
+	Percentiles []float64
+	Interval    time.Duration // Bucket size of the returned series
+	Source      string        // gasPrice or basefee
+}
+
+// GasHistory returns gas price or base fee percentiles over a window
+func (c *Client) GasHistory(ctx context.Context, q GasHistoryQuery) (*GasHistory, error) {
+	query := url.Values{}
+	if q.Window > 0 {
+		query.Set("window", q.Window.String())
+	}
+	if len(q.Percentiles) > 0 {
+		parts := make([]string, len(q.Percentiles))
+		for i, p := range q.Percentiles {
+			parts[i] = strconv.FormatFloat(p, 'f', -1, 64)
+		}
+		query.Set("percentiles", strings.Join(parts, ","))
+	}
+	if q.Interval > 0 {
+		query.Set("interval", q.Interval.String())
+	}
+	if q.Source != "" {
+		query.Set("source", q.Source)
+	}
+
+	var history GasHistory
+	if err := c.getJSON(ctx, "/gas/history", query, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// Health returns the component status of the server. A degraded server
+// answers 503 with the same body, which is returned without an error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	req, err := c.newRequest(ctx, "/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+
+	var health Health
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/streams"
+)
+
+// ConsumeJetStream reads a stream straight from JetStream, bypassing the HTTP
+// server, and calls handler for every message until ctx is done or handler
+// returns an error. stream is a built-in or derived stream name such as
+// "blocks", or a raw subject.
+// Event IDs are the same stream sequences the SSE endpoint sends, so
+// resumeFrom can come from either transport; zero starts at new messages.
+// The ordered consumer recreates itself after NATS reconnects.
+func ConsumeJetStream(ctx context.Context, js nats.JetStreamContext, stream string, resumeFrom uint64, handler func(Event) error) error {
+	return ConsumeNamespace(ctx, js, "", stream, resumeFrom, handler)
+}
+
+// ConsumeNamespace is ConsumeJetStream for a deployment publishing under a
+// subject namespace (SUBJECT_NAMESPACE on the server)
+func ConsumeNamespace(ctx context.Context, js nats.JetStreamContext, ns streams.Namespace, stream string, resumeFrom uint64, handler func(Event) error) error {
+	subject := stream
+	if s, ok := streams.LookupBuiltin(stream); ok {
+		subject = s
+	} else if streams.NamePattern.MatchString(stream) {
+		subject = streams.DerivedSubjectPrefix + stream
+	}
+	subject = ns.Subject(subject)
+
+	deliver := nats.DeliverNew()
+	if resumeFrom > 0 {
+		deliver = nats.StartSequence(resumeFrom + 1)
+	}
+	msgs := make(chan *nats.Msg, 256)
+	sub, err := js.ChanSubscribe(subject, msgs, nats.OrderedConsumer(), deliver)
+	if err != nil {
+		return fmt.Errorf("subscribe to %s: %w", subject, err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-msgs:
+			event := Event{Data: msg.Data}
+			if meta, err := msg.Metadata(); err == nil {
+				event.ID = meta.Sequence.Stream
+			}
+			if err := handler(event); err != nil {
+				return err
+			}
+		}
+	}
+}
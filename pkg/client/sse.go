@@ -0,0 +1,196 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one message of a stream
+type Event struct {
+	ID   uint64 // JetStream stream sequence, used to resume after reconnects
+	Data json.RawMessage
+}
+
+// SubscribeOptions tune a stream subscription
+type SubscribeOptions struct {
+	Detail      string                               // Block detail level on the blocks stream: header, hashes or full
+	ResumeFrom  uint64                               // Start after this event ID instead of at the latest message
+	OnNotice    func(Notice)                         // Called when the server reports dropped messages
+	OnReconnect func(err error, delay time.Duration) // Called before each reconnect attempt
+}
+
+// handlerError marks errors returned by the caller's handler, which end the
+// subscription instead of triggering a reconnect
+type handlerError struct{ err error }
+
+func (e handlerError) Error() string { return e.err.Error() }
+
+// Subscribe streams a stream over SSE and calls handler for every message
+// until ctx is done or handler returns an error, which is then returned.
+// Dropped connections and temporary server errors are retried with backoff,
+// resuming after the last delivered event so no stored message is missed.
+func (c *Client) Subscribe(ctx context.Context, stream string, opts SubscribeOptions, handler func(Event) error) error {
+	lastID := opts.ResumeFrom
+	backoff := c.minBackoff
+	for {
+		connected, err := c.stream(ctx, stream, opts, &lastID, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var herr handlerError
+		if errors.As(err, &herr) {
+			return herr.err
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && !apiErr.temporary() {
+			return err
+		}
+		if err == nil {
+			err = io.EOF // The server closed the stream, e.g. after the idle timeout
+		}
+
+		if connected {
+			backoff = c.minBackoff
+		}
+		delay := backoff
+		if apiErr != nil && apiErr.RetryAfter > delay {
+			delay = apiErr.RetryAfter
+		}
+		if opts.OnReconnect != nil {
+			opts.OnReconnect(err, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+// stream runs one SSE connection and reports whether it was established
+func (c *Client) stream(ctx context.Context, stream string, opts SubscribeOptions, lastID *uint64, handler func(Event) error) (bool, error) {
+	query := url.Values{}
+	if opts.Detail != "" {
+		query.Set("detail", opts.Detail)
+	}
+	req, err := c.newRequest(ctx, "/sse/"+url.PathEscape(stream), query)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(*lastID, 10))
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	var id uint64
+	var event string
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return true, nil
+			}
+			return true, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			// A blank line dispatches the buffered event
+			if data.Len() > 0 {
+				if err := c.dispatch(event, id, data.String(), opts, handler); err != nil {
+					return true, err
+				}
+				if event == "" && id > 0 {
+					*lastID = id
+				}
+			}
+			event, id = "", 0
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Keepalive comment
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				id, _ = strconv.ParseUint(value, 10, 64)
+			case "event":
+				event = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+		}
+	}
+}
+
+// dispatch hands one SSE event to the notice callback or the handler
+func (c *Client) dispatch(event string, id uint64, data string, opts SubscribeOptions, handler func(Event) error) error {
+	if event == "notice" {
+		if opts.OnNotice != nil {
+			var notice Notice
+			if err := json.Unmarshal([]byte(data), &notice); err == nil {
+				opts.OnNotice(notice)
+			}
+		}
+		return nil
+	}
+	if err := handler(Event{ID: id, Data: json.RawMessage(data)}); err != nil {
+		return handlerError{err}
+	}
+	return nil
+}
+
+// Decode adapts a handler of typed payloads to Subscribe. Payloads that fail
+// to decode end the subscription with the decoding error.
+func Decode[T any](handler func(T) error) func(Event) error {
+	return func(event Event) error {
+		var payload T
+		if err := json.Unmarshal(event.Data, &payload); err != nil {
+			return fmt.Errorf("decode event %d: %w", event.ID, err)
+		}
+		return handler(payload)
+	}
+}
+
+// Blocks subscribes to new blocks. Set opts.Detail to header or hashes to
+// receive blocks without full transactions.
+func (c *Client) Blocks(ctx context.Context, opts SubscribeOptions, handler func(Block) error) error {
+	return c.Subscribe(ctx, "blocks", opts, Decode(handler))
+}
+
+// Pending subscribes to pending transaction deltas
+func (c *Client) Pending(ctx context.Context, opts SubscribeOptions, handler func(PendingBatch) error) error {
+	return c.Subscribe(ctx, "pending", opts, Decode(handler))
+}
+
+// PendingSnapshots subscribes to the periodic full pending pool snapshots
+func (c *Client) PendingSnapshots(ctx context.Context, opts SubscribeOptions, handler func(PendingBatch) error) error {
+	return c.Subscribe(ctx, "pending-full", opts, Decode(handler))
+}
+
+// Logs subscribes to recent event logs
+func (c *Client) Logs(ctx context.Context, opts SubscribeOptions, handler func(LogBatch) error) error {
+	return c.Subscribe(ctx, "logs", opts, Decode(handler))
+}
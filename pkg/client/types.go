@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Part describes how a capped payload was truncated or split (see
+// OVERFLOW_MODE); Parts is zero unless the batch was split
+type Part struct {
+	Returned  int  `json:"returned"`
+	Truncated bool `json:"truncated"`
+	Omitted   int  `json:"omitted,omitempty"`
+	Part      int  `json:"part,omitempty"`
+	Parts     int  `json:"parts,omitempty"`
+}
+
+// Block is a block published on the blocks, blocks-header and blocks-hashes
+// streams. Transactions is empty for header-only blocks and holds only the
+// hash of each transaction on blocks-hashes.
+type Block struct {
+	Number        string      `json:"number"`
+	Hash          common.Hash `json:"hash"`
+	ParentHash    common.Hash `json:"parentHash"`
+	Timestamp     uint64      `json:"timestamp"`
+	GasUsed       uint64      `json:"gasUsed"`
+	GasLimit      uint64      `json:"gasLimit"`
+	Difficulty    string      `json:"difficulty"`
+	Size          uint64      `json:"size"`
+	Miner         string      `json:"miner"`
+	ExtraData     string      `json:"extraData"`
+	StateRoot     common.Hash `json:"stateRoot"`
+	ReceiptsRoot  common.Hash `json:"receiptsRoot"`
+	TxRoot        common.Hash `json:"txRoot"`
+	UnclesHash    common.Hash `json:"unclesHash"`
+	Nonce         string      `json:"nonce"`
+	MixHash       common.Hash `json:"mixHash"`
+	BaseFeePerGas string      `json:"baseFeePerGas,omitempty"` // Decimal wei
+	TxCount       int         `json:"txCount"`
+	Transactions  []Tx        `json:"transactions,omitempty"`
+}
+
+// Tx is a transaction of a published block. Amounts are decimal wei strings.
+type Tx struct {
+	Hash                 common.Hash     `json:"hash"`
+	From                 *common.Address `json:"from"`
+	To                   *common.Address `json:"to"`
+	Value                string          `json:"value"`
+	GasPrice             string          `json:"gasPrice"`
+	Gas                  uint64          `json:"gas"`
+	Nonce                uint64          `json:"nonce"`
+	Type                 uint8           `json:"type"`
+	EffectiveTip         string          `json:"effectiveTip,omitempty"`
+	MaxFeePerGas         string          `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string          `json:"maxPriorityFeePerGas,omitempty"`
+}
+
+// UnmarshalJSON accepts a bare hash as published on blocks-hashes
+func (tx *Tx) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*tx = Tx{}
+		return json.Unmarshal(data, &tx.Hash)
+	}
+	type plain Tx
+	return json.Unmarshal(data, (*plain)(tx))
+}
+
+// PendingTx is a pending transaction as returned by eth_pendingTransactions
+type PendingTx struct {
+	Hash                 common.Hash     `json:"hash"`
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Value                *hexutil.Big    `json:"value"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	Input                hexutil.Bytes   `json:"input"`
+	Type                 hexutil.Uint64  `json:"type"`
+}
+
+// PendingBatch is a message of the pending (type "delta") or pending-full
+// (type "snapshot") streams. Count is the size of the whole pending pool;
+// deltas list the newly observed transactions and the hashes that left it.
+type PendingBatch struct {
+	Type         string        `json:"type"`
+	Count        int           `json:"count"`
+	Added        int           `json:"added,omitempty"`
+	Removed      []common.Hash `json:"removed,omitempty"`
+	Timestamp    int64         `json:"timestamp"`
+	Transactions []PendingTx   `json:"transactions"`
+	Part
+}
+
+// LogBatch is a message of the logs stream
+type LogBatch struct {
+	Count     int         `json:"count"`
+	FromBlock uint64      `json:"fromBlock"`
+	ToBlock   uint64      `json:"toBlock"`
+	Timestamp int64       `json:"timestamp"`
+	Logs      []types.Log `json:"logs"`
+	Part
+}
+
+// Notice is sent to a client that lost messages to its overflow policy
+type Notice struct {
+	Type      string `json:"type"`
+	Policy    string `json:"policy"`
+	Dropped   uint64 `json:"dropped"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Lifecycle is the in-memory lifecycle state of a tracked transaction
+type Lifecycle struct {
+	Hash        string `json:"hash"`
+	State       string `json:"state"`
+	From        string `json:"from,omitempty"`
+	Nonce       string `json:"nonce,omitempty"`
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+	BlockHash   string `json:"blockHash,omitempty"`
+}
+
+// TxStatus is the response of GET /tx/:hash. Status is one of pending,
+// mined, failed, finalized, dropped or unknown.
+type TxStatus struct {
+	Hash          common.Hash            `json:"hash"`
+	Status        string                 `json:"status"`
+	BlockNumber   uint64                 `json:"blockNumber,omitempty"`
+	BlockHash     *common.Hash           `json:"blockHash,omitempty"`
+	Confirmations uint64                 `json:"confirmations,omitempty"`
+	Transaction   *types.Transaction     `json:"transaction,omitempty"`
+	Receipt       *types.Receipt         `json:"receipt,omitempty"`
+	Lifecycle     *Lifecycle             `json:"lifecycle,omitempty"`
+	Stored        map[string]interface{} `json:"stored,omitempty"`
+}
+
+// GasHistory is the response of GET /gas/history. Percentiles are keyed like
+// "p50" and given in gwei.
+type GasHistory struct {
+	Source      string             `json:"source"`
+	Window      string             `json:"window"`
+	From        int64              `json:"from"`
+	To          int64              `json:"to"`
+	Samples     int                `json:"samples"`
+	Unit        string             `json:"unit"`
+	Percentiles map[string]float64 `json:"percentiles"`
+	Interval    string             `json:"interval,omitempty"`
+	Series      []GasHistoryBucket `json:"series,omitempty"`
+}
+
+// GasHistoryBucket is one interval of a gas history series
+type GasHistoryBucket struct {
+	Start       int64              `json:"start"`
+	Samples     int                `json:"samples"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+// Health is the response of the /health endpoint
+type Health struct {
+	Status     string                     `json:"status"` // ok or degraded
+	Components map[string]HealthComponent `json:"components"`
+	Timestamp  int64                      `json:"timestamp"`
+}
+
+// HealthComponent is the status of one of rpc, nats, jetstream and monitors.
+// Only the fields of the component are set.
+type HealthComponent struct {
+	Status   string                   `json:"status"`
+	Error    string                   `json:"error,omitempty"`
+	Head     uint64                   `json:"head,omitempty"`     // rpc
+	HeadAge  string                   `json:"headAge,omitempty"`  // rpc
+	Latency  string                   `json:"latency,omitempty"`  // rpc
+	Server   string                   `json:"server,omitempty"`   // nats
+	Missing  []string                 `json:"missing,omitempty"`  // jetstream
+	Monitors map[string]MonitorHealth `json:"monitors,omitempty"` // monitors
+}
+
+// MonitorHealth is the status of one background monitor
+type MonitorHealth struct {
+	Status      string `json:"status"` // ok, paused, starting or stale
+	LastSuccess int64  `json:"lastSuccess,omitempty"`
+	LastError   string `json:"lastError,omitempty"`
+}
@@ -0,0 +1,836 @@
+// Package config loads the SomniaStream configuration from environment
+// variables (and a .env file loaded by the caller), with defaults for every
+// setting.
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every SomniaStream setting. Fields are plain values so an
+// embedding service can build a Config by hand instead of calling Load.
+type Config struct {
+	RPCEndpoint string
+	NATSUrl     string
+	NATSToken   string
+	ServerPort  string
+
+	// Listeners
+	ServerListen []string // Addresses for the public API, host:port or unix:/path (defaults to :SERVER_PORT)
+	AdminListen  []string // Separate addresses for /admin and /auth routes (served with the public API when empty)
+	Dashboard    bool     // Serve the embedded live dashboard at /
+
+	// NATS TLS and authentication
+	NATSTLS          bool   // Require TLS to the NATS server
+	NATSTLSCAFile    string // CA bundle for the NATS server certificate
+	NATSTLSCertFile  string // Client certificate for NATS TLS
+	NATSTLSKeyFile   string // Client key for NATS TLS
+	NATSCredsFile    string // .creds file (JWT + NKey) for operator-mode clusters and NGS
+	NATSNKeySeedFile string // NKey seed file
+
+	// Embedded NATS server
+	EmbeddedNATS        bool   // Run an in-process NATS server with JetStream instead of connecting to NATS_URL
+	EmbeddedNATSDataDir string // JetStream store directory of the embedded server
+	EmbeddedNATSAddr    string // host:port the embedded server also listens on (in-process only when empty)
+
+	// Mock RPC
+	MockRPC           bool          // Serve a synthetic chain locally instead of connecting to RPC_ENDPOINT
+	MockRPCAddr       string        // host:port the mock JSON-RPC server listens on
+	MockChainID       int           // Chain ID of the synthetic chain
+	MockBlockInterval time.Duration // Time between synthetic blocks
+	MockTxsPerBlock   int           // Average transactions per synthetic block
+	MockLogsPerTx     int           // Transfer logs emitted by each synthetic token transaction
+	MockFailureRate   float64       // Share of synthetic token transactions that revert (0-1)
+	MockSeed          int           // Seeds the synthetic accounts and traffic (0 = random)
+
+	// RPC record and replay
+	RPCRecordFile string // Append every raw RPC response to this file
+	RPCReplayFile string // Answer RPC requests from this recording instead of RPC_ENDPOINT
+
+	// Additional networks
+	ChainName string  // Name of the RPC_ENDPOINT network, usable in /sse/:chain/:stream
+	Chains    []Chain // Further networks monitored next to RPC_ENDPOINT
+
+	SubjectNamespace string // Prefixes subjects with <namespace>.<chainId> for shared NATS clusters (disabled when empty)
+
+	// Fault injection
+	Chaos bool // Allow injecting RPC timeouts, NATS disconnects, malformed payloads and delayed blocks through /admin/chaos
+
+	// Gas price spike detection
+	GasSpikeWindow     int     // Number of gas price samples in the rolling baseline
+	GasSpikeMultiplier float64 // Deviation multiple that triggers an alert
+	GasSpikeMinSamples int     // Samples required before alerts are emitted
+
+	// Whale transaction alerts
+	WhaleThreshold       string            // Minimum native value (in ether units) for a whale alert
+	WhaleTokenThresholds map[string]string // Minimum ERC-20 transfer amounts (in token units) for a whale alert, by token address
+
+	// Bridge monitoring
+	BridgeContracts map[string]string // Bridge contract addresses watched for deposits and withdrawals, by name
+
+	// Liquidity pool tracking
+	PoolContracts  map[string]string // Uniswap V2 or V3 style pool addresses whose state is published, by name
+	PoolQuoteToken string            // Token TVL is valued in (per-token totals only when empty)
+
+	// Balance watching
+	BalanceWatchlist map[string]string // Addresses whose native balance changes are published, by name
+
+	// Stuck transaction detection
+	NonceWatchlist map[string]string // Addresses whose nonces are checked for gaps and stuck transactions, by name
+	StuckTxAge     time.Duration     // How long the next nonce may stay pending before it is reported as stuck
+
+	// Block tracing
+	BlockTracer string // debug_traceBlockByNumber tracer published on eth.traces, "callTracer" or "prestateTracer" (disabled when empty)
+	TraceMaxTxs int    // Max transaction traces per message
+
+	// Internal transactions
+	InternalTxs    bool // Derive internal transactions from callTracer traces and publish them on eth.tx.internal
+	InternalTxsMax int  // Max internal transactions per message
+
+	// State diffs
+	StateDiffs    bool // Publish the account and storage changes of every block on eth.state.diffs
+	StateDiffsMax int  // Max changed accounts per message
+
+	// Consensus statistics
+	ConsensusStats      bool              // Publish block proposers, participation and missed slots on eth.consensus
+	ConsensusValidators map[string]string // Validator addresses whose participation is reported, by name
+	ConsensusSlotTime   time.Duration     // Expected block interval missed slots are counted against (0 = not counted)
+
+	// Block scheduling
+	AdaptivePolling   bool          // Adapt the blocks poll interval to the observed block interval
+	AdaptivePollMin   time.Duration // Fastest adaptive blocks poll interval
+	BlockSubscription bool          // Poll for blocks as soon as a newHeads subscription announces one
+	BlockCatchupMax   int           // Max skipped blocks published per poll before older ones are dropped
+	BlockFetchWorkers int           // Concurrent block and receipt fetches while catching up
+
+	// Failed transaction tracking
+	TrackFailedTxs bool // Fetch receipts and publish reverted transactions
+
+	// Monitor checkpoints
+	Checkpoints        bool          // Resume block-driven monitors from their last processed block after a restart
+	CheckpointInterval time.Duration // How often checkpoints are written to the MONITOR_CHECKPOINTS bucket
+	CheckpointMaxGap   int           // Max blocks backfilled after a restart; older missed blocks are skipped
+
+	// In-memory caches
+	BlockCacheSize   int // Recent blocks kept by number
+	ReceiptCacheSize int // Receipts kept by transaction hash
+
+	// Receipt fetching
+	ReceiptBatchSize   int // eth_getTransactionReceipt calls per batch when eth_getBlockReceipts is unavailable
+	ReceiptConcurrency int // Concurrent receipt batches per block
+
+	// Transaction lifecycle tracking
+	LifecycleFinalityDepth int           // Confirmations before a mined transaction is finalized
+	LifecycleDropTimeout   time.Duration // How long a pending transaction may go unseen before it is dropped
+
+	// Mempool delta stream
+	PendingSnapshotInterval time.Duration // How often a full pending snapshot is published for resync
+
+	// newPendingTransactions subscription
+	PendingSubscription   bool   // Subscribe to newPendingTransactions when a WebSocket endpoint is available
+	PendingWSEndpoint     string // WebSocket RPC endpoint (defaults to RPC_ENDPOINT when it is ws:// or wss://)
+	PendingHydrateWorkers int    // Concurrent eth_getTransactionByHash calls for hash-only notifications
+
+	// Fee suggestions
+	FeeHistoryBlocks int // Number of recent blocks sampled with eth_feeHistory
+
+	// EIP-1559 base fee series
+	TrackBaseFee bool // Publish per-block base fee and effective tip stats
+
+	// Throughput aggregates
+	ThroughputWindows []time.Duration // Rolling windows for TPS, block interval and utilization
+
+	// Rollups
+	RollupRetention time.Duration // How long per-minute/per-hour rollups are kept
+
+	// Block stream variants
+	BlockDetailLevels []string // Any of "header", "hashes", "full"
+
+	// Payload caps
+	PendingMaxTxs     int    // Max pending transactions per message
+	LogsMaxPerMessage int    // Max logs per message
+	LogsChunkSize     int    // Blocks per eth_getLogs call, halved further when the endpoint rejects a range
+	OverflowMode      string // "truncate" or "split" when a cap is exceeded
+
+	// Monitor scheduling
+	PollIntervals    map[string]time.Duration // Per-monitor poll interval overrides
+	DisabledMonitors []string                 // Monitors that start paused
+
+	// Admin API
+	AdminToken string // Bearer token for /admin routes (admin API is disabled when empty)
+
+	// Per-client delivery
+	ClientRateLimit        float64           // Messages per second delivered to one client (0 = unlimited)
+	ClientRateBurst        int               // Messages a client may receive in a burst above the rate
+	ClientQueueSize        int               // Messages buffered per client before the overflow policy applies
+	ClientOverflowPolicy   string            // "drop-oldest" or "conflate"
+	ClientOverflowPolicies map[string]string // Per-stream overflow policy overrides
+
+	// Delivery semantics of the streaming endpoints
+	DeliveryMode          string            // "at-most-once" or "at-least-once"
+	DeliveryModes         map[string]string // Per-stream delivery mode overrides
+	DeliveryAckWait       time.Duration     // How long an at-least-once event may go unacknowledged before it is redelivered
+	DeliveryMaxAckPending int               // Unacknowledged events per at-least-once consumer before delivery pauses
+	DeliveryConsumerTTL   time.Duration     // How long an unused at-least-once or pull consumer is kept
+	ConsumeMaxBatch       int               // Most messages one POST /consume call returns
+	ConsumeMaxWait        time.Duration     // Longest a POST /consume call waits for messages
+
+	// Streaming connection limits (0 = unlimited)
+	MaxConnections          int // Concurrent SSE/WS connections across all streams
+	MaxConnectionsPerStream int // Concurrent connections to a single stream
+	MaxConnectionsPerIP     int // Concurrent connections from a single client IP
+
+	// SSE connection upkeep
+	SSEHeartbeatInterval time.Duration // Quiet period after which a ": keepalive" comment is sent (0 = never)
+	SSEIdleTimeout       time.Duration // Close connections that received no events for this long (0 = never)
+	SSEWriteTimeout      time.Duration // Close connections whose writes block for this long (0 = never)
+
+	// HTTP rate limiting
+	HTTPRateLimit  float64  // Requests per second per client IP (0 = unlimited)
+	HTTPRateBurst  int      // Requests a client IP may burst above the rate
+	TrustedProxies []string // Proxy IPs/CIDRs whose X-Forwarded-For header is trusted
+
+	// eth_call proxy
+	CallRateLimit float64 // POST /call and /simulate requests per second per API key, JWT subject or client IP (0 = unlimited)
+	CallRateBurst int     // Calls a caller may burst above the rate
+	CallCacheSize int     // Results cached by block and call (0 disables caching)
+
+	// Cross-origin policy
+	CORSAllowedOrigins []string // Origins allowed to call the API from a browser (* wildcards supported)
+	WSAllowedOrigins   []string // Origins allowed to open WebSockets (defaults to CORSAllowedOrigins)
+
+	// API key authentication
+	APIKeyAuth bool // Require an API key on streaming and history endpoints
+
+	// JWT authentication
+	JWTIssuer       string        // Required "iss" claim (not checked when empty)
+	JWTAudience     string        // Required "aud" claim (not checked when empty)
+	JWTJWKSURL      string        // JWKS endpoint for RS*/ES* signing keys
+	JWTJWKSRefresh  time.Duration // How long fetched signing keys are cached
+	JWTSecret       string        // Shared secret for HS* tokens
+	JWTStreamsClaim string        // Claim listing the streams a token may access
+
+	// OIDC login for admin routes
+	OIDCIssuer         string        // Issuer URL (OIDC login is disabled when empty)
+	OIDCClientID       string        // OAuth client ID
+	OIDCClientSecret   string        // OAuth client secret
+	OIDCRedirectURL    string        // Public URL of /auth/callback
+	OIDCAllowedUsers   []string      // Emails allowed to sign in (anyone when both lists are empty)
+	OIDCAllowedDomains []string      // Email domains allowed to sign in
+	SessionSecret      string        // HMAC key for session cookies (random per process when empty)
+	SessionTTL         time.Duration // Lifetime of a login session
+
+	// RPC retries
+	RPCRetryAttempts   int           // Total attempts per RPC request
+	RPCRetryBackoff    time.Duration // Delay before the first retry, doubled on each further attempt
+	RPCRetryMaxBackoff time.Duration // Upper bound of a single retry delay
+	RPCRetryJitter     float64       // Fraction of each delay that is randomized (0-1)
+	RPCAttemptTimeout  time.Duration // Timeout of a single attempt (0 = caller's deadline only)
+	RPCRetryCodes      []string      // JSON-RPC error codes treated as transient
+
+	// RPC circuit breaker
+	RPCBreakerThreshold int           // Consecutive failed RPC requests that open the circuit (0 = disabled)
+	RPCBreakerCooldown  time.Duration // How long the circuit stays open before a half-open probe
+
+	// RPC telemetry
+	RPCMetricsInterval time.Duration // How often per-method RPC latency and error rates are published on somnia.rpc.metrics
+
+	// Multi-endpoint head lag
+	RPCPeerEndpoints []string      // Additional RPC endpoints whose head blocks are compared with RPC_ENDPOINT
+	HeadLagInterval  time.Duration // How often head blocks are compared
+	HeadLagThreshold int           // Blocks the active endpoint may fall behind its peers before an alert (0 = no alerts)
+
+	// Cross-provider consistency checks
+	ConsistencyEndpoint string // Second RPC provider that confirms block hashes before publishing (disabled when empty)
+	ConsistencyStrict   bool   // Withhold blocks whose hash the second provider disagrees with
+
+	// Name-service enrichment
+	NameRegistry  string        // ENS-compatible registry whose reverse records name addresses (disabled when empty)
+	NameCacheTTL  time.Duration // How long resolved names, and addresses without one, are cached
+	NameCacheSize int           // Addresses kept in the name cache
+
+	// Method selector decoding
+	DecodeSelectors   bool   // Annotate transactions with the method their 4-byte selector calls
+	SelectorFile      string // Local signatures overriding the built-in ones
+	SelectorLookupURL string // 4byte.directory compatible API for unknown selectors (disabled when empty)
+
+	// Contract ABI retrieval
+	ABISourcifyURL     string        // Sourcify server verified ABIs are fetched from (disabled when empty)
+	ABIExplorerURL     string        // Etherscan or Blockscout compatible API verified ABIs are fetched from (disabled when empty)
+	ABIExplorerAPIKey  string        // API key of ABIExplorerURL
+	ABIFetchRetryAfter time.Duration // How long an unverified contract isn't asked for again
+
+	// Multicall3 contract that contract reads are batched through (one call per read when empty)
+	MulticallAddress string
+
+	// Token metadata
+	TokenMetadata    bool          // Add name, symbol and decimals of the emitting contract to token event logs
+	TokenMetadataTTL time.Duration // How long cached token metadata is kept before it is fetched again
+	TokenCacheSize   int           // Contracts whose metadata is kept in memory, the rest is read from the bucket
+
+	// Publish retries and dead-lettering
+	PublishRetries      int           // Extra JetStream publish attempts before a payload is dead-lettered
+	PublishRetryBackoff time.Duration // Delay before the first retry, doubled on each further attempt
+	DLQSpoolDir         string        // Local spool for payloads that can't reach somnia.dlq either (disabled when empty)
+
+	// Publish hooks
+	PublishWasmHooks    map[string]string // WebAssembly modules run on messages before publishing, by stream name
+	PublishWasmTimeout  time.Duration     // Time a module gets per message
+	PublishWasmMemoryMB int               // Memory limit of each module instance
+
+	// Scheduled snapshot exports
+	Exports        []Export // Streams whose recent messages are exported on a schedule
+	ExportDir      string   // Directory snapshots are written to (disabled when empty)
+	ExportS3Bucket string   // S3 bucket snapshots are uploaded to (disabled when empty)
+	ExportS3Prefix string   // Key prefix of uploaded snapshots
+
+	// Archival of messages before they leave JetStream
+	ArchiveStreams      []string      // Streams whose messages are archived
+	ArchiveDir          string        // Directory the archive is kept in, unless ARCHIVE_S3_BUCKET is set
+	ArchiveS3Bucket     string        // S3 bucket the archive is kept in (the directory is used when empty)
+	ArchiveS3Prefix     string        // Key prefix of archived segments
+	ArchiveInterval     time.Duration // How often completed hours are archived
+	ArchiveHotRetention time.Duration // Max age of the JetStream streams holding archived streams (unchanged when 0)
+
+	// S3 endpoint and credentials of exports and the archive
+	S3Region        string // Region of the buckets
+	S3Endpoint      string // S3-compatible endpoint, e.g. of MinIO (AWS when empty)
+	AWSAccessKeyID  string
+	AWSSecretKey    string
+	AWSSessionToken string
+
+	// Health checks
+	HealthMaxHeadAge time.Duration // Chain head age above which /health reports the RPC as degraded (0 = unchecked)
+
+	// Usage metering
+	UsageInterval time.Duration // How often per-key usage is published on somnia.usage
+
+	// HTTPS
+	TLSCertFile         string   // PEM certificate (HTTPS is enabled when set)
+	TLSKeyFile          string   // PEM private key
+	TLSAutocertDomains  []string // Domains to obtain Let's Encrypt certificates for
+	TLSAutocertCacheDir string   // Directory caching autocert certificates
+	TLSAutocertEmail    string   // Contact address for the ACME account
+	TLSAutocertHTTPAddr string   // Listener for ACME HTTP-01 challenges (empty to rely on TLS-ALPN)
+	TLSClientCAFile     string   // CA bundle for verifying client certificates (mutual TLS when set)
+	TLSClientAuth       string   // "require" or "optional" client certificates
+}
+
+// Load builds the configuration from environment variables and defaults
+func Load() *Config {
+	return &Config{
+		RPCEndpoint: getEnv("RPC_ENDPOINT", "https://dream-rpc.somnia.network"),
+		NATSUrl:     getEnv("NATS_URL", "nats://localhost:4222"),
+		NATSToken:   getEnv("NATS_TOKEN", "nats_token"),
+		ServerPort:  getEnv("SERVER_PORT", "8080"),
+
+		ServerListen: getEnvList("SERVER_LISTEN", ""),
+		AdminListen:  getEnvList("ADMIN_LISTEN", ""),
+		Dashboard:    getEnvBool("DASHBOARD", true),
+
+		NATSTLS:          getEnvBool("NATS_TLS", false),
+		NATSTLSCAFile:    getEnv("NATS_TLS_CA_FILE", ""),
+		NATSTLSCertFile:  getEnv("NATS_TLS_CERT_FILE", ""),
+		NATSTLSKeyFile:   getEnv("NATS_TLS_KEY_FILE", ""),
+		NATSCredsFile:    getEnv("NATS_CREDS_FILE", ""),
+		NATSNKeySeedFile: getEnv("NATS_NKEY_SEED_FILE", ""),
+
+		EmbeddedNATS:        getEnvBool("EMBEDDED_NATS", false),
+		EmbeddedNATSDataDir: getEnv("EMBEDDED_NATS_DATA_DIR", "./data/nats"),
+		EmbeddedNATSAddr:    getEnv("EMBEDDED_NATS_ADDR", ""),
+
+		MockRPC:           getEnvBool("MOCK_RPC", false),
+		MockRPCAddr:       getEnv("MOCK_RPC_ADDR", "127.0.0.1:8545"),
+		MockChainID:       getEnvInt("MOCK_CHAIN_ID", 50312),
+		MockBlockInterval: getEnvDuration("MOCK_BLOCK_INTERVAL", 2*time.Second),
+		MockTxsPerBlock:   getEnvInt("MOCK_TXS_PER_BLOCK", 20),
+		MockLogsPerTx:     getEnvInt("MOCK_LOGS_PER_TX", 2),
+		MockFailureRate:   getEnvFloat("MOCK_FAILURE_RATE", 0.02),
+		MockSeed:          getEnvInt("MOCK_SEED", 0),
+
+		RPCRecordFile: getEnv("RPC_RECORD_FILE", ""),
+		RPCReplayFile: getEnv("RPC_REPLAY_FILE", ""),
+
+		ChainName: getEnv("CHAIN_NAME", "somnia"),
+		Chains:    loadChains(),
+
+		SubjectNamespace: getEnv("SUBJECT_NAMESPACE", ""),
+
+		Chaos: getEnvBool("CHAOS", false),
+
+		GasSpikeWindow:     getEnvInt("GAS_SPIKE_WINDOW", 20),
+		GasSpikeMultiplier: getEnvFloat("GAS_SPIKE_MULTIPLIER", 2.0),
+		GasSpikeMinSamples: getEnvInt("GAS_SPIKE_MIN_SAMPLES", 5),
+
+		WhaleThreshold:       getEnv("WHALE_THRESHOLD", "10000"),
+		WhaleTokenThresholds: parseTokenAmounts(getEnvList("WHALE_TOKEN_THRESHOLDS", "")),
+
+		BridgeContracts: parseNamedAddresses("bridge", getEnvList("BRIDGE_CONTRACTS", "")),
+
+		PoolContracts:  parseNamedAddresses("pool", getEnvList("POOL_CONTRACTS", "")),
+		PoolQuoteToken: getEnv("POOL_QUOTE_TOKEN", ""),
+
+		BalanceWatchlist: parseNamedAddresses("balance watchlist", getEnvList("BALANCE_WATCHLIST", "")),
+
+		NonceWatchlist: parseNamedAddresses("nonce watchlist", getEnvList("NONCE_WATCHLIST", "")),
+		StuckTxAge:     getEnvDuration("STUCK_TX_AGE", 5*time.Minute),
+
+		BlockTracer: getEnv("BLOCK_TRACER", ""),
+		TraceMaxTxs: getEnvInt("TRACE_MAX_TXS", 50),
+
+		InternalTxs:    getEnvBool("INTERNAL_TXS", false),
+		InternalTxsMax: getEnvInt("INTERNAL_TXS_MAX", 500),
+
+		StateDiffs:    getEnvBool("STATE_DIFFS", false),
+		StateDiffsMax: getEnvInt("STATE_DIFFS_MAX", 500),
+
+		ConsensusStats:      getEnvBool("CONSENSUS_STATS", false),
+		ConsensusValidators: parseNamedAddresses("validator", getEnvList("CONSENSUS_VALIDATORS", "")),
+		ConsensusSlotTime:   getEnvDuration("CONSENSUS_SLOT_TIME", 0),
+
+		AdaptivePolling:   getEnvBool("ADAPTIVE_POLLING", true),
+		AdaptivePollMin:   getEnvDuration("ADAPTIVE_POLL_MIN", 50*time.Millisecond),
+		BlockSubscription: getEnvBool("BLOCK_SUBSCRIPTION", true),
+		BlockCatchupMax:   getEnvInt("BLOCK_CATCHUP_MAX", 100),
+		BlockFetchWorkers: getEnvInt("BLOCK_FETCH_WORKERS", 8),
+
+		TrackFailedTxs: getEnvBool("TRACK_FAILED_TXS", true),
+
+		Checkpoints:        getEnvBool("CHECKPOINTS", true),
+		CheckpointInterval: getEnvDuration("CHECKPOINT_INTERVAL", 5*time.Second),
+		CheckpointMaxGap:   getEnvInt("CHECKPOINT_MAX_GAP", 10000),
+
+		BlockCacheSize:   getEnvInt("BLOCK_CACHE_SIZE", 256),
+		ReceiptCacheSize: getEnvInt("RECEIPT_CACHE_SIZE", 10000),
+
+		ReceiptBatchSize:   getEnvInt("RECEIPT_BATCH_SIZE", 100),
+		ReceiptConcurrency: getEnvInt("RECEIPT_CONCURRENCY", 8),
+
+		LifecycleFinalityDepth: getEnvInt("LIFECYCLE_FINALITY_DEPTH", 5),
+		LifecycleDropTimeout:   getEnvDuration("LIFECYCLE_DROP_TIMEOUT", 5*time.Minute),
+
+		PendingSnapshotInterval: getEnvDuration("PENDING_SNAPSHOT_INTERVAL", time.Minute),
+
+		PendingSubscription:   getEnvBool("PENDING_SUBSCRIPTION", true),
+		PendingWSEndpoint:     getEnv("PENDING_WS_ENDPOINT", ""),
+		PendingHydrateWorkers: getEnvInt("PENDING_HYDRATE_WORKERS", 8),
+
+		FeeHistoryBlocks: getEnvInt("FEE_HISTORY_BLOCKS", 20),
+
+		TrackBaseFee: getEnvBool("TRACK_BASE_FEE", true),
+
+		ThroughputWindows: parseDurations(getEnv("THROUGHPUT_WINDOWS", "1m,5m,15m")),
+
+		RollupRetention: getEnvDuration("ROLLUP_RETENTION", 30*24*time.Hour),
+
+		BlockDetailLevels: getEnvList("BLOCK_DETAIL_LEVELS", "header,hashes,full"),
+
+		PendingMaxTxs:     getEnvInt("PENDING_MAX_TXS", 50),
+		LogsMaxPerMessage: getEnvInt("LOGS_MAX_PER_MESSAGE", 100),
+		LogsChunkSize:     getEnvInt("LOGS_CHUNK_SIZE", 1000),
+		OverflowMode:      getEnv("OVERFLOW_MODE", "truncate"),
+
+		PollIntervals:    loadPollIntervals(),
+		DisabledMonitors: getEnvList("DISABLED_MONITORS", ""),
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
+		ClientRateLimit:        getEnvFloat("CLIENT_RATE_LIMIT", 0),
+		ClientRateBurst:        getEnvInt("CLIENT_RATE_BURST", 20),
+		ClientQueueSize:        getEnvInt("CLIENT_QUEUE_SIZE", 256),
+		ClientOverflowPolicy:   getEnv("CLIENT_OVERFLOW_POLICY", "drop-oldest"),
+		ClientOverflowPolicies: parseDeliveryPolicies(getEnvList("CLIENT_OVERFLOW_POLICIES", "")),
+
+		DeliveryMode:          getEnv("DELIVERY_MODE", "at-most-once"),
+		DeliveryModes:         parseDeliveryPolicies(getEnvList("DELIVERY_MODES", "")),
+		DeliveryAckWait:       getEnvDuration("DELIVERY_ACK_WAIT", 30*time.Second),
+		DeliveryMaxAckPending: getEnvInt("DELIVERY_MAX_ACK_PENDING", 1000),
+		DeliveryConsumerTTL:   getEnvDuration("DELIVERY_CONSUMER_TTL", 24*time.Hour),
+		ConsumeMaxBatch:       getEnvInt("CONSUME_MAX_BATCH", 1000),
+		ConsumeMaxWait:        getEnvDuration("CONSUME_MAX_WAIT", 30*time.Second),
+
+		MaxConnections:          getEnvInt("MAX_CONNECTIONS", 0),
+		MaxConnectionsPerStream: getEnvInt("MAX_CONNECTIONS_PER_STREAM", 0),
+		MaxConnectionsPerIP:     getEnvInt("MAX_CONNECTIONS_PER_IP", 0),
+
+		SSEHeartbeatInterval: getEnvDuration("SSE_HEARTBEAT_INTERVAL", 15*time.Second),
+		SSEIdleTimeout:       getEnvDuration("SSE_IDLE_TIMEOUT", 0),
+		SSEWriteTimeout:      getEnvDuration("SSE_WRITE_TIMEOUT", 30*time.Second),
+
+		HTTPRateLimit:  getEnvFloat("HTTP_RATE_LIMIT", 0),
+		HTTPRateBurst:  getEnvInt("HTTP_RATE_BURST", 20),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES", ""),
+
+		CallRateLimit: getEnvFloat("CALL_RATE_LIMIT", 10),
+		CallRateBurst: getEnvInt("CALL_RATE_BURST", 20),
+		CallCacheSize: getEnvInt("CALL_CACHE_SIZE", 10000),
+
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", "http://localhost,http://localhost:*,http://127.0.0.1:*"),
+		WSAllowedOrigins:   getEnvList("WS_ALLOWED_ORIGINS", ""),
+
+		APIKeyAuth: getEnvBool("API_KEY_AUTH", false),
+
+		JWTIssuer:       getEnv("JWT_ISSUER", ""),
+		JWTAudience:     getEnv("JWT_AUDIENCE", ""),
+		JWTJWKSURL:      getEnv("JWT_JWKS_URL", ""),
+		JWTJWKSRefresh:  getEnvDuration("JWT_JWKS_REFRESH", time.Hour),
+		JWTSecret:       getEnv("JWT_SECRET", ""),
+		JWTStreamsClaim: getEnv("JWT_STREAMS_CLAIM", "streams"),
+
+		OIDCIssuer:         getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:       getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:    getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCAllowedUsers:   getEnvList("OIDC_ALLOWED_USERS", ""),
+		OIDCAllowedDomains: getEnvList("OIDC_ALLOWED_DOMAINS", ""),
+		SessionSecret:      getEnv("SESSION_SECRET", ""),
+		SessionTTL:         getEnvDuration("SESSION_TTL", 12*time.Hour),
+
+		RPCRetryAttempts:   getEnvInt("RPC_RETRY_ATTEMPTS", 3),
+		RPCRetryBackoff:    getEnvDuration("RPC_RETRY_BACKOFF", 250*time.Millisecond),
+		RPCRetryMaxBackoff: getEnvDuration("RPC_RETRY_MAX_BACKOFF", 5*time.Second),
+		RPCRetryJitter:     getEnvFloat("RPC_RETRY_JITTER", 0.5),
+		RPCAttemptTimeout:  getEnvDuration("RPC_ATTEMPT_TIMEOUT", 10*time.Second),
+		RPCRetryCodes:      getEnvList("RPC_RETRY_CODES", "-32005,-32603"),
+
+		RPCBreakerThreshold: getEnvInt("RPC_BREAKER_THRESHOLD", 5),
+		RPCBreakerCooldown:  getEnvDuration("RPC_BREAKER_COOLDOWN", 30*time.Second),
+
+		RPCMetricsInterval: getEnvDuration("RPC_METRICS_INTERVAL", 30*time.Second),
+
+		RPCPeerEndpoints: getEnvList("RPC_PEER_ENDPOINTS", ""),
+		HeadLagInterval:  getEnvDuration("HEAD_LAG_INTERVAL", 15*time.Second),
+		HeadLagThreshold: getEnvInt("HEAD_LAG_THRESHOLD", 5),
+
+		ConsistencyEndpoint: getEnv("CONSISTENCY_RPC_ENDPOINT", ""),
+		ConsistencyStrict:   getEnvBool("CONSISTENCY_STRICT", false),
+
+		NameRegistry:  getEnv("NAME_REGISTRY", ""),
+		NameCacheTTL:  getEnvDuration("NAME_CACHE_TTL", time.Hour),
+		NameCacheSize: getEnvInt("NAME_CACHE_SIZE", 10000),
+
+		DecodeSelectors:   getEnvBool("DECODE_SELECTORS", true),
+		SelectorFile:      getEnv("SELECTOR_FILE", ""),
+		SelectorLookupURL: getEnv("SELECTOR_LOOKUP_URL", ""),
+
+		ABISourcifyURL:     getEnv("ABI_SOURCIFY_URL", ""),
+		ABIExplorerURL:     getEnv("ABI_EXPLORER_URL", ""),
+		ABIExplorerAPIKey:  getEnv("ABI_EXPLORER_API_KEY", ""),
+		ABIFetchRetryAfter: getEnvDuration("ABI_FETCH_RETRY_AFTER", 6*time.Hour),
+
+		MulticallAddress: getEnv("MULTICALL_ADDRESS", "0xcA11bde05977b3631167028862bE2a173976CA11"),
+
+		TokenMetadata:    getEnvBool("TOKEN_METADATA", true),
+		TokenMetadataTTL: getEnvDuration("TOKEN_METADATA_TTL", 7*24*time.Hour),
+		TokenCacheSize:   getEnvInt("TOKEN_CACHE_SIZE", 10000),
+
+		PublishRetries:      getEnvInt("PUBLISH_RETRIES", 2),
+		PublishRetryBackoff: getEnvDuration("PUBLISH_RETRY_BACKOFF", 200*time.Millisecond),
+		DLQSpoolDir:         getEnv("DLQ_SPOOL_DIR", ""),
+
+		PublishWasmHooks:    parseDeliveryPolicies(getEnvList("PUBLISH_WASM_HOOKS", "")),
+		PublishWasmTimeout:  getEnvDuration("PUBLISH_WASM_TIMEOUT", 100*time.Millisecond),
+		PublishWasmMemoryMB: getEnvInt("PUBLISH_WASM_MEMORY_MB", 64),
+
+		Exports:        loadExports(),
+		ExportDir:      getEnv("EXPORT_DIR", "./data/exports"),
+		ExportS3Bucket: getEnv("EXPORT_S3_BUCKET", ""),
+		ExportS3Prefix: getEnv("EXPORT_S3_PREFIX", ""),
+
+		ArchiveStreams:      getEnvList("ARCHIVE_STREAMS", ""),
+		ArchiveDir:          getEnv("ARCHIVE_DIR", "./data/archive"),
+		ArchiveS3Bucket:     getEnv("ARCHIVE_S3_BUCKET", ""),
+		ArchiveS3Prefix:     getEnv("ARCHIVE_S3_PREFIX", ""),
+		ArchiveInterval:     getEnvDuration("ARCHIVE_INTERVAL", 10*time.Minute),
+		ArchiveHotRetention: getEnvDuration("ARCHIVE_HOT_RETENTION", 0),
+
+		S3Region:        getEnv("S3_REGION", "us-east-1"),
+		S3Endpoint:      getEnv("S3_ENDPOINT", ""),
+		AWSAccessKeyID:  getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretKey:    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken: getEnv("AWS_SESSION_TOKEN", ""),
+
+		HealthMaxHeadAge: getEnvDuration("HEALTH_MAX_HEAD_AGE", time.Minute),
+
+		UsageInterval: getEnvDuration("USAGE_INTERVAL", time.Minute),
+
+		TLSCertFile:         getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:          getEnv("TLS_KEY_FILE", ""),
+		TLSAutocertDomains:  getEnvList("TLS_AUTOCERT_DOMAINS", ""),
+		TLSAutocertCacheDir: getEnv("TLS_AUTOCERT_CACHE_DIR", "autocert-cache"),
+		TLSAutocertEmail:    getEnv("TLS_AUTOCERT_EMAIL", ""),
+		TLSAutocertHTTPAddr: getEnv("TLS_AUTOCERT_HTTP_ADDR", ":80"),
+		TLSClientCAFile:     getEnv("TLS_CLIENT_CA_FILE", ""),
+		TLSClientAuth:       getEnv("TLS_CLIENT_AUTH", "require"),
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid number for %s: %q, using default %v", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid boolean for %s: %q, using default %t", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Chain is an additional network monitored next to RPC_ENDPOINT
+type Chain struct {
+	Name        string   // Prefix of its NATS subjects and path segment of /sse/:chain/:stream
+	RPCEndpoint string   // HTTP(S) or WebSocket JSON-RPC endpoint
+	Monitors    []string // Monitors run against it: blocks, gasPrice and/or network
+
+	PollIntervals    map[string]time.Duration // Per-monitor overrides of <MONITOR>_POLL_INTERVAL
+	DisabledMonitors []string                 // Monitors that start paused, next to DISABLED_MONITORS
+	Retention        time.Duration            // Max age of its JetStream stream (24h when zero)
+	MaxMsgs          int64                    // Max messages of its JetStream stream (10k when zero, -1 = unlimited)
+	OnDisk           bool                     // File storage instead of memory
+}
+
+// Chain returns the additional network with the given name
+func (c *Config) Chain(name string) (Chain, bool) {
+	for _, chain := range c.Chains {
+		if chain.Name == name {
+			return chain, true
+		}
+	}
+	return Chain{}, false
+}
+
+// DefaultChainMonitors run on additional networks unless CHAIN_MONITORS or
+// CHAIN_<NAME>_MONITORS say otherwise
+var DefaultChainMonitors = "blocks,gasPrice,network"
+
+// loadChains reads CHAINS=name=endpoint pairs such as
+// "testnet=https://dream-rpc.somnia.network,devnet=http://127.0.0.1:8545"
+// and the CHAIN_<NAME>_* overrides of each network
+func loadChains() []Chain {
+	defaultMonitors := getEnv("CHAIN_MONITORS", DefaultChainMonitors)
+	var chains []Chain
+	for _, pair := range getEnvList("CHAINS", "") {
+		name, endpoint, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Printf("Ignoring chain %q, expected name=endpoint", pair)
+			continue
+		}
+		name = strings.TrimSpace(name)
+		prefix := "CHAIN_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		chain := Chain{
+			Name:             name,
+			RPCEndpoint:      strings.TrimSpace(endpoint),
+			Monitors:         getEnvList(prefix+"MONITORS", defaultMonitors),
+			PollIntervals:    make(map[string]time.Duration),
+			DisabledMonitors: getEnvList(prefix+"DISABLED_MONITORS", ""),
+			Retention:        getEnvDuration(prefix+"RETENTION", 0),
+			MaxMsgs:          int64(getEnvInt(prefix+"MAX_MSGS", 0)),
+			OnDisk:           getEnv(prefix+"STORAGE", "memory") == "file",
+		}
+		for _, monitor := range chain.Monitors {
+			if interval := getEnvDuration(prefix+strings.ToUpper(monitor)+"_POLL_INTERVAL", 0); interval > 0 {
+				chain.PollIntervals[monitor] = interval
+			}
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// Export is a scheduled snapshot of a stream's recent messages
+type Export struct {
+	Name     string        // File name prefix of its snapshots
+	Stream   string        // Stream whose messages are exported
+	Interval time.Duration // Time between snapshots; each covers the messages since the previous one
+	Format   string        // "csv" or "ndjson"
+	Fields   string        // Dotted fields kept, as in ?fields= (all when empty)
+}
+
+// loadExports reads EXPORTS=name=stream pairs such as
+// "gas-hourly=gasPrice,blocks=blocks-header" and the EXPORT_<NAME>_* settings
+// of each export
+func loadExports() []Export {
+	var exports []Export
+	for _, pair := range getEnvList("EXPORTS", "") {
+		name, stream, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Printf("Ignoring export %q, expected name=stream", pair)
+			continue
+		}
+		name = strings.TrimSpace(name)
+		prefix := "EXPORT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		export := Export{
+			Name:     name,
+			Stream:   strings.TrimSpace(stream),
+			Interval: getEnvDuration(prefix+"INTERVAL", time.Hour),
+			Format:   getEnv(prefix+"FORMAT", "csv"),
+			Fields:   getEnv(prefix+"FIELDS", ""),
+		}
+		if export.Format != "csv" && export.Format != "ndjson" {
+			log.Printf("Ignoring export %s, unknown format %q (expected csv or ndjson)", name, export.Format)
+			continue
+		}
+		if export.Interval < time.Minute {
+			log.Printf("Export %s interval %s raised to 1m", name, export.Interval)
+			export.Interval = time.Minute
+		}
+		exports = append(exports, export)
+	}
+	return exports
+}
+
+// DefaultPollIntervals are the built-in tick intervals per monitor
+var DefaultPollIntervals = map[string]time.Duration{
+	"blocks":     2 * time.Second,
+	"pending":    3 * time.Second,
+	"logs":       5 * time.Second,
+	"network":    10 * time.Second,
+	"gasPrice":   15 * time.Second,
+	"fees":       15 * time.Second,
+	"throughput": 10 * time.Second,
+	"bridge":     10 * time.Second,
+	"pools":      10 * time.Second,
+	"balances":   time.Minute,
+	"nonces":     30 * time.Second,
+	"traces":     2 * time.Second,
+	"consensus":  10 * time.Second,
+}
+
+// loadPollIntervals reads <MONITOR>_POLL_INTERVAL overrides, e.g. BLOCKS_POLL_INTERVAL=500ms
+func loadPollIntervals() map[string]time.Duration {
+	intervals := make(map[string]time.Duration, len(DefaultPollIntervals))
+	for name, interval := range DefaultPollIntervals {
+		intervals[name] = getEnvDuration(strings.ToUpper(name)+"_POLL_INTERVAL", interval)
+	}
+	return intervals
+}
+
+// parseDurations parses a comma separated list like "1m,5m,15m"
+func parseDurations(value string) []time.Duration {
+	var durations []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil || d <= 0 {
+			log.Printf("Ignoring invalid duration %q", part)
+			continue
+		}
+		durations = append(durations, d)
+	}
+	return durations
+}
+
+// parseNamedAddresses parses "name=address" pairs such as
+// "stargate-usdc=0x1234...,warp-eth=0xabcd..."; a bare address is named by itself
+func parseNamedAddresses(kind string, pairs []string) map[string]string {
+	contracts := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, address, ok := strings.Cut(pair, "=")
+		if !ok {
+			address = name
+		}
+		name, address = strings.TrimSpace(name), strings.TrimSpace(address)
+		if !isHexAddress(address) {
+			log.Printf("Ignoring %s entry %q: invalid address", kind, pair)
+			continue
+		}
+		contracts[name] = address
+	}
+	return contracts
+}
+
+// parseTokenAmounts parses "address=amount" pairs such as
+// "0xa0b8...=1000000,0xdac1...=500000" into amounts by lowercase address
+func parseTokenAmounts(pairs []string) map[string]string {
+	amounts := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		address, amount, ok := strings.Cut(pair, "=")
+		address, amount = strings.TrimSpace(address), strings.TrimSpace(amount)
+		if !ok || !isHexAddress(address) {
+			log.Printf("Ignoring token amount %q, expected address=amount", pair)
+			continue
+		}
+		amounts[strings.ToLower(address)] = amount
+	}
+	return amounts
+}
+
+// isHexAddress reports whether s is a 0x-prefixed 20-byte hex address
+func isHexAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	for _, c := range s[2:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDeliveryPolicies parses "stream=value" pairs such as
+// "blocks=drop-oldest,network=conflate"
+func parseDeliveryPolicies(pairs []string) map[string]string {
+	policies := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		stream, policy, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		policies[strings.TrimSpace(stream)] = strings.TrimSpace(policy)
+	}
+	return policies
+}
@@ -0,0 +1,470 @@
+// Package mockchain generates a synthetic chain and serves it over JSON-RPC,
+// so SomniaStream and its consumers can run without network access.
+//
+// A Chain produces signed EIP-1559 transactions into a pending pool at a
+// steady rate and mines them into blocks on a fixed interval, with ERC-20
+// Transfer logs, occasional reverts and whale-sized transfers. Handler serves
+// the eth_* methods SomniaStream uses over HTTP and WebSocket, including
+// newPendingTransactions and newHeads subscriptions.
+package mockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+const (
+	startHeight    = 1_000_000 // First block number, high enough for "latest minus N" lookbacks
+	gasPerTx       = 80_000    // Gas limit budget per expected transaction, about twice the average use
+	transferGas    = 21_000
+	tokenBaseGas   = 35_000
+	tokenLogGas    = 15_000
+	minBaseFee     = 500_000_000   // 0.5 gwei
+	initialBaseFee = 2_000_000_000 // 2 gwei
+	whaleChance    = 0.01          // Share of native transfers with a whale-sized value
+	tokenTxShare   = 0.4           // Share of transactions that call a token contract
+	accountCount   = 64
+)
+
+var (
+	// TransferTopic is the topic of ERC-20 Transfer(address,address,uint256) logs
+	TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	transferSelector = []byte{0xa9, 0x05, 0x9c, 0xbb} // transfer(address,uint256)
+	ether            = big.NewInt(1e18)
+	gwei             = big.NewInt(1e9)
+)
+
+// Options tune the generated chain
+type Options struct {
+	ChainID       int64
+	BlockInterval time.Duration
+	TxsPerBlock   int     // Average transactions per block
+	LogsPerTx     int     // Transfer logs emitted by each token transaction
+	FailureRate   float64 // Share of token transactions that revert (0-1)
+	History       int     // Blocks kept for lookups and eth_getLogs
+	Seed          int64   // Seeds accounts and randomness; 0 uses the current time
+}
+
+// DefaultOptions returns a 2s chain with 20 transactions per block
+func DefaultOptions() Options {
+	return Options{
+		ChainID:       50312,
+		BlockInterval: 2 * time.Second,
+		TxsPerBlock:   20,
+		LogsPerTx:     2,
+		FailureRate:   0.02,
+		History:       256,
+	}
+}
+
+// account is a generated externally owned account
+type account struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+	nonce   uint64
+}
+
+// pendingTx is a transaction waiting in the pool
+type pendingTx struct {
+	tx      *types.Transaction
+	from    common.Address
+	reverts bool // Fails when mined
+	logs    int  // Transfer logs emitted when mined
+}
+
+// minedBlock is a block with its receipts and senders
+type minedBlock struct {
+	block    *types.Block
+	receipts []*types.Receipt
+	senders  []common.Address
+}
+
+// txLocation points at a mined transaction
+type txLocation struct {
+	block *minedBlock
+	index int
+}
+
+// Chain is a synthetic chain that mines its pending pool on a fixed interval
+type Chain struct {
+	opts     Options
+	chainID  *big.Int
+	signer   types.Signer
+	gasLimit uint64
+
+	mu       sync.RWMutex
+	rng      *rand.Rand
+	accounts []*account
+	tokens   []common.Address
+	miners   []common.Address
+	blocks   []*minedBlock // Oldest first, at most opts.History
+	byHash   map[common.Hash]*minedBlock
+	txs      map[common.Hash]txLocation
+	pending  []*pendingTx
+	baseFee  *big.Int
+	reverted map[common.Hash]string // Call key of reverted transactions to their revert reason
+
+	pendingFeed event.Feed // *pendingTx
+	headFeed    event.Feed // *minedBlock
+}
+
+// New creates a chain and mines its first block
+func New(opts Options) (*Chain, error) {
+	switch {
+	case opts.ChainID <= 0:
+		return nil, errors.New("chain ID must be positive")
+	case opts.BlockInterval <= 0:
+		return nil, errors.New("block interval must be positive")
+	case opts.TxsPerBlock < 0 || opts.LogsPerTx < 0:
+		return nil, errors.New("transactions and logs per block can't be negative")
+	case opts.FailureRate < 0 || opts.FailureRate > 1:
+		return nil, errors.New("failure rate must be between 0 and 1")
+	}
+	if opts.History <= 0 {
+		opts.History = DefaultOptions().History
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	c := &Chain{
+		opts:     opts,
+		chainID:  big.NewInt(opts.ChainID),
+		signer:   types.LatestSignerForChainID(big.NewInt(opts.ChainID)),
+		gasLimit: max(uint64(opts.TxsPerBlock)*gasPerTx, 1_000_000),
+		rng:      rand.New(rand.NewSource(seed)),
+		byHash:   make(map[common.Hash]*minedBlock),
+		txs:      make(map[common.Hash]txLocation),
+		baseFee:  big.NewInt(initialBaseFee),
+		reverted: make(map[common.Hash]string),
+	}
+	for i := 0; i < accountCount; i++ {
+		key, err := crypto.ToECDSA(c.derive("account", i).Bytes())
+		if err != nil {
+			return nil, err
+		}
+		c.accounts = append(c.accounts, &account{key: key, address: crypto.PubkeyToAddress(key.PublicKey)})
+	}
+	for i := 0; i < 3; i++ {
+		c.tokens = append(c.tokens, common.BytesToAddress(c.derive("token", i).Bytes()))
+	}
+	for i := 0; i < 4; i++ {
+		c.miners = append(c.miners, common.BytesToAddress(c.derive("miner", i).Bytes()))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mine(time.Now())
+	return c, nil
+}
+
+// derive returns a deterministic hash for a generated key or address
+func (c *Chain) derive(kind string, i int) common.Hash {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(c.rng.Int63()))
+	binary.BigEndian.PutUint64(buf[8:], uint64(i))
+	return crypto.Keccak256Hash([]byte(kind), buf[:])
+}
+
+// ChainID returns the chain ID of the generated transactions
+func (c *Chain) ChainID() *big.Int {
+	return new(big.Int).Set(c.chainID)
+}
+
+// Run generates transactions and mines blocks until ctx is done
+func (c *Chain) Run(ctx context.Context) {
+	blocks := time.NewTicker(c.opts.BlockInterval)
+	defer blocks.Stop()
+
+	// Spread transactions over the block interval; each tick adds 0-2 so
+	// block sizes vary around the average
+	var txTick <-chan time.Time
+	if c.opts.TxsPerBlock > 0 {
+		txs := time.NewTicker(max(c.opts.BlockInterval/time.Duration(c.opts.TxsPerBlock), time.Millisecond))
+		defer txs.Stop()
+		txTick = txs.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-txTick:
+			c.mu.Lock()
+			var added []*pendingTx
+			for n := c.rng.Intn(3); n > 0; n-- {
+				ptx, err := c.generateTx()
+				if err == nil {
+					c.pending = append(c.pending, ptx)
+					added = append(added, ptx)
+				}
+			}
+			c.mu.Unlock()
+			for _, ptx := range added {
+				c.pendingFeed.Send(ptx)
+			}
+		case now := <-blocks.C:
+			c.mu.Lock()
+			mined := c.mine(now)
+			c.mu.Unlock()
+			c.headFeed.Send(mined)
+		}
+	}
+}
+
+// generateTx signs a random native or token transfer. Callers hold mu.
+func (c *Chain) generateTx() (*pendingTx, error) {
+	from := c.accounts[c.rng.Intn(len(c.accounts))]
+	to := c.accounts[c.rng.Intn(len(c.accounts))].address
+	tip := new(big.Int).Mul(big.NewInt(int64(1+c.rng.Intn(200))), big.NewInt(10_000_000)) // 0.01-2 gwei
+	feeCap := new(big.Int).Add(new(big.Int).Mul(c.baseFee, big.NewInt(2)), tip)
+
+	ptx := &pendingTx{from: from.address}
+	txdata := &types.DynamicFeeTx{
+		ChainID:   c.chainID,
+		Nonce:     from.nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       transferGas,
+		To:        &to,
+		Value:     c.randomValue(),
+	}
+	if c.rng.Float64() < tokenTxShare {
+		token := c.tokens[c.rng.Intn(len(c.tokens))]
+		amount := new(big.Int).Mul(big.NewInt(int64(1+c.rng.Intn(100_000))), big.NewInt(1e15))
+		data := append(append([]byte{}, transferSelector...), common.LeftPadBytes(to.Bytes(), 32)...)
+		txdata.To, txdata.Value = &token, new(big.Int)
+		txdata.Data = append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+		txdata.Gas = tokenBaseGas + uint64(c.opts.LogsPerTx)*tokenLogGas + 10_000
+		ptx.logs = c.opts.LogsPerTx
+		ptx.reverts = c.rng.Float64() < c.opts.FailureRate
+	}
+
+	tx, err := types.SignNewTx(from.key, c.signer, txdata)
+	if err != nil {
+		return nil, err
+	}
+	from.nonce++
+	ptx.tx = tx
+	if ptx.reverts {
+		c.reverted[callKey(from.address, tx.To(), tx.Data())] = "ERC20: transfer amount exceeds balance"
+	}
+	return ptx, nil
+}
+
+// randomValue returns a native transfer value, occasionally whale-sized
+func (c *Chain) randomValue() *big.Int {
+	if c.rng.Float64() < whaleChance {
+		return new(big.Int).Mul(big.NewInt(int64(1_000+c.rng.Intn(99_000))), ether)
+	}
+	milli := big.NewInt(int64(1 + c.rng.Intn(10_000))) // 0.001-10 ether
+	return new(big.Int).Mul(milli, big.NewInt(1e15))
+}
+
+// mine packs pending transactions into a block and adjusts the base fee.
+// Callers hold mu.
+func (c *Chain) mine(now time.Time) *minedBlock {
+	number := uint64(startHeight)
+	parent := common.Hash{}
+	if head := c.head(); head != nil {
+		number = head.block.NumberU64() + 1
+		parent = head.block.Hash()
+	}
+
+	header := &types.Header{
+		ParentHash: parent,
+		UncleHash:  types.EmptyUncleHash,
+		Coinbase:   c.miners[number%uint64(len(c.miners))],
+		Root:       crypto.Keccak256Hash(parent.Bytes(), []byte("state")),
+		Number:     new(big.Int).SetUint64(number),
+		GasLimit:   c.gasLimit,
+		Time:       uint64(now.Unix()),
+		Extra:      []byte("somnia-stream mock"),
+		BaseFee:    new(big.Int).Set(c.baseFee),
+		Difficulty: new(big.Int),
+	}
+
+	var (
+		txs      []*types.Transaction
+		receipts []*types.Receipt
+		senders  []common.Address
+		rest     []*pendingTx
+	)
+	for _, ptx := range c.pending {
+		if header.GasUsed+ptx.tx.Gas() > header.GasLimit {
+			rest = append(rest, ptx) // Stays pending for the next block
+			continue
+		}
+		receipt := c.receipt(ptx, header, len(txs))
+		header.GasUsed += receipt.GasUsed
+		receipt.CumulativeGasUsed = header.GasUsed
+		txs = append(txs, ptx.tx)
+		receipts = append(receipts, receipt)
+		senders = append(senders, ptx.from)
+	}
+	c.pending = rest
+
+	block := types.NewBlock(header, txs, nil, receipts, new(listHasher))
+	logIndex := uint(0)
+	for _, receipt := range receipts {
+		receipt.BlockHash = block.Hash()
+		for _, l := range receipt.Logs {
+			l.BlockHash = block.Hash()
+			l.Index = logIndex
+			logIndex++
+		}
+	}
+
+	mined := &minedBlock{block: block, receipts: receipts, senders: senders}
+	c.blocks = append(c.blocks, mined)
+	c.byHash[block.Hash()] = mined
+	for i, tx := range txs {
+		c.txs[tx.Hash()] = txLocation{block: mined, index: i}
+	}
+	for len(c.blocks) > c.opts.History {
+		old := c.blocks[0]
+		c.blocks = c.blocks[1:]
+		delete(c.byHash, old.block.Hash())
+		for i, tx := range old.block.Transactions() {
+			delete(c.txs, tx.Hash())
+			if old.receipts[i].Status == types.ReceiptStatusFailed {
+				delete(c.reverted, callKey(old.senders[i], tx.To(), tx.Data()))
+			}
+		}
+	}
+
+	// EIP-1559: move the base fee by up to 1/8 towards the 50% gas target
+	target := new(big.Int).SetUint64(header.GasLimit / 2)
+	delta := new(big.Int).Sub(new(big.Int).SetUint64(header.GasUsed), target)
+	delta.Mul(delta, c.baseFee).Quo(delta, target).Quo(delta, big.NewInt(8))
+	c.baseFee.Add(c.baseFee, delta)
+	if c.baseFee.Cmp(big.NewInt(minBaseFee)) < 0 {
+		c.baseFee.SetInt64(minBaseFee)
+	}
+	return mined
+}
+
+// receipt builds the receipt of a transaction included at index
+func (c *Chain) receipt(ptx *pendingTx, header *types.Header, index int) *types.Receipt {
+	tx := ptx.tx
+	price := effectiveGasPrice(tx, header.BaseFee)
+	receipt := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            types.ReceiptStatusSuccessful,
+		TxHash:            tx.Hash(),
+		GasUsed:           transferGas,
+		EffectiveGasPrice: price,
+		BlockNumber:       new(big.Int).Set(header.Number),
+		TransactionIndex:  uint(index),
+		Logs:              []*types.Log{},
+	}
+	if len(tx.Data()) > 0 {
+		receipt.GasUsed = tokenBaseGas + uint64(ptx.logs)*tokenLogGas
+	}
+	if ptx.reverts {
+		receipt.Status = types.ReceiptStatusFailed
+		receipt.GasUsed = tokenBaseGas
+	} else {
+		// The first log is the transfer itself, further ones model router hops
+		// through the other tokens
+		for i := 0; i < ptx.logs; i++ {
+			token := *tx.To()
+			if i > 0 {
+				token = c.tokens[(index+i)%len(c.tokens)]
+			}
+			receipt.Logs = append(receipt.Logs, &types.Log{
+				Address:     token,
+				Topics:      []common.Hash{TransferTopic, common.BytesToHash(ptx.from.Bytes()), common.BytesToHash(tx.Data()[4:36])},
+				Data:        tx.Data()[36:68],
+				BlockNumber: header.Number.Uint64(),
+				TxHash:      tx.Hash(),
+				TxIndex:     uint(index),
+			})
+		}
+	}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	return receipt
+}
+
+// listHasher stands in for the transaction and receipt tries. Roots are
+// consistent for the same list but are not Merkle-Patricia roots, which
+// clients don't verify.
+type listHasher struct {
+	entries [][]byte
+}
+
+func (h *listHasher) Reset() {
+	h.entries = h.entries[:0]
+}
+
+func (h *listHasher) Update(key, value []byte) error {
+	h.entries = append(h.entries, common.CopyBytes(key), common.CopyBytes(value))
+	return nil
+}
+
+func (h *listHasher) Hash() common.Hash {
+	return crypto.Keccak256Hash(h.entries...)
+}
+
+// effectiveGasPrice is the price a transaction pays per gas at a base fee
+func effectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	price := new(big.Int).Add(baseFee, tx.GasTipCap())
+	if price.Cmp(tx.GasFeeCap()) > 0 {
+		return new(big.Int).Set(tx.GasFeeCap())
+	}
+	return price
+}
+
+// callKey identifies the call of a transaction for eth_call replays
+func callKey(from common.Address, to *common.Address, data []byte) common.Hash {
+	var target []byte
+	if to != nil {
+		target = to.Bytes()
+	}
+	return crypto.Keccak256Hash(from.Bytes(), target, data)
+}
+
+// head returns the latest block. Callers hold mu.
+func (c *Chain) head() *minedBlock {
+	if len(c.blocks) == 0 {
+		return nil
+	}
+	return c.blocks[len(c.blocks)-1]
+}
+
+// blockByNumber returns a retained block. Callers hold mu.
+func (c *Chain) blockByNumber(number uint64) *minedBlock {
+	if len(c.blocks) == 0 {
+		return nil
+	}
+	first := c.blocks[0].block.NumberU64()
+	if number < first || number-first >= uint64(len(c.blocks)) {
+		return nil
+	}
+	return c.blocks[number-first]
+}
+
+// gasPrice suggests the base fee of the next block plus a 1 gwei tip
+func (c *Chain) gasPrice() *big.Int {
+	return new(big.Int).Add(c.baseFee, gwei)
+}
+
+// String describes the chain for startup logs
+func (c *Chain) String() string {
+	return fmt.Sprintf("chain %d, %s blocks, ~%d txs/block, %d logs/token tx, %.0f%% reverts",
+		c.opts.ChainID, c.opts.BlockInterval, c.opts.TxsPerBlock, c.opts.LogsPerTx, c.opts.FailureRate*100)
+}
@@ -0,0 +1,508 @@
+package mockchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// finalityDepth is how far the finalized and safe tags trail the head
+const finalityDepth = 2
+
+// revertError is returned by eth_call for transactions that reverted, with
+// the ABI-encoded Error(string) reason as data like a real node
+type revertError struct {
+	reason string
+}
+
+func (e *revertError) Error() string  { return "execution reverted: " + e.reason }
+func (e *revertError) ErrorCode() int { return 3 }
+
+func (e *revertError) ErrorData() interface{} {
+	// Error(string) selector, string offset, length and padded bytes
+	data := crypto.Keccak256([]byte("Error(string)"))[:4]
+	data = append(data, common.LeftPadBytes(big.NewInt(32).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(e.reason))).Bytes(), 32)...)
+	data = append(data, common.RightPadBytes([]byte(e.reason), (len(e.reason)+31)/32*32)...)
+	return hexutil.Encode(data)
+}
+
+// Handler serves the chain over JSON-RPC: HTTP POST requests and WebSocket
+// upgrades on the same address
+func (c *Chain) Handler() (http.Handler, error) {
+	server := rpc.NewServer()
+	for namespace, service := range map[string]interface{}{
+		"eth":  &ethAPI{c},
+		"net":  &netAPI{c},
+		"web3": &web3API{},
+	} {
+		if err := server.RegisterName(namespace, service); err != nil {
+			return nil, err
+		}
+	}
+	ws := server.WebsocketHandler([]string{"*"})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}), nil
+}
+
+// ethAPI implements the eth namespace
+type ethAPI struct {
+	c *Chain
+}
+
+func (api *ethAPI) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(api.c.ChainID())
+}
+
+func (api *ethAPI) BlockNumber() hexutil.Uint64 {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	return hexutil.Uint64(api.c.head().block.NumberU64())
+}
+
+func (api *ethAPI) GasPrice() *hexutil.Big {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	return (*hexutil.Big)(api.c.gasPrice())
+}
+
+func (api *ethAPI) MaxPriorityFeePerGas() *hexutil.Big {
+	return (*hexutil.Big)(new(big.Int).Set(gwei))
+}
+
+func (api *ethAPI) Syncing() bool {
+	return false
+}
+
+func (api *ethAPI) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) map[string]interface{} {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	if mined := api.c.resolve(number); mined != nil {
+		return marshalBlock(mined, fullTx)
+	}
+	return nil
+}
+
+func (api *ethAPI) GetBlockByHash(hash common.Hash, fullTx bool) map[string]interface{} {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	if mined := api.c.byHash[hash]; mined != nil {
+		return marshalBlock(mined, fullTx)
+	}
+	return nil
+}
+
+func (api *ethAPI) GetBlockReceipts(blockNrOrHash rpc.BlockNumberOrHash) []*types.Receipt {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	if mined := api.c.resolveBlock(blockNrOrHash); mined != nil {
+		// An empty list, not null, which clients read as an unknown block
+		return append([]*types.Receipt{}, mined.receipts...)
+	}
+	return nil
+}
+
+func (api *ethAPI) GetTransactionByHash(hash common.Hash) map[string]interface{} {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	if loc, ok := api.c.txs[hash]; ok {
+		return marshalTx(loc.block.block.Transactions()[loc.index], loc.block.senders[loc.index], loc.block, loc.index)
+	}
+	for _, ptx := range api.c.pending {
+		if ptx.tx.Hash() == hash {
+			return marshalTx(ptx.tx, ptx.from, nil, 0)
+		}
+	}
+	return nil
+}
+
+func (api *ethAPI) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	if loc, ok := api.c.txs[hash]; ok {
+		return loc.block.receipts[loc.index]
+	}
+	return nil
+}
+
+func (api *ethAPI) PendingTransactions() []map[string]interface{} {
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	txs := make([]map[string]interface{}, 0, len(api.c.pending))
+	for _, ptx := range api.c.pending {
+		txs = append(txs, marshalTx(ptx.tx, ptx.from, nil, 0))
+	}
+	return txs
+}
+
+// callArgs are the eth_call fields used to recognize replayed transactions
+type callArgs struct {
+	From  *common.Address `json:"from"`
+	To    *common.Address `json:"to"`
+	Data  hexutil.Bytes   `json:"data"`
+	Input hexutil.Bytes   `json:"input"`
+}
+
+// Call reverts for transactions that reverted when mined and returns no
+// data for anything else
+func (api *ethAPI) Call(args callArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	data := args.Input
+	if len(data) == 0 {
+		data = args.Data
+	}
+	var from common.Address
+	if args.From != nil {
+		from = *args.From
+	}
+
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	if reason, ok := api.c.reverted[callKey(from, args.To, data)]; ok {
+		return nil, &revertError{reason: reason}
+	}
+	return hexutil.Bytes{}, nil
+}
+
+// feeHistory is the eth_feeHistory response
+type feeHistory struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+func (api *ethAPI) FeeHistory(blockCount hexutil.Uint64, lastBlock rpc.BlockNumber, percentiles []float64) (*feeHistory, error) {
+	if blockCount == 0 {
+		return nil, fmt.Errorf("blockCount must be positive")
+	}
+	for i, p := range percentiles {
+		if p < 0 || p > 100 || (i > 0 && p < percentiles[i-1]) {
+			return nil, fmt.Errorf("invalid reward percentile %v", p)
+		}
+	}
+
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+	newest := api.c.resolve(lastBlock)
+	if newest == nil {
+		return nil, fmt.Errorf("block %d not found", lastBlock)
+	}
+
+	var blocks []*minedBlock
+	for n := newest.block.NumberU64(); uint64(len(blocks)) < uint64(blockCount); n-- {
+		mined := api.c.blockByNumber(n)
+		if mined == nil {
+			break
+		}
+		blocks = append([]*minedBlock{mined}, blocks...)
+	}
+
+	history := &feeHistory{OldestBlock: (*hexutil.Big)(blocks[0].block.Number())}
+	for _, mined := range blocks {
+		header := mined.block.Header()
+		history.BaseFee = append(history.BaseFee, (*hexutil.Big)(header.BaseFee))
+		history.GasUsedRatio = append(history.GasUsedRatio, float64(header.GasUsed)/float64(header.GasLimit))
+		if len(percentiles) > 0 {
+			history.Reward = append(history.Reward, rewards(mined, percentiles))
+		}
+	}
+	// The last entry is the base fee of the block after the newest one
+	next := api.c.baseFee
+	if newest != api.c.head() {
+		if after := api.c.blockByNumber(newest.block.NumberU64() + 1); after != nil {
+			next = after.block.BaseFee()
+		}
+	}
+	history.BaseFee = append(history.BaseFee, (*hexutil.Big)(new(big.Int).Set(next)))
+	return history, nil
+}
+
+// rewards returns the effective tips at gas-weighted percentiles of a block
+func rewards(mined *minedBlock, percentiles []float64) []*hexutil.Big {
+	type tip struct {
+		reward *big.Int
+		gas    uint64
+	}
+	baseFee := mined.block.BaseFee()
+	tips := make([]tip, len(mined.receipts))
+	for i, tx := range mined.block.Transactions() {
+		tips[i] = tip{reward: new(big.Int).Sub(effectiveGasPrice(tx, baseFee), baseFee), gas: mined.receipts[i].GasUsed}
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].reward.Cmp(tips[j].reward) < 0 })
+
+	result := make([]*hexutil.Big, len(percentiles))
+	for i, p := range percentiles {
+		result[i] = (*hexutil.Big)(new(big.Int))
+		threshold := uint64(float64(mined.block.GasUsed()) * p / 100)
+		var sum uint64
+		for _, t := range tips {
+			sum += t.gas
+			result[i] = (*hexutil.Big)(t.reward)
+			if sum >= threshold {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// filterQuery is the eth_getLogs filter object
+type filterQuery struct {
+	BlockHash *common.Hash      `json:"blockHash"`
+	FromBlock *rpc.BlockNumber  `json:"fromBlock"`
+	ToBlock   *rpc.BlockNumber  `json:"toBlock"`
+	Address   json.RawMessage   `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+func (api *ethAPI) GetLogs(query filterQuery) ([]*types.Log, error) {
+	addresses, err := decodeOneOrMany[common.Address](query.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %v", err)
+	}
+	topics := make([][]common.Hash, len(query.Topics))
+	for i, raw := range query.Topics {
+		if topics[i], err = decodeOneOrMany[common.Hash](raw); err != nil {
+			return nil, fmt.Errorf("invalid topic %d: %v", i, err)
+		}
+	}
+
+	api.c.mu.RLock()
+	defer api.c.mu.RUnlock()
+
+	var blocks []*minedBlock
+	if query.BlockHash != nil {
+		if mined := api.c.byHash[*query.BlockHash]; mined != nil {
+			blocks = append(blocks, mined)
+		}
+	} else {
+		from, to := rpc.LatestBlockNumber, rpc.LatestBlockNumber
+		if query.FromBlock != nil {
+			from = *query.FromBlock
+		}
+		if query.ToBlock != nil {
+			to = *query.ToBlock
+		}
+		first, last := api.c.resolveNumber(from), api.c.resolveNumber(to)
+		if first > last {
+			return nil, fmt.Errorf("fromBlock %d is after toBlock %d", first, last)
+		}
+		for _, mined := range api.c.blocks {
+			if n := mined.block.NumberU64(); n >= first && n <= last {
+				blocks = append(blocks, mined)
+			}
+		}
+	}
+
+	logs := []*types.Log{}
+	for _, mined := range blocks {
+		for _, receipt := range mined.receipts {
+			for _, l := range receipt.Logs {
+				if matchLog(l, addresses, topics) {
+					logs = append(logs, l)
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+// matchLog applies the address and positional topic filters of eth_getLogs
+func matchLog(l *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 && !contains(addresses, l.Address) {
+		return false
+	}
+	if len(topics) > len(l.Topics) {
+		return false
+	}
+	for i, options := range topics {
+		if len(options) > 0 && !contains(options, l.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains[T comparable](list []T, value T) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeOneOrMany decodes null, a single value or a list of values
+func decodeOneOrMany[T any](raw json.RawMessage) ([]T, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var many []T
+	if err := json.Unmarshal(raw, &many); err == nil {
+		return many, nil
+	}
+	var one T
+	if err := json.Unmarshal(raw, &one); err != nil {
+		return nil, err
+	}
+	return []T{one}, nil
+}
+
+// NewPendingTransactions notifies transactions entering the pool, as full
+// objects when fullTx is true and hashes otherwise
+func (api *ethAPI) NewPendingTransactions(ctx context.Context, fullTx *bool) (*rpc.Subscription, error) {
+	full := fullTx != nil && *fullTx
+	return subscribe(ctx, &api.c.pendingFeed, func(ptx *pendingTx) interface{} {
+		if full {
+			return marshalTx(ptx.tx, ptx.from, nil, 0)
+		}
+		return ptx.tx.Hash()
+	})
+}
+
+// NewHeads notifies the header of every mined block
+func (api *ethAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	return subscribe(ctx, &api.c.headFeed, func(mined *minedBlock) interface{} {
+		return mined.block.Header()
+	})
+}
+
+// subscribe forwards feed events to an eth_subscribe subscription
+func subscribe[T any](ctx context.Context, feed *event.Feed, render func(T) interface{}) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan T, 256)
+		feedSub := feed.Subscribe(events)
+		defer feedSub.Unsubscribe()
+		for {
+			select {
+			case event := <-events:
+				_ = notifier.Notify(sub.ID, render(event))
+			case <-sub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// resolveNumber turns a block tag into a number. Callers hold mu.
+func (c *Chain) resolveNumber(number rpc.BlockNumber) uint64 {
+	head := c.head().block.NumberU64()
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		return head
+	case rpc.FinalizedBlockNumber, rpc.SafeBlockNumber:
+		return head - min(finalityDepth, uint64(len(c.blocks)-1))
+	case rpc.EarliestBlockNumber:
+		return c.blocks[0].block.NumberU64()
+	}
+	return uint64(number)
+}
+
+// resolve returns the block of a number or tag. Callers hold mu.
+func (c *Chain) resolve(number rpc.BlockNumber) *minedBlock {
+	return c.blockByNumber(c.resolveNumber(number))
+}
+
+// resolveBlock returns the block of a number, tag or hash. Callers hold mu.
+func (c *Chain) resolveBlock(blockNrOrHash rpc.BlockNumberOrHash) *minedBlock {
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		return c.byHash[hash]
+	}
+	if number, ok := blockNrOrHash.Number(); ok {
+		return c.resolve(number)
+	}
+	return nil
+}
+
+// marshalBlock renders a block like eth_getBlockByNumber
+func marshalBlock(mined *minedBlock, fullTx bool) map[string]interface{} {
+	block := mined.block
+	raw, _ := json.Marshal(block.Header())
+	var fields map[string]interface{}
+	_ = json.Unmarshal(raw, &fields)
+
+	txs := make([]interface{}, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		if fullTx {
+			txs[i] = marshalTx(tx, mined.senders[i], mined, i)
+		} else {
+			txs[i] = tx.Hash()
+		}
+	}
+	fields["hash"] = block.Hash()
+	fields["size"] = hexutil.Uint64(block.Size())
+	fields["totalDifficulty"] = (*hexutil.Big)(new(big.Int))
+	fields["uncles"] = []common.Hash{}
+	fields["transactions"] = txs
+	return fields
+}
+
+// marshalTx renders a transaction like eth_getTransactionByHash; mined is
+// nil for pending transactions
+func marshalTx(tx *types.Transaction, from common.Address, mined *minedBlock, index int) map[string]interface{} {
+	raw, _ := tx.MarshalJSON()
+	var fields map[string]interface{}
+	_ = json.Unmarshal(raw, &fields)
+
+	fields["from"] = from
+	fields["gasPrice"] = (*hexutil.Big)(tx.GasFeeCap())
+	fields["blockHash"] = nil
+	fields["blockNumber"] = nil
+	fields["transactionIndex"] = nil
+	if mined != nil {
+		fields["gasPrice"] = (*hexutil.Big)(effectiveGasPrice(tx, mined.block.BaseFee()))
+		fields["blockHash"] = mined.block.Hash()
+		fields["blockNumber"] = (*hexutil.Big)(mined.block.Number())
+		fields["transactionIndex"] = hexutil.Uint64(index)
+	}
+	return fields
+}
+
+// netAPI implements the net namespace
+type netAPI struct {
+	c *Chain
+}
+
+func (api *netAPI) Version() string {
+	return api.c.chainID.String()
+}
+
+func (api *netAPI) PeerCount() hexutil.Uint {
+	return hexutil.Uint(len(api.c.miners))
+}
+
+func (api *netAPI) Listening() bool {
+	return true
+}
+
+// web3API implements the web3 namespace
+type web3API struct{}
+
+func (web3API) ClientVersion() string {
+	return "SomniaStream/mock"
+}
@@ -0,0 +1,343 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"somnia-stream/pkg/selectors"
+)
+
+// BlockDetailSubjects maps each block detail level to the subject it is published on
+var BlockDetailSubjects = map[string]string{
+	"header": "eth.blocks.header",
+	"hashes": "eth.blocks.hashes",
+	"full":   "eth.blocks.full",
+}
+
+// BlockPayload builds the published header fields and transactions of a
+// block; senders are recovered with signer
+func BlockPayload(block *types.Block, signer types.Signer) (map[string]interface{}, []map[string]interface{}) {
+	transactions := make([]map[string]interface{}, len(block.Transactions()))
+	baseFee := block.BaseFee()
+	for i, tx := range block.Transactions() {
+		transactions[i] = map[string]interface{}{
+			"hash":     tx.Hash().Hex(),
+			"from":     nil,
+			"to":       tx.To(),
+			"value":    tx.Value().String(),
+			"gasPrice": tx.GasPrice().String(),
+			"gas":      tx.Gas(),
+			"nonce":    tx.Nonce(),
+		}
+		// Recover the sender with the signer for the configured chain ID
+		if from, err := types.Sender(signer, tx); err == nil {
+			transactions[i]["from"] = from.Hex()
+		} else {
+			log.Printf("[BLOCKS] WARNING: Failed to recover sender of %s: %v", tx.Hash().Hex(), err)
+		}
+		if baseFee != nil {
+			if tip, err := tx.EffectiveGasTip(baseFee); err == nil {
+				transactions[i]["effectiveTip"] = tip.String()
+			}
+		}
+		if selector, ok := selectors.FromData(tx.Data()); ok {
+			transactions[i]["methodId"] = selector
+		}
+		transactions[i]["type"] = tx.Type()
+		if tx.Type() >= types.DynamicFeeTxType {
+			transactions[i]["maxFeePerGas"] = tx.GasFeeCap().String()
+			transactions[i]["maxPriorityFeePerGas"] = tx.GasTipCap().String()
+		}
+		if tx.Type() == types.BlobTxType {
+			transactions[i]["maxFeePerBlobGas"] = tx.BlobGasFeeCap().String()
+			transactions[i]["blobGas"] = tx.BlobGas()
+			transactions[i]["blobVersionedHashes"] = tx.BlobHashes()
+		}
+	}
+
+	header := map[string]interface{}{
+		"number":       block.Number().String(),
+		"hash":         block.Hash().Hex(),
+		"parentHash":   block.ParentHash().Hex(),
+		"timestamp":    block.Time(),
+		"gasUsed":      block.GasUsed(),
+		"gasLimit":     block.GasLimit(),
+		"difficulty":   block.Difficulty().String(),
+		"size":         block.Size(),
+		"miner":        block.Coinbase().Hex(),
+		"extraData":    hexutil.Encode(block.Extra()),
+		"stateRoot":    block.Root().Hex(),
+		"receiptsRoot": block.ReceiptHash().Hex(),
+		"txRoot":       block.TxHash().Hex(),
+		"unclesHash":   block.UncleHash().Hex(),
+		"nonce":        hexutil.EncodeUint64(block.Nonce()),
+		"mixHash":      block.MixDigest().Hex(),
+		"txCount":      len(transactions),
+	}
+	if baseFee != nil {
+		header["baseFeePerGas"] = baseFee.String()
+	}
+	// Blob gas fields of EIP-4844 blocks
+	if blobGasUsed, excessBlobGas := block.BlobGasUsed(), block.ExcessBlobGas(); blobGasUsed != nil && excessBlobGas != nil {
+		header["blobGasUsed"] = *blobGasUsed
+		header["excessBlobGas"] = *excessBlobGas
+		header["blobBaseFee"] = eip4844.CalcBlobFee(*excessBlobGas).String()
+	}
+	return header, transactions
+}
+
+// PublishBlockDetailLevels publishes a block at every detail level in levels:
+// header only, header plus transaction hashes, and header plus full
+// transactions. prefix is prepended to the subjects, e.g. "testnet." for an
+// additional network.
+func PublishBlockDetailLevels(publisher Publisher, levels []string, prefix string, header map[string]interface{}, transactions []map[string]interface{}) error {
+	for _, level := range levels {
+		subject, ok := BlockDetailSubjects[level]
+		if !ok {
+			log.Printf("[BLOCKS] WARNING: Unknown block detail level %q, skipping", level)
+			continue
+		}
+		subject = prefix + subject
+
+		payload := make(map[string]interface{}, len(header)+1)
+		for k, v := range header {
+			payload[k] = v
+		}
+		switch level {
+		case "hashes":
+			hashes := make([]interface{}, len(transactions))
+			for i, tx := range transactions {
+				hashes[i] = tx["hash"]
+			}
+			payload["transactions"] = hashes
+		case "full":
+			payload["transactions"] = transactions
+		}
+
+		data, _ := json.Marshal(payload)
+		log.Printf("[BLOCKS] Publishing %s block data to %s (size: %d bytes)", level, subject, len(data))
+
+		if err := publisher.Publish(subject, data); err != nil {
+			log.Printf("[BLOCKS] ERROR: Failed to publish to JetStream: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishLatestBlock publishes the new head, and the blocks produced since
+// lastBlock first so fast chains don't lose blocks between polls
+func (c *Chain) PublishLatestBlock(lastBlock *uint64) error {
+	log.Printf("[BLOCKS] Fetching latest block from Somnia RPC...")
+	block, err := c.eth.BlockByNumber(context.Background(), nil)
+	if err != nil {
+		log.Printf("[BLOCKS] ERROR: Failed to fetch latest block: %v", err)
+		return err
+	}
+
+	currentBlockNumber := block.Number().Uint64()
+	log.Printf("[BLOCKS] Current block number: %d, Last processed: %d", currentBlockNumber, *lastBlock)
+
+	if currentBlockNumber <= *lastBlock {
+		log.Printf("[BLOCKS] No new block, skipping...")
+		return nil // No new block
+	}
+	if c.Hooks.Head != nil && !c.Hooks.Head(block) {
+		return nil // Withheld and retried on the next poll
+	}
+
+	if *lastBlock > 0 && currentBlockNumber > *lastBlock+1 {
+		from := *lastBlock + 1
+		if catchupMax := uint64(max(c.options().BlockCatchupMax, 0)); currentBlockNumber-from > catchupMax {
+			log.Printf("[BLOCKS] WARNING: Fell behind, skipping blocks %d-%d", from, currentBlockNumber-catchupMax-1)
+			from = currentBlockNumber - catchupMax
+		}
+		err := c.fetchBlocks(from, currentBlockNumber-1, func(missed fetchedBlock) error {
+			log.Printf("[BLOCKS] Processing skipped block #%d with hash %s", missed.block.NumberU64(), missed.block.Hash().Hex())
+			if err := c.processBlock(missed.block, missed.receipts); err != nil {
+				return err
+			}
+			*lastBlock = missed.block.NumberU64()
+			return nil
+		})
+		if err != nil {
+			log.Printf("[BLOCKS] ERROR: Failed to catch up on skipped blocks: %v", err)
+			return err
+		}
+	}
+	*lastBlock = currentBlockNumber
+
+	log.Printf("[BLOCKS] Processing new block #%d with hash %s", currentBlockNumber, block.Hash().Hex())
+
+	// eth_getBlockByNumber already returned the full transactions
+	return c.processBlock(block, nil)
+}
+
+// processBlock publishes a block and hands it to the Block hook. Receipts are
+// fetched here unless they were fetched ahead.
+func (c *Chain) processBlock(block *types.Block, receipts []*types.Receipt) error {
+	log.Printf("[BLOCKS] Block contains %d transactions", len(block.Transactions()))
+	header, transactions := BlockPayload(block, c.signer)
+	if c.Hooks.Transactions != nil {
+		c.Hooks.Transactions(transactions)
+	}
+
+	if err := PublishBlockDetailLevels(c.publisher, c.options().BlockDetailLevels, "", header, transactions); err != nil {
+		return err
+	}
+	log.Printf("[BLOCKS] ✅ Successfully published block #%d to JetStream", block.NumberU64())
+	c.pending.markMined(block)
+
+	if c.Hooks.Block == nil {
+		return nil
+	}
+	if receipts == nil && c.Hooks.Receipts != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		var err error
+		receipts, err = c.Hooks.Receipts(ctx, block)
+		cancel()
+		if err != nil {
+			log.Printf("[BLOCKS] ERROR: Failed to fetch receipts for block #%d: %v", block.NumberU64(), err)
+		}
+	}
+	c.Hooks.Block(block, receipts)
+	return nil
+}
+
+// Backfill publishes the blocks missed while the service was down, in steps
+// of BlockCatchupMax, until PublishLatestBlock can take over. Gaps larger
+// than BackfillMaxGap are skipped up to the last BackfillMaxGap blocks.
+// checkpoint is called with every published block.
+func (c *Chain) Backfill(ctx context.Context, lastBlock *uint64, checkpoint func(uint64)) {
+	opts := c.options()
+	step := uint64(max(opts.BlockCatchupMax, 1))
+	maxGap := uint64(max(opts.BackfillMaxGap, 0))
+	for ctx.Err() == nil {
+		headCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		head, err := c.eth.BlockNumber(headCtx)
+		cancel()
+		if err != nil {
+			log.Printf("[BLOCKS] WARNING: Backfill stopped, failed to fetch head: %v", err)
+			return
+		}
+		if head <= *lastBlock+step {
+			return // Close enough for the blocks monitor to catch up
+		}
+		if head-*lastBlock > maxGap {
+			log.Printf("[BLOCKS] WARNING: %d blocks missed since the checkpoint, skipping blocks %d-%d", head-*lastBlock, *lastBlock+1, head-maxGap)
+			*lastBlock = head - maxGap
+			if maxGap <= step {
+				return
+			}
+		}
+
+		from, to := *lastBlock+1, *lastBlock+step
+		log.Printf("[BLOCKS] Backfilling blocks %d-%d (head %d)", from, to, head)
+		err = c.fetchBlocks(from, to, func(missed fetchedBlock) error {
+			if err := c.processBlock(missed.block, missed.receipts); err != nil {
+				return err
+			}
+			*lastBlock = missed.block.NumberU64()
+			checkpoint(*lastBlock)
+			return nil
+		})
+		if err != nil {
+			log.Printf("[BLOCKS] WARNING: Backfill stopped at block %d: %v", *lastBlock, err)
+			return
+		}
+	}
+}
+
+// fetchedBlock is a block fetched ahead of publishing, with its receipts when
+// the Receipts hook returned them
+type fetchedBlock struct {
+	block    *types.Block
+	receipts []*types.Receipt
+	err      error
+}
+
+// blockByNumber returns a block through the BlockByNumber hook or the endpoint
+func (c *Chain) blockByNumber(ctx context.Context, number uint64) (*types.Block, error) {
+	if c.Hooks.BlockByNumber != nil {
+		return c.Hooks.BlockByNumber(ctx, number)
+	}
+	return c.eth.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+}
+
+// fetchBlock fetches a block and its receipts. A failed receipt fetch leaves
+// receipts nil so processBlock retries it.
+func (c *Chain) fetchBlock(ctx context.Context, number uint64) fetchedBlock {
+	blockCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	block, err := c.blockByNumber(blockCtx, number)
+	if err != nil {
+		return fetchedBlock{err: fmt.Errorf("fetching block #%d: %w", number, err)}
+	}
+	fetched := fetchedBlock{block: block}
+	if c.Hooks.Block != nil && c.Hooks.Receipts != nil {
+		fetched.receipts, _ = c.Hooks.Receipts(blockCtx, block)
+	}
+	return fetched
+}
+
+// fetchBlocks fetches the blocks from..to with BlockFetchWorkers concurrent
+// workers and hands them to process in block-number order. It stops at the
+// first failed fetch or process error.
+func (c *Chain) fetchBlocks(from, to uint64, process func(fetchedBlock) error) error {
+	if to < from {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	count := int(to - from + 1)
+	results := make([]chan fetchedBlock, count)
+	for i := range results {
+		results[i] = make(chan fetchedBlock, 1)
+	}
+	jobs := make(chan int)
+	var workers sync.WaitGroup
+	for w := 0; w < min(max(c.options().BlockFetchWorkers, 1), count); w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range jobs {
+				results[i] <- c.fetchBlock(ctx, from+uint64(i))
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; i < count; i++ {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	defer func() {
+		cancel() // Stop outstanding fetches after an error
+		workers.Wait()
+	}()
+
+	for i := 0; i < count; i++ {
+		fetched := <-results[i]
+		if fetched.err != nil {
+			return fetched.err
+		}
+		if err := process(fetched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"encoding/json"
+)
+
+// Overflow modes for list payloads that exceed their configured cap
+const (
+	OverflowTruncate = "truncate" // Publish the first N items with continuation metadata
+	OverflowSplit    = "split"    // Spread all items over several messages
+)
+
+// PublishCapped publishes a payload whose list field may exceed limit. Every
+// message carries "returned" and "truncated"; truncated messages also carry
+// "omitted", and split messages carry "part"/"parts" so consumers can
+// reassemble the full list.
+func PublishCapped(publisher Publisher, subject string, base map[string]interface{}, field string, items []map[string]interface{}, limit int, mode string) error {
+	if limit <= 0 || len(items) <= limit {
+		return publishPart(publisher, subject, base, field, items, map[string]interface{}{
+			"returned":  len(items),
+			"truncated": false,
+		})
+	}
+
+	if mode != OverflowSplit {
+		return publishPart(publisher, subject, base, field, items[:limit], map[string]interface{}{
+			"returned":  limit,
+			"truncated": true,
+			"omitted":   len(items) - limit,
+		})
+	}
+
+	parts := (len(items) + limit - 1) / limit
+	for part := 0; part < parts; part++ {
+		chunk := items[part*limit : min((part+1)*limit, len(items))]
+		if err := publishPart(publisher, subject, base, field, chunk, map[string]interface{}{
+			"returned":  len(chunk),
+			"truncated": false,
+			"part":      part + 1,
+			"parts":     parts,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func publishPart(publisher Publisher, subject string, base map[string]interface{}, field string, items []map[string]interface{}, meta map[string]interface{}) error {
+	payload := make(map[string]interface{}, len(base)+len(meta)+1)
+	for k, v := range base {
+		payload[k] = v
+	}
+	for k, v := range meta {
+		payload[k] = v
+	}
+	payload[field] = items
+
+	data, _ := json.Marshal(payload)
+	return publisher.Publish(subject, data)
+}
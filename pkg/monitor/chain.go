@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Options are the settings of a Chain's monitors; they can be swapped with
+// SetOptions while the monitors run
+type Options struct {
+	BlockDetailLevels       []string      // Levels blocks are published at, see BlockDetailSubjects
+	BlockCatchupMax         int           // Most skipped blocks published per poll; also the backfill step
+	BlockFetchWorkers       int           // Blocks fetched concurrently while catching up
+	BackfillMaxGap          int           // Blocks missed since a checkpoint beyond this are skipped
+	LogsChunkSize           int           // Blocks per eth_getLogs request
+	LogsMaxPerMessage       int           // Logs per eth.logs message (0 = unlimited)
+	PendingMaxTxs           int           // Transactions per eth.pending message (0 = unlimited)
+	PendingSnapshotInterval time.Duration // Full eth.pending.snapshot interval (0 = disabled)
+	PendingHydrateWorkers   int           // Concurrent eth_getTransactionByHash calls for announced hashes
+	OverflowMode            string        // OverflowTruncate or OverflowSplit
+}
+
+// Hooks let the service embedding a Chain enrich payloads and react to what
+// was published. Every hook is optional.
+type Hooks struct {
+	// BlockByNumber fetches a block, e.g. through a cache, instead of
+	// eth_getBlockByNumber
+	BlockByNumber func(ctx context.Context, number uint64) (*types.Block, error)
+	// Receipts fetches the receipts of a block for the Block hook; nil
+	// receipts skip them
+	Receipts func(ctx context.Context, block *types.Block) ([]*types.Receipt, error)
+	// Head is called with every new head before it is published; returning
+	// false withholds it until the next poll
+	Head func(block *types.Block) bool
+	// Transactions enriches block and pending transactions before they are published
+	Transactions func(txs []map[string]interface{})
+	// Logs enriches logs before they are published
+	Logs func(logs []map[string]interface{})
+	// Block is called after a block was published, with its receipts when fetched
+	Block func(block *types.Block, receipts []*types.Receipt)
+	// Pending is called with the pending transactions seen by a tick: the
+	// whole pool when polling, new arrivals with a subscription
+	Pending func(txs []map[string]interface{})
+	// Pool is called with the transactions still pending after a
+	// subscription tick
+	Pool func(hashes []string)
+	// GasPrice is called with every published gas price; its error fails the tick
+	GasPrice func(price *big.Int) error
+}
+
+// Chain runs the block, pending transaction, log, gas price and network
+// monitors of one network. Its Publish* methods are monitor ticks, usually
+// run by a Registry, and hand every payload to the Publisher.
+type Chain struct {
+	Hooks Hooks // Set before the monitors start
+
+	rpc       *rpc.Client
+	eth       *ethclient.Client
+	signer    types.Signer
+	publisher Publisher
+
+	mu   sync.RWMutex
+	opts Options
+
+	mempool *mempool            // Owned by the pending monitor
+	pending pendingSubscription // Filled by SubscribePending
+}
+
+// NewChain returns the monitors of the network behind client, whose
+// transaction senders are recovered for chainID
+func NewChain(client *rpc.Client, chainID *big.Int, publisher Publisher, opts Options) *Chain {
+	return &Chain{
+		rpc:       client,
+		eth:       ethclient.NewClient(client),
+		signer:    types.LatestSignerForChainID(chainID),
+		publisher: publisher,
+		opts:      opts,
+		mempool:   newMempool(),
+	}
+}
+
+// SetOptions swaps the options on configuration reload
+func (c *Chain) SetOptions(opts Options) {
+	c.mu.Lock()
+	c.opts = opts
+	c.mu.Unlock()
+}
+
+func (c *Chain) options() Options {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.opts
+}
+
+// publishCapped publishes a list payload with the chain's overflow mode
+func (c *Chain) publishCapped(subject string, base map[string]interface{}, field string, items []map[string]interface{}, limit int) error {
+	return PublishCapped(c.publisher, subject, base, field, items, limit, c.options().OverflowMode)
+}
+
+// PublishGasPrice publishes the suggested gas price on eth.gasPrice
+func (c *Chain) PublishGasPrice() error {
+	gasPrice, err := c.eth.SuggestGasPrice(context.Background())
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(GasPricePayload(gasPrice))
+	if err := c.publisher.Publish("eth.gasPrice", data); err != nil {
+		return err
+	}
+	if c.Hooks.GasPrice != nil {
+		return c.Hooks.GasPrice(gasPrice)
+	}
+	return nil
+}
+
+// GasPricePayload builds the eth.gasPrice payload of a gas price
+func GasPricePayload(gasPrice *big.Int) map[string]interface{} {
+	return map[string]interface{}{
+		"gasPrice":  gasPrice.String(),
+		"gwei":      float64(gasPrice.Uint64()) / 1e9,
+		"timestamp": time.Now().Unix(),
+	}
+}
+
+// PublishNetworkStats publishes the network statistics on eth.network
+func (c *Chain) PublishNetworkStats() error {
+	data, _ := json.Marshal(NetworkStats(c.rpc))
+	return c.publisher.Publish("eth.network", data)
+}
+
+// NetworkStats collects the published network statistics of an endpoint
+func NetworkStats(client *rpc.Client) map[string]interface{} {
+	var chainId, blockNumber, gasPrice, peerCount string
+
+	// Get various network stats
+	client.Call(&chainId, "eth_chainId")
+	client.Call(&blockNumber, "eth_blockNumber")
+	client.Call(&gasPrice, "eth_gasPrice")
+	client.Call(&peerCount, "net_peerCount")
+
+	var syncing interface{}
+	client.Call(&syncing, "eth_syncing")
+
+	return map[string]interface{}{
+		"chainId":     chainId,
+		"blockNumber": blockNumber,
+		"gasPrice":    gasPrice,
+		"peerCount":   peerCount,
+		"syncing":     syncing,
+		"timestamp":   time.Now().Unix(),
+	}
+}
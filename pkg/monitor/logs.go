@@ -0,0 +1,146 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// logsMaxBlockRange bounds the blocks the logs monitor covers per tick, so a
+// monitor that fell behind, e.g. after a restart, catches up in steps
+const logsMaxBlockRange = 5000
+
+// logsTooLargeMessages are the error messages providers answer eth_getLogs
+// with when a range returns too many logs or spans too many blocks
+var logsTooLargeMessages = []string{
+	"response too large",
+	"response size exceeded",
+	"query returned more than",
+	"too many results",
+	"block range",
+	"range too large",
+	"limit exceeded",
+	"exceeds the limit",
+}
+
+// logsTooLarge reports whether an eth_getLogs error asks for a smaller range
+func logsTooLarge(err error) bool {
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	if rpcErr.ErrorCode() == -32005 { // Limit exceeded
+		return true
+	}
+	message := strings.ToLower(rpcErr.Error())
+	for _, tooLarge := range logsTooLargeMessages {
+		if strings.Contains(message, tooLarge) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLogs runs eth_getLogs with filter over from..to in LogsChunkSize block
+// chunks, bisecting a chunk whenever the endpoint rejects it as too large.
+// filter holds the address and topics; the block range is set per chunk.
+func (c *Chain) GetLogs(ctx context.Context, filter map[string]interface{}, from, to uint64) ([]map[string]interface{}, error) {
+	chunk := uint64(max(c.options().LogsChunkSize, 1))
+	var logs []map[string]interface{}
+	for start := from; start <= to; start += chunk {
+		end := to
+		if end-start >= chunk {
+			end = start + chunk - 1
+		}
+		chunkLogs, err := c.getLogsRange(ctx, filter, start, end)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, chunkLogs...)
+	}
+	return logs, nil
+}
+
+// getLogsRange fetches the logs of one range, splitting it in halves until
+// every part is small enough
+func (c *Chain) getLogsRange(ctx context.Context, filter map[string]interface{}, from, to uint64) ([]map[string]interface{}, error) {
+	query := make(map[string]interface{}, len(filter)+2)
+	for k, v := range filter {
+		query[k] = v
+	}
+	query["fromBlock"] = fmt.Sprintf("0x%x", from)
+	query["toBlock"] = fmt.Sprintf("0x%x", to)
+
+	var logs []map[string]interface{}
+	err := c.rpc.CallContext(ctx, &logs, "eth_getLogs", query)
+	if err == nil {
+		return logs, nil
+	}
+	if !logsTooLarge(err) || from == to {
+		return nil, fmt.Errorf("eth_getLogs %d-%d: %w", from, to, err)
+	}
+
+	mid := from + (to-from)/2
+	log.Printf("[LOGS] Range %d-%d too large (%v), splitting at %d", from, to, err, mid)
+	first, err := c.getLogsRange(ctx, filter, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	second, err := c.getLogsRange(ctx, filter, mid+1, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// PublishLogs publishes the logs of the blocks after lastBlock on eth.logs
+func (c *Chain) PublishLogs(lastBlock *uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	head, err := c.eth.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	if head <= *lastBlock {
+		return nil
+	}
+
+	from := *lastBlock + 1
+	if *lastBlock == 0 {
+		from = 0 // Start with the last 5 blocks
+		if head > 5 {
+			from = head - 5
+		}
+	}
+	to := head
+	if to-from >= logsMaxBlockRange {
+		to = from + logsMaxBlockRange - 1
+	}
+
+	logs, err := c.GetLogs(ctx, nil, from, to)
+	if err != nil {
+		return err
+	}
+
+	if len(logs) > 0 {
+		if c.Hooks.Logs != nil {
+			c.Hooks.Logs(logs)
+		}
+		err := c.publishCapped("eth.logs", map[string]interface{}{
+			"count":     len(logs),
+			"fromBlock": from,
+			"toBlock":   to,
+			"timestamp": time.Now().Unix(),
+		}, "logs", logs, c.options().LogsMaxPerMessage)
+		if err != nil {
+			return err
+		}
+	}
+	*lastBlock = to
+	return nil
+}
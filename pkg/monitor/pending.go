@@ -0,0 +1,378 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PendingSubscriptionResync is how often the pool should be fully polled
+// while subscribed when no snapshot interval is set, since the subscription
+// alone never reports dropped transactions
+const PendingSubscriptionResync = time.Minute
+
+// mempool remembers the pending pool between ticks so only changes are
+// published. It is owned by the pending transaction monitor goroutine.
+type mempool struct {
+	known        map[string]struct{}
+	lastSnapshot time.Time
+}
+
+func newMempool() *mempool {
+	return &mempool{known: make(map[string]struct{})}
+}
+
+// diff replaces the known pool with the current one and returns the newly
+// observed transactions and the hashes that left the pool
+func (m *mempool) diff(pendingTxs []map[string]interface{}) ([]map[string]interface{}, []string) {
+	current := make(map[string]struct{}, len(pendingTxs))
+	var added []map[string]interface{}
+
+	for _, tx := range pendingTxs {
+		hash, _ := tx["hash"].(string)
+		if hash == "" {
+			continue
+		}
+		current[hash] = struct{}{}
+		if _, ok := m.known[hash]; !ok {
+			added = append(added, tx)
+		}
+	}
+
+	var removed []string
+	for hash := range m.known {
+		if _, ok := current[hash]; !ok {
+			removed = append(removed, hash)
+		}
+	}
+
+	m.known = current
+	return added, removed
+}
+
+// add records transactions announced by a subscription and returns the ones not known yet
+func (m *mempool) add(txs []map[string]interface{}) []map[string]interface{} {
+	var added []map[string]interface{}
+	for _, tx := range txs {
+		hash, _ := tx["hash"].(string)
+		if hash == "" {
+			continue
+		}
+		if _, ok := m.known[hash]; !ok {
+			m.known[hash] = struct{}{}
+			added = append(added, tx)
+		}
+	}
+	return added
+}
+
+// remove forgets mined transactions and returns the hashes that were known
+func (m *mempool) remove(hashes []string) []string {
+	var removed []string
+	for _, hash := range hashes {
+		if _, ok := m.known[hash]; ok {
+			delete(m.known, hash)
+			removed = append(removed, hash)
+		}
+	}
+	return removed
+}
+
+// hashes returns the transactions currently believed to be pending
+func (m *mempool) hashes() []string {
+	hashes := make([]string, 0, len(m.known))
+	for hash := range m.known {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// size returns the number of transactions currently believed to be pending
+func (m *mempool) size() int {
+	return len(m.known)
+}
+
+// snapshotStale reports whether a snapshot is due without consuming it
+func (m *mempool) snapshotStale(interval time.Duration) bool {
+	return interval > 0 && time.Since(m.lastSnapshot) >= interval
+}
+
+// snapshotDue reports whether a full snapshot should be published now
+func (m *mempool) snapshotDue(interval time.Duration) bool {
+	if interval <= 0 || time.Since(m.lastSnapshot) < interval {
+		return false
+	}
+	m.lastSnapshot = time.Now()
+	return true
+}
+
+// pendingSubscription buffers transactions delivered by a newPendingTransactions
+// subscription, and the hashes of transactions mined since, until the pending
+// monitor flushes them
+type pendingSubscription struct {
+	mu      sync.Mutex
+	buffer  []map[string]interface{}
+	mined   []string
+	running atomic.Bool
+}
+
+func (p *pendingSubscription) active() bool {
+	return p.running.Load()
+}
+
+func (p *pendingSubscription) push(tx map[string]interface{}) {
+	p.mu.Lock()
+	p.buffer = append(p.buffer, tx)
+	p.mu.Unlock()
+}
+
+// markMined records the transaction hashes of a new block
+func (p *pendingSubscription) markMined(block *types.Block) {
+	if !p.active() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tx := range block.Transactions() {
+		p.mined = append(p.mined, tx.Hash().Hex())
+	}
+}
+
+// drain returns the buffered transactions and mined hashes
+func (p *pendingSubscription) drain() ([]map[string]interface{}, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	txs, mined := p.buffer, p.mined
+	p.buffer, p.mined = nil, nil
+	return txs, mined
+}
+
+// PublishPending publishes the pending pool changes since the last tick on
+// eth.pending, and a periodic full snapshot on eth.pending.snapshot. While
+// SubscribePending is subscribed the changes come from the subscription,
+// otherwise the pool is polled with eth_pendingTransactions.
+func (c *Chain) PublishPending() error {
+	if c.pending.active() {
+		return c.flushSubscribedPending()
+	}
+	return c.pollPending()
+}
+
+// pollPending publishes pending transaction deltas (and a periodic full snapshot)
+func (c *Chain) pollPending() error {
+	log.Printf("[PENDING] Fetching pending transactions from Somnia RPC...")
+	var pendingTxs []map[string]interface{}
+
+	// Get pending transactions using RPC call
+	err := c.rpc.Call(&pendingTxs, "eth_pendingTransactions")
+	if err != nil {
+		log.Printf("[PENDING] ERROR: Failed to fetch pending transactions: %v", err)
+		return err
+	}
+
+	log.Printf("[PENDING] Found %d pending transactions", len(pendingTxs))
+
+	added, removed := c.mempool.diff(pendingTxs)
+	if len(added) > 0 || len(removed) > 0 {
+		if err := c.publishPendingDelta(len(pendingTxs), added, removed); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("[PENDING] No mempool changes since last poll")
+	}
+
+	if c.mempool.snapshotDue(c.options().PendingSnapshotInterval) {
+		if err := c.publishPendingSnapshot(pendingTxs); err != nil {
+			return err
+		}
+	}
+
+	if len(pendingTxs) > 0 && c.Hooks.Pending != nil {
+		c.Hooks.Pending(pendingTxs)
+	}
+
+	return nil
+}
+
+// publishPendingDelta publishes newly observed and dropped pending
+// transactions on eth.pending
+func (c *Chain) publishPendingDelta(poolSize int, added []map[string]interface{}, removed []string) error {
+	log.Printf("[PENDING] Publishing pending delta to JetStream (+%d / -%d)", len(added), len(removed))
+	if c.Hooks.Transactions != nil {
+		c.Hooks.Transactions(added)
+	}
+
+	err := c.publishCapped("eth.pending", map[string]interface{}{
+		"type":      "delta",
+		"count":     poolSize,
+		"added":     len(added),
+		"removed":   removed,
+		"timestamp": time.Now().Unix(),
+	}, "transactions", added, c.options().PendingMaxTxs)
+	if err != nil {
+		log.Printf("[PENDING] ERROR: Failed to publish to JetStream: %v", err)
+		return err
+	}
+
+	log.Printf("[PENDING] ✅ Successfully published pending transactions to JetStream")
+	return nil
+}
+
+// publishPendingSnapshot publishes the full pending pool so delta consumers can resync
+func (c *Chain) publishPendingSnapshot(pendingTxs []map[string]interface{}) error {
+	if c.Hooks.Transactions != nil {
+		c.Hooks.Transactions(pendingTxs)
+	}
+	err := c.publishCapped("eth.pending.snapshot", map[string]interface{}{
+		"type":      "snapshot",
+		"count":     len(pendingTxs),
+		"timestamp": time.Now().Unix(),
+	}, "transactions", pendingTxs, c.options().PendingMaxTxs)
+	if err != nil {
+		log.Printf("[PENDING] ERROR: Failed to publish pending snapshot: %v", err)
+		return err
+	}
+
+	log.Printf("[PENDING] Published full pending snapshot (%d transactions)", len(pendingTxs))
+	return nil
+}
+
+// flushSubscribedPending publishes transactions received through the
+// subscription, and those mined, since the last tick
+func (c *Chain) flushSubscribedPending() error {
+	txs, mined := c.pending.drain()
+	added := c.mempool.add(txs)
+	removed := c.mempool.remove(mined)
+	if len(added) > 0 || len(removed) > 0 {
+		if err := c.publishPendingDelta(c.mempool.size(), added, removed); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 && c.Hooks.Pending != nil {
+		c.Hooks.Pending(added)
+	}
+	if c.Hooks.Pool != nil {
+		c.Hooks.Pool(c.mempool.hashes())
+	}
+
+	// The subscription only announces arrivals; a periodic full poll detects
+	// dropped transactions and refreshes the snapshot subject
+	if c.mempool.snapshotStale(c.options().PendingSnapshotInterval) {
+		return c.pollPending()
+	}
+
+	return nil
+}
+
+// SubscribePending keeps a newPendingTransactions subscription on endpoint
+// alive until ctx is done, so PublishPending doesn't have to poll. While the
+// endpoint rejects or drops it, PublishPending polls and the subscription is
+// retried with backoff. Announcements are discarded while paused reports true.
+func (c *Chain) SubscribePending(ctx context.Context, endpoint string, paused func() bool) {
+	backoff := time.Second
+	for {
+		err := c.subscribePending(ctx, endpoint, paused)
+		c.pending.running.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[PENDING] Subscription unavailable (%v), polling and retrying in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// subscribePending subscribes to newPendingTransactions and hydrates hashes
+// into full transactions
+func (c *Chain) subscribePending(ctx context.Context, endpoint string, paused func() bool) error {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// Ask for full bodies; nodes that don't support the flag send hashes instead
+	notifications := make(chan json.RawMessage, 1024)
+	sub, err := client.EthSubscribe(ctx, notifications, "newPendingTransactions", true)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	log.Printf("[PENDING] ✅ Subscribed to newPendingTransactions on %s", endpoint)
+	c.pending.running.Store(true)
+
+	hashes := make(chan string, 1024)
+	var workers sync.WaitGroup
+	for i := 0; i < max(c.options().PendingHydrateWorkers, 1); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for hash := range hashes {
+				c.hydratePending(ctx, client, hash)
+			}
+		}()
+	}
+	defer func() {
+		close(hashes)
+		workers.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case raw := <-notifications:
+			if paused != nil && paused() {
+				continue // Don't buffer while the pending monitor is paused
+			}
+
+			var hash string
+			if err := json.Unmarshal(raw, &hash); err == nil {
+				select {
+				case hashes <- hash:
+				default:
+					log.Printf("[PENDING] Hydration queue full, skipping %s", hash)
+				}
+				continue
+			}
+
+			var tx map[string]interface{}
+			if err := json.Unmarshal(raw, &tx); err == nil {
+				c.pending.push(tx)
+			}
+		}
+	}
+}
+
+// hydratePending fetches the full body of a pending transaction announced by hash
+func (c *Chain) hydratePending(ctx context.Context, client *rpc.Client, hash string) {
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var tx map[string]interface{}
+	if err := client.CallContext(callCtx, &tx, "eth_getTransactionByHash", hash); err != nil {
+		log.Printf("[PENDING] Failed to hydrate pending transaction %s: %v", hash, err)
+		return
+	}
+	if tx == nil {
+		return // Already mined or dropped before we could fetch it
+	}
+	c.pending.push(tx)
+}
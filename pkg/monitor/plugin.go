@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PluginNamePattern restricts plugin names, which double as monitor names,
+// <NAME>_POLL_INTERVAL settings and PLUGIN_<NAME> JetStream streams
+var PluginNamePattern = regexp.MustCompile(`^[a-z][A-Za-z0-9]{0,31}$`)
+
+// Monitor is a poller compiled into the service next to the built-in
+// monitors. It is registered, paused, resumed and re-timed like them and its
+// ticks are counted in /monitors and /health.
+type Monitor interface {
+	// Start runs the monitor until ctx is done, usually through Host.Run
+	Start(ctx context.Context)
+	// Subjects are the subjects the monitor publishes on, without the
+	// subject namespace; they are captured by the plugin's JetStream stream
+	Subjects() []string
+	// Health returns an error while the monitor is unhealthy
+	Health() error
+}
+
+// Host is what the service lends a plugin monitor
+type Host interface {
+	// RPC is the client of RPC_ENDPOINT, with the service's retries,
+	// circuit breaker and RPC metrics
+	RPC() *rpc.Client
+	// Publish publishes a payload on a subject, namespaced, retried and
+	// dead-lettered like the payloads of the built-in monitors
+	Publish(subject string, data []byte) error
+	// Run calls tick on the monitor's interval until ctx is done, honouring
+	// pauses and interval changes; failed ticks are reported on the system
+	// stream
+	Run(ctx context.Context, tick func() error)
+}
+
+// Plugin registers a Monitor implementation
+type Plugin struct {
+	Name     string        // Monitor name, see PluginNamePattern
+	Interval time.Duration // Default tick interval, DefaultInterval when 0
+	New      func(host Host) Monitor
+}
+
+var (
+	pluginsMu sync.Mutex
+	plugins   = make(map[string]Plugin)
+)
+
+// RegisterPlugin adds a plugin monitor, typically from the init function of
+// a file compiled into the binary. It panics on an invalid or duplicate name.
+func RegisterPlugin(plugin Plugin) {
+	if !PluginNamePattern.MatchString(plugin.Name) {
+		panic(fmt.Sprintf("monitor: invalid plugin name %q", plugin.Name))
+	}
+	if plugin.New == nil {
+		panic(fmt.Sprintf("monitor: plugin %s has no constructor", plugin.Name))
+	}
+	if plugin.Interval <= 0 {
+		plugin.Interval = DefaultInterval
+	}
+
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if _, ok := plugins[plugin.Name]; ok {
+		panic(fmt.Sprintf("monitor: plugin %s registered twice", plugin.Name))
+	}
+	plugins[plugin.Name] = plugin
+}
+
+// Plugins returns the registered plugins sorted by name
+func Plugins() []Plugin {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	list := make([]Plugin, 0, len(plugins))
+	for _, plugin := range plugins {
+		list = append(list, plugin)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,249 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/streams"
+)
+
+// Failed publishes are dead-lettered on somnia.dlq (stream SOMNIA_DLQ) with the
+// original subject and error in headers, or spooled to the spool directory
+// when JetStream itself is unavailable
+const (
+	SpoolFile = "dlq.jsonl"
+
+	HeaderOriginalSubject = "Somnia-Original-Subject"
+	HeaderPublishError    = "Somnia-Publish-Error"
+	HeaderFailedAt        = "Somnia-Failed-At"
+	HeaderAttempts        = "Somnia-Attempts"
+)
+
+// PublishPolicy controls publish retries and the local dead-letter spool
+type PublishPolicy struct {
+	Retries  int           // Extra publish attempts before a payload is dead-lettered
+	Backoff  time.Duration // Delay before the first retry, doubled on each further attempt
+	SpoolDir string        // Local spool for payloads that can't reach somnia.dlq either (disabled when empty)
+	DLQ      string        // Dead-letter subject, streams.DLQSubject when empty
+}
+
+// SpooledMsg is one line of the local dead-letter spool
+type SpooledMsg struct {
+	Subject  string `json:"subject"`
+	Data     []byte `json:"data"`
+	Error    string `json:"error"`
+	FailedAt int64  `json:"failedAt"`
+	Attempts int    `json:"attempts"`
+}
+
+// Publisher publishes a payload on a subject. The monitors of a Chain
+// publish through it, so a service can namespace, enrich or redirect their
+// output; JetStreamPublisher publishes straight to JetStream.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// PublisherFunc adapts a function to a Publisher
+type PublisherFunc func(subject string, data []byte) error
+
+// Publish calls f
+func (f PublisherFunc) Publish(subject string, data []byte) error {
+	return f(subject, data)
+}
+
+// JetStreamPublisher publishes payloads to JetStream with retries and
+// dead-letters the ones that still fail
+type JetStreamPublisher struct {
+	js     nats.JetStreamContext
+	policy atomic.Pointer[PublishPolicy]
+	spool  sync.Mutex // Serializes access to the spool file
+}
+
+// NewJetStreamPublisher returns a publisher on a JetStream context. The
+// somnia.dlq stream must exist (see streams.Setup) for dead-lettering to
+// JetStream.
+func NewJetStreamPublisher(js nats.JetStreamContext, policy PublishPolicy) *JetStreamPublisher {
+	p := &JetStreamPublisher{js: js}
+	p.policy.Store(&policy)
+	return p
+}
+
+// SetPolicy swaps the retry and spool settings on configuration reload
+func (p *JetStreamPublisher) SetPolicy(policy PublishPolicy) {
+	p.policy.Store(&policy)
+}
+
+// Publish publishes to JetStream, retrying with backoff, and dead-letters the
+// payload when every attempt failed. The publish error is still returned so
+// the calling monitor records the failure.
+func (p *JetStreamPublisher) Publish(subject string, data []byte) error {
+	policy := p.policy.Load()
+	attempts := max(policy.Retries+1, 1)
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if _, err = p.js.Publish(subject, data); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			time.Sleep(policy.Backoff * time.Duration(1<<(attempt-1)))
+		}
+	}
+
+	p.DeadLetter(subject, data, err, attempts)
+	return err
+}
+
+// DeadLetter stores a payload that could not be published
+func (p *JetStreamPublisher) DeadLetter(subject string, data []byte, publishErr error, attempts int) {
+	failedAt := time.Now()
+
+	dlq := p.policy.Load().DLQ
+	if dlq == "" {
+		dlq = streams.DLQSubject
+	}
+	msg := nats.NewMsg(dlq)
+	msg.Data = data
+	msg.Header.Set(HeaderOriginalSubject, subject)
+	msg.Header.Set(HeaderPublishError, publishErr.Error())
+	msg.Header.Set(HeaderFailedAt, strconv.FormatInt(failedAt.Unix(), 10))
+	msg.Header.Set(HeaderAttempts, strconv.Itoa(attempts))
+	if _, err := p.js.PublishMsg(msg); err == nil {
+		log.Printf("[DLQ] Dead-lettered message for %s after %d attempts: %v", subject, attempts, publishErr)
+		return
+	}
+
+	spooled := SpooledMsg{
+		Subject:  subject,
+		Data:     data,
+		Error:    publishErr.Error(),
+		FailedAt: failedAt.Unix(),
+		Attempts: attempts,
+	}
+	if err := p.spoolMessage(spooled); err != nil {
+		log.Printf("[DLQ] ERROR: Lost message for %s (%v): %v", subject, publishErr, err)
+		return
+	}
+	log.Printf("[DLQ] Spooled message for %s after %d attempts: %v", subject, attempts, publishErr)
+}
+
+// spoolMessage appends a message to the local spool file
+func (p *JetStreamPublisher) spoolMessage(msg SpooledMsg) error {
+	dir := p.policy.Load().SpoolDir
+	if dir == "" {
+		return errors.New("DLQ_SPOOL_DIR not set")
+	}
+
+	p.spool.Lock()
+	defer p.spool.Unlock()
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, SpoolFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, _ := json.Marshal(msg)
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Spooled returns the messages in the local spool
+func (p *JetStreamPublisher) Spooled() ([]SpooledMsg, error) {
+	p.spool.Lock()
+	defer p.spool.Unlock()
+	return p.readSpool()
+}
+
+// readSpool reads the spool file; must be called with spool held
+func (p *JetStreamPublisher) readSpool() ([]SpooledMsg, error) {
+	dir := p.policy.Load().SpoolDir
+	if dir == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filepath.Join(dir, SpoolFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msgs []SpooledMsg
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var msg SpooledMsg
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("[DLQ] Skipping corrupt spool entry: %v", err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, scanner.Err()
+}
+
+// writeSpool replaces the spool file with the given messages; must be called with spool held
+func (p *JetStreamPublisher) writeSpool(msgs []SpooledMsg) error {
+	path := filepath.Join(p.policy.Load().SpoolDir, SpoolFile)
+	if len(msgs) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		line, _ := json.Marshal(msg)
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RedriveSpool re-publishes spooled messages to their original subjects,
+// keeping the ones that still fail, and returns how many were re-driven
+func (p *JetStreamPublisher) RedriveSpool() (int, error) {
+	p.spool.Lock()
+	defer p.spool.Unlock()
+
+	msgs, err := p.readSpool()
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+
+	for i, msg := range msgs {
+		if _, err := p.js.Publish(msg.Subject, msg.Data); err != nil {
+			if writeErr := p.writeSpool(msgs[i:]); writeErr != nil {
+				log.Printf("[DLQ] ERROR: Failed to rewrite spool: %v", writeErr)
+			}
+			return i, fmt.Errorf("re-drive to %s failed: %v", msg.Subject, err)
+		}
+	}
+	return len(msgs), p.writeSpool(nil)
+}
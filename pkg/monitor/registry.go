@@ -0,0 +1,365 @@
+// Package monitor runs the polling monitors of the streaming pipeline and
+// publishes their output to JetStream.
+//
+// A Chain holds the block, pending transaction, log, gas price and network
+// monitors of one network and hands their payloads to a Publisher; a
+// JetStreamPublisher publishes them with retries and dead-letters the ones
+// that still fail. A Registry schedules named monitors that can be paused,
+// resumed and re-timed at runtime. None of them need the HTTP API, so other
+// services can embed the pipeline or just the publisher. Plugin monitors
+// added with RegisterPlugin run next to the built-in ones.
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is used for monitors run without an interval
+const DefaultInterval = 10 * time.Second
+
+// state is the runtime control and bookkeeping of a single monitor
+type state struct {
+	mu          sync.Mutex
+	name        string
+	run         func(context.Context)
+	interval    time.Duration
+	paused      bool
+	running     bool
+	reset       chan time.Duration
+	trigger     chan struct{}
+	runs        uint64
+	failures    uint64
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+}
+
+// Status is the JSON view of a monitor
+type Status struct {
+	Name        string `json:"name"`
+	Interval    string `json:"interval"`
+	Paused      bool   `json:"paused"`
+	Running     bool   `json:"running"`
+	Runs        uint64 `json:"runs"`
+	Failures    uint64 `json:"failures"`
+	LastRun     int64  `json:"lastRun,omitempty"`
+	LastSuccess int64  `json:"lastSuccess,omitempty"`
+	LastError   string `json:"lastError,omitempty"`
+}
+
+func (m *state) status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := Status{
+		Name:      m.name,
+		Interval:  m.interval.String(),
+		Paused:    m.paused,
+		Running:   m.running,
+		Runs:      m.runs,
+		Failures:  m.failures,
+		LastError: m.lastError,
+	}
+	if !m.lastRun.IsZero() {
+		status.LastRun = m.lastRun.Unix()
+	}
+	if !m.lastSuccess.IsZero() {
+		status.LastSuccess = m.lastSuccess.Unix()
+	}
+	return status
+}
+
+// Registry tracks every monitor so they can be paused, resumed and tuned at
+// runtime. The hooks must be set before StartAll.
+type Registry struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	monitors map[string]*state
+
+	// Skip, when set, is consulted before every tick of the named monitor;
+	// ticks are skipped while it returns true, e.g. while the RPC circuit
+	// breaker is open
+	Skip func(name string) bool
+	// OnError is called when a monitor starts failing, not on every failed tick
+	OnError func(name string, err error)
+	// OnRecover is called when a failing monitor succeeds again
+	OnRecover func(name string)
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{monitors: make(map[string]*state)}
+}
+
+// Register adds a monitor. run is started by StartAll and is expected to call
+// Run with the monitor's tick function.
+func (r *Registry) Register(name string, run func(context.Context)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.monitors[name] = &state{
+		name:    name,
+		run:     run,
+		reset:   make(chan time.Duration, 1),
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+func (r *Registry) get(name string) (*state, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.monitors[name]
+	return m, ok
+}
+
+// Status returns the state of one monitor
+func (r *Registry) Status(name string) (Status, bool) {
+	m, ok := r.get(name)
+	if !ok {
+		return Status{}, false
+	}
+	return m.status(), true
+}
+
+// List returns the status of all monitors sorted by name
+func (r *Registry) List() []Status {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.monitors))
+	for name := range r.monitors {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	statuses := make([]Status, 0, len(names))
+	for _, name := range names {
+		if m, ok := r.get(name); ok {
+			statuses = append(statuses, m.status())
+		}
+	}
+	return statuses
+}
+
+// Configure seeds the interval and paused flag of a monitor before it starts
+func (r *Registry) Configure(name string, interval time.Duration, paused bool) {
+	m, ok := r.get(name)
+	if !ok {
+		return
+	}
+
+	m.mu.Lock()
+	m.interval = interval
+	m.paused = paused
+	m.mu.Unlock()
+}
+
+// StartAll starts every registered monitor that is not paused
+func (r *Registry) StartAll(ctx context.Context) {
+	r.mu.Lock()
+	r.ctx = ctx
+	monitors := make([]*state, 0, len(r.monitors))
+	for _, m := range r.monitors {
+		monitors = append(monitors, m)
+	}
+	r.mu.Unlock()
+
+	for _, m := range monitors {
+		m.mu.Lock()
+		paused := m.paused
+		m.mu.Unlock()
+		if paused {
+			log.Printf("Monitor %s is disabled", m.name)
+			continue
+		}
+		r.start(m)
+	}
+}
+
+// start launches a monitor goroutine unless it is already running
+func (r *Registry) start(m *state) {
+	r.mu.Lock()
+	ctx := r.ctx
+	r.mu.Unlock()
+	if ctx == nil {
+		return
+	}
+
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = true
+	m.mu.Unlock()
+
+	go m.run(ctx)
+}
+
+// Run calls tick on the monitor's interval until ctx is done, honouring
+// runtime pause/resume and interval changes. interval applies when the
+// monitor wasn't configured with one; unregistered monitors are registered.
+func (r *Registry) Run(ctx context.Context, name string, interval time.Duration, tick func() error) {
+	m, ok := r.get(name)
+	if !ok {
+		r.Register(name, nil)
+		m, _ = r.get(name)
+	}
+
+	m.mu.Lock()
+	if m.interval <= 0 {
+		m.interval = interval
+	}
+	if m.interval <= 0 {
+		m.interval = DefaultInterval
+	}
+	interval = m.interval
+	m.running = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.running = false
+		m.mu.Unlock()
+	}()
+
+	log.Printf("Starting %s monitor (every %s)", name, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case interval := <-m.reset:
+			ticker.Reset(interval)
+		case <-ticker.C:
+			r.tick(m, tick)
+		case <-m.trigger:
+			r.tick(m, tick)
+		}
+	}
+}
+
+// tick runs one tick of a monitor unless it is paused or skipped
+func (r *Registry) tick(m *state, tick func() error) {
+	m.mu.Lock()
+	paused := m.paused
+	m.mu.Unlock()
+	if paused {
+		return
+	}
+	if r.Skip != nil && r.Skip(m.name) {
+		return
+	}
+
+	err := tick()
+
+	m.mu.Lock()
+	m.runs++
+	m.lastRun = time.Now()
+	wasFailing := m.lastError != ""
+	if err != nil {
+		m.failures++
+		m.lastError = err.Error()
+	} else {
+		m.lastSuccess = m.lastRun
+		m.lastError = ""
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Error in %s monitor: %v", m.name, err)
+		if !wasFailing && r.OnError != nil {
+			r.OnError(m.name, err)
+		}
+	} else if wasFailing && r.OnRecover != nil {
+		r.OnRecover(m.name)
+	}
+}
+
+// Trigger runs a tick of a monitor as soon as it is idle, in addition to its
+// interval, e.g. when a subscription announces new data. Triggers arriving
+// while a tick is pending are coalesced.
+func (r *Registry) Trigger(name string) {
+	m, ok := r.get(name)
+	if !ok {
+		return
+	}
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Pause stops a monitor from ticking without stopping its goroutine
+func (r *Registry) Pause(name string) error {
+	m, ok := r.get(name)
+	if !ok {
+		return fmt.Errorf("unknown monitor %q", name)
+	}
+
+	m.mu.Lock()
+	m.paused = true
+	m.mu.Unlock()
+
+	log.Printf("Monitor %s paused", name)
+	return nil
+}
+
+// Resume resumes a paused monitor, starting it if it was disabled at startup
+func (r *Registry) Resume(name string) error {
+	m, ok := r.get(name)
+	if !ok {
+		return fmt.Errorf("unknown monitor %q", name)
+	}
+
+	m.mu.Lock()
+	m.paused = false
+	m.mu.Unlock()
+	r.start(m)
+
+	log.Printf("Monitor %s resumed", name)
+	return nil
+}
+
+// SetInterval changes the tick interval of a monitor at runtime
+func (r *Registry) SetInterval(name string, interval time.Duration) error {
+	if interval < 10*time.Millisecond {
+		return fmt.Errorf("interval must be at least 10ms")
+	}
+	m, ok := r.get(name)
+	if !ok {
+		return fmt.Errorf("unknown monitor %q", name)
+	}
+
+	m.mu.Lock()
+	m.interval = interval
+	m.mu.Unlock()
+
+	// Replace any pending reset so the latest interval wins
+	select {
+	case <-m.reset:
+	default:
+	}
+	m.reset <- interval
+
+	log.Printf("Monitor %s interval set to %s", name, interval)
+	return nil
+}
+
+// Paused reports whether a monitor is currently paused
+func (r *Registry) Paused(name string) bool {
+	m, ok := r.get(name)
+	if !ok {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
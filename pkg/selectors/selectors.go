@@ -0,0 +1,172 @@
+// Package selectors maps 4-byte function selectors to their signatures
+package selectors
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// seed holds common signatures from 4byte.directory
+//
+//go:embed seed.txt
+var seed string
+
+// signaturePattern matches a function signature such as transfer(address,uint256)
+var signaturePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*\(.*\)$`)
+
+// Signature is a decoded function signature
+type Signature struct {
+	Selector string   `json:"selector"` // 0x-prefixed, lowercase
+	Text     string   `json:"text"`     // e.g. transfer(address,uint256)
+	Name     string   `json:"name"`     // e.g. transfer
+	Args     []string `json:"args"`     // Argument types, tuples as (address,uint256)
+}
+
+// Selector returns the 4-byte selector of a function signature
+func Selector(text string) string {
+	return hexutil.Encode(crypto.Keccak256([]byte(text))[:4])
+}
+
+// Parse parses a function signature; the selector is computed from it
+func Parse(text string) (Signature, error) {
+	text = strings.ReplaceAll(strings.TrimSpace(text), " ", "")
+	if !signaturePattern.MatchString(text) {
+		return Signature{}, fmt.Errorf("invalid function signature %q", text)
+	}
+	open := strings.IndexByte(text, '(')
+	args, err := splitArgs(text[open+1 : len(text)-1])
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid function signature %q: %v", text, err)
+	}
+	return Signature{Selector: Selector(text), Text: text, Name: text[:open], Args: args}, nil
+}
+
+// splitArgs splits argument types on top-level commas, keeping tuples intact
+func splitArgs(list string) ([]string, error) {
+	args := []string{}
+	if list == "" {
+		return args, nil
+	}
+	depth, start := 0, 0
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+	return append(args, list[start:]), nil
+}
+
+// FromData returns the selector of transaction input data, if it has one
+func FromData(data []byte) (string, bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+	return hexutil.Encode(data[:4]), true
+}
+
+// DB is a selector to signature database, safe for concurrent use
+type DB struct {
+	mu   sync.RWMutex
+	sigs map[string]Signature
+}
+
+// NewDB returns a database seeded with the embedded common signatures
+func NewDB() *DB {
+	db := &DB{sigs: make(map[string]Signature)}
+	if _, err := db.load(seed, false); err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Lookup returns the signature of a 0x-prefixed selector
+func (db *DB) Lookup(selector string) (Signature, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	sig, ok := db.sigs[strings.ToLower(selector)]
+	return sig, ok
+}
+
+// Add stores a signature, keeping an existing one for the same selector
+// unless override is set
+func (db *DB) Add(sig Signature, override bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.sigs[sig.Selector]; ok && !override {
+		return
+	}
+	db.sigs[sig.Selector] = sig
+}
+
+// Len returns the number of known selectors
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.sigs)
+}
+
+// LoadFile loads local overrides, which replace seeded signatures. Every line
+// is a signature, optionally preceded by its selector to name a selector
+// whose signature is unknown; # starts a comment.
+func (db *DB) LoadFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return db.load(string(data), true)
+}
+
+// load parses signature lines
+func (db *DB) load(text string, override bool) (int, error) {
+	count := 0
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(entry, '#'); i >= 0 {
+			entry = strings.TrimSpace(entry[:i])
+		}
+		if entry == "" {
+			continue
+		}
+
+		var selector string
+		if fields := strings.Fields(entry); len(fields) == 2 && strings.HasPrefix(fields[0], "0x") {
+			selector, entry = strings.ToLower(fields[0]), fields[1]
+			if b, err := hexutil.Decode(selector); err != nil || len(b) != 4 {
+				return count, fmt.Errorf("line %d: invalid selector %q", line, fields[0])
+			}
+		}
+		sig, err := Parse(entry)
+		if err != nil {
+			return count, fmt.Errorf("line %d: %v", line, err)
+		}
+		if selector != "" {
+			sig.Selector = selector
+		}
+		db.Add(sig, override)
+		count++
+	}
+	return count, scanner.Err()
+}
@@ -0,0 +1,73 @@
+package streams
+
+import "strings"
+
+// Entry maps a public stream name (as used by /sse/:stream) to its NATS subject
+type Entry struct {
+	Name        string       `json:"name"`
+	Subject     string       `json:"subject"`
+	Description string       `json:"description"`
+	Derived     *DerivedSpec `json:"derived,omitempty"`
+}
+
+// Builtin are the streams published by the monitors
+var Builtin = []Entry{
+	{Name: "blocks", Subject: "eth.blocks.full", Description: "Full block data with transactions"},
+	{Name: "pending", Subject: "eth.pending", Description: "Pending transaction deltas: newly observed and dropped"},
+	{Name: "pending-full", Subject: "eth.pending.snapshot", Description: "Periodic full pending pool snapshot for resync"},
+	{Name: "logs", Subject: "eth.logs", Description: "Recent event logs"},
+	{Name: "network", Subject: "eth.network", Description: "Network statistics"},
+	{Name: "gasPrice", Subject: "eth.gasPrice", Description: "Current gas price"},
+	{Name: "blocks-simple", Subject: "eth.blocks.header", Description: "Alias of blocks-header"},
+	{Name: "blocks-header", Subject: "eth.blocks.header", Description: "Block header only"},
+	{Name: "blocks-hashes", Subject: "eth.blocks.hashes", Description: "Block header plus transaction hashes"},
+	{Name: "uncles", Subject: "eth.blocks.uncles", Description: "Uncle headers and published blocks that were replaced by another canonical block"},
+	{Name: "gas-alerts", Subject: "eth.alerts.gas", Description: "Gas price spike/drop alerts"},
+	{Name: "whales", Subject: "eth.alerts.whale", Description: "High-value transaction alerts"},
+	{Name: "bridge", Subject: "eth.bridge.*", Description: "Deposits and withdrawals of registered bridge contracts"},
+	{Name: "bridge-deposits", Subject: "eth.bridge.deposit", Description: "Assets sent to other networks through registered bridge contracts"},
+	{Name: "bridge-withdrawals", Subject: "eth.bridge.withdrawal", Description: "Assets arriving from other networks through registered bridge contracts"},
+	{Name: "pools", Subject: "eth.defi.pools", Description: "Reserves, liquidity and price of registered liquidity pools"},
+	{Name: "tvl", Subject: "eth.defi.tvl", Description: "Total value locked across registered liquidity pools"},
+	{Name: "balances", Subject: "eth.balances", Description: "Native balance changes of watchlisted addresses"},
+	{Name: "stuck-txs", Subject: "eth.alerts.stuck-tx", Description: "Nonce gaps and stuck transactions of watchlisted addresses"},
+	{Name: "consensus", Subject: "eth.consensus", Description: "Block proposers, validator participation and missed slots, when CONSENSUS_STATS is set"},
+	{Name: "blobs", Subject: "eth.blobs", Description: "Blob gas usage, blob base fee and blob transactions of EIP-4844 blocks"},
+	{Name: "internal-txs", Subject: "eth.tx.internal", Description: "Contract-to-contract calls and value transfers, when INTERNAL_TXS is set"},
+	{Name: "traces", Subject: "eth.traces", Description: "debug_traceBlockByNumber traces of every block, when BLOCK_TRACER is set"},
+	{Name: "state", Subject: StateSubjectPrefix + ">", Description: "Results of every registered state read (state.<name> streams one) and state diffs"},
+	{Name: "state-diffs", Subject: StateDiffsSubject, Description: "Net account and storage changes of every block, when STATE_DIFFS is set"},
+	{Name: "consistency-alerts", Subject: ConsistencySubject, Description: "Block hash mismatches between the RPC endpoint and a second provider"},
+	{Name: "failed", Subject: "eth.tx.failed", Description: "Reverted transactions with revert reasons"},
+	{Name: "lifecycle", Subject: "eth.tx.lifecycle", Description: "Transaction seen/mined/finalized/dropped events"},
+	{Name: "fees", Subject: "eth.fees.suggestions", Description: "Slow/standard/fast EIP-1559 fee suggestions"},
+	{Name: "basefee", Subject: "eth.fees.basefee", Description: "Per-block base fee and effective priority fee stats"},
+	{Name: "throughput", Subject: "eth.stats.throughput", Description: "Rolling TPS, block interval and gas utilization"},
+	{Name: "rollups-1m", Subject: "eth.rollups.1m", Description: "Per-minute block/tx/gas/sender aggregates (long retention)"},
+	{Name: "rollups-1h", Subject: "eth.rollups.1h", Description: "Per-hour block/tx/gas/sender aggregates (long retention)"},
+	{Name: "system", Subject: SystemSubject, Description: "SomniaStream operational events: monitor errors, NATS reconnects, dropped clients"},
+	{Name: "rpc-metrics", Subject: RPCMetricsSubject, Description: "Per-method RPC latency and error rates"},
+	{Name: "rpc-headlag", Subject: HeadLagSubject, Description: "Head block and lag of the active RPC endpoint and its peers"},
+}
+
+// Aliases are alternative names accepted by /sse/:stream
+var Aliases = map[string]string{
+	"gas": "gasPrice",
+}
+
+// LookupBuiltin returns the subject of a built-in stream name or alias, or of
+// a single state read named state.<name>
+func LookupBuiltin(name string) (string, bool) {
+	if alias, ok := Aliases[name]; ok {
+		name = alias
+	}
+	if read, ok := strings.CutPrefix(name, "state."); ok && NamePattern.MatchString(read) {
+		return StateSubjectPrefix + read, true
+	}
+	for _, entry := range Builtin {
+		if entry.Name == name {
+			return entry.Subject, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,58 @@
+package streams
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Additional networks publish the chain data subjects under their name, e.g.
+// testnet.eth.blocks.full, and are stored in CHAIN_<NAME>
+const ChainStreamPrefix = "CHAIN_"
+
+// ChainNamePattern restricts network names, which are used in subjects,
+// stream names and URL paths
+var ChainNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// ChainBuiltin are the built-in streams published for additional networks
+var ChainBuiltin = []string{"blocks", "blocks-header", "blocks-simple", "blocks-hashes", "network", "gasPrice"}
+
+// ChainSubject returns the subject a network publishes a chain data subject on
+func ChainSubject(chain, subject string) string {
+	return chain + "." + subject
+}
+
+// LookupChain returns the subject of a built-in stream of an additional network
+func LookupChain(chain, name string) (string, bool) {
+	if alias, ok := Aliases[name]; ok {
+		name = alias
+	}
+	for _, builtin := range ChainBuiltin {
+		if builtin == name {
+			subject, _ := LookupBuiltin(name)
+			return ChainSubject(chain, subject), true
+		}
+	}
+	return "", false
+}
+
+// ValidateChainName rejects names that are invalid or would collide with
+// SomniaStream's own subjects
+func ValidateChainName(name string) error {
+	if !ChainNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid chain name %q, expected lowercase letters, digits and dashes", name)
+	}
+	switch name {
+	case "eth", "somnia", strings.TrimSuffix(DerivedSubjectPrefix, "."):
+		return fmt.Errorf("chain name %q is reserved", name)
+	}
+	return nil
+}
+
+// ChainSpec describes the JetStream stream of an additional network
+func ChainSpec(chain string) Spec {
+	return Spec{
+		Name:     ChainStreamPrefix + strings.ToUpper(strings.ReplaceAll(chain, "-", "_")),
+		Subjects: []string{ChainSubject(chain, "eth.>")},
+	}
+}
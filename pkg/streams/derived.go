@@ -0,0 +1,207 @@
+package streams
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Derived streams are published on derived.<name> and stored in DERIVED_<name>
+const (
+	DerivedSubjectPrefix = "derived."
+	DerivedStreamPrefix  = "DERIVED_"
+	DefinitionsBucket    = "STREAM_DEFINITIONS"
+)
+
+// NamePattern restricts the names of derived streams
+var NamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Filter is a single condition on a JSON field of a source message, e.g.
+// {"field": "to", "op": "eq", "value": "0xabc..."}
+type Filter struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// DerivedSpec declares a stream derived from existing streams at runtime
+type DerivedSpec struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Sources     []string `json:"sources"`             // Stream names or NATS subjects
+	Each        string   `json:"each,omitempty"`      // Array field to fan out, e.g. "transactions"
+	Filters     []Filter `json:"filters,omitempty"`   // All filters must match
+	Transform   string   `json:"transform,omitempty"` // Expression applied to every matching payload, see Transform
+	MaxAge      string   `json:"maxAge,omitempty"`
+	MaxMsgs     int64    `json:"maxMsgs,omitempty"`
+	Storage     string   `json:"storage,omitempty"` // "memory" (default) or "file"
+	CreatedAt   int64    `json:"createdAt"`
+}
+
+// Validate checks the name, sources, filters and storage settings of a spec
+func (s *DerivedSpec) Validate() error {
+	if !NamePattern.MatchString(s.Name) {
+		return errors.New("name must be 1-64 letters, digits, '-' or '_'")
+	}
+	if len(s.Sources) == 0 {
+		return errors.New("at least one source is required")
+	}
+
+	if err := ValidateFilters(s.Filters); err != nil {
+		return err
+	}
+	if _, err := CompileTransform(s.Transform); err != nil {
+		return err
+	}
+
+	if s.MaxAge != "" {
+		if _, err := time.ParseDuration(s.MaxAge); err != nil {
+			return fmt.Errorf("invalid maxAge: %v", err)
+		}
+	}
+	switch s.Storage {
+	case "", "memory", "file":
+	default:
+		return errors.New("storage must be memory or file")
+	}
+	return nil
+}
+
+// ValidateFilters checks that every filter names a field and a supported op
+func ValidateFilters(filters []Filter) error {
+	for _, filter := range filters {
+		if filter.Field == "" {
+			return errors.New("filter field is required")
+		}
+		switch filter.Op {
+		case "eq", "ne", "gt", "gte", "lt", "lte", "contains", "in", "exists":
+		default:
+			return fmt.Errorf("unsupported filter op %q", filter.Op)
+		}
+	}
+	return nil
+}
+
+// StreamConfig returns the JetStream stream storing the derived stream in a namespace
+func (s *DerivedSpec) StreamConfig(ns Namespace) *nats.StreamConfig {
+	streamConfig := &nats.StreamConfig{
+		Name:      ns.Stream(DerivedStreamPrefix + s.Name),
+		Subjects:  []string{ns.Subject(DerivedSubjectPrefix + s.Name)},
+		Storage:   nats.MemoryStorage,
+		Retention: nats.LimitsPolicy,
+		MaxAge:    time.Hour * 24,
+		MaxMsgs:   10000,
+	}
+	if s.Storage == "file" {
+		streamConfig.Storage = nats.FileStorage
+	}
+	if s.MaxAge != "" {
+		streamConfig.MaxAge, _ = time.ParseDuration(s.MaxAge)
+	}
+	if s.MaxMsgs != 0 {
+		streamConfig.MaxMsgs = s.MaxMsgs
+	}
+	return streamConfig
+}
+
+// LookupField resolves a dotted path such as "receipt.status" inside a decoded JSON value
+func LookupField(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[key]
+	}
+	return value
+}
+
+// MatchFilters reports whether a decoded JSON value satisfies every filter
+func MatchFilters(value interface{}, filters []Filter) bool {
+	for _, filter := range filters {
+		if !matchFilter(LookupField(value, filter.Field), filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchFilter(actual interface{}, filter Filter) bool {
+	switch filter.Op {
+	case "exists":
+		return actual != nil
+	case "eq":
+		return valuesEqual(actual, filter.Value)
+	case "ne":
+		return !valuesEqual(actual, filter.Value)
+	case "in":
+		options, _ := filter.Value.([]interface{})
+		for _, option := range options {
+			if valuesEqual(actual, option) {
+				return true
+			}
+		}
+		return false
+	case "contains":
+		return strings.Contains(strings.ToLower(fmt.Sprint(actual)), strings.ToLower(fmt.Sprint(filter.Value)))
+	}
+
+	a, okA := numericValue(actual)
+	b, okB := numericValue(filter.Value)
+	if !okA || !okB {
+		return false
+	}
+	cmp := a.Cmp(b)
+	switch filter.Op {
+	case "gt":
+		return cmp > 0
+	case "gte":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Compare numerically when both sides are numbers (including hex and decimal
+// strings), otherwise compare as case-insensitive strings so addresses match
+func valuesEqual(actual, expected interface{}) bool {
+	if actual == nil || expected == nil {
+		return actual == expected
+	}
+	if a, ok := numericValue(actual); ok {
+		if b, ok := numericValue(expected); ok {
+			return a.Cmp(b) == 0
+		}
+	}
+	return strings.EqualFold(fmt.Sprint(actual), fmt.Sprint(expected))
+}
+
+// Parse JSON numbers, decimal strings and 0x-prefixed hex strings
+func numericValue(value interface{}) (*big.Float, bool) {
+	switch v := value.(type) {
+	case float64:
+		return big.NewFloat(v), true
+	case string:
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			if len(v) > 66 {
+				return nil, false // Longer than a word, e.g. calldata
+			}
+			n, ok := new(big.Int).SetString(v[2:], 16)
+			if !ok {
+				return nil, false
+			}
+			return new(big.Float).SetInt(n), true
+		}
+		f, ok := new(big.Float).SetString(v)
+		return f, ok
+	}
+	return nil, false
+}
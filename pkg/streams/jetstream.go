@@ -0,0 +1,158 @@
+package streams
+
+import (
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Spec describes a built-in JetStream stream. Streams are kept in memory for
+// 24h and 10k messages unless overridden.
+type Spec struct {
+	Name     string
+	Subjects []string
+	OnDisk   bool
+	MaxAge   time.Duration
+	MaxMsgs  int64
+}
+
+// Specs lists the built-in JetStream streams; rollups are kept for rollupRetention
+func Specs(rollupRetention time.Duration) []Spec {
+	return []Spec{
+		{
+			Name:     "ETH_BLOCKS",
+			Subjects: []string{"eth.blocks.full", "eth.blocks.hashes", "eth.blocks.header", "eth.blocks", "eth.blocks.uncles"},
+		},
+		{
+			Name:     "ETH_TRANSACTIONS",
+			Subjects: []string{"eth.pending", "eth.pending.snapshot", "eth.tx.failed", "eth.tx.lifecycle", "eth.tx.internal"},
+		},
+		{
+			Name:     "ETH_LOGS",
+			Subjects: []string{"eth.logs"},
+		},
+		{
+			Name:     "ETH_NETWORK",
+			Subjects: []string{"eth.network", "eth.gasPrice"},
+		},
+		{
+			Name:     "ETH_FEES",
+			Subjects: []string{"eth.fees.suggestions", "eth.fees.basefee"},
+		},
+		{
+			Name:     "ETH_STATS",
+			Subjects: []string{"eth.stats.throughput"},
+		},
+		{
+			Name:     "ETH_ROLLUPS",
+			Subjects: []string{"eth.rollups.1m", "eth.rollups.1h"},
+			OnDisk:   true,
+			MaxAge:   rollupRetention,
+			MaxMsgs:  -1,
+		},
+		{
+			Name:     "ETH_ALERTS",
+			Subjects: []string{"eth.alerts.gas", "eth.alerts.whale", "eth.alerts.stuck-tx", ConsistencySubject},
+		},
+		{
+			Name:     "ETH_BRIDGE",
+			Subjects: []string{"eth.bridge.deposit", "eth.bridge.withdrawal"},
+		},
+		{
+			Name:     "ETH_DEFI",
+			Subjects: []string{"eth.defi.pools", "eth.defi.tvl"},
+		},
+		{
+			Name:     "ETH_BALANCES",
+			Subjects: []string{"eth.balances"},
+		},
+		{
+			Name:     "ETH_CONSENSUS",
+			Subjects: []string{"eth.consensus"},
+		},
+		{
+			Name:     "ETH_BLOBS",
+			Subjects: []string{"eth.blobs"},
+		},
+		{
+			Name:     "ETH_TRACES",
+			Subjects: []string{"eth.traces"},
+			MaxAge:   time.Hour, // Traces are large; keep an hour for consumers to catch up
+		},
+		{
+			Name:     "ETH_STATE",
+			Subjects: []string{StateSubjectPrefix + ">"},
+		},
+		{
+			Name:     "SOMNIA_SYSTEM",
+			Subjects: []string{SystemSubject},
+		},
+		{
+			Name:     "SOMNIA_RPC_METRICS",
+			Subjects: []string{RPCMetricsSubject, HeadLagSubject},
+		},
+		{
+			Name:     DLQStream,
+			Subjects: []string{DLQSubject},
+			OnDisk:   true,
+			MaxAge:   7 * 24 * time.Hour,
+			MaxMsgs:  -1,
+		},
+		{
+			Name:     "SOMNIA_USAGE",
+			Subjects: []string{UsageSubject},
+			OnDisk:   true,
+			MaxAge:   30 * 24 * time.Hour,
+			MaxMsgs:  -1,
+		},
+	}
+}
+
+// Setup creates the given JetStream streams, updating existing ones so newly
+// added subjects are picked up
+func Setup(js nats.JetStreamContext, specs []Spec) error {
+	log.Println("Setting up JetStream streams...")
+
+	for _, stream := range specs {
+		streamConfig := &nats.StreamConfig{
+			Name:      stream.Name,
+			Subjects:  stream.Subjects,
+			Storage:   nats.MemoryStorage,
+			Retention: nats.LimitsPolicy,
+			MaxAge:    time.Hour * 24, // Keep data for 24 hours
+			MaxMsgs:   10000,          // Keep up to 10k messages
+		}
+		if stream.OnDisk {
+			streamConfig.Storage = nats.FileStorage
+		}
+		if stream.MaxAge != 0 {
+			streamConfig.MaxAge = stream.MaxAge
+		}
+		if stream.MaxMsgs != 0 {
+			streamConfig.MaxMsgs = stream.MaxMsgs
+		}
+
+		// Try to get existing stream info first
+		_, err := js.StreamInfo(stream.Name)
+		if err != nil {
+			// Stream doesn't exist, create it
+			_, err = js.AddStream(streamConfig)
+			if err != nil {
+				log.Printf("Failed to create stream %s: %v", stream.Name, err)
+				return err
+			}
+			log.Printf("Created JetStream stream: %s", stream.Name)
+		} else {
+			// Stream exists, update it so newly added subjects are picked up
+			if _, err = js.UpdateStream(streamConfig); err != nil {
+				log.Printf("Failed to update stream %s: %v", stream.Name, err)
+				return err
+			}
+			log.Printf("JetStream stream already exists: %s", stream.Name)
+		}
+	}
+
+	log.Println("✅ JetStream streams setup complete")
+	return nil
+}
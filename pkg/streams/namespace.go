@@ -0,0 +1,66 @@
+package streams
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Namespace prefixes every subject, JetStream stream and key-value bucket of a
+// deployment, e.g. somnia.50312, so deployments for several networks can share
+// a NATS cluster. The empty namespace leaves names unchanged.
+type Namespace string
+
+// NewNamespace returns the namespace <prefix>.<chainID>, or the empty
+// namespace when prefix is empty
+func NewNamespace(prefix string, chainID *big.Int) (Namespace, error) {
+	if prefix == "" {
+		return "", nil
+	}
+	if !NamePattern.MatchString(prefix) {
+		return "", fmt.Errorf("invalid subject namespace %q, expected letters, digits, dashes and underscores", prefix)
+	}
+	return Namespace(prefix + "." + chainID.String()), nil
+}
+
+// Subject returns the namespaced form of a subject
+func (ns Namespace) Subject(subject string) string {
+	if ns == "" {
+		return subject
+	}
+	return string(ns) + "." + subject
+}
+
+// TrimSubject returns a namespaced subject without the namespace
+func (ns Namespace) TrimSubject(subject string) string {
+	if ns == "" {
+		return subject
+	}
+	return strings.TrimPrefix(subject, string(ns)+".")
+}
+
+// Stream returns the namespaced name of a JetStream stream or key-value
+// bucket, e.g. SOMNIA_50312_ETH_BLOCKS
+func (ns Namespace) Stream(name string) string {
+	if ns == "" {
+		return name
+	}
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(string(ns))) + "_" + name
+}
+
+// Specs returns the namespaced form of stream specs
+func (ns Namespace) Specs(specs []Spec) []Spec {
+	if ns == "" {
+		return specs
+	}
+	namespaced := make([]Spec, len(specs))
+	for i, spec := range specs {
+		spec.Name = ns.Stream(spec.Name)
+		spec.Subjects = make([]string, len(specs[i].Subjects))
+		for j, subject := range specs[i].Subjects {
+			spec.Subjects[j] = ns.Subject(subject)
+		}
+		namespaced[i] = spec
+	}
+	return namespaced
+}
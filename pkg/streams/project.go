@@ -0,0 +1,78 @@
+package streams
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ParseFields splits a comma separated field list such as
+// "number,hash,transactions.hash", dropping empty entries
+func ParseFields(list string) []string {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Project keeps only the listed dotted field paths of a decoded JSON value.
+// Arrays are projected element by element, so "transactions.hash" keeps the
+// hash of every transaction; fields missing from the value are left out.
+func Project(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		projected := make([]interface{}, len(v))
+		for i, item := range v {
+			projected[i] = Project(item, fields)
+		}
+		return projected
+	case map[string]interface{}:
+		projected := make(map[string]interface{})
+		nested := make(map[string][]string)
+		for _, field := range fields {
+			key, rest, ok := strings.Cut(field, ".")
+			if _, exists := v[key]; !exists {
+				continue
+			}
+			if !ok {
+				projected[key] = v[key]
+			} else {
+				nested[key] = append(nested[key], rest)
+			}
+		}
+		for key, rest := range nested {
+			if _, whole := projected[key]; whole {
+				continue // The whole field was requested too
+			}
+			switch v[key].(type) {
+			case map[string]interface{}, []interface{}:
+				projected[key] = Project(v[key], rest)
+			}
+		}
+		return projected
+	}
+	return value
+}
+
+// ProjectJSON applies Project to a JSON message, returning it unchanged when
+// there are no fields or it isn't JSON
+func ProjectJSON(data []byte, fields []string) []byte {
+	if len(fields) == 0 {
+		return data
+	}
+	// Numbers are kept as written so large integers survive the round trip
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return data
+	}
+	projected, err := json.Marshal(Project(value, fields))
+	if err != nil {
+		return data
+	}
+	return projected
+}
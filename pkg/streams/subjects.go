@@ -0,0 +1,26 @@
+// Package streams describes the NATS subjects and JetStream streams
+// SomniaStream publishes, the public stream names mapped onto them, and the
+// filters used by derived streams.
+package streams
+
+// SomniaStream's own subjects, next to the eth.* chain data subjects
+const (
+	SystemSubject       = "somnia.system"          // Operational events
+	UsageSubject        = "somnia.usage"           // Per-API-key usage
+	RPCMetricsSubject   = "somnia.rpc.metrics"     // Per-method RPC latency and error rates
+	HeadLagSubject      = "somnia.rpc.headlag"     // Head block of every configured RPC endpoint
+	ConsistencySubject  = "eth.alerts.consistency" // Block hash mismatches between RPC providers
+	SlowConsumerSubject = "somnia.clients.slow"    // Clients falling behind (core NATS only)
+	DLQSubject          = "somnia.dlq"             // Payloads that could not be published
+)
+
+// StateSubjectPrefix prefixes the subjects of registered state reads,
+// published on eth.state.<name> and streamed as state.<name>
+const StateSubjectPrefix = "eth.state."
+
+// StateDiffsSubject carries per-block state changes; its name is reserved
+// among state reads
+const StateDiffsSubject = StateSubjectPrefix + "diffs"
+
+// DLQStream is the JetStream stream storing DLQSubject
+const DLQStream = "SOMNIA_DLQ"
@@ -0,0 +1,777 @@
+package streams
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Transform is a compiled JMESPath-style expression that reshapes a message
+// before delivery, e.g. "transactions[].hash" or
+// "{number: number, hashes: transactions[].hash}". It supports field access,
+// indexes, slices, list, object and flatten projections, filters such as
+// "logs[?address == '0x...']", multi-selects, pipes, literals and the
+// ==, !=, <, <=, >, >=, &&, || and ! operators; functions are not supported.
+type Transform struct {
+	expr string
+	root node
+}
+
+// CompileTransform parses an expression. An empty expression compiles to a
+// nil transform, which leaves messages unchanged.
+func CompileTransform(expr string) (*Transform, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := lexTransform(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform: %v", err)
+	}
+	p := &transformParser{tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform: %v", err)
+	}
+	return &Transform{expr: expr, root: root}, nil
+}
+
+// String returns the expression the transform was compiled from
+func (t *Transform) String() string {
+	return t.expr
+}
+
+// Apply evaluates the transform against a decoded JSON value
+func (t *Transform) Apply(value interface{}) interface{} {
+	return t.root.eval(value)
+}
+
+// ApplyJSON transforms a JSON message. It reports false when the message
+// isn't JSON or the expression yields null, so the message can be skipped.
+// A nil transform returns the message unchanged.
+func (t *Transform) ApplyJSON(data []byte) ([]byte, bool) {
+	if t == nil {
+		return data, true
+	}
+	value, err := decodeNumbers(data)
+	if err != nil {
+		return nil, false
+	}
+	result := t.Apply(value)
+	if result == nil {
+		return nil, false
+	}
+	transformed, err := json.Marshal(result)
+	if err != nil {
+		return nil, false
+	}
+	return transformed, true
+}
+
+// decodeNumbers decodes JSON keeping numbers as written, so large integers
+// survive the round trip
+func decodeNumbers(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Tokens
+
+type transformToken struct {
+	kind  string // One of the token kinds below, or the operator itself
+	value interface{}
+	pos   int
+}
+
+const (
+	tokEOF        = "eof"
+	tokIdentifier = "identifier"
+	tokLiteral    = "literal"
+	tokNumber     = "number"
+)
+
+// bindingPower orders the operators of the grammar; tokens missing from it
+// bind with 0
+var bindingPower = map[string]int{
+	"|": 1, "||": 2, "&&": 3,
+	"==": 5, "!=": 5, "<": 5, "<=": 5, ">": 5, ">=": 5,
+	"[]": 9, "*": 20, "[?": 21, ".": 40, "!": 45, "{": 50, "[": 55, "(": 60,
+}
+
+func lexTransform(expr string) ([]transformToken, error) {
+	var tokens []transformToken
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		start := i
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+			continue
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			for i < len(expr) && (expr[i] == '_' || expr[i] >= 'a' && expr[i] <= 'z' || expr[i] >= 'A' && expr[i] <= 'Z' || expr[i] >= '0' && expr[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, transformToken{kind: tokIdentifier, value: expr[start:i], pos: start})
+			continue
+		case ch == '-' || ch >= '0' && ch <= '9':
+			i++
+			for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
+				i++
+			}
+			n, err := strconv.Atoi(expr[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at %d", start)
+			}
+			tokens = append(tokens, transformToken{kind: tokNumber, value: n, pos: start})
+			continue
+		case ch == '"':
+			end, err := closingQuote(expr, i, '"')
+			if err != nil {
+				return nil, err
+			}
+			var name string
+			if err := json.Unmarshal([]byte(expr[i:end+1]), &name); err != nil {
+				return nil, fmt.Errorf("invalid quoted identifier at %d", start)
+			}
+			tokens = append(tokens, transformToken{kind: tokIdentifier, value: name, pos: start})
+			i = end + 1
+			continue
+		case ch == '\'':
+			end, err := closingQuote(expr, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			raw := strings.ReplaceAll(expr[i+1:end], `\'`, `'`)
+			tokens = append(tokens, transformToken{kind: tokLiteral, value: raw, pos: start})
+			i = end + 1
+			continue
+		case ch == '`':
+			end, err := closingQuote(expr, i, '`')
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeNumbers([]byte(strings.ReplaceAll(expr[i+1:end], "\\`", "`")))
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON literal at %d", start)
+			}
+			tokens = append(tokens, transformToken{kind: tokLiteral, value: value, pos: start})
+			i = end + 1
+			continue
+		}
+
+		op := ""
+		for _, candidate := range []string{"[]", "[?", "||", "&&", "==", "!=", "<=", ">=", ".", "*", "[", "]", "{", "}", "(", ")", ",", ":", "|", "<", ">", "!", "@"} {
+			if strings.HasPrefix(expr[i:], candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("unexpected %q at %d", ch, i)
+		}
+		tokens = append(tokens, transformToken{kind: op, pos: i})
+		i += len(op)
+	}
+	return append(tokens, transformToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+// closingQuote finds the quote closing the one at start, skipping escapes
+func closingQuote(expr string, start int, quote byte) (int, error) {
+	for i := start + 1; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			i++
+		case quote:
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated %c at %d", quote, start)
+}
+
+// Parser: a Pratt parser following the JMESPath grammar
+
+type transformParser struct {
+	tokens []transformToken
+	pos    int
+}
+
+func (p *transformParser) parse() (node, error) {
+	root, err := p.expression(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+	return root, nil
+}
+
+func (p *transformParser) peek() transformToken {
+	return p.tokens[p.pos]
+}
+
+func (p *transformParser) lookahead(n int) transformToken {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *transformParser) next() transformToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *transformParser) expect(kind string) error {
+	if tok := p.next(); tok.kind != kind {
+		return p.unexpected(tok)
+	}
+	return nil
+}
+
+func (p *transformParser) unexpected(tok transformToken) error {
+	if tok.kind == tokEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %s at %d", tok.kind, tok.pos)
+}
+
+func (p *transformParser) expression(bp int) (node, error) {
+	left, err := p.nud(p.next())
+	if err != nil {
+		return nil, err
+	}
+	for bp < bindingPower[p.peek().kind] {
+		if left, err = p.led(p.next(), left); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *transformParser) nud(tok transformToken) (node, error) {
+	switch tok.kind {
+	case tokIdentifier:
+		return fieldNode{name: tok.value.(string)}, nil
+	case tokLiteral:
+		return literalNode{value: tok.value}, nil
+	case "@":
+		return identityNode{}, nil
+	case "*":
+		right, err := p.projectionRHS(bindingPower["*"])
+		return valueProjectNode{left: identityNode{}, right: right}, err
+	case "[]":
+		right, err := p.projectionRHS(bindingPower["[]"])
+		return projectNode{left: flattenNode{left: identityNode{}}, right: right}, err
+	case "[?":
+		return p.filter(identityNode{})
+	case "!":
+		operand, err := p.expression(bindingPower["!"])
+		return notNode{operand: operand}, err
+	case "(":
+		inner, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case "{":
+		return p.multiHash()
+	case "[":
+		switch next := p.peek().kind; {
+		case next == tokNumber || next == ":":
+			return p.indexOrSlice(identityNode{})
+		case next == "*" && p.lookahead(1).kind == "]":
+			p.next()
+			p.next()
+			right, err := p.projectionRHS(bindingPower["*"])
+			return projectNode{left: identityNode{}, right: right}, err
+		}
+		return p.multiList()
+	}
+	return nil, p.unexpected(tok)
+}
+
+func (p *transformParser) led(tok transformToken, left node) (node, error) {
+	switch tok.kind {
+	case ".":
+		if p.peek().kind == "*" {
+			p.next()
+			right, err := p.projectionRHS(bindingPower["."])
+			return valueProjectNode{left: left, right: right}, err
+		}
+		right, err := p.dotRHS(bindingPower["."])
+		return subNode{left: left, right: right}, err
+	case "|":
+		right, err := p.expression(bindingPower["|"])
+		return pipeNode{left: left, right: right}, err
+	case "||", "&&":
+		right, err := p.expression(bindingPower[tok.kind])
+		return logicNode{op: tok.kind, left: left, right: right}, err
+	case "==", "!=", "<", "<=", ">", ">=":
+		right, err := p.expression(bindingPower[tok.kind])
+		return compareNode{op: tok.kind, left: left, right: right}, err
+	case "[]":
+		right, err := p.projectionRHS(bindingPower["[]"])
+		return projectNode{left: flattenNode{left: left}, right: right}, err
+	case "[?":
+		return p.filter(left)
+	case "[":
+		if next := p.peek().kind; next == tokNumber || next == ":" {
+			return p.indexOrSlice(left)
+		}
+		if err := p.expect("*"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		right, err := p.projectionRHS(bindingPower["*"])
+		return projectNode{left: left, right: right}, err
+	}
+	return nil, p.unexpected(tok)
+}
+
+// projectionRHS parses what a projection applies to each element
+func (p *transformParser) projectionRHS(bp int) (node, error) {
+	switch tok := p.peek(); {
+	case bindingPower[tok.kind] < 10:
+		return identityNode{}, nil
+	case tok.kind == "[" || tok.kind == "[?":
+		return p.expression(bp)
+	case tok.kind == ".":
+		p.next()
+		return p.dotRHS(bp)
+	default:
+		return nil, p.unexpected(tok)
+	}
+}
+
+// dotRHS parses the right side of a dot
+func (p *transformParser) dotRHS(bp int) (node, error) {
+	switch tok := p.peek(); tok.kind {
+	case tokIdentifier, "*":
+		return p.expression(bp)
+	case "[":
+		p.next()
+		return p.multiList()
+	case "{":
+		p.next()
+		return p.multiHash()
+	default:
+		return nil, p.unexpected(tok)
+	}
+}
+
+// filter parses the rest of a [? condition ] projection
+func (p *transformParser) filter(left node) (node, error) {
+	condition, err := p.expression(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	var right node = identityNode{}
+	if p.peek().kind != "[]" {
+		if right, err = p.projectionRHS(bindingPower["[?"]); err != nil {
+			return nil, err
+		}
+	}
+	return filterNode{left: left, condition: condition, right: right}, nil
+}
+
+// indexOrSlice parses [n] or [start:stop:step] after the opening bracket
+func (p *transformParser) indexOrSlice(left node) (node, error) {
+	var parts [3]*int
+	part, colons := 0, 0
+	for {
+		switch tok := p.next(); tok.kind {
+		case tokNumber:
+			n := tok.value.(int)
+			parts[part] = &n
+		case ":":
+			if colons++; colons > 2 {
+				return nil, p.unexpected(tok)
+			}
+			part++
+		case "]":
+			if colons == 0 {
+				if parts[0] == nil {
+					return nil, p.unexpected(tok)
+				}
+				return subNode{left: left, right: indexNode{index: *parts[0]}}, nil
+			}
+			if parts[2] != nil && *parts[2] == 0 {
+				return nil, fmt.Errorf("slice step can't be 0")
+			}
+			right, err := p.projectionRHS(bindingPower["*"])
+			return projectNode{left: subNode{left: left, right: sliceNode{start: parts[0], stop: parts[1], step: parts[2]}}, right: right}, err
+		default:
+			return nil, p.unexpected(tok)
+		}
+	}
+}
+
+// multiList parses [a, b, ...] after the opening bracket
+func (p *transformParser) multiList() (node, error) {
+	var items []node
+	for {
+		item, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		switch tok := p.next(); tok.kind {
+		case ",":
+		case "]":
+			return multiListNode{items: items}, nil
+		default:
+			return nil, p.unexpected(tok)
+		}
+	}
+}
+
+// multiHash parses {key: expr, ...} after the opening brace
+func (p *transformParser) multiHash() (node, error) {
+	var keys []string
+	var values []node
+	for {
+		tok := p.next()
+		if tok.kind != tokIdentifier {
+			return nil, p.unexpected(tok)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		keys, values = append(keys, tok.value.(string)), append(values, value)
+		switch tok := p.next(); tok.kind {
+		case ",":
+		case "}":
+			return multiHashNode{keys: keys, values: values}, nil
+		default:
+			return nil, p.unexpected(tok)
+		}
+	}
+}
+
+// Evaluation
+
+type node interface {
+	eval(value interface{}) interface{}
+}
+
+type identityNode struct{}
+
+func (identityNode) eval(value interface{}) interface{} { return value }
+
+type literalNode struct{ value interface{} }
+
+func (n literalNode) eval(interface{}) interface{} { return n.value }
+
+type fieldNode struct{ name string }
+
+func (n fieldNode) eval(value interface{}) interface{} {
+	obj, _ := value.(map[string]interface{})
+	return obj[n.name]
+}
+
+type subNode struct{ left, right node }
+
+func (n subNode) eval(value interface{}) interface{} {
+	if value = n.left.eval(value); value == nil {
+		return nil
+	}
+	return n.right.eval(value)
+}
+
+type pipeNode struct{ left, right node }
+
+func (n pipeNode) eval(value interface{}) interface{} {
+	return n.right.eval(n.left.eval(value))
+}
+
+type indexNode struct{ index int }
+
+func (n indexNode) eval(value interface{}) interface{} {
+	list, _ := value.([]interface{})
+	i := n.index
+	if i < 0 {
+		i += len(list)
+	}
+	if i < 0 || i >= len(list) {
+		return nil
+	}
+	return list[i]
+}
+
+type sliceNode struct{ start, stop, step *int }
+
+func (n sliceNode) eval(value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	step := 1
+	if n.step != nil {
+		step = *n.step
+	}
+	// Bounds are clamped like Python slices
+	bound := func(i *int, fallback int) int {
+		if i == nil {
+			return fallback
+		}
+		v := *i
+		if v < 0 {
+			if v += len(list); v < 0 {
+				v = 0
+				if step < 0 {
+					v = -1
+				}
+			}
+		} else if v >= len(list) {
+			v = len(list)
+			if step < 0 {
+				v = len(list) - 1
+			}
+		}
+		return v
+	}
+	sliced := []interface{}{}
+	if step > 0 {
+		for i := bound(n.start, 0); i < bound(n.stop, len(list)); i += step {
+			sliced = append(sliced, list[i])
+		}
+	} else {
+		for i := bound(n.start, len(list)-1); i > bound(n.stop, -1); i += step {
+			sliced = append(sliced, list[i])
+		}
+	}
+	return sliced
+}
+
+type flattenNode struct{ left node }
+
+func (n flattenNode) eval(value interface{}) interface{} {
+	list, ok := n.left.eval(value).([]interface{})
+	if !ok {
+		return nil
+	}
+	flat := []interface{}{}
+	for _, item := range list {
+		if inner, ok := item.([]interface{}); ok {
+			flat = append(flat, inner...)
+		} else {
+			flat = append(flat, item)
+		}
+	}
+	return flat
+}
+
+// project applies right to every element, dropping null results
+func project(list []interface{}, right node) []interface{} {
+	projected := []interface{}{}
+	for _, item := range list {
+		if result := right.eval(item); result != nil {
+			projected = append(projected, result)
+		}
+	}
+	return projected
+}
+
+type projectNode struct{ left, right node }
+
+func (n projectNode) eval(value interface{}) interface{} {
+	list, ok := n.left.eval(value).([]interface{})
+	if !ok {
+		return nil
+	}
+	return project(list, n.right)
+}
+
+type valueProjectNode struct{ left, right node }
+
+func (n valueProjectNode) eval(value interface{}) interface{} {
+	obj, ok := n.left.eval(value).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = obj[key]
+	}
+	return project(values, n.right)
+}
+
+type filterNode struct{ left, condition, right node }
+
+func (n filterNode) eval(value interface{}) interface{} {
+	list, ok := n.left.eval(value).([]interface{})
+	if !ok {
+		return nil
+	}
+	var kept []interface{}
+	for _, item := range list {
+		if truthy(n.condition.eval(item)) {
+			kept = append(kept, item)
+		}
+	}
+	return project(kept, n.right)
+}
+
+type multiListNode struct{ items []node }
+
+func (n multiListNode) eval(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		list[i] = item.eval(value)
+	}
+	return list
+}
+
+type multiHashNode struct {
+	keys   []string
+	values []node
+}
+
+func (n multiHashNode) eval(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	obj := make(map[string]interface{}, len(n.keys))
+	for i, key := range n.keys {
+		obj[key] = n.values[i].eval(value)
+	}
+	return obj
+}
+
+type notNode struct{ operand node }
+
+func (n notNode) eval(value interface{}) interface{} {
+	return !truthy(n.operand.eval(value))
+}
+
+type logicNode struct {
+	op          string
+	left, right node
+}
+
+func (n logicNode) eval(value interface{}) interface{} {
+	left := n.left.eval(value)
+	if truthy(left) == (n.op == "||") {
+		return left
+	}
+	return n.right.eval(value)
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(value interface{}) interface{} {
+	left, right := n.left.eval(value), n.right.eval(value)
+	switch n.op {
+	case "==":
+		return jsonEqual(left, right)
+	case "!=":
+		return !jsonEqual(left, right)
+	}
+	a, okA := jsonNumber(left)
+	b, okB := jsonNumber(right)
+	if !okA || !okB {
+		return nil // Ordering is only defined for numbers
+	}
+	switch n.op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	default:
+		return a >= b
+	}
+}
+
+// truthy follows JMESPath: false, null and empty strings, lists and objects are false
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func jsonNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil && !math.IsNaN(f)
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := jsonNumber(a); ok {
+		y, ok := jsonNumber(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			if other, ok := y[key]; !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,188 @@
+package streams
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileTransformErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		err  string
+	}{
+		{"trailing dot", "a.", "unexpected end of expression"},
+		{"unclosed bracket", "a[", "unexpected end of expression"},
+		{"unclosed multi-list", "[a, b", "unexpected end of expression"},
+		{"zero slice step", "a[1:2:0]", "slice step can't be 0"},
+		{"too many colons", "a[1:2:3:4]", "unexpected :"},
+		{"empty index", "a[]b", "unexpected identifier"},
+		{"unterminated literal", "a == 'b", "unterminated '"},
+		{"unterminated quoted identifier", `"a`, `unterminated "`},
+		{"invalid JSON literal", "a == `{b`", "invalid JSON literal"},
+		{"multi-hash without value", "{a}", "unexpected }"},
+		{"multi-hash with quoted key", "{'a': b}", "unexpected literal"},
+		{"missing right operand", "a ==", "unexpected end of expression"},
+		{"adjacent identifiers", "a b", "unexpected identifier at 2"},
+		{"unknown character", "a # b", `unexpected '#' at 2`},
+		{"functions", "length(a)", "unexpected ("},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := CompileTransform(tt.expr)
+			if err == nil {
+				t.Fatalf("CompileTransform(%q) = %v, want error", tt.expr, transform)
+			}
+			if !strings.HasPrefix(err.Error(), "invalid transform: ") || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("CompileTransform(%q) error = %q, want it to mention %q", tt.expr, err, tt.err)
+			}
+		})
+	}
+}
+
+// transformTest runs an expression against a JSON message; want is the
+// transformed JSON, empty when the message is skipped
+type transformTest struct {
+	name  string
+	expr  string
+	input string
+	want  string
+}
+
+func runTransformTests(t *testing.T, tests []transformTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := CompileTransform(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileTransform(%q): %v", tt.expr, err)
+			}
+			got, ok := transform.ApplyJSON([]byte(tt.input))
+			if tt.want == "" {
+				if ok {
+					t.Errorf("%q on %s = %s, want the message skipped", tt.expr, tt.input, got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("%q on %s skipped the message, want %s", tt.expr, tt.input, tt.want)
+			}
+			if string(got) != tt.want {
+				t.Errorf("%q on %s = %s, want %s", tt.expr, tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformProjections(t *testing.T) {
+	block := `{"number":"0x10","transactions":[{"hash":"0xa","value":1},{"hash":"0xb","value":5},{"value":7}]}`
+	runTransformTests(t, []transformTest{
+		{"field", "number", block, `"0x10"`},
+		{"nested field", "a.b.c", `{"a":{"b":{"c":true}}}`, `true`},
+		{"quoted identifier", `"foo-bar"`, `{"foo-bar":1}`, `1`},
+		{"identity", "@", `[1,2]`, `[1,2]`},
+		{"flatten projection drops nulls", "transactions[].hash", block, `["0xa","0xb"]`},
+		{"list projection", "transactions[*].value", block, `[1,5,7]`},
+		{"value projection in key order", "*.n", `{"b":{"n":2},"a":{"n":1},"c":3}`, `[1,2]`},
+		{"nested flatten", "a[][]", `{"a":[[1,[2,3]],[4]]}`, `[1,2,3,4]`},
+		{"projection of projection", "a[*].b[*].c", `{"a":[{"b":[{"c":1},{"c":2}]},{"b":[{"c":3}]}]}`, `[[1,2],[3]]`},
+		{"flattened projection of projection", "a[].b[].c", `{"a":[{"b":[{"c":1},{"c":2}]},{"b":[{"c":3}]}]}`, `[1,2,3]`},
+		{"projection of a non-list", "a[*].b", `{"a":{"b":1}}`, ``},
+		{"filter", "transactions[?value > `1`].hash", block, `["0xb"]`},
+		{"filter on string", "logs[?address == '0x1'].data", `{"logs":[{"address":"0x1","data":"x"},{"address":"0x2","data":"y"}]}`, `["x"]`},
+		{"filter with logic", "a[?x && !y]", `{"a":[{"x":1},{"x":1,"y":true},{"y":false}]}`, `[{"x":1}]`},
+		{"multi-hash", "{number: number, hashes: transactions[].hash}", block, `{"hashes":["0xa","0xb"],"number":"0x10"}`},
+		{"multi-list", "[number, transactions[0].hash]", block, `["0x10","0xa"]`},
+		{"multi-hash projection", "transactions[*].{h: hash}", block, `[{"h":"0xa"},{"h":"0xb"},{"h":null}]`},
+		{"pipe stops the projection", "transactions[*].value | [1]", block, `5`},
+		{"or falls back", "missing || number", block, `"0x10"`},
+		{"and short-circuits", "missing && number", block, ``},
+		{"large integers survive", "a", `{"a":123456789012345678901234567890}`, `123456789012345678901234567890`},
+		{"JSON literal", "`{\"k\":[1,2]}`", `{}`, `{"k":[1,2]}`},
+	})
+}
+
+func TestTransformIndexesAndSlices(t *testing.T) {
+	list := `{"a":[0,1,2,3,4]}`
+	runTransformTests(t, []transformTest{
+		{"index", "a[1]", list, `1`},
+		{"negative index", "a[-1]", list, `4`},
+		{"index out of range", "a[5]", list, ``},
+		{"negative index out of range", "a[-6]", list, ``},
+		{"index of a non-list", "a[0]", `{"a":{"0":1}}`, ``},
+		{"root index", "[0]", `["x","y"]`, `"x"`},
+		{"slice", "a[1:3]", list, `[1,2]`},
+		{"open start", "a[:2]", list, `[0,1]`},
+		{"open stop", "a[3:]", list, `[3,4]`},
+		{"negative bounds", "a[-2:]", list, `[3,4]`},
+		{"step", "a[::2]", list, `[0,2,4]`},
+		{"reverse", "a[::-1]", list, `[4,3,2,1,0]`},
+		{"reverse with bounds", "a[3:0:-1]", list, `[3,2,1]`},
+		{"clamped bounds", "a[-10:10]", list, `[0,1,2,3,4]`},
+		{"clamped reverse bounds", "a[10:-10:-2]", list, `[4,2,0]`},
+		{"empty slice", "a[3:1]", list, `[]`},
+		{"root slice", "[1:]", `[1,2]`, `[2]`},
+		{"slice projection", "a[1:3].b", `{"a":[{"b":1},{"b":2},{"b":3}]}`, `[2,3]`},
+		{"slice of a non-list", "a[1:]", `{"a":"abc"}`, ``},
+	})
+}
+
+func TestTransformComparisons(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{"number equals literal", "a == `1`", `{"a":1}`, `true`},
+		{"numbers compare by value", "a == `1.0`", `{"a":1}`, `true`},
+		{"number is not its string", "a == '1'", `{"a":1}`, `false`},
+		{"string is not its number", "a != `1`", `{"a":"1"}`, `true`},
+		{"bool is not a string", "a == 'true'", `{"a":true}`, `false`},
+		{"null equals null", "a == b", `{}`, `true`},
+		{"null is not false", "a == `false`", `{}`, `false`},
+		{"lists compare deeply", "a == b", `{"a":[1,{"c":2}],"b":[1,{"c":2.0}]}`, `true`},
+		{"lists of different lengths", "a == b", `{"a":[1],"b":[1,1]}`, `false`},
+		{"objects compare deeply", "a == b", `{"a":{"x":1,"y":[2]},"b":{"y":[2],"x":1}}`, `true`},
+		{"objects with different keys", "a == b", `{"a":{"x":1},"b":{"y":1}}`, `false`},
+		{"list is not an object", "a == b", `{"a":[],"b":{}}`, `false`},
+		{"less than", "a < b", `{"a":1,"b":2}`, `true`},
+		{"greater or equal", "a >= `2`", `{"a":2}`, `true`},
+		{"strings are not ordered", "a < b", `{"a":"a","b":"b"}`, ``},
+		{"number and string are not ordered", "a > '0'", `{"a":1}`, ``},
+		{"null is not ordered", "a <= `1`", `{}`, ``},
+		{"filter skips unordered items", "a[?@ > `1`]", `{"a":[1,2,"3",null,3.5,true]}`, `[2,3.5]`},
+		{"filter on mixed equality", "a[?@ == `1`]", `{"a":[1,"1",1.0,true,[1]]}`, `[1,1.0]`},
+		{"not of a comparison", "!(a == `1`)", `{"a":2}`, `true`},
+	})
+}
+
+func TestTransformNilInputs(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{"null message", "a", `null`, ``},
+		{"missing field", "a.b", `{}`, ``},
+		{"field of a null", "a.b", `{"a":null}`, ``},
+		{"field of a scalar", "a.b", `{"a":1}`, ``},
+		{"projection of a null", "a[].b", `{}`, ``},
+		{"filter of a null", "a[?b]", `{}`, ``},
+		{"value projection of a null", "a.*", `{}`, ``},
+		{"multi-hash of a null", "a.{b: b}", `{}`, ``},
+		{"multi-list of a null", "a.[b]", `{}`, ``},
+		{"multi-hash of missing fields", "{b: b}", `{}`, `{"b":null}`},
+		{"not of a null", "!a", `{}`, `true`},
+		{"empty values are falsy", "[!a, !b, !c, !d]", `{"a":"","b":[],"c":{},"d":0}`, `[true,true,true,false]`},
+		{"not JSON", "a", `not json`, ``},
+	})
+
+	var nilTransform *Transform
+	if got, ok := nilTransform.ApplyJSON([]byte("not json")); !ok || string(got) != "not json" {
+		t.Errorf("nil transform = %s, %v, want the message unchanged", got, ok)
+	}
+	for _, expr := range []string{"", "  \t"} {
+		if transform, err := CompileTransform(expr); transform != nil || err != nil {
+			t.Errorf("CompileTransform(%q) = %v, %v, want a nil transform", expr, transform, err)
+		}
+	}
+	transform, err := CompileTransform("a[0].b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := transform.Apply(nil); got != nil {
+		t.Errorf("Apply(nil) = %v, want nil", got)
+	}
+}
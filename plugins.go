@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// pluginMonitor is a plugin monitor bound to this service
+type pluginMonitor struct {
+	name     string
+	stream   string // JetStream stream capturing its subjects
+	instance monitor.Monitor
+}
+
+// pluginHost lends the RPC client, publisher and scheduler to a plugin
+type pluginHost struct {
+	dt   *SomniaStream
+	name string
+}
+
+func (h *pluginHost) RPC() *rpc.Client {
+	return h.dt.rpcClient
+}
+
+func (h *pluginHost) Publish(subject string, data []byte) error {
+	return h.dt.publish(subject, data)
+}
+
+func (h *pluginHost) Run(ctx context.Context, tick func() error) {
+	h.dt.runMonitor(ctx, h.name, tick)
+}
+
+// registerPluginIntervals adds the default intervals of the plugin monitors,
+// so <NAME>_POLL_INTERVAL overrides them like the built-in ones. It must run
+// once, before the configuration is loaded.
+func registerPluginIntervals() error {
+	for _, plugin := range monitor.Plugins() {
+		if _, builtin := config.DefaultPollIntervals[plugin.Name]; builtin {
+			return fmt.Errorf("plugin monitor %s clashes with a built-in monitor", plugin.Name)
+		}
+		config.DefaultPollIntervals[plugin.Name] = plugin.Interval
+	}
+	return nil
+}
+
+// loadPlugins creates the registered plugin monitors and lists their subjects
+// as streams. Their JetStream streams are created by setupJetStreams.
+func (dt *SomniaStream) loadPlugins() error {
+	var entries []streams.Entry
+	for _, plugin := range monitor.Plugins() {
+		instance := plugin.New(&pluginHost{dt: dt, name: plugin.Name})
+		subjects := instance.Subjects()
+		if len(subjects) == 0 {
+			return fmt.Errorf("plugin monitor %s publishes no subjects", plugin.Name)
+		}
+		for _, subject := range subjects {
+			if _, taken := dt.streams.lookup(subject); taken {
+				return fmt.Errorf("plugin monitor %s: subject %s is already a stream", plugin.Name, subject)
+			}
+			entries = append(entries, streams.Entry{
+				Name:        subject,
+				Subject:     subject,
+				Description: "Published by the " + plugin.Name + " plugin monitor",
+			})
+		}
+		dt.plugins = append(dt.plugins, pluginMonitor{
+			name:     plugin.Name,
+			stream:   "PLUGIN_" + strings.ToUpper(plugin.Name),
+			instance: instance,
+		})
+	}
+	dt.streams.setPlugins(entries)
+	return nil
+}
+
+// pluginSpecs returns the JetStream streams of the plugin monitors
+func (dt *SomniaStream) pluginSpecs() []streams.Spec {
+	specs := make([]streams.Spec, 0, len(dt.plugins))
+	for _, plugin := range dt.plugins {
+		specs = append(specs, streams.Spec{Name: plugin.stream, Subjects: plugin.instance.Subjects()})
+	}
+	return specs
+}
+
+// registerPlugins adds the plugin monitors to the monitor registry
+func (dt *SomniaStream) registerPlugins() {
+	for _, plugin := range dt.plugins {
+		dt.monitors.Register(plugin.name, plugin.instance.Start)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Getters of Uniswap V2 and V3 style pools and their tokens
+var (
+	selectorToken0      = crypto.Keccak256([]byte("token0()"))[:4]
+	selectorToken1      = crypto.Keccak256([]byte("token1()"))[:4]
+	selectorGetReserves = crypto.Keccak256([]byte("getReserves()"))[:4]
+	selectorSlot0       = crypto.Keccak256([]byte("slot0()"))[:4]
+	selectorLiquidity   = crypto.Keccak256([]byte("liquidity()"))[:4]
+	selectorBalanceOf   = crypto.Keccak256([]byte("balanceOf(address)"))[:4]
+)
+
+// poolMaxBlockRange bounds the blocks scanned for pool events per tick
+const poolMaxBlockRange = 500
+
+// q96 is 2^96, the fixed point scale of V3 square root prices
+var q96 = new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96))
+
+// poolToken is one side of a pool
+type poolToken struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol,omitempty"`
+	Decimals *uint8 `json:"decimals,omitempty"`
+}
+
+// poolState is the eth.defi.pools payload of a pool. V2 pools report their
+// reserves, V3 pools the token balances they hold plus liquidity and price.
+type poolState struct {
+	Pool         string    `json:"pool"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"` // "v2" or "v3"
+	Token0       poolToken `json:"token0"`
+	Token1       poolToken `json:"token1"`
+	Reserve0     string    `json:"reserve0"`
+	Reserve1     string    `json:"reserve1"`
+	Liquidity    string    `json:"liquidity,omitempty"`
+	SqrtPriceX96 string    `json:"sqrtPriceX96,omitempty"`
+	Tick         *int64    `json:"tick,omitempty"`
+	Price        *float64  `json:"price,omitempty"` // Token1 per token0, decimals applied
+	BlockNumber  uint64    `json:"blockNumber"`
+	Timestamp    int64     `json:"timestamp"`
+
+	reserve0, reserve1 *big.Int
+}
+
+// poolWatch is the state the pools monitor keeps between ticks
+type poolWatch struct {
+	lastBlock uint64
+	pools     map[common.Address]*poolState
+}
+
+// Monitor registered liquidity pools and publish their state and TVL
+func (dt *SomniaStream) monitorPools(ctx context.Context) {
+	watch := &poolWatch{pools: make(map[common.Address]*poolState)}
+	dt.runMonitor(ctx, "pools", func() error {
+		return dt.publishPoolStates(watch)
+	})
+}
+
+// Publish the state of every pool in POOL_CONTRACTS that emitted an event
+// since the last scanned block, and the TVL when any pool changed. Every pool
+// is published once when it is first watched.
+func (dt *SomniaStream) publishPoolStates(watch *poolWatch) error {
+	cfg := dt.config()
+	names := make(map[common.Address]string, len(cfg.PoolContracts))
+	addresses := make([]common.Address, 0, len(cfg.PoolContracts))
+	for name, address := range cfg.PoolContracts {
+		addr := common.HexToAddress(address)
+		names[addr] = name
+		addresses = append(addresses, addr)
+	}
+	for addr := range watch.pools {
+		if _, ok := names[addr]; !ok {
+			delete(watch.pools, addr) // Removed on reload
+		}
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	head, err := dt.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	if watch.lastBlock == 0 && head > 0 {
+		watch.lastBlock = head - 1
+	}
+	if head <= watch.lastBlock {
+		return nil
+	}
+	from := watch.lastBlock + 1
+	to := from + poolMaxBlockRange - 1
+	if to > head {
+		to = head
+	}
+
+	touched := make(map[common.Address]bool)
+	for _, addr := range addresses {
+		if watch.pools[addr] == nil {
+			touched[addr] = true
+		}
+	}
+	logs, err := dt.primary.GetLogs(ctx, map[string]interface{}{"address": addresses}, from, to)
+	if err != nil {
+		return err
+	}
+	for _, entry := range logs {
+		if addr, ok := addressOf(entry["address"]); ok {
+			touched[addr] = true
+		}
+	}
+
+	changed := false
+	for addr := range touched {
+		state, err := dt.readPool(ctx, addr, names[addr], watch.pools[addr], to)
+		if err != nil {
+			log.Printf("[POOLS] WARNING: Failed to read pool %s (%s): %v", names[addr], addr.Hex(), err)
+			continue
+		}
+		watch.pools[addr] = state
+		changed = true
+
+		data, _ := json.Marshal(state)
+		if err := dt.publish("eth.defi.pools", data); err != nil {
+			log.Printf("[POOLS] ERROR: Failed to publish state of %s: %v", names[addr], err)
+		}
+	}
+	watch.lastBlock = to
+
+	if changed {
+		data, _ := json.Marshal(poolTVL(watch.pools, cfg.PoolQuoteToken, to))
+		if err := dt.publish("eth.defi.tvl", data); err != nil {
+			log.Printf("[POOLS] ERROR: Failed to publish TVL: %v", err)
+		}
+	}
+	return nil
+}
+
+// readPool reads the state of a pool at a block. The pool's tokens are read
+// once; getReserves tells V2 pools apart from V3 pools.
+func (dt *SomniaStream) readPool(ctx context.Context, addr common.Address, name string, previous *poolState, block uint64) (*poolState, error) {
+	at := new(big.Int).SetUint64(block)
+	call := func(to common.Address, data []byte) ([]byte, error) {
+		return dt.ethClient.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, at)
+	}
+
+	state := &poolState{
+		Pool:        strings.ToLower(addr.Hex()),
+		Name:        name,
+		BlockNumber: block,
+		Timestamp:   time.Now().Unix(),
+	}
+	if previous != nil {
+		state.Token0, state.Token1 = previous.Token0, previous.Token1
+	} else {
+		for _, side := range []struct {
+			selector []byte
+			token    *poolToken
+		}{{selectorToken0, &state.Token0}, {selectorToken1, &state.Token1}} {
+			out, err := call(addr, side.selector)
+			if err != nil {
+				return nil, err
+			}
+			if len(out) < 32 {
+				return nil, errors.New("not a pool: token0() or token1() returned no address")
+			}
+			side.token.Address = strings.ToLower(common.BytesToAddress(out[12:32]).Hex())
+		}
+	}
+	dt.poolTokenMetadata(&state.Token0)
+	dt.poolTokenMetadata(&state.Token1)
+
+	if out, err := call(addr, selectorGetReserves); err == nil && len(out) >= 64 {
+		state.Type = "v2"
+		state.reserve0 = new(big.Int).SetBytes(out[:32])
+		state.reserve1 = new(big.Int).SetBytes(out[32:64])
+		if price, ok := reservePrice(state.reserve0, state.reserve1, state.Token0.Decimals, state.Token1.Decimals); ok {
+			state.Price = &price
+		}
+	} else {
+		state.Type = "v3"
+		out, err := call(addr, selectorSlot0)
+		if err != nil || len(out) < 64 {
+			return nil, errors.New("neither getReserves() nor slot0() answered")
+		}
+		sqrtPrice := new(big.Int).SetBytes(out[:32])
+		tickWord := new(big.Int).SetBytes(out[32:64])
+		if out[32]&0x80 != 0 { // int24 sign-extended to 256 bits
+			tickWord.Sub(tickWord, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		tick := tickWord.Int64()
+		state.SqrtPriceX96 = sqrtPrice.String()
+		state.Tick = &tick
+		if price, ok := sqrtPriceX96Price(sqrtPrice, state.Token0.Decimals, state.Token1.Decimals); ok {
+			state.Price = &price
+		}
+
+		out, err = call(addr, selectorLiquidity)
+		if err != nil || len(out) < 32 {
+			return nil, errors.New("liquidity() returned nothing")
+		}
+		state.Liquidity = new(big.Int).SetBytes(out[:32]).String()
+
+		// Reserves are the token balances held by the pool
+		for _, side := range []struct {
+			token   string
+			reserve **big.Int
+		}{{state.Token0.Address, &state.reserve0}, {state.Token1.Address, &state.reserve1}} {
+			data := append(append([]byte{}, selectorBalanceOf...), common.LeftPadBytes(addr.Bytes(), 32)...)
+			out, err := call(common.HexToAddress(side.token), data)
+			if err != nil || len(out) < 32 {
+				return nil, fmt.Errorf("balanceOf() of %s failed", side.token)
+			}
+			*side.reserve = new(big.Int).SetBytes(out[:32])
+		}
+	}
+	state.Reserve0, state.Reserve1 = state.reserve0.String(), state.reserve1.String()
+	return state, nil
+}
+
+// poolTokenMetadata fills in the symbol and decimals of a pool token from the
+// token metadata cache, once known
+func (dt *SomniaStream) poolTokenMetadata(token *poolToken) {
+	if dt.tokens == nil || token.Decimals != nil {
+		return
+	}
+	if meta := dt.tokens.lookup(common.HexToAddress(token.Address)); meta != nil {
+		token.Symbol, token.Decimals = meta.Symbol, meta.Decimals
+	}
+}
+
+// reservePrice is the price of token0 in token1 from V2 reserves
+func reservePrice(reserve0, reserve1 *big.Int, decimals0, decimals1 *uint8) (float64, bool) {
+	if reserve0.Sign() == 0 || decimals0 == nil || decimals1 == nil {
+		return 0, false
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(reserve1), new(big.Float).SetInt(reserve0)).Float64()
+	return ratio * math.Pow10(int(*decimals0)-int(*decimals1)), true
+}
+
+// sqrtPriceX96Price is the price of token0 in token1 from a V3 square root price
+func sqrtPriceX96Price(sqrtPrice *big.Int, decimals0, decimals1 *uint8) (float64, bool) {
+	if sqrtPrice.Sign() == 0 || decimals0 == nil || decimals1 == nil {
+		return 0, false
+	}
+	root := new(big.Float).Quo(new(big.Float).SetInt(sqrtPrice), q96)
+	ratio, _ := new(big.Float).Mul(root, root).Float64()
+	return ratio * math.Pow10(int(*decimals0)-int(*decimals1)), true
+}
+
+// poolTVL sums the reserves of every pool per token and, with a quote token,
+// values them through the deepest pool pairing each token with it
+func poolTVL(pools map[common.Address]*poolState, quoteToken string, block uint64) map[string]interface{} {
+	type tokenTotal struct {
+		poolToken
+		Amount string   `json:"amount"`
+		Value  *float64 `json:"value,omitempty"` // In quote token units
+
+		amount *big.Int
+	}
+	totals := make(map[string]*tokenTotal)
+	add := func(token poolToken, amount *big.Int) {
+		total, ok := totals[token.Address]
+		if !ok {
+			total = &tokenTotal{poolToken: token, amount: new(big.Int)}
+			totals[token.Address] = total
+		}
+		total.amount.Add(total.amount, amount)
+	}
+	for _, pool := range pools {
+		add(pool.Token0, pool.reserve0)
+		add(pool.Token1, pool.reserve1)
+	}
+
+	quote := strings.ToLower(quoteToken)
+	prices := make(map[string]float64) // Quote token per token
+	depth := make(map[string]*big.Int)
+	prices[quote] = 1
+	for _, pool := range pools {
+		if pool.Price == nil || *pool.Price == 0 {
+			continue
+		}
+		var token string
+		var price float64
+		var quoteReserve *big.Int
+		switch quote {
+		case pool.Token1.Address:
+			token, price, quoteReserve = pool.Token0.Address, *pool.Price, pool.reserve1
+		case pool.Token0.Address:
+			token, price, quoteReserve = pool.Token1.Address, 1 / *pool.Price, pool.reserve0
+		default:
+			continue
+		}
+		if depth[token] == nil || quoteReserve.Cmp(depth[token]) > 0 {
+			prices[token], depth[token] = price, quoteReserve
+		}
+	}
+
+	tokens := make([]*tokenTotal, 0, len(totals))
+	unpriced := []string{}
+	var tvl float64
+	for _, total := range totals {
+		total.Amount = total.amount.String()
+		price, ok := prices[total.Address]
+		if quote != "" && ok && total.Decimals != nil {
+			units, _ := new(big.Float).Quo(new(big.Float).SetInt(total.amount), big.NewFloat(math.Pow10(int(*total.Decimals)))).Float64()
+			value := units * price
+			total.Value = &value
+			tvl += value
+		} else if quote != "" {
+			unpriced = append(unpriced, total.Address)
+		}
+		tokens = append(tokens, total)
+	}
+
+	payload := map[string]interface{}{
+		"pools":       len(pools),
+		"tokens":      tokens,
+		"blockNumber": block,
+		"timestamp":   time.Now().Unix(),
+	}
+	if quote != "" {
+		payload["quoteToken"] = quote
+		payload["tvl"] = tvl
+		payload["unpriced"] = unpriced
+	}
+	return payload
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// ipLimiterIdle is how long an IP's bucket is kept after its last request
+const ipLimiterIdle = 10 * time.Minute
+
+// ipRateLimiter keeps a token bucket per client IP
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*ipLimiter
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newIPRateLimiter() *ipRateLimiter {
+	return &ipRateLimiter{limiters: make(map[string]*ipLimiter)}
+}
+
+// get returns the bucket of an IP, applying the current limit and burst
+func (l *ipRateLimiter) get(ip string, limit rate.Limit, burst int) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.limiters[ip]
+	if !ok {
+		entry = &ipLimiter{limiter: rate.NewLimiter(limit, burst)}
+		l.limiters[ip] = entry
+	} else if entry.limiter.Limit() != limit || entry.limiter.Burst() != burst {
+		// Configuration was reloaded
+		entry.limiter.SetLimit(limit)
+		entry.limiter.SetBurst(burst)
+	}
+	entry.lastSeen = time.Now()
+	return entry.limiter
+}
+
+// cleanup drops the buckets of IPs that have been idle for a while
+func (l *ipRateLimiter) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			for ip, entry := range l.limiters {
+				if time.Since(entry.lastSeen) > ipLimiterIdle {
+					delete(l.limiters, ip)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// rateLimitByIP rejects requests above HTTP_RATE_LIMIT per client IP with 429
+// and a Retry-After header. The client IP honours X-Forwarded-For/X-Real-IP
+// only when the request comes from one of TRUSTED_PROXIES.
+func (dt *SomniaStream) rateLimitByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := dt.config()
+		if cfg.HTTPRateLimit <= 0 {
+			c.Next()
+			return
+		}
+
+		limiter := dt.ipLimits.get(c.ClientIP(), rate.Limit(cfg.HTTPRateLimit), max(cfg.HTTPRateBurst, 1))
+		reservation := limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
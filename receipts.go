@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Fetch all receipts for a block, from the receipt cache when all of them are
+// cached, preferring eth_getBlockReceipts and falling back to batches of
+// RECEIPT_BATCH_SIZE eth_getTransactionReceipt calls, at most
+// RECEIPT_CONCURRENCY batches at a time. Endpoints that don't know
+// eth_getBlockReceipts aren't asked again.
+func (dt *SomniaStream) fetchReceipts(ctx context.Context, block *types.Block) ([]*types.Receipt, error) {
+	txs := block.Transactions()
+	if receipts, ok := dt.cachedReceipts(block); ok {
+		return receipts, nil
+	}
+	receipts, err := dt.fetchBlockReceipts(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	for i, receipt := range receipts {
+		dt.receipts.add(txs[i].Hash(), receipt)
+	}
+	return receipts, nil
+}
+
+// cachedReceipts returns the receipts of a block when all of them are cached
+func (dt *SomniaStream) cachedReceipts(block *types.Block) ([]*types.Receipt, bool) {
+	receipts := make([]*types.Receipt, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		receipt, ok := dt.receipts.get(tx.Hash())
+		if !ok || receipt.BlockHash != block.Hash() {
+			return nil, false
+		}
+		receipts[i] = receipt
+	}
+	return receipts, true
+}
+
+func (dt *SomniaStream) fetchBlockReceipts(ctx context.Context, block *types.Block) ([]*types.Receipt, error) {
+	txs := block.Transactions()
+	if !dt.noBlockRcp.Load() {
+		receipts, err := dt.ethClient.BlockReceipts(ctx, rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+		if err == nil && len(receipts) == len(txs) {
+			return receipts, nil
+		}
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+			log.Printf("[RECEIPTS] eth_getBlockReceipts is not supported, batching eth_getTransactionReceipt instead")
+			dt.noBlockRcp.Store(true)
+		}
+	}
+
+	cfg := dt.config()
+	batchSize := max(cfg.ReceiptBatchSize, 1)
+	slots := make(chan struct{}, max(cfg.ReceiptConcurrency, 1))
+	failed := make(chan error, 1)
+	receipts := make([]*types.Receipt, len(txs))
+	var batches sync.WaitGroup
+	for start := 0; start < len(txs); start += batchSize {
+		end := min(start+batchSize, len(txs))
+		slots <- struct{}{}
+		batches.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				batches.Done()
+			}()
+			if err := dt.fetchReceiptBatch(ctx, txs[start:end], receipts[start:end]); err != nil {
+				select {
+				case failed <- err:
+				default:
+				}
+			}
+		}()
+	}
+	batches.Wait()
+
+	select {
+	case err := <-failed:
+		return nil, err
+	default:
+		return receipts, nil
+	}
+}
+
+// fetchReceiptBatch fetches the receipts of txs into receipts with one batch
+// call, or one call per transaction when the endpoint rejects batches
+func (dt *SomniaStream) fetchReceiptBatch(ctx context.Context, txs []*types.Transaction, receipts []*types.Receipt) error {
+	results := make([]json.RawMessage, len(txs))
+	batch := make([]rpc.BatchElem, len(txs))
+	for i, tx := range txs {
+		batch[i] = rpc.BatchElem{Method: "eth_getTransactionReceipt", Args: []interface{}{tx.Hash()}, Result: &results[i]}
+	}
+	if err := dt.rpcClient.BatchCallContext(ctx, batch); err != nil {
+		for i, tx := range txs {
+			receipt, err := dt.ethClient.TransactionReceipt(ctx, tx.Hash())
+			if err != nil {
+				return err
+			}
+			receipts[i] = receipt
+		}
+		return nil
+	}
+
+	for i, elem := range batch {
+		if elem.Error != nil {
+			return fmt.Errorf("fetching receipt of %s: %w", txs[i].Hash().Hex(), elem.Error)
+		}
+		if len(results[i]) == 0 || string(results[i]) == "null" {
+			return fmt.Errorf("fetching receipt of %s: %w", txs[i].Hash().Hex(), ethereum.NotFound)
+		}
+		receipt := new(types.Receipt)
+		if err := json.Unmarshal(results[i], receipt); err != nil {
+			return fmt.Errorf("decoding receipt of %s: %w", txs[i].Hash().Hex(), err)
+		}
+		receipts[i] = receipt
+	}
+	return nil
+}
+
+// Publish failed (status=0) transactions of a block together with their revert reasons
+func (dt *SomniaStream) publishFailedTransactions(block *types.Block, receipts []*types.Receipt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	txs := block.Transactions()
+	for i, receipt := range receipts {
+		if receipt.Status != types.ReceiptStatusFailed {
+			continue
+		}
+		tx := txs[i]
+
+		from, _ := types.Sender(dt.signer, tx)
+		reason, revertData, replayErr := dt.replayRevertReason(ctx, tx, from, block.Number())
+
+		failed := map[string]interface{}{
+			"hash":         tx.Hash().Hex(),
+			"blockNumber":  block.NumberU64(),
+			"blockHash":    block.Hash().Hex(),
+			"from":         from.Hex(),
+			"to":           tx.To(),
+			"value":        tx.Value().String(),
+			"gas":          tx.Gas(),
+			"gasUsed":      receipt.GasUsed,
+			"nonce":        tx.Nonce(),
+			"revertReason": reason,
+			"revertData":   revertData,
+			"timestamp":    time.Now().Unix(),
+		}
+		if replayErr != nil {
+			failed["replayError"] = replayErr.Error()
+		}
+		dt.names.annotate([]map[string]interface{}{failed}, "from", "to")
+
+		data, _ := json.Marshal(failed)
+		if err := dt.publish("eth.tx.failed", data); err != nil {
+			log.Printf("[FAILED] ERROR: Failed to publish failed transaction %s: %v", tx.Hash().Hex(), err)
+			return err
+		}
+		log.Printf("[FAILED] Published failed transaction %s (reason: %q)", tx.Hash().Hex(), reason)
+
+		dt.updateTxStatus(tx.Hash().Hex(), map[string]interface{}{
+			"status":       txStatusFailed,
+			"blockNumber":  block.NumberU64(),
+			"blockHash":    block.Hash().Hex(),
+			"revertReason": reason,
+		})
+	}
+
+	return nil
+}
+
+// Replay a transaction with eth_call against the parent block state to recover
+// the revert reason. Transactions earlier in the same block are not applied, so
+// the reason is best-effort for state-dependent reverts.
+func (dt *SomniaStream) replayRevertReason(ctx context.Context, tx *types.Transaction, from common.Address, blockNumber *big.Int) (string, string, error) {
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+
+	parent := new(big.Int).Sub(blockNumber, big.NewInt(1))
+	_, err := dt.ethClient.CallContract(ctx, msg, parent)
+	if err == nil {
+		return "", "", errors.New("transaction did not revert on replay")
+	}
+
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if hexData, ok := dataErr.ErrorData().(string); ok {
+			raw, decodeErr := hexutil.Decode(hexData)
+			if decodeErr == nil {
+				if reason, unpackErr := abi.UnpackRevert(raw); unpackErr == nil {
+					return reason, hexData, nil
+				}
+			}
+			return strings.TrimPrefix(err.Error(), "execution reverted: "), hexData, nil
+		}
+	}
+
+	return strings.TrimPrefix(err.Error(), "execution reverted: "), "", nil
+}
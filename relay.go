@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRawTxSize matches the transaction size limit of geth's pool
+const maxRawTxSize = 128 * 1024
+
+// relayRequest is the body of POST /tx
+type relayRequest struct {
+	Raw string `json:"raw"` // 0x-prefixed signed transaction
+}
+
+// relayResponse is the result of POST /tx
+type relayResponse struct {
+	Hash  string `json:"hash"`
+	From  string `json:"from"`
+	Nonce uint64 `json:"nonce"`
+	State string `json:"state"` // Lifecycle state, seen until the transaction is mined
+}
+
+// Handle POST /tx relaying a signed raw transaction through
+// eth_sendRawTransaction. Accepted transactions are enrolled in lifecycle
+// tracking right away, so eth.tx.lifecycle and GET /tx/:hash follow them
+// even before the pending monitor sees them.
+func (dt *SomniaStream) handleSendRawTx(c *gin.Context) {
+	var req relayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	raw, err := hexutil.Decode(req.Raw)
+	if err != nil || len(raw) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "raw must be a 0x-prefixed signed transaction"})
+		return
+	}
+	if len(raw) > maxRawTxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("transaction exceeds %d bytes", maxRawTxSize)})
+		return
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction: " + err.Error()})
+		return
+	}
+	from, err := types.Sender(dt.signer, tx)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid signature: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	var hash common.Hash
+	if err := dt.rpcClient.CallContext(ctx, &hash, "eth_sendRawTransaction", hexutil.Bytes(raw)); err != nil {
+		// Rejections such as "nonce too low" come back as JSON-RPC errors,
+		// anything else means the node couldn't be reached
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "node unavailable: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": rpcErr.Error(), "code": rpcErr.ErrorCode(), "hash": tx.Hash().Hex()})
+		return
+	}
+	if hash != tx.Hash() {
+		log.Printf("[RELAY] WARNING: Node returned hash %s for transaction %s", hash.Hex(), tx.Hash().Hex())
+	}
+
+	sender := strings.ToLower(from.Hex())
+	tracked, isNew := dt.lifecycle.enroll(tx.Hash().Hex(), sender, hexutil.EncodeUint64(tx.Nonce()))
+	state := txStateSeen
+	if tracked != nil {
+		state = tracked.State
+		if isNew {
+			dt.publishLifecycleEvent(*tracked, map[string]interface{}{"source": "relay"})
+		}
+	}
+	log.Printf("[RELAY] Relayed transaction %s from %s (nonce %d)", tx.Hash().Hex(), sender, tx.Nonce())
+
+	c.JSON(http.StatusAccepted, relayResponse{Hash: tx.Hash().Hex(), From: sender, Nonce: tx.Nonce(), State: state})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+
+	"somnia-stream/pkg/config"
+)
+
+// Reload the configuration whenever the process receives SIGHUP
+func (dt *SomniaStream) watchReloadSignal(ctx context.Context) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupCh:
+			log.Println("Received SIGHUP, reloading configuration...")
+			dt.reloadConfig()
+		}
+	}
+}
+
+// reloadConfig re-reads the .env file and environment and applies every
+// setting that can change at runtime. Client connections and JetStream streams
+// are left untouched.
+func (dt *SomniaStream) reloadConfig() []string {
+	// Overload so edited .env values replace the ones loaded at startup
+	if err := godotenv.Overload(); err != nil {
+		log.Printf("No .env file reloaded (%v), using current environment", err)
+	}
+
+	previous := dt.config()
+	next := config.Load()
+
+	// Mock, record and replay modes rewrote the RPC endpoints at startup
+	if previous.MockRPC || previous.RPCRecordFile != "" || previous.RPCReplayFile != "" {
+		next.RPCEndpoint = previous.RPCEndpoint
+		next.PendingWSEndpoint = previous.PendingWSEndpoint
+		next.RPCPeerEndpoints = previous.RPCPeerEndpoints
+		next.ConsistencyEndpoint = previous.ConsistencyEndpoint
+	}
+
+	// Connection settings are bound at startup and need a restart to change
+	for _, field := range []string{"RPCEndpoint", "RPCPeerEndpoints", "ConsistencyEndpoint", "NATSUrl", "NATSToken", "ServerPort", "ServerListen", "AdminListen", "PendingWSEndpoint", "RollupRetention", "TrustedProxies", "JWTJWKSURL", "OIDCIssuer", "SessionSecret", "TLSCertFile", "TLSKeyFile", "TLSAutocertDomains", "MockRPCAddr", "MockChainID", "MockBlockInterval", "MockTxsPerBlock", "MockLogsPerTx", "MockFailureRate", "MockSeed", "Chaos", "ChainName", "SubjectNamespace", "NameRegistry", "NameCacheTTL", "NameCacheSize", "DecodeSelectors", "SelectorLookupURL", "ABISourcifyURL", "ABIExplorerURL", "ABIExplorerAPIKey", "ABIFetchRetryAfter", "MulticallAddress", "TokenMetadata", "TokenMetadataTTL", "TokenCacheSize", "BlockCacheSize", "ReceiptCacheSize", "CheckpointInterval", "Exports", "ExportS3Bucket", "ExportS3Prefix", "ArchiveStreams", "ArchiveDir", "ArchiveS3Bucket", "ArchiveS3Prefix", "ArchiveInterval", "ArchiveHotRetention", "S3Region", "S3Endpoint", "AWSAccessKeyID", "AWSSecretKey", "AWSSessionToken"} {
+		if !reflect.DeepEqual(reflect.ValueOf(*previous).FieldByName(field).Interface(), reflect.ValueOf(*next).FieldByName(field).Interface()) {
+			log.Printf("⚠️ %s changed, restart required to apply it", field)
+		}
+	}
+	next.RPCEndpoint = previous.RPCEndpoint
+	next.RPCPeerEndpoints = previous.RPCPeerEndpoints
+	next.ConsistencyEndpoint = previous.ConsistencyEndpoint
+	next.NATSUrl = previous.NATSUrl
+	next.NATSToken = previous.NATSToken
+	next.ServerPort = previous.ServerPort
+	next.ServerListen = previous.ServerListen
+	next.AdminListen = previous.AdminListen
+	next.PendingWSEndpoint = previous.PendingWSEndpoint
+	next.RollupRetention = previous.RollupRetention
+	next.TrustedProxies = previous.TrustedProxies
+	next.JWTJWKSURL = previous.JWTJWKSURL
+	next.OIDCIssuer = previous.OIDCIssuer
+	next.SessionSecret = previous.SessionSecret
+	next.TLSCertFile = previous.TLSCertFile
+	next.TLSKeyFile = previous.TLSKeyFile
+	next.TLSAutocertDomains = previous.TLSAutocertDomains
+	next.Chaos = previous.Chaos
+	next.ChainName = previous.ChainName
+	next.Chains = reloadChains(previous.Chains, next.Chains)
+	next.SubjectNamespace = previous.SubjectNamespace
+	next.NameRegistry = previous.NameRegistry
+	next.NameCacheTTL = previous.NameCacheTTL
+	next.NameCacheSize = previous.NameCacheSize
+	next.DecodeSelectors = previous.DecodeSelectors
+	next.SelectorLookupURL = previous.SelectorLookupURL
+	next.ABISourcifyURL = previous.ABISourcifyURL
+	next.ABIExplorerURL = previous.ABIExplorerURL
+	next.ABIExplorerAPIKey = previous.ABIExplorerAPIKey
+	next.ABIFetchRetryAfter = previous.ABIFetchRetryAfter
+	next.MulticallAddress = previous.MulticallAddress
+	next.TokenMetadata = previous.TokenMetadata
+	next.TokenMetadataTTL = previous.TokenMetadataTTL
+	next.TokenCacheSize = previous.TokenCacheSize
+	next.BlockCacheSize = previous.BlockCacheSize
+	next.ReceiptCacheSize = previous.ReceiptCacheSize
+	next.CheckpointInterval = previous.CheckpointInterval
+	next.Exports = previous.Exports
+	next.ArchiveStreams = previous.ArchiveStreams
+
+	// The embedded NATS server, mock chain and RPC recording may be enabled by command-line flags, which aren't re-read
+	next.EmbeddedNATS = previous.EmbeddedNATS
+	next.EmbeddedNATSDataDir = previous.EmbeddedNATSDataDir
+	next.EmbeddedNATSAddr = previous.EmbeddedNATSAddr
+	next.MockRPC = previous.MockRPC
+	next.MockRPCAddr = previous.MockRPCAddr
+	next.MockChainID = previous.MockChainID
+	next.MockBlockInterval = previous.MockBlockInterval
+	next.MockTxsPerBlock = previous.MockTxsPerBlock
+	next.MockLogsPerTx = previous.MockLogsPerTx
+	next.MockFailureRate = previous.MockFailureRate
+	next.MockSeed = previous.MockSeed
+	next.RPCRecordFile = previous.RPCRecordFile
+	next.RPCReplayFile = previous.RPCReplayFile
+
+	// Keep the previous whale thresholds if the new ones don't parse
+	if err := dt.whales.setThresholds(next.WhaleThreshold, next.WhaleTokenThresholds); err != nil {
+		log.Printf("Invalid WHALE_THRESHOLD or WHALE_TOKEN_THRESHOLDS on reload, keeping the previous thresholds: %v", err)
+		next.WhaleThreshold = previous.WhaleThreshold
+		next.WhaleTokenThresholds = previous.WhaleTokenThresholds
+	}
+
+	dt.cfg.Store(next)
+
+	dt.gasSpike.reconfigure(next.GasSpikeWindow, next.GasSpikeMultiplier, next.GasSpikeMinSamples)
+	dt.lifecycle.reconfigure(next.LifecycleFinalityDepth, next.LifecycleDropTimeout)
+	dt.throughput.setWindows(next.ThroughputWindows)
+	if err := dt.selectors.loadFile(next.SelectorFile); err != nil {
+		log.Printf("Keeping the loaded selector overrides: %v", err)
+	}
+	if err := dt.loadPublishHooks(next); err != nil {
+		log.Printf("Keeping the loaded publish hooks: %v", err)
+	}
+	dt.rpcRetry.setPolicy(rpcRetryPolicyFromConfig(next))
+	dt.publisher.SetPolicy(publishPolicy(next, dt.ns))
+	dt.primary.SetOptions(chainOptions(next))
+	dt.rpcRetry.breaker.reconfigure(next.RPCBreakerThreshold, next.RPCBreakerCooldown)
+	for _, chain := range dt.chains {
+		chain.rpcRetry.setPolicy(rpcRetryPolicyFromConfig(next))
+		chain.rpcRetry.breaker.reconfigure(next.RPCBreakerThreshold, next.RPCBreakerCooldown)
+	}
+
+	// Apply monitor intervals and enabled state
+	for _, status := range dt.monitors.List() {
+		if interval := dt.pollInterval(status.Name); interval.String() != status.Interval {
+			if err := dt.monitors.SetInterval(status.Name, interval); err != nil {
+				log.Printf("Failed to apply interval for %s: %v", status.Name, err)
+			}
+		}
+		switch disabled := dt.monitorDisabled(status.Name); {
+		case disabled && !status.Paused:
+			_ = dt.monitors.Pause(status.Name)
+		case !disabled && status.Paused:
+			_ = dt.monitors.Resume(status.Name)
+		}
+	}
+
+	var changed []string
+	prevValue, nextValue := reflect.ValueOf(*previous), reflect.ValueOf(*next)
+	for i := 0; i < prevValue.NumField(); i++ {
+		if !reflect.DeepEqual(prevValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			changed = append(changed, prevValue.Type().Field(i).Name)
+		}
+	}
+
+	log.Printf("✅ Configuration reloaded (%d settings changed: %v)", len(changed), changed)
+	return changed
+}
+
+// Handle POST /admin/config/reload, the HTTP equivalent of SIGHUP
+func (dt *SomniaStream) handleReloadConfig(c *gin.Context) {
+	changed := dt.reloadConfig()
+	c.JSON(http.StatusOK, gin.H{"reloaded": true, "changed": changed})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// rollupResolutions are the downsampling periods published on eth.rollups.<name>
+var rollupResolutions = []struct {
+	name   string
+	period time.Duration
+}{
+	{name: "1m", period: time.Minute},
+	{name: "1h", period: time.Hour},
+}
+
+// rollupBucket accumulates block data for one period
+type rollupBucket struct {
+	start         time.Time
+	firstBlock    uint64
+	lastBlock     uint64
+	sampledBlocks int
+	txCount       int
+	gasUsed       uint64
+	gasPriceSum   *big.Int
+	gasPriceCount int64
+	senders       map[string]struct{}
+}
+
+func newRollupBucket(start time.Time, blockNumber uint64) *rollupBucket {
+	return &rollupBucket{
+		start:       start,
+		firstBlock:  blockNumber,
+		lastBlock:   blockNumber,
+		gasPriceSum: new(big.Int),
+		senders:     make(map[string]struct{}),
+	}
+}
+
+// rollupEngine downsamples observed blocks into per-minute and per-hour aggregates
+type rollupEngine struct {
+	mu      sync.Mutex
+	buckets map[string]*rollupBucket
+}
+
+func newRollupEngine() *rollupEngine {
+	return &rollupEngine{buckets: make(map[string]*rollupBucket)}
+}
+
+// Add a block to the current rollup buckets, publishing any bucket the block closes
+func (dt *SomniaStream) observeRollups(block *types.Block) {
+	blockTime := time.Unix(int64(block.Time()), 0).UTC()
+	var closed []map[string]interface{}
+	var subjects []string
+
+	dt.rollups.mu.Lock()
+	for _, res := range rollupResolutions {
+		start := blockTime.Truncate(res.period)
+		bucket := dt.rollups.buckets[res.name]
+
+		if bucket != nil && start.After(bucket.start) {
+			closed = append(closed, bucket.summary(res.name, res.period))
+			subjects = append(subjects, "eth.rollups."+res.name)
+			bucket = nil
+		}
+		if bucket == nil {
+			bucket = newRollupBucket(start, block.NumberU64())
+			dt.rollups.buckets[res.name] = bucket
+		}
+		if start.Before(bucket.start) {
+			continue // Late block for an already published period
+		}
+
+		bucket.lastBlock = max(bucket.lastBlock, block.NumberU64())
+		bucket.sampledBlocks++
+		bucket.txCount += len(block.Transactions())
+		bucket.gasUsed += block.GasUsed()
+		for _, tx := range block.Transactions() {
+			bucket.gasPriceSum.Add(bucket.gasPriceSum, tx.GasPrice())
+			bucket.gasPriceCount++
+			if from, err := types.Sender(dt.signer, tx); err == nil {
+				bucket.senders[from.Hex()] = struct{}{}
+			}
+		}
+	}
+	dt.rollups.mu.Unlock()
+
+	for i, rollup := range closed {
+		data, _ := json.Marshal(rollup)
+		if err := dt.publish(subjects[i], data); err != nil {
+			log.Printf("[ROLLUP] ERROR: Failed to publish %s rollup: %v", subjects[i], err)
+			continue
+		}
+		log.Printf("[ROLLUP] Published %s rollup for %v", subjects[i], rollup["periodStart"])
+	}
+}
+
+// summary renders a closed bucket as a rollup message
+func (b *rollupBucket) summary(resolution string, period time.Duration) map[string]interface{} {
+	avgGasPrice := new(big.Int)
+	if b.gasPriceCount > 0 {
+		avgGasPrice.Div(b.gasPriceSum, big.NewInt(b.gasPriceCount))
+	}
+
+	return map[string]interface{}{
+		"resolution":      resolution,
+		"periodStart":     b.start.Unix(),
+		"periodEnd":       b.start.Add(period).Unix(),
+		"firstBlock":      b.firstBlock,
+		"lastBlock":       b.lastBlock,
+		"blockCount":      b.lastBlock - b.firstBlock + 1,
+		"sampledBlocks":   b.sampledBlocks,
+		"txCount":         b.txCount,
+		"gasUsed":         b.gasUsed,
+		"avgGasPrice":     avgGasPrice.String(),
+		"avgGasPriceGwei": weiToGwei(avgGasPrice),
+		"uniqueSenders":   len(b.senders),
+		"timestamp":       time.Now().Unix(),
+	}
+}
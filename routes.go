@@ -0,0 +1,269 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"somnia-stream/pkg/api"
+	"somnia-stream/pkg/client"
+	"somnia-stream/pkg/streams"
+)
+
+// setupRoutes registers every endpoint, documenting each in the OpenAPI spec
+// as it is registered. Every endpoint except health and admin requires a JWT
+// or API key when configured.
+func (dt *SomniaStream) setupRoutes() {
+	public := api.Documented(&dt.router.RouterGroup, dt.openapi).Group("", dt.requireAuth())
+	public.GET("/streams", api.Operation{
+		Summary:  "List the streams available to the caller",
+		Tags:     []string{"streams"},
+		Response: streamListResponse{},
+		Errors:   authErrors,
+		Security: publicSecurity,
+	}, dt.listStreams)
+	// api.GET("/ws/:stream", dt.handleWebSocketStream)
+	public.GET("/sse/:stream", api.Operation{
+		Summary: "Subscribe to a stream over Server-Sent Events",
+		Description: "Each event carries its JetStream stream sequence as the SSE id. Reconnect with Last-Event-ID to " +
+			"receive the stored messages missed in between. Slow clients receive `event: notice` frames when " +
+			"messages are dropped. With delivery=at-least-once events come from a durable consumer and are " +
+			"redelivered until acknowledged through POST /sse/ack. Built-in streams: " + strings.Join(streamNames(), ", ") + "; derived streams are also accepted.",
+		Tags: []string{"streams"},
+		Params: []api.Param{
+			{Name: "stream", In: "path", Description: "Stream name"},
+			{Name: "detail", In: "query", Description: "Block detail level, blocks stream only", Enum: []string{"header", "hashes", "full"}},
+			{Name: "Last-Event-ID", In: "header", Description: "Resume after this event ID"},
+			{Name: "lastEventId", In: "query", Description: "Same as Last-Event-ID, for clients that can't set headers"},
+			{Name: "delivery", In: "query", Description: "Delivery semantics, DELIVERY_MODE by default", Enum: []string{"at-most-once", "at-least-once"}},
+			{Name: "consumer", In: "query", Description: "At-least-once consumer name, \"default\" when omitted"},
+			{Name: "ackToken", In: "query", Description: "Ack token of an anonymous at-least-once consumer to resume, a new one is issued when omitted"},
+			{Name: "group", In: "query", Description: "Queue group; each message goes to one of the caller's connections in the group"},
+			{Name: "groupToken", In: "query", Description: "Token shared by the members of an anonymous caller's queue group, required with group without an API key or JWT"},
+			{Name: "fields", In: "query", Description: "Comma separated (dotted) fields to keep, e.g. number,hash,transactions.hash"},
+			{Name: "transform", In: "query", Description: "JMESPath-style expression applied to every message, e.g. transactions[].hash; messages it maps to null are skipped"},
+		},
+		Stream: true,
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest:         "Invalid detail level, event ID, delivery mode, consumer or group name, group token, or transform",
+			http.StatusNotFound:           "Unknown stream",
+			http.StatusConflict:           "The at-least-once consumer is already connected",
+			http.StatusServiceUnavailable: "Connection limit reached, retry after Retry-After",
+		}),
+		Security: publicSecurity,
+	}, dt.handleSSEStream)
+	public.GET("/sse", api.Operation{
+		Summary: "Subscribe to several streams over one Server-Sent Events connection",
+		Description: "Merges the listed streams into one feed. Each event's data is {\"stream\", \"id\", \"data\"}: the stream it came " +
+			"from, its JetStream stream sequence and the message. The merged feed has no SSE ids and starts at new messages.",
+		Tags: []string{"streams"},
+		Params: []api.Param{
+			{Name: "streams", In: "query", Description: "Comma separated stream names, e.g. blocks,gasPrice,logs"},
+			{Name: "fields", In: "query", Description: "Comma separated (dotted) fields to keep of every message"},
+			{Name: "transform", In: "query", Description: "JMESPath-style expression applied to every message before it is wrapped"},
+		},
+		Stream: true,
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest:         "No streams, too many streams, or an invalid transform",
+			http.StatusNotFound:           "Unknown stream",
+			http.StatusServiceUnavailable: "Connection limit reached, retry after Retry-After",
+		}),
+		Security: publicSecurity,
+	}, dt.handleMergedSSE)
+	public.GET("/ws", api.Operation{
+		Summary: "Subscribe to streams over a WebSocket",
+		Description: "Clients send JSON commands to change what they receive without reconnecting: " +
+			"{\"op\":\"subscribe\",\"stream\",\"filters\",\"lastEventId\",\"delivery\",\"consumer\"}, {\"op\":\"unsubscribe\",\"stream\"}, " +
+			"{\"op\":\"set-filter\",\"stream\",\"filters\"} and {\"op\":\"ack\",\"stream\",\"ids\"|\"upTo\"}. Each command is answered with " +
+			"an ok or error frame carrying its ref; events arrive as {\"type\":\"event\",\"stream\",\"id\",\"data\"}.",
+		Tags: []string{"streams"},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest:         "Not a WebSocket upgrade request",
+			http.StatusServiceUnavailable: "Connection limit reached, retry after Retry-After",
+		}),
+		Security: publicSecurity,
+	}, dt.handleWebSocket)
+	public.GET("/chains", api.Operation{
+		Summary: "List the monitored networks and their streams",
+		Tags:    []string{"streams"},
+		Response: struct {
+			Chains []chainStatus `json:"chains"`
+		}{},
+		Errors:   authErrors,
+		Security: publicSecurity,
+	}, dt.handleListChains)
+	// gin requires one wildcard name after /sse/, so the network segment is
+	// routed as :stream and documented as {network}
+	public.GET("/sse/:stream/:name", api.Operation{
+		Path:    "/sse/:network/:name",
+		Summary: "Subscribe to a stream of a network over Server-Sent Events",
+		Description: "Same as /sse/{stream} for the network named by the first segment: CHAIN_NAME for RPC_ENDPOINT, " +
+			"or one of CHAINS, whose streams are " + strings.Join(streams.ChainBuiltin, ", ") + ".",
+		Tags: []string{"streams"},
+		Params: []api.Param{
+			{Name: "network", In: "path", Description: "Network name, see /chains"},
+			{Name: "name", In: "path", Description: "Stream name"},
+			{Name: "detail", In: "query", Description: "Block detail level, blocks stream only", Enum: []string{"header", "hashes", "full"}},
+			{Name: "Last-Event-ID", In: "header", Description: "Resume after this event ID"},
+			{Name: "delivery", In: "query", Description: "Delivery semantics, DELIVERY_MODE by default", Enum: []string{"at-most-once", "at-least-once"}},
+			{Name: "consumer", In: "query", Description: "At-least-once consumer name, \"default\" when omitted"},
+			{Name: "ackToken", In: "query", Description: "Ack token of an anonymous at-least-once consumer to resume, a new one is issued when omitted"},
+			{Name: "group", In: "query", Description: "Queue group; each message goes to one of the caller's connections in the group"},
+			{Name: "groupToken", In: "query", Description: "Token shared by the members of an anonymous caller's queue group, required with group without an API key or JWT"},
+			{Name: "fields", In: "query", Description: "Comma separated (dotted) fields to keep, e.g. number,hash,transactions.hash"},
+			{Name: "transform", In: "query", Description: "JMESPath-style expression applied to every message, e.g. transactions[].hash; messages it maps to null are skipped"},
+		},
+		Stream: true,
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest:         "Invalid detail level, event ID, delivery mode, consumer or group name, group token, or transform",
+			http.StatusNotFound:           "Unknown network or stream",
+			http.StatusConflict:           "The at-least-once consumer is already connected",
+			http.StatusServiceUnavailable: "Connection limit reached, retry after Retry-After",
+		}),
+		Security: publicSecurity,
+	}, dt.handleChainSSEStream)
+	public.POST("/sse/ack", api.Operation{
+		Summary: "Acknowledge events of an at-least-once stream",
+		Description: "Acknowledges the listed event IDs, or every delivered event up to upTo, of the caller's consumer " +
+			"connected to the stream. Anonymous callers also send the ackToken of the connection. " +
+			"Unacknowledged events are redelivered after DELIVERY_ACK_WAIT.",
+		Tags:     []string{"streams"},
+		Body:     ackRequest{},
+		Response: ackResponse{},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest:   "Invalid body or unknown stream",
+			http.StatusUnauthorized: "An anonymous caller sent no ackToken",
+			http.StatusNotFound:     "The consumer is not connected",
+		}),
+		Security: publicSecurity,
+	}, dt.handleAck)
+	public.POST("/consume/:stream", api.Operation{
+		Summary: "Fetch a batch of stored messages from a pull consumer",
+		Description: "Creates the caller's durable pull consumer of the stream on first use, starting at startSeq or the oldest " +
+			"stored message, and returns up to batch messages, waiting up to wait for the first one. Messages stay pending " +
+			"until acknowledged through POST /consume/{stream}/ack and are fetched again after DELIVERY_ACK_WAIT otherwise.",
+		Tags:     []string{"streams"},
+		Params:   []api.Param{{Name: "stream", In: "path", Description: "Stream name"}},
+		Body:     consumeRequest{},
+		Response: consumeResponse{},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest: "Invalid body or consumer name",
+			http.StatusNotFound:   "Unknown stream",
+		}),
+		Security: publicSecurity,
+	}, dt.handleConsume)
+	public.POST("/consume/:stream/ack", api.Operation{
+		Summary:     "Acknowledge messages fetched from a pull consumer",
+		Description: "Acknowledges the listed message IDs, or every fetched message up to upTo, and hands the IDs in nak back for redelivery.",
+		Tags:        []string{"streams"},
+		Params:      []api.Param{{Name: "stream", In: "path", Description: "Stream name"}},
+		Body:        consumeAckRequest{},
+		Response:    consumeAckResponse{},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest: "Invalid body or consumer name",
+			http.StatusNotFound:   "Unknown stream, or no messages were fetched from the consumer",
+		}),
+		Security: publicSecurity,
+	}, dt.handleConsumeAck)
+	public.GET("/streams/:name/stats", api.Operation{
+		Summary:  "Storage and consumer statistics of a stream",
+		Tags:     []string{"streams"},
+		Errors:   mergeErrors(authErrors, map[int]string{http.StatusNotFound: "Unknown stream"}),
+		Security: publicSecurity,
+	}, dt.handleStreamStats)
+	public.GET("/tx/:hash", api.Operation{
+		Summary:  "Latest known state of a transaction",
+		Tags:     []string{"transactions"},
+		Params:   []api.Param{{Name: "hash", In: "path", Description: "0x-prefixed transaction hash"}},
+		Response: client.TxStatus{},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest: "Invalid transaction hash",
+			http.StatusNotFound:   "Transaction unknown to the node and the lifecycle store",
+		}),
+		Security: publicSecurity,
+	}, dt.requireScope(scopeReadTx), dt.handleTxStatus)
+	public.POST("/tx", api.Operation{
+		Summary: "Relay a signed raw transaction",
+		Description: "Sends the transaction with eth_sendRawTransaction and enrolls its hash in lifecycle tracking, " +
+			"so it can be followed on the lifecycle stream or with GET /tx/{hash}. API keys need the write:tx scope.",
+		Tags:     []string{"transactions"},
+		Body:     relayRequest{},
+		Response: relayResponse{},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest: "Invalid transaction, or the node rejected it",
+			http.StatusBadGateway: "Node unavailable",
+		}),
+		Security: publicSecurity,
+	}, dt.requireScope(scopeWriteTx), dt.handleSendRawTx)
+	public.GET("/gas/history", api.Operation{
+		Summary: "Gas price or base fee percentiles over a window",
+		Tags:    []string{"gas"},
+		Params: []api.Param{
+			{Name: "window", In: "query", Description: "Duration to look back, default 1h"},
+			{Name: "percentiles", In: "query", Description: "Comma separated percentiles, default 25,50,95"},
+			{Name: "interval", In: "query", Description: "Bucket size of an optional series"},
+			{Name: "source", In: "query", Enum: []string{"gasPrice", "basefee"}},
+		},
+		Response: client.GasHistory{},
+		Errors:   mergeErrors(authErrors, map[int]string{http.StatusBadRequest: "Invalid query parameter"}),
+		Security: publicSecurity,
+	}, dt.requireScope(scopeReadHistory), dt.handleGasHistory)
+	public.POST("/call", api.Operation{
+		Summary: "Read-only eth_call proxy",
+		Description: "Runs eth_call on the node without exposing its RPC credentials. Calls are rate limited per API key, " +
+			"JWT subject or client IP by CALL_RATE_LIMIT; results at latest or a numbered block are cached by block number.",
+		Tags:     []string{"calls"},
+		Body:     callRequest{},
+		Response: callResponse{},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest: "Invalid call, or the node rejected it (reverts carry the revert data)",
+			http.StatusBadGateway: "Node unavailable",
+		}),
+		Security: publicSecurity,
+	}, dt.requireScope(scopeReadCall), dt.rateLimitCalls(), dt.handleCall)
+	public.POST("/simulate", api.Operation{
+		Summary: "Preview a transaction at a block",
+		Description: "Runs the transaction with eth_call, eth_estimateGas and debug_traceCall at the chosen block and returns " +
+			"the outcome, revert reason, gas estimate, emitted logs and state changes. Logs and state changes need the node's " +
+			"debug API; without it traceError is set. Shares the CALL_RATE_LIMIT of /call.",
+		Tags:     []string{"calls"},
+		Body:     callRequest{},
+		Response: simulationResult{},
+		Errors: mergeErrors(authErrors, map[int]string{
+			http.StatusBadRequest: "Invalid transaction or block",
+			http.StatusBadGateway: "Node unavailable",
+		}),
+		Security: publicSecurity,
+	}, dt.requireScope(scopeReadCall), dt.rateLimitCalls(), dt.handleSimulate)
+
+	// Health, probe, version and API description endpoints are served on the admin listener as well
+	routers := []*gin.Engine{dt.router}
+	if dt.adminAPI != dt.router {
+		routers = append(routers, dt.adminAPI)
+	}
+	for _, router := range routers {
+		routes := api.Documented(&router.RouterGroup, dt.openapi)
+		routes.GET("/health", api.Operation{
+			Summary: "Component health of RPC, NATS and JetStream",
+			Tags:    []string{"operations"},
+			Errors:  map[int]string{http.StatusServiceUnavailable: "A component is degraded or down"},
+		}, dt.handleHealth)
+		routes.GET("/healthz", api.Operation{Summary: "Liveness probe", Tags: []string{"operations"}}, dt.handleLiveness)
+		routes.GET("/readyz", api.Operation{
+			Summary: "Readiness probe",
+			Tags:    []string{"operations"},
+			Errors:  map[int]string{http.StatusServiceUnavailable: "Not ready to serve traffic"},
+		}, dt.handleReadiness)
+		routes.GET("/version", api.Operation{Summary: "Build information and enabled features", Tags: []string{"operations"}}, dt.handleVersion)
+		routes.GET("/metrics", api.Operation{
+			Summary:     "Prometheus metrics",
+			Description: "Served in the Prometheus text exposition format.",
+			Tags:        []string{"operations"},
+		}, dt.handleMetrics())
+		routes.GET("/openapi.json", api.Operation{Summary: "This OpenAPI document", Tags: []string{"operations"}}, dt.openapi.ServeSpec)
+		router.GET("/docs", api.SwaggerUI("/openapi.json"))
+	}
+	dt.setupAdminRoutes()
+	dt.setupDashboard()
+}
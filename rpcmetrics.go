@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"somnia-stream/pkg/streams"
+)
+
+// rpcLatencySamples bounds the latency samples kept per method and interval
+const rpcLatencySamples = 2048
+
+// rpcMethodStats accumulates the calls of one RPC method during an interval
+type rpcMethodStats struct {
+	calls   uint64
+	errors  uint64
+	retries uint64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration // Ring of the most recent latencies, for percentiles
+	next    int
+}
+
+func (s *rpcMethodStats) observe(latency time.Duration, retries int, failed bool) {
+	s.calls++
+	s.retries += uint64(retries)
+	if failed {
+		s.errors++
+	}
+	s.total += latency
+	if latency > s.max {
+		s.max = latency
+	}
+	if len(s.samples) < rpcLatencySamples {
+		s.samples = append(s.samples, latency)
+	} else {
+		s.samples[s.next] = latency
+		s.next = (s.next + 1) % rpcLatencySamples
+	}
+}
+
+// summary returns the published form of the interval stats
+func (s *rpcMethodStats) summary() map[string]interface{} {
+	sorted := append([]time.Duration(nil), s.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return millis(sorted[int(p*float64(len(sorted)-1))])
+	}
+
+	var avg time.Duration
+	if s.calls > 0 {
+		avg = s.total / time.Duration(s.calls)
+	}
+	return map[string]interface{}{
+		"calls":        s.calls,
+		"errors":       s.errors,
+		"retries":      s.retries,
+		"errorRate":    float64(s.errors) / float64(max(s.calls, 1)),
+		"avgLatencyMs": millis(avg),
+		"p50LatencyMs": percentile(0.5),
+		"p95LatencyMs": percentile(0.95),
+		"p99LatencyMs": percentile(0.99),
+		"maxLatencyMs": millis(s.max),
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// rpcTelemetry records the latency and outcome of every RPC request, as seen
+// by the caller including retries. Interval stats are published on
+// somnia.rpc.metrics; cumulative ones are exported to Prometheus.
+type rpcTelemetry struct {
+	endpoint string // Host of the RPC endpoint, without path or credentials
+
+	mu            sync.Mutex
+	intervalStart time.Time
+	current       map[string]*rpcMethodStats
+
+	registry *prometheus.Registry
+	latency  *prometheus.HistogramVec
+	requests *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+}
+
+// endpointHost strips the scheme, path and credentials from an RPC endpoint,
+// which often carry provider API keys
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return endpoint
+}
+
+func newRPCTelemetry(endpoint string) *rpcTelemetry {
+	m := &rpcTelemetry{
+		endpoint:      endpointHost(endpoint),
+		intervalStart: time.Now(),
+		current:       make(map[string]*rpcMethodStats),
+		registry:      prometheus.NewRegistry(),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "somnia_rpc_request_duration_seconds",
+			Help:    "RPC request latency by method, including retries.",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"endpoint", "method"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "somnia_rpc_requests_total",
+			Help: "RPC requests by method and outcome (ok or error).",
+		}, []string{"endpoint", "method", "outcome"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "somnia_rpc_retries_total",
+			Help: "RPC request retries by method.",
+		}, []string{"endpoint", "method"}),
+	}
+	m.registry.MustRegister(
+		m.latency, m.requests, m.retries,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// forEndpoint returns telemetry for another endpoint exported through the
+// same Prometheus collectors; its interval stats aren't published
+func (m *rpcTelemetry) forEndpoint(endpoint string) *rpcTelemetry {
+	return &rpcTelemetry{
+		endpoint:      endpointHost(endpoint),
+		intervalStart: time.Now(),
+		current:       make(map[string]*rpcMethodStats),
+		registry:      m.registry,
+		latency:       m.latency,
+		requests:      m.requests,
+		retries:       m.retries,
+	}
+}
+
+// observe records one finished RPC request
+func (m *rpcTelemetry) observe(method string, latency time.Duration, retries int, failed bool) {
+	m.mu.Lock()
+	stats, ok := m.current[method]
+	if !ok {
+		stats = &rpcMethodStats{}
+		m.current[method] = stats
+	}
+	stats.observe(latency, retries, failed)
+	m.mu.Unlock()
+
+	outcome := "ok"
+	if failed {
+		outcome = "error"
+	}
+	m.latency.WithLabelValues(m.endpoint, method).Observe(latency.Seconds())
+	m.requests.WithLabelValues(m.endpoint, method, outcome).Inc()
+	if retries > 0 {
+		m.retries.WithLabelValues(m.endpoint, method).Add(float64(retries))
+	}
+}
+
+// rotate closes the current interval and returns its stats
+func (m *rpcTelemetry) rotate() (time.Time, time.Time, map[string]*rpcMethodStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start, end, interval := m.intervalStart, time.Now(), m.current
+	m.current = make(map[string]*rpcMethodStats)
+	m.intervalStart = end
+	return start, end, interval
+}
+
+// Periodically publish the RPC stats of the elapsed interval on somnia.rpc.metrics
+func (dt *SomniaStream) runRPCMetrics(ctx context.Context) {
+	ticker := time.NewTicker(dt.config().RPCMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dt.publishRPCMetrics()
+		}
+	}
+}
+
+func (dt *SomniaStream) publishRPCMetrics() {
+	start, end, interval := dt.telemetry.rotate()
+	if len(interval) == 0 {
+		return
+	}
+
+	var calls, errors uint64
+	methods := make(map[string]interface{}, len(interval))
+	for method, stats := range interval {
+		calls += stats.calls
+		errors += stats.errors
+		methods[method] = stats.summary()
+	}
+	circuit, _ := dt.rpcRetry.breaker.status()
+
+	event := map[string]interface{}{
+		"endpoint":      dt.telemetry.endpoint,
+		"calls":         calls,
+		"errors":        errors,
+		"errorRate":     float64(errors) / float64(max(calls, 1)),
+		"circuit":       circuit,
+		"methods":       methods,
+		"intervalStart": start.Unix(),
+		"intervalEnd":   end.Unix(),
+		"timestamp":     time.Now().Unix(),
+	}
+	data, _ := json.Marshal(event)
+	if err := dt.publish(streams.RPCMetricsSubject, data); err != nil {
+		log.Printf("[RPC] ERROR: Failed to publish RPC metrics: %v", err)
+	}
+}
+
+// Handle GET /metrics in the Prometheus text format
+func (dt *SomniaStream) handleMetrics() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(dt.telemetry.registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"somnia-stream/pkg/config"
+)
+
+// rpcExchange is one recorded RPC request and the raw response to it, stored
+// one per line in the recording file
+type rpcExchange struct {
+	At       time.Time       `json:"at"`
+	Method   string          `json:"method"`
+	Request  json.RawMessage `json:"request"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Text     string          `json:"text,omitempty"` // Response body that isn't JSON, e.g. a proxy error page
+}
+
+// setupRPCRecording records or replays the RPC traffic below the retry
+// transport, so replays exercise retries, metrics and decoding exactly like
+// the recorded run
+func setupRPCRecording(cfg *config.Config, transport *rpcRetryTransport) error {
+	if cfg.RPCRecordFile == "" && cfg.RPCReplayFile == "" {
+		return nil
+	}
+	switch {
+	case cfg.RPCRecordFile != "" && cfg.RPCReplayFile != "":
+		return errors.New("RPC_RECORD_FILE and RPC_REPLAY_FILE can't be used together")
+	case cfg.RPCReplayFile != "" && cfg.MockRPC:
+		return errors.New("RPC_REPLAY_FILE can't be used with the mock chain")
+	case !strings.HasPrefix(cfg.RPCEndpoint, "http://") && !strings.HasPrefix(cfg.RPCEndpoint, "https://"):
+		return fmt.Errorf("recording and replaying RPC traffic needs an HTTP(S) RPC_ENDPOINT, got %s", cfg.RPCEndpoint)
+	}
+
+	// Only the HTTP traffic is captured: pending transactions are polled
+	// instead of subscribed to, and the peer and consistency providers are skipped
+	cfg.PendingWSEndpoint = ""
+	if cfg.RPCReplayFile != "" {
+		cfg.RPCPeerEndpoints = nil
+		cfg.ConsistencyEndpoint = ""
+	}
+
+	if cfg.RPCRecordFile != "" {
+		recorder, err := newRPCRecorder(cfg.RPCRecordFile, transport.next)
+		if err != nil {
+			return err
+		}
+		transport.next = recorder
+		log.Printf("[RPC] Recording RPC responses to %s", cfg.RPCRecordFile)
+		return nil
+	}
+
+	replayer, err := loadRPCReplay(cfg.RPCReplayFile)
+	if err != nil {
+		return err
+	}
+	transport.next = replayer
+	log.Printf("[RPC] Replaying %d recorded RPC responses from %s instead of calling %s", replayer.remaining, cfg.RPCReplayFile, cfg.RPCEndpoint)
+	return nil
+}
+
+// rpcRecorder appends every RPC exchange to a file. Entries are written
+// unbuffered so a killed process leaves a usable recording.
+type rpcRecorder struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newRPCRecorder(path string, next http.RoundTripper) (*rpcRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RPC recording: %v", err)
+	}
+	return &rpcRecorder{next: next, file: file}, nil
+}
+
+func (r *rpcRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err // Connection errors have no response to replay
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	exchange := rpcExchange{At: time.Now().UTC(), Method: rpcMethod(body), Request: compactJSON(body), Status: resp.StatusCode}
+	if json.Valid(respBody) {
+		exchange.Response = compactJSON(respBody)
+	} else {
+		exchange.Text = string(respBody)
+	}
+	line, _ := json.Marshal(exchange)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		log.Printf("[RPC] ERROR: Failed to record %s response: %v", exchange.Method, err)
+	}
+	return resp, nil
+}
+
+// rpcReplayer answers RPC requests from a recording. Identical requests
+// (ignoring JSON-RPC ids) get their recorded responses in the recorded order;
+// once those run out the last one is repeated, as if the chain stood still.
+type rpcReplayer struct {
+	mu        sync.Mutex
+	queues    map[string][]rpcExchange
+	last      map[string]rpcExchange
+	remaining int
+}
+
+func loadRPCReplay(path string) (*rpcReplayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RPC recording: %v", err)
+	}
+	defer file.Close()
+
+	r := &rpcReplayer{queues: make(map[string][]rpcExchange), last: make(map[string]rpcExchange)}
+	dec := json.NewDecoder(file)
+	for line := 1; dec.More(); line++ {
+		var exchange rpcExchange
+		if err := dec.Decode(&exchange); err != nil {
+			return nil, fmt.Errorf("invalid RPC recording entry %d: %v", line, err)
+		}
+		key, err := rpcRequestKey(exchange.Request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request in RPC recording entry %d: %v", line, err)
+		}
+		r.queues[key] = append(r.queues[key], exchange)
+		r.remaining++
+	}
+	if r.remaining == 0 {
+		return nil, fmt.Errorf("RPC recording %s is empty", path)
+	}
+	return r, nil
+}
+
+func (r *rpcReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	key, err := rpcRequestKey(body)
+	if err != nil {
+		return nil, err
+	}
+
+	exchange, ok := r.next(key)
+	if !ok {
+		return replayResponse(req, http.StatusNotFound, "text/plain", []byte("no recorded response for "+rpcMethod(body))), nil
+	}
+	if exchange.Response == nil {
+		return replayResponse(req, exchange.Status, "text/plain", []byte(exchange.Text)), nil
+	}
+	return replayResponse(req, exchange.Status, "application/json", withRequestIDs(exchange.Request, body, exchange.Response)), nil
+}
+
+// next pops the next recorded exchange of a request
+func (r *rpcReplayer) next(key string) (rpcExchange, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queue := r.queues[key]
+	if len(queue) == 0 {
+		exchange, ok := r.last[key]
+		return exchange, ok
+	}
+	exchange := queue[0]
+	r.queues[key] = queue[1:]
+	r.last[key] = exchange
+	if r.remaining--; r.remaining == 0 {
+		log.Printf("[RPC] Replay finished, every recorded response has been served; repeating the last ones")
+	}
+	return exchange, true
+}
+
+func replayResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// rpcCall is the part of a JSON-RPC request that identifies it
+type rpcCall struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// parseRPCCalls decodes a single or batch JSON-RPC request
+func parseRPCCalls(body []byte) ([]rpcCall, error) {
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("[")) {
+		var calls []rpcCall
+		err := json.Unmarshal(body, &calls)
+		return calls, err
+	}
+	var call rpcCall
+	err := json.Unmarshal(body, &call)
+	return []rpcCall{call}, err
+}
+
+// rpcRequestKey identifies a request by its methods and parameters, ignoring ids
+func rpcRequestKey(body []byte) (string, error) {
+	calls, err := parseRPCCalls(body)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(calls))
+	for i, call := range calls {
+		parts[i] = call.Method + string(compactJSON(call.Params))
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+// withRequestIDs rewrites the ids of a recorded response to those of the
+// request being answered, matching batch elements by their recorded ids
+func withRequestIDs(recordedReq, req, resp []byte) []byte {
+	recorded, err1 := parseRPCCalls(recordedReq)
+	current, err2 := parseRPCCalls(req)
+	if err1 != nil || err2 != nil || len(recorded) != len(current) {
+		return resp
+	}
+	rewrite := func(element map[string]json.RawMessage) {
+		for i, call := range recorded {
+			if bytes.Equal(call.ID, element["id"]) {
+				element["id"] = current[i].ID
+				return
+			}
+		}
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(resp), []byte("[")) {
+		var elements []map[string]json.RawMessage
+		if json.Unmarshal(resp, &elements) != nil {
+			return resp
+		}
+		for _, element := range elements {
+			rewrite(element)
+		}
+		out, _ := json.Marshal(elements)
+		return out
+	}
+	var element map[string]json.RawMessage
+	if json.Unmarshal(resp, &element) != nil {
+		return resp
+	}
+	rewrite(element)
+	out, _ := json.Marshal(element)
+	return out
+}
+
+// compactJSON strips insignificant whitespace, leaving invalid JSON as is
+func compactJSON(data []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if json.Compact(&buf, data) != nil {
+		return data
+	}
+	return buf.Bytes()
+}
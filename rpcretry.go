@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"somnia-stream/pkg/config"
+)
+
+// rpcRetryPolicy controls how RPC requests are retried
+type rpcRetryPolicy struct {
+	attempts       int           // Total attempts per request
+	backoff        time.Duration // Delay before the first retry, doubled per attempt
+	maxBackoff     time.Duration // Upper bound of a single delay
+	jitter         float64       // Fraction of each delay that is randomized (0-1)
+	attemptTimeout time.Duration // Timeout of one attempt (0 = the caller's context only)
+	retryCodes     map[int]bool  // JSON-RPC error codes worth retrying
+}
+
+func rpcRetryPolicyFromConfig(cfg *config.Config) *rpcRetryPolicy {
+	codes := make(map[int]bool, len(cfg.RPCRetryCodes))
+	for _, code := range cfg.RPCRetryCodes {
+		if n, err := strconv.Atoi(code); err == nil {
+			codes[n] = true
+		}
+	}
+	return &rpcRetryPolicy{
+		attempts:       max(cfg.RPCRetryAttempts, 1),
+		backoff:        cfg.RPCRetryBackoff,
+		maxBackoff:     cfg.RPCRetryMaxBackoff,
+		jitter:         math.Min(math.Max(cfg.RPCRetryJitter, 0), 1),
+		attemptTimeout: cfg.RPCAttemptTimeout,
+		retryCodes:     codes,
+	}
+}
+
+// delay returns the jittered backoff before retry number n (starting at 1)
+func (p *rpcRetryPolicy) delay(n int) time.Duration {
+	d := float64(p.backoff) * math.Pow(2, float64(n-1))
+	if p.maxBackoff > 0 {
+		d = math.Min(d, float64(p.maxBackoff))
+	}
+	d *= 1 - p.jitter*rand.Float64()
+	return time.Duration(d)
+}
+
+// retryableStatus lists HTTP statuses that indicate a transient upstream problem
+var retryableStatus = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooEarly:            true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// rpcRetryTransport retries JSON-RPC requests over HTTP on network errors,
+// timeouts, retryable HTTP statuses and retryable JSON-RPC error codes, with
+// exponential backoff and jitter. It sits under both the raw RPC client and
+// the ethclient, so every call is covered. Requests that still fail feed the
+// circuit breaker, which rejects requests outright while open. The outcome
+// and latency of every request are recorded in the RPC telemetry.
+type rpcRetryTransport struct {
+	next    http.RoundTripper
+	policy  atomic.Pointer[rpcRetryPolicy]
+	breaker *circuitBreaker
+	metrics *rpcTelemetry
+}
+
+func newRPCRetryTransport(policy *rpcRetryPolicy, breaker *circuitBreaker, metrics *rpcTelemetry) *rpcRetryTransport {
+	t := &rpcRetryTransport{next: http.DefaultTransport, breaker: breaker, metrics: metrics}
+	t.policy.Store(policy)
+	return t
+}
+
+// setPolicy swaps the retry policy on configuration reload
+func (t *rpcRetryTransport) setPolicy(policy *rpcRetryPolicy) {
+	t.policy.Store(policy)
+}
+
+func (t *rpcRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+	policy := t.policy.Load()
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	method := rpcMethod(body)
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		resp, reason, err := t.attempt(req, body, policy)
+		if reason == "" || attempt >= policy.attempts || req.Context().Err() != nil {
+			if reason != "" || err != nil {
+				t.breaker.failure()
+			} else {
+				t.breaker.success()
+			}
+			failed := reason != "" || err != nil || resp.StatusCode != http.StatusOK
+			t.metrics.observe(method, time.Since(start), attempt-1, failed)
+			return resp, err
+		}
+
+		delay := policy.delay(attempt)
+		if resp != nil {
+			// Honour Retry-After from rate limiting providers, within the backoff cap
+			if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				delay = time.Duration(seconds) * time.Second
+				if policy.maxBackoff > 0 && delay > policy.maxBackoff {
+					delay = policy.maxBackoff
+				}
+			}
+			resp.Body.Close()
+		}
+		log.Printf("[RPC] Retrying %s (attempt %d/%d) in %s: %s", method, attempt+1, policy.attempts, delay.Round(time.Millisecond), reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			t.breaker.failure()
+			t.metrics.observe(method, time.Since(start), attempt-1, true)
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt performs one request and returns the retry reason when it failed transiently
+func (t *rpcRetryTransport) attempt(req *http.Request, body []byte, policy *rpcRetryPolicy) (*http.Response, string, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if policy.attemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, policy.attemptTimeout)
+	}
+	defer cancel()
+
+	attemptReq := req.Clone(ctx)
+	attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+	attemptReq.ContentLength = int64(len(body))
+
+	resp, err := t.next.RoundTrip(attemptReq)
+	if err != nil {
+		if req.Context().Err() != nil {
+			return nil, "", err // The caller gave up; don't retry
+		}
+		return nil, err.Error(), err
+	}
+
+	// Read the body while the attempt context is alive and classify JSON-RPC errors
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		if req.Context().Err() != nil {
+			return nil, "", err
+		}
+		return nil, "reading response: " + err.Error(), err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if retryableStatus[resp.StatusCode] {
+		return resp, resp.Status, nil
+	}
+	if resp.StatusCode == http.StatusOK {
+		if code, message, ok := rpcErrorCode(respBody); ok && policy.retryCodes[code] {
+			return resp, fmt.Sprintf("JSON-RPC error %d: %s", code, message), nil
+		}
+	}
+	return resp, "", nil
+}
+
+// rpcMethod extracts the method name of a JSON-RPC request for logging
+func rpcMethod(body []byte) string {
+	var single struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &single); err == nil && single.Method != "" {
+		return single.Method
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		return "batch"
+	}
+	return "request"
+}
+
+// rpcErrorCode returns the error code of a single JSON-RPC error response
+func rpcErrorCode(body []byte) (int, string, bool) {
+	var resp struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error == nil {
+		return 0, "", false
+	}
+	return resp.Error.Code, resp.Error.Message, true
+}
+
+// dialRPC connects to an RPC endpoint. HTTP(S) endpoints get the retrying transport.
+func dialRPC(endpoint string, transport *rpcRetryTransport) (*rpc.Client, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		log.Printf("[RPC] Retries are not applied to non-HTTP endpoint %s", endpoint)
+		return rpc.Dial(endpoint)
+	}
+	return rpc.DialOptions(context.Background(), endpoint, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+}
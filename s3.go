@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"somnia-stream/pkg/config"
+)
+
+// errS3NotFound is returned for objects that don't exist
+var errS3NotFound = errors.New("s3 object not found")
+
+// s3Client reads and writes objects of an S3 or S3-compatible bucket, signing
+// the requests with AWS Signature Version 4. Objects are addressed
+// path-style, which AWS and MinIO both accept.
+type s3Client struct {
+	endpoint     string
+	region       string
+	bucket       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// newS3Client returns a client of a bucket at S3_ENDPOINT, or nil when the
+// bucket is empty
+func newS3Client(cfg *config.Config, bucket, prefix string) *s3Client {
+	if bucket == "" {
+		return nil
+	}
+	endpoint := strings.TrimRight(cfg.S3Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.S3Region + ".amazonaws.com"
+	}
+	return &s3Client{
+		endpoint:     endpoint,
+		region:       cfg.S3Region,
+		bucket:       bucket,
+		prefix:       prefix,
+		accessKey:    cfg.AWSAccessKeyID,
+		secretKey:    cfg.AWSSecretKey,
+		sessionToken: cfg.AWSSessionToken,
+		client:       &http.Client{Timeout: time.Minute},
+	}
+}
+
+// put uploads an object under the key prefix
+func (s *s3Client) put(ctx context.Context, key, contentType string, body []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, contentType, body)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// get downloads an object under the key prefix, failing with errS3NotFound
+// when it doesn't exist
+func (s *s3Client) get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// do sends a signed request for an object and checks its status
+func (s *s3Client) do(ctx context.Context, method, key, contentType string, body []byte) (*http.Response, error) {
+	path := "/" + s.bucket + "/" + s3EscapePath(s.prefix+key)
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, path, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errS3NotFound
+		}
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(message))
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 headers of a request
+func (s *s3Client) sign(req *http.Request, path string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	var headers []string
+	if req.Header.Get("Content-Type") != "" {
+		headers = append(headers, "content-type")
+	}
+	headers = append(headers, "host", "x-amz-content-sha256", "x-amz-date")
+	if s.sessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, path, "", canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath percent-encodes an object key as Signature Version 4 expects,
+// keeping the slashes
+func s3EscapePath(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', strings.IndexByte("-._~/", b) >= 0:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
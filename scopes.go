@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultKeyScopes apply to API keys created without explicit scopes
+var defaultKeyScopes = []string{"read:*"}
+
+// Scopes that guard endpoints which are not tied to a single stream
+const (
+	scopeReadTx      = "read:tx"
+	scopeReadHistory = "read:history"
+	scopeReadCall    = "read:call"
+	scopeWriteTx     = "write:tx"
+)
+
+// adminScopes lists the admin scope of each admin route group
+var adminScopes = []string{"admin:monitors", "admin:config", "admin:streams", "admin:clients", "admin:keys", "admin:usage", "admin:dlq", "admin:chaos", "admin:abis", "admin:state"}
+
+// validateScopes checks scope syntax: read:<stream|subject|*>, read:tx,
+// read:history, read:call, write:tx, admin:<area> or admin:*
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		kind, target, ok := strings.Cut(scope, ":")
+		if !ok || target == "" {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+		switch kind {
+		case "read":
+		case "write":
+			if target != "tx" && target != "*" {
+				return fmt.Errorf("unknown write scope %q", scope)
+			}
+		case "admin":
+			if target == "*" {
+				continue
+			}
+			known := false
+			for _, s := range adminScopes {
+				known = known || s == scope
+			}
+			if !known {
+				return fmt.Errorf("unknown admin scope %q", scope)
+			}
+		default:
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// effectiveScopes returns the scopes of a key, falling back to read-only access
+func (k *apiKey) effectiveScopes() []string {
+	if len(k.Scopes) == 0 {
+		return defaultKeyScopes
+	}
+	return k.Scopes
+}
+
+// hasScope reports whether the key grants a scope directly or through a wildcard
+func (k *apiKey) hasScope(required string) bool {
+	kind, _, _ := strings.Cut(required, ":")
+	for _, scope := range k.effectiveScopes() {
+		if scope == required || scope == kind+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsStream reports whether the key may read a stream, granted either by
+// name (read:blocks) or by a NATS subject pattern (read:eth.blocks.>)
+func (k *apiKey) allowsStream(stream, subject string) bool {
+	for _, scope := range k.effectiveScopes() {
+		target, ok := strings.CutPrefix(scope, "read:")
+		if !ok {
+			continue
+		}
+		if target == "*" || target == stream || (subject != "" && subjectMatches(target, subject)) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectMatches matches a NATS subject against a pattern with * and > wildcards
+func subjectMatches(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// requestKey returns the authenticated API key of a request, if any
+func requestKey(c *gin.Context) (*apiKey, bool) {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return nil, false
+	}
+	return value.(*apiKey), true
+}
+
+// requireScope rejects API keys lacking a scope; other callers pass through
+func (dt *SomniaStream) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := requestKey(c); ok && !key.hasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"somnia-stream/pkg/selectors"
+)
+
+// Selectors 4byte.directory doesn't know are asked again after a day
+const selectorMissTTL = 24 * time.Hour
+
+// selectorDecoder annotates transactions with the method their input data
+// calls. Unknown selectors are looked up in the background when
+// SELECTOR_LOOKUP_URL is set, so publishing never waits on the lookup.
+type selectorDecoder struct {
+	db        *selectors.DB
+	lookupURL string
+	client    *http.Client
+
+	mu      sync.Mutex
+	queued  map[string]bool
+	misses  map[string]time.Time // Unknown selectors and when to ask again
+	lookups chan string
+}
+
+// newSelectorDecoder returns a decoder seeded with common signatures and the
+// overrides in SELECTOR_FILE, or nil when decoding is disabled
+func newSelectorDecoder(enabled bool, file, lookupURL string) (*selectorDecoder, error) {
+	if !enabled {
+		return nil, nil
+	}
+	d := &selectorDecoder{
+		db:        selectors.NewDB(),
+		lookupURL: lookupURL,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		queued:    make(map[string]bool),
+		misses:    make(map[string]time.Time),
+		lookups:   make(chan string, 256),
+	}
+	if err := d.loadFile(file); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// loadFile applies the overrides in a signature file, if any
+func (d *selectorDecoder) loadFile(file string) error {
+	if d == nil || file == "" {
+		return nil
+	}
+	count, err := d.db.LoadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to load selector file %s: %v", file, err)
+	}
+	log.Printf("[SELECTORS] Loaded %d signatures from %s (%d known)", count, file, d.db.Len())
+	return nil
+}
+
+// annotate adds methodId, method, methodSignature and methodArgs to
+// transactions, reading the selector from methodId or the input data
+func (d *selectorDecoder) annotate(txs []map[string]interface{}) {
+	if d == nil {
+		return
+	}
+	for _, tx := range txs {
+		selector, _ := tx["methodId"].(string)
+		if selector == "" {
+			input, _ := tx["input"].(string)
+			if len(input) < 10 || !strings.HasPrefix(input, "0x") {
+				continue
+			}
+			selector = strings.ToLower(input[:10])
+			tx["methodId"] = selector
+		}
+		sig, ok := d.db.Lookup(selector)
+		if !ok {
+			d.queue(selector)
+			continue
+		}
+		tx["method"] = sig.Name
+		tx["methodSignature"] = sig.Text
+		tx["methodArgs"] = sig.Args
+	}
+}
+
+// queue schedules a background lookup of an unknown selector
+func (d *selectorDecoder) queue(selector string) {
+	if d.lookupURL == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.queued[selector] || time.Now().Before(d.misses[selector]) {
+		return
+	}
+	select {
+	case d.lookups <- selector:
+		d.queued[selector] = true
+	default: // Queued again the next time it is seen
+	}
+}
+
+// run looks up queued selectors until ctx is done
+func (d *selectorDecoder) run(ctx context.Context) {
+	if d == nil || d.lookupURL == "" {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case selector := <-d.lookups:
+			sig, found, err := d.fetch(ctx, selector)
+			d.mu.Lock()
+			delete(d.queued, selector)
+			if err == nil && !found {
+				d.misses[selector] = time.Now().Add(selectorMissTTL)
+			}
+			d.mu.Unlock()
+			switch {
+			case err != nil:
+				log.Printf("[SELECTORS] WARNING: Failed to look up %s: %v", selector, err)
+			case found:
+				d.db.Add(sig, false)
+				log.Printf("[SELECTORS] Resolved %s to %s", selector, sig.Text)
+			}
+		}
+	}
+}
+
+// fetch asks a 4byte.directory compatible API for the signature of a
+// selector, taking the oldest submission matching it
+func (d *selectorDecoder) fetch(ctx context.Context, selector string) (selectors.Signature, bool, error) {
+	query := url.Values{"hex_signature": {selector}, "ordering": {"created_at"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.lookupURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return selectors.Signature{}, false, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return selectors.Signature{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return selectors.Signature{}, false, fmt.Errorf("lookup returned %s", resp.Status)
+	}
+
+	var page struct {
+		Results []struct {
+			TextSignature string `json:"text_signature"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return selectors.Signature{}, false, fmt.Errorf("invalid lookup response: %v", err)
+	}
+	for _, result := range page.Results {
+		// Never trust a submission whose hash doesn't match the selector
+		if sig, err := selectors.Parse(result.TextSignature); err == nil && sig.Selector == selector {
+			return sig, true, nil
+		}
+	}
+	return selectors.Signature{}, false, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/acme/autocert"
+
+	"somnia-stream/pkg/api"
+)
+
+// listenerSet is a group of addresses serving the same router
+type listenerSet struct {
+	name    string
+	addrs   []string
+	handler *gin.Engine
+}
+
+// serve runs the public API listeners and, when ADMIN_LISTEN is set, the
+// separate admin listeners until ctx is cancelled. TCP listeners use TLS when a
+// certificate or autocert domains are configured; Unix sockets are always plain.
+func (dt *SomniaStream) serve(ctx context.Context) error {
+	cfg := dt.config()
+
+	tlsConfig, err := dt.serverTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	publicAddrs := cfg.ServerListen
+	if len(publicAddrs) == 0 {
+		publicAddrs = []string{":" + cfg.ServerPort}
+	}
+	sets := []listenerSet{{name: "API", addrs: publicAddrs, handler: dt.router}}
+	if dt.adminAPI != dt.router {
+		sets = append(sets, listenerSet{name: "admin", addrs: cfg.AdminListen, handler: dt.adminAPI})
+	}
+
+	var servers []*http.Server
+	errCh := make(chan error, len(publicAddrs)+len(cfg.AdminListen))
+	for _, set := range sets {
+		for _, addr := range set.addrs {
+			ln, unix, err := api.Listen(addr)
+			if err != nil {
+				shutdownServers(servers)
+				return err
+			}
+
+			// No WriteTimeout: SSE responses stay open for as long as the client listens
+			server := &http.Server{
+				Handler:           set.handler,
+				ReadHeaderTimeout: 10 * time.Second,
+				IdleTimeout:       2 * time.Minute,
+			}
+			servers = append(servers, server)
+
+			if tlsConfig != nil && !unix {
+				server.TLSConfig = tlsConfig.Clone()
+				log.Printf("Starting HTTPS %s listener on %s", set.name, addr)
+				go func() { errCh <- server.ServeTLS(ln, "", "") }()
+			} else {
+				log.Printf("Starting %s listener on %s", set.name, addr)
+				go func() { errCh <- server.Serve(ln) }()
+			}
+		}
+	}
+
+	// Stop every listener on shutdown or when one of them fails
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+	}
+	shutdownServers(servers)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func shutdownServers(servers []*http.Server) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		_ = server.Shutdown(shutdownCtx)
+	}
+}
+
+// serverTLSConfig builds the HTTPS configuration from autocert domains or a
+// certificate file, or returns nil to serve plain HTTP
+func (dt *SomniaStream) serverTLSConfig() (*tls.Config, error) {
+	cfg := dt.config()
+
+	clientAuth, err := dt.clientAuthTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	switch {
+	case len(cfg.TLSAutocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		tlsConfig = manager.TLSConfig()
+
+		// HTTP-01 challenges and redirects to HTTPS
+		if cfg.TLSAutocertHTTPAddr != "" {
+			go func() {
+				log.Printf("Serving ACME HTTP challenges on %s", cfg.TLSAutocertHTTPAddr)
+				if err := http.ListenAndServe(cfg.TLSAutocertHTTPAddr, manager.HTTPHandler(nil)); err != nil {
+					log.Printf("ACME HTTP listener stopped: %v", err)
+				}
+			}()
+		}
+		log.Printf("Using autocert certificates for %v", cfg.TLSAutocertDomains)
+	case cfg.TLSCertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	default:
+		if clientAuth != nil {
+			return nil, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+		}
+		return nil, nil
+	}
+
+	tlsConfig.MinVersion = tls.VersionTLS12
+	applyClientAuth(tlsConfig, clientAuth)
+	return tlsConfig, nil
+}
+
+// clientAuthTLSConfig builds the client certificate policy from TLS_CLIENT_CA_FILE
+// and TLS_CLIENT_AUTH, or returns nil when mutual TLS is not configured
+func (dt *SomniaStream) clientAuthTLSConfig() (*tls.Config, error) {
+	cfg := dt.config()
+	if cfg.TLSClientCAFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.TLSClientCAFile)
+	}
+
+	clientAuth := tls.RequireAndVerifyClientCert
+	switch cfg.TLSClientAuth {
+	case "require", "":
+	case "optional":
+		clientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, errors.New("TLS_CLIENT_AUTH must be require or optional")
+	}
+
+	log.Printf("Mutual TLS enabled (%s client certificates)", cfg.TLSClientAuth)
+	return &tls.Config{ClientCAs: pool, ClientAuth: clientAuth}, nil
+}
+
+func applyClientAuth(tlsConfig, clientAuth *tls.Config) {
+	if clientAuth == nil {
+		return
+	}
+	tlsConfig.ClientCAs = clientAuth.ClientCAs
+	tlsConfig.ClientAuth = clientAuth.ClientAuth
+}
+
+// clientCertSubject returns the common name of a verified client certificate, if any
+func clientCertSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
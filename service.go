@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/api"
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// SomniaStream is the service: its RPC and NATS connections, monitors and HTTP API
+type SomniaStream struct {
+	cfg       atomic.Pointer[config.Config] // Swapped on configuration reload
+	rpcClient *rpc.Client
+	ethClient *ethclient.Client
+	rpcRetry  *rpcRetryTransport
+	chaos     *chaosInjector // Fault injection, nil unless CHAOS is enabled
+	telemetry *rpcTelemetry
+	natsConn  *nats.Conn
+	js        nats.JetStreamContext
+	stopNATS  func()          // Shuts down the embedded NATS server, if any
+	stopMock  func()          // Stops the mock chain, if any
+	chains    []*chainMonitor // Networks monitored next to RPC_ENDPOINT
+	chainID   *big.Int
+	ns        streams.Namespace // Prefix of every subject, stream and bucket
+	signer    types.Signer
+	upgrader  websocket.Upgrader
+	router    *gin.Engine
+	adminAPI  *gin.Engine // Same as router unless ADMIN_LISTEN is set
+	openapi   *api.Spec   // Routes are documented here as they are registered
+
+	gasSpike   *gasSpikeDetector
+	whales     *whaleDetector
+	lifecycle  *txLifecycleTracker
+	txStatus   nats.KeyValue
+	primary    *monitor.Chain // Block, pending, log, gas price and network monitors of RPC_ENDPOINT
+	throughput *throughputTracker
+	rollups    *rollupEngine
+	monitors   *monitor.Registry
+	streams    *streamCatalog
+	streamDefs nats.KeyValue
+	clients    *clientRegistry
+	ipLimits   *ipRateLimiter
+	callLimits *ipRateLimiter // Keyed by caller, see callerID
+	callCache  *callCache
+	acks       *ackSessions    // Connected at-least-once streaming clients
+	pulls      *pullConsumers  // Bound /consume pull consumers
+	hooks      *publishHooks   // PUBLISH_WASM_HOOKS modules
+	archive    *messageArchive // nil unless ARCHIVE_STREAMS is set
+	plugins    []pluginMonitor // Compiled-in monitor.Plugins
+	apiKeys    nats.KeyValue
+	jwks       *jwksCache
+	oidc       *oidcProvider
+	usage      *usageMeter
+	headLag    *headLagMonitor
+	verifier   *consistencyChecker
+	names      *nameResolver    // nil unless NAME_REGISTRY is set
+	selectors  *selectorDecoder // nil when DECODE_SELECTORS is off
+	abis       *abiRegistry
+	tokens     *tokenCache
+	balances   *balanceWatcher
+	nonces     *nonceWatcher
+	state      *stateReader
+	history    *blockHistory // Recently published blocks, for orphan detection
+	pacer      blockPacer    // Observed block interval, for adaptive polling
+	noBlockRcp atomic.Bool   // The endpoint doesn't support eth_getBlockReceipts
+	cursors    *checkpointStore
+	blocks     *lruCache[uint64, *types.Block]
+	receipts   *lruCache[common.Hash, *types.Receipt] // By transaction hash
+	ready      readiness
+	publisher  *monitor.JetStreamPublisher
+}
+
+// config returns the active configuration
+func (dt *SomniaStream) config() *config.Config {
+	return dt.cfg.Load()
+}
+
+// NewSomniaStream connects to the RPC endpoint and NATS and sets up the
+// streams, stores and HTTP engines of the service
+func NewSomniaStream(cfg *config.Config) (*SomniaStream, error) {
+	// Swap the RPC endpoint for a local synthetic chain in mock mode
+	var stopMockRPC func()
+	if cfg.MockRPC {
+		shutdown, err := startMockRPC(cfg)
+		if err != nil {
+			return nil, err
+		}
+		stopMockRPC = shutdown
+	}
+
+	// Connect to RPC; every call is retried with backoff and measured by the transport
+	rpcMetrics := newRPCTelemetry(cfg.RPCEndpoint)
+	rpcRetry := newRPCRetryTransport(rpcRetryPolicyFromConfig(cfg), newCircuitBreaker(cfg.RPCBreakerThreshold, cfg.RPCBreakerCooldown), rpcMetrics)
+	if err := setupRPCRecording(cfg, rpcRetry); err != nil {
+		return nil, err
+	}
+	var chaos *chaosInjector
+	if cfg.Chaos {
+		chaos = newChaosInjector()
+		rpcRetry.next = &chaosTransport{chaos: chaos, next: rpcRetry.next}
+		log.Printf("[CHAOS] Fault injection enabled, manage it through /admin/chaos")
+	}
+	rpcClient, err := dialRPC(cfg.RPCEndpoint, rpcRetry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RPC: %v", err)
+	}
+
+	// Additional networks get their own RPC connections
+	chains, err := newChainMonitors(cfg, rpcMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ethereum client sharing the RPC connection
+	ethClient := ethclient.NewClient(rpcClient)
+
+	// Resolve chain ID for transaction signature recovery
+	chainID, err := ethClient.ChainID(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch chain ID: %v", err)
+	}
+	ns, err := streams.NewNamespace(cfg.SubjectNamespace, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to NATS. The TLS, credential and fault injection settings only
+	// apply to an external server; the embedded one is connected in-process.
+	var natsOpts []nats.Option
+	var stopNATS func()
+	if cfg.EmbeddedNATS {
+		natsOpts, stopNATS, err = startEmbeddedNATS(cfg)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if natsOpts, err = natsOptions(cfg); err != nil {
+			return nil, err
+		}
+		if chaos != nil {
+			natsOpts = append(natsOpts, nats.SetCustomDialer(chaos))
+		}
+	}
+	natsConn, err := nats.Connect(cfg.NATSUrl, natsOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+
+	// Create JetStream context
+	js, err := natsConn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %v", err)
+	}
+
+	// Initialize WebSocket upgrader (origin check is installed below)
+	upgrader := websocket.Upgrader{}
+
+	// Initialize Gin router
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery())
+
+	// Only trust forwarding headers from configured proxies when resolving client IPs
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+
+	// Admin routes get their own engine, without CORS and rate limiting, when
+	// they are served on separate listeners
+	adminAPI := router
+	if len(cfg.AdminListen) > 0 {
+		adminAPI = gin.New()
+		adminAPI.Use(gin.Logger(), gin.Recovery())
+		if err := adminAPI.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+			return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+		}
+	}
+
+	whales, err := newWhaleDetector(cfg.WhaleThreshold, cfg.WhaleTokenThresholds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid whale threshold: %v", err)
+	}
+
+	verifier, err := newConsistencyChecker(cfg.ConsistencyEndpoint, rpcMetrics.registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to consistency RPC: %v", err)
+	}
+
+	names, err := newNameResolver(cfg.NameRegistry, ethClient, cfg.NameCacheTTL, cfg.NameCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	selectorDecoder, err := newSelectorDecoder(cfg.DecodeSelectors, cfg.SelectorFile, cfg.SelectorLookupURL)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := newUsageMeter()
+	devtool := &SomniaStream{
+		rpcClient:  rpcClient,
+		ethClient:  ethClient,
+		rpcRetry:   rpcRetry,
+		chaos:      chaos,
+		telemetry:  rpcMetrics,
+		natsConn:   natsConn,
+		stopNATS:   stopNATS,
+		stopMock:   stopMockRPC,
+		chains:     chains,
+		js:         js,
+		chainID:    chainID,
+		ns:         ns,
+		signer:     types.LatestSignerForChainID(chainID),
+		upgrader:   upgrader,
+		router:     router,
+		adminAPI:   adminAPI,
+		openapi:    newAPISpec(),
+		gasSpike:   newGasSpikeDetector(cfg.GasSpikeWindow, cfg.GasSpikeMultiplier, cfg.GasSpikeMinSamples),
+		whales:     whales,
+		lifecycle:  newTxLifecycleTracker(cfg.LifecycleFinalityDepth, cfg.LifecycleDropTimeout),
+		throughput: newThroughputTracker(cfg.ThroughputWindows),
+		rollups:    newRollupEngine(),
+		monitors:   monitor.NewRegistry(),
+		streams:    newStreamCatalog(),
+		publisher:  monitor.NewJetStreamPublisher(js, publishPolicy(cfg, ns)),
+		clients:    newClientRegistry(usage),
+		usage:      usage,
+		headLag:    newHeadLagMonitor(cfg.RPCPeerEndpoints, rpcMetrics.registry),
+		verifier:   verifier,
+		names:      names,
+		selectors:  selectorDecoder,
+		abis:       newABIRegistry(chainID, cfg.ABISourcifyURL, cfg.ABIExplorerURL, cfg.ABIExplorerAPIKey, cfg.ABIFetchRetryAfter),
+		tokens:     newTokenCache(cfg.TokenMetadata, ethClient, cfg.MulticallAddress, cfg.TokenMetadataTTL, cfg.TokenCacheSize),
+		balances:   newBalanceWatcher(),
+		nonces:     newNonceWatcher(),
+		state:      newStateReader(),
+		history:    newBlockHistory(),
+		cursors:    newCheckpointStore(),
+		blocks:     newLRUCache[uint64, *types.Block](cfg.BlockCacheSize),
+		receipts:   newLRUCache[common.Hash, *types.Receipt](cfg.ReceiptCacheSize),
+		ipLimits:   newIPRateLimiter(),
+		callLimits: newIPRateLimiter(),
+		callCache:  newCallCache(),
+		acks:       newAckSessions(),
+		pulls:      newPullConsumers(),
+		hooks:      newPublishHooks(),
+	}
+
+	devtool.cfg.Store(cfg)
+	devtool.primary = monitor.NewChain(rpcClient, chainID, monitor.PublisherFunc(devtool.publish), chainOptions(cfg))
+	devtool.primary.Hooks = devtool.chainHooks()
+
+	// Setup CORS and the WebSocket origin policy
+	router.Use(devtool.corsMiddleware())
+	devtool.upgrader.CheckOrigin = api.CheckOrigin(devtool.wsAllowedOrigins)
+
+	if cfg.JWTJWKSURL != "" {
+		devtool.jwks = newJWKSCache(cfg.JWTJWKSURL)
+	}
+	if cfg.OIDCIssuer != "" {
+		devtool.oidc = newOIDCProvider(cfg.OIDCIssuer, cfg.SessionSecret)
+	}
+
+	// Plugin monitors add JetStream streams of their own
+	if err := devtool.loadPlugins(); err != nil {
+		return nil, err
+	}
+
+	// Setup JetStream streams
+	if err := devtool.setupJetStreams(); err != nil {
+		return nil, fmt.Errorf("failed to setup JetStreams: %v", err)
+	}
+
+	// Setup JetStream key-value stores
+	if err := devtool.setupKeyValueStores(); err != nil {
+		return nil, fmt.Errorf("failed to setup key-value stores: %v", err)
+	}
+
+	// Resume derived streams declared through the admin API
+	devtool.restoreDerivedStreams()
+	if err := devtool.loadPublishHooks(cfg); err != nil {
+		return nil, err
+	}
+	devtool.archive = devtool.newMessageArchive()
+	devtool.ready.jetStream.Store(true)
+	devtool.watchNATSConnection()
+	rpcRetry.breaker.onChange = devtool.rpcBreakerChanged
+	devtool.monitors.Skip = devtool.monitorSkipped
+	devtool.monitors.OnError = devtool.monitorFailed
+	devtool.monitors.OnRecover = devtool.monitorRecovered
+
+	return devtool, nil
+}
+
+// setupJetStreams creates the necessary JetStream streams
+func (dt *SomniaStream) setupJetStreams() error {
+	specs := streams.Specs(dt.config().RollupRetention)
+	for _, chain := range dt.config().Chains {
+		spec := streams.ChainSpec(chain.Name)
+		spec.MaxAge, spec.MaxMsgs, spec.OnDisk = chain.Retention, chain.MaxMsgs, chain.OnDisk
+		specs = append(specs, spec)
+	}
+	specs = append(specs, dt.pluginSpecs()...)
+	dt.applyHotRetention(specs)
+	return streams.Setup(dt.js, dt.ns.Specs(specs))
+}
+
+// setupKeyValueStores binds (or creates) the KV buckets used for derived state.
+// API keys are shared by every namespace on the cluster.
+func (dt *SomniaStream) setupKeyValueStores() error {
+	txStatusBucket := dt.ns.Stream("TX_STATUS")
+	kv, err := dt.js.KeyValue(txStatusBucket)
+	if err != nil {
+		kv, err = dt.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      txStatusBucket,
+			Description: "Latest known status per transaction hash",
+			Storage:     nats.MemoryStorage,
+			TTL:         time.Hour * 24,
+		})
+		if err != nil {
+			log.Printf("Failed to create key-value store %s: %v", txStatusBucket, err)
+			return err
+		}
+		log.Printf("Created JetStream key-value store: %s", txStatusBucket)
+	}
+	dt.txStatus = kv
+
+	defsBucket := dt.ns.Stream(streams.DefinitionsBucket)
+	defs, err := dt.js.KeyValue(defsBucket)
+	if err != nil {
+		defs, err = dt.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      defsBucket,
+			Description: "Derived stream definitions created through the admin API",
+			Storage:     nats.FileStorage,
+		})
+		if err != nil {
+			log.Printf("Failed to create key-value store %s: %v", defsBucket, err)
+			return err
+		}
+		log.Printf("Created JetStream key-value store: %s", defsBucket)
+	}
+	dt.streamDefs = defs
+
+	keys, err := dt.js.KeyValue(apiKeysBucket)
+	if err != nil {
+		keys, err = dt.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      apiKeysBucket,
+			Description: "API keys by SHA-256 of the key",
+			Storage:     nats.FileStorage,
+		})
+		if err != nil {
+			log.Printf("Failed to create key-value store %s: %v", apiKeysBucket, err)
+			return err
+		}
+		log.Printf("Created JetStream key-value store: %s", apiKeysBucket)
+	}
+	dt.apiKeys = keys
+
+	abisBucket := dt.ns.Stream(contractABIsBucket)
+	abis, err := dt.js.KeyValue(abisBucket)
+	if err != nil {
+		abis, err = dt.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      abisBucket,
+			Description: "Contract ABIs used to decode events, by address",
+			Storage:     nats.FileStorage,
+		})
+		if err != nil {
+			log.Printf("Failed to create key-value store %s: %v", abisBucket, err)
+			return err
+		}
+		log.Printf("Created JetStream key-value store: %s", abisBucket)
+	}
+	if err := dt.abis.bind(abis); err != nil {
+		return err
+	}
+
+	stateBucket := dt.ns.Stream(stateReadsBucket)
+	stateReads, err := dt.js.KeyValue(stateBucket)
+	if err != nil {
+		stateReads, err = dt.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      stateBucket,
+			Description: "State reads published on eth.state.<name>, by name",
+			Storage:     nats.FileStorage,
+		})
+		if err != nil {
+			log.Printf("Failed to create key-value store %s: %v", stateBucket, err)
+			return err
+		}
+		log.Printf("Created JetStream key-value store: %s", stateBucket)
+	}
+	if err := dt.state.bind(stateReads); err != nil {
+		return err
+	}
+
+	checkpointsBucket := dt.ns.Stream(monitorCheckpointsBucket)
+	checkpoints, err := dt.js.KeyValue(checkpointsBucket)
+	if err != nil {
+		checkpoints, err = dt.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      checkpointsBucket,
+			Description: "Last block processed by each block-driven monitor, by monitor",
+			Storage:     nats.FileStorage,
+		})
+		if err != nil {
+			log.Printf("Failed to create key-value store %s: %v", checkpointsBucket, err)
+			return err
+		}
+		log.Printf("Created JetStream key-value store: %s", checkpointsBucket)
+	}
+	if err := dt.cursors.bind(checkpoints); err != nil {
+		return err
+	}
+
+	if dt.tokens == nil {
+		return nil
+	}
+	tokensBucket := dt.ns.Stream(tokenMetadataBucket)
+	tokens, err := dt.js.KeyValue(tokensBucket)
+	if err != nil {
+		tokens, err = dt.js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      tokensBucket,
+			Description: "Token name, symbol and decimals, by address",
+			Storage:     nats.FileStorage,
+			TTL:         dt.config().TokenMetadataTTL,
+		})
+		if err != nil {
+			log.Printf("Failed to create key-value store %s: %v", tokensBucket, err)
+			return err
+		}
+		log.Printf("Created JetStream key-value store: %s", tokensBucket)
+	}
+	return dt.tokens.bind(tokens)
+}
+
+// Start serves the HTTP API and runs the RPC monitors until ctx is done
+func (dt *SomniaStream) Start(ctx context.Context) error {
+	dt.router.Use(dt.rateLimitByIP())
+	go dt.ipLimits.cleanup(ctx)
+	go dt.callLimits.cleanup(ctx)
+	go dt.whales.cleanup(ctx)
+	go dt.names.run(ctx)
+	go dt.selectors.run(ctx)
+	go dt.abis.run(ctx)
+	go dt.tokens.run(ctx)
+	go dt.runBalanceReads(ctx)
+	go dt.runStateReads(ctx)
+	go dt.runCheckpoints(ctx)
+	go dt.pulls.cleanup(ctx)
+	go dt.runExports(ctx)
+	go dt.runArchive(ctx)
+
+	dt.setupRoutes()
+
+	// Start RPC monitoring
+	go dt.monitorRPC(ctx)
+	go dt.watchReloadSignal(ctx)
+	go dt.runUsageMeter(ctx)
+	go dt.probeRPC(ctx)
+	go dt.runRPCMetrics(ctx)
+	go dt.runHeadLag(ctx)
+
+	err := dt.serve(ctx)
+	dt.cursors.flush()
+	if dt.stopNATS != nil {
+		// Flush pending publishes before the embedded store closes
+		_ = dt.natsConn.Drain()
+		dt.stopNATS()
+	}
+	if dt.stopMock != nil {
+		dt.stopMock()
+	}
+	return err
+}
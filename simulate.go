@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+)
+
+// simulationResult is the result of POST /simulate
+type simulationResult struct {
+	Success      bool                     `json:"success"`
+	BlockNumber  uint64                   `json:"blockNumber,omitempty"`
+	GasEstimate  uint64                   `json:"gasEstimate,omitempty"` // eth_estimateGas, for successful calls
+	GasUsed      uint64                   `json:"gasUsed,omitempty"`     // Gas used by the traced call
+	ReturnData   string                   `json:"returnData,omitempty"`
+	RevertReason string                   `json:"revertReason,omitempty"`
+	RevertData   string                   `json:"revertData,omitempty"`
+	Error        string                   `json:"error,omitempty"`
+	Logs         []map[string]interface{} `json:"logs"`                   // Emitted by the call, in order, decoded when the ABI is known
+	StateChanges json.RawMessage          `json:"stateChanges,omitempty"` // prestateTracer diff: {"pre": {...}, "post": {...}}
+	TraceError   string                   `json:"traceError,omitempty"`   // Why logs and state changes are missing
+}
+
+// callFrame is the part of a callTracer frame simulations use
+type callFrame struct {
+	GasUsed hexutil.Uint64           `json:"gasUsed"`
+	Logs    []map[string]interface{} `json:"logs"`
+	Calls   []callFrame              `json:"calls"`
+}
+
+// frameLogs returns the logs of a frame and its subcalls in emission order; a
+// log's position is the number of subcalls made before it
+func frameLogs(frame callFrame) []map[string]interface{} {
+	var logs []map[string]interface{}
+	next := 0
+	for i, call := range frame.Calls {
+		for next < len(frame.Logs) && logPosition(frame.Logs[next]) <= i {
+			logs = append(logs, frame.Logs[next])
+			next++
+		}
+		logs = append(logs, frameLogs(call)...)
+	}
+	return append(logs, frame.Logs[next:]...)
+}
+
+func logPosition(entry map[string]interface{}) int {
+	position, _ := entry["position"].(string)
+	n, err := hexutil.DecodeUint64(position)
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// Handle POST /simulate previewing a transaction at a block: eth_call for the
+// outcome, eth_estimateGas for the gas limit, and debug_traceCall for the logs
+// and state changes. Nodes without the debug API still get the outcome and
+// gas estimate, with traceError explaining the rest.
+func (dt *SomniaStream) handleSimulate(c *gin.Context) {
+	var req callRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	args, err := req.callArgs()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	number, tag, err := parseCallBlock(req.Block)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid block %q", req.Block)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+
+	// Every step runs at the same block, so latest is pinned to the head
+	if tag == "latest" {
+		head, err := dt.ethClient.BlockNumber(ctx)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "node unavailable: " + err.Error()})
+			return
+		}
+		number, tag = head, ""
+	}
+	blockArg := tag
+	if tag == "" {
+		blockArg = hexutil.EncodeUint64(number)
+	}
+	result := simulationResult{BlockNumber: number, Logs: []map[string]interface{}{}}
+
+	var output hexutil.Bytes
+	err = dt.rpcClient.CallContext(ctx, &output, "eth_call", args, blockArg)
+	var rpcErr rpc.Error
+	switch {
+	case err == nil:
+		result.Success = true
+		result.ReturnData = output.String()
+	case errors.As(err, &rpcErr):
+		result.Error = rpcErr.Error()
+		result.RevertReason = strings.TrimPrefix(rpcErr.Error(), "execution reverted: ")
+		var dataErr rpc.DataError
+		if errors.As(err, &dataErr) {
+			if hexData, ok := dataErr.ErrorData().(string); ok {
+				result.RevertData = hexData
+				if raw, err := hexutil.Decode(hexData); err == nil {
+					if reason, err := abi.UnpackRevert(raw); err == nil {
+						result.RevertReason = reason
+					}
+				}
+			}
+		}
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "node unavailable: " + err.Error()})
+		return
+	}
+
+	if result.Success {
+		var estimate hexutil.Uint64
+		if err := dt.rpcClient.CallContext(ctx, &estimate, "eth_estimateGas", args, blockArg); err == nil {
+			result.GasEstimate = uint64(estimate)
+		}
+	}
+
+	var frame callFrame
+	err = dt.rpcClient.CallContext(ctx, &frame, "debug_traceCall", args, blockArg, map[string]interface{}{
+		"tracer":       "callTracer",
+		"tracerConfig": map[string]interface{}{"withLog": true},
+	})
+	if err != nil {
+		result.TraceError = err.Error()
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	result.GasUsed = uint64(frame.GasUsed)
+	if logs := frameLogs(frame); len(logs) > 0 {
+		for _, entry := range logs {
+			delete(entry, "position")
+		}
+		dt.abis.decode(logs)
+		dt.tokens.annotate(logs)
+		result.Logs = logs
+	}
+
+	var diff json.RawMessage
+	err = dt.rpcClient.CallContext(ctx, &diff, "debug_traceCall", args, blockArg, map[string]interface{}{
+		"tracer":       "prestateTracer",
+		"tracerConfig": map[string]interface{}{"diffMode": true},
+	})
+	if err != nil {
+		result.TraceError = err.Error()
+	} else {
+		result.StateChanges = diff
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/api"
+)
+
+// Handle SSE for specific stream
+func (dt *SomniaStream) handleSSEStream(c *gin.Context) {
+	dt.serveSSE(c, "", c.Param("stream"))
+}
+
+// serveSSE streams a stream of RPC_ENDPOINT's network, or of an additional
+// network when chain is set
+func (dt *SomniaStream) serveSSE(c *gin.Context, chain, stream string) {
+	subject, ok := dt.streamSubject(chain, stream)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown stream %q", stream)})
+		return
+	}
+	if !dt.streamAllowed(c, stream) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("access to stream %q denied", stream)})
+		return
+	}
+
+	// Block consumers can pick a lighter variant, e.g. /sse/blocks?detail=header
+	if detail := c.Query("detail"); detail != "" && stream == "blocks" {
+		if subject, ok = blockDetailSubject(chain, detail); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "detail must be one of header, hashes, full"})
+			return
+		}
+	}
+
+	mode, err := dt.deliveryMode(c, stream)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// e.g. ?fields=number,hash,txCount or ?transform=transactions[].hash
+	shape, err := newMessageShape(c.Query("fields"), c.Query("transform"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Members of a queue group share a consumer, so each message is delivered
+	// to only one of them
+	group, groupPrincipal := c.Query("group"), ""
+	if group != "" {
+		if !consumerNamePattern.MatchString(group) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group must be 1-64 letters, digits, '-' or '_'"})
+			return
+		}
+		if c.Query("delivery") == deliveryAtLeastOnce {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group can't be combined with delivery=at-least-once"})
+			return
+		}
+		mode = deliveryAtMostOnce
+		if groupPrincipal, err = groupCaller(callerID(c), c.Query("groupToken")); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, errGroupTokenRequired) {
+				status = http.StatusUnauthorized
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Reconnecting clients resume after the last event they received; the
+	// event ID is the JetStream stream sequence
+	deliver := nats.DeliverNew()
+	var startSeq uint64
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("lastEventId") // For clients that can't set headers
+	}
+	if lastID != "" {
+		seq, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Last-Event-ID must be a stream sequence"})
+			return
+		}
+		startSeq = seq + 1
+		deliver = nats.StartSequence(startSeq)
+	}
+
+	// At-least-once clients stream from a durable consumer that keeps their
+	// position; messages stay pending until acknowledged through POST /sse/ack
+	var session *ackSession
+	if mode == deliveryAtLeastOnce {
+		consumer := c.DefaultQuery("consumer", "default")
+		if !consumerNamePattern.MatchString(consumer) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "consumer must be 1-64 letters, digits, '-' or '_'"})
+			return
+		}
+		// Anonymous callers are told apart by an ack token rather than their
+		// address, which callers behind one NAT share, and resume their
+		// consumer by reconnecting with ?ackToken=
+		caller, token := callerID(c), ""
+		if anonymousCaller(caller) {
+			if token, err = ackToken(c.Query("ackToken")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			caller = "token:" + token
+		}
+		key := ackSessionKey(caller, subject, consumer)
+		if session, err = dt.acks.open(key, durableConsumerName("sse", caller, dt.ns.Subject(subject), consumer)); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		defer dt.acks.close(key)
+		if token != "" {
+			c.Header(headerAckToken, token)
+		}
+	}
+
+	client, ctx, err := dt.clients.connect(c, "sse", stream, subject, dt.connectionLimits())
+	if err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(connectionRetryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer dt.clients.disconnect(client)
+
+	// Messages are queued so a slow client never blocks the NATS callback;
+	// the queue applies the per-client rate limit and overflow policy
+	queue := dt.newClientQueue(stream)
+	if token := c.Writer.Header().Get(headerAckToken); token != "" {
+		data, _ := json.Marshal(gin.H{"ackToken": token}) // For EventSource clients, which can't read headers
+		queue.Push(api.Message{Event: "session", Data: data})
+	}
+	gaps := gapDetector{lastStream: max(startSeq, 1) - 1}
+	handler := func(msg *nats.Msg) {
+		queued := api.Message{Subject: msg.Subject}
+		if meta, err := msg.Metadata(); err == nil {
+			queued.Seq = meta.Sequence.Stream
+			if session == nil && group == "" {
+				if notice := dt.detectGap(&gaps, meta); notice != nil {
+					log.Printf("SSE client %s on %s missed messages no longer stored: %s", client.id, stream, notice)
+					client.gaps.Add(1)
+					queue.Push(api.Message{Event: "gap", Data: notice})
+				}
+			}
+		}
+		data, ok := shape.apply(msg.Data)
+		if !ok {
+			if session != nil || group != "" {
+				msg.Ack() // Skipped on purpose, never redelivered
+			}
+			return
+		}
+		queued.Data = data
+		if session != nil {
+			session.track(queued.Seq, msg) // Dropped messages are redelivered after DELIVERY_ACK_WAIT
+		} else if group != "" {
+			msg.Ack()
+		}
+		if dropped := queue.Push(queued); dropped > 0 {
+			client.dropped.Add(uint64(dropped))
+		}
+	}
+	var sub *nats.Subscription
+	switch {
+	case session != nil:
+		sub, err = dt.subscribeDurable(dt.ns.Subject(subject), session.durable, startSeq, handler)
+	case group != "":
+		durable := durableConsumerName("group", groupPrincipal, dt.ns.Subject(subject), group)
+		sub, err = dt.subscribeGroup(dt.ns.Subject(subject), durable, group, handler)
+	default:
+		// Ordered consumers detect sequence gaps, e.g. after a NATS reconnect,
+		// and recreate themselves after the last delivered message
+		sub, err = dt.js.Subscribe(dt.ns.Subject(subject), handler, deliver, nats.OrderedConsumer())
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "already bound") { // Another connection streams from the consumer
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Unsubscribe()
+
+	dt.writeEvents(ctx, c, client, queue, stream)
+}
+
+// writeEvents writes the messages of queue to an SSE client until it
+// disconnects, with heartbeats, idle and slow-consumer handling. Messages with
+// a stream sequence carry it as the event ID.
+func (dt *SomniaStream) writeEvents(ctx context.Context, c *gin.Context, client *clientConn, queue *api.Queue, stream string) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Stop nginx-style proxies from buffering events
+	if c.Request.ProtoMajor == 1 {
+		c.Header("Connection", "keep-alive") // Hop-by-hop headers are invalid over HTTP/2
+	}
+	c.Status(http.StatusOK)
+	c.Writer.Flush() // Send headers now so TLS/HTTP2 clients see the stream open before the first event
+
+	cfg := dt.config()
+	lastDelivery := time.Now()
+	var notified uint64
+	var lastNotice time.Time
+	for {
+		// Wait at most one heartbeat interval so quiet streams still see traffic
+		waitCtx, cancel := ctx, context.CancelFunc(func() {})
+		if cfg.SSEHeartbeatInterval > 0 {
+			waitCtx, cancel = context.WithTimeout(ctx, cfg.SSEHeartbeatInterval)
+		}
+		msg, err := queue.Next(waitCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Tell lagging clients what they lost, at most once per notice interval
+		if dropped := client.dropped.Load(); dropped > notified && (err != nil || time.Since(lastNotice) >= slowNoticeInterval) {
+			notice := dt.slowConsumerNotice(client, queue.Policy(), dropped-notified)
+			notified, lastNotice = dropped, time.Now()
+			if err := api.WriteSSE(c.Writer, cfg.SSEWriteTimeout, "event: notice\ndata: %s\n\n", notice); err != nil {
+				return
+			}
+		}
+
+		if errors.Is(err, api.ErrSlowConsumer) {
+			log.Printf("Disconnecting slow SSE client %s on %s", client.id, stream)
+			dt.clientDropped(client, "slow_consumer")
+			return
+		}
+		if err != nil {
+			if cfg.SSEIdleTimeout > 0 && time.Since(lastDelivery) > cfg.SSEIdleTimeout {
+				log.Printf("Closing idle SSE client %s on %s after %s", client.id, stream, cfg.SSEIdleTimeout)
+				dt.clientDropped(client, "idle")
+				return
+			}
+			if err := api.WriteSSE(c.Writer, cfg.SSEWriteTimeout, ": keepalive\n\n"); err != nil {
+				return
+			}
+			continue
+		}
+
+		if msg.Event != "" {
+			if err := api.WriteSSE(c.Writer, cfg.SSEWriteTimeout, "event: %s\ndata: %s\n\n", msg.Event, msg.Data); err != nil {
+				return
+			}
+			continue
+		}
+		if msg.Seq == 0 {
+			err = api.WriteSSE(c.Writer, cfg.SSEWriteTimeout, "data: %s\n\n", msg.Data)
+		} else {
+			err = api.WriteSSE(c.Writer, cfg.SSEWriteTimeout, "id: %d\ndata: %s\n\n", msg.Seq, msg.Data)
+		}
+		if err != nil {
+			return
+		}
+		lastDelivery = time.Now()
+		client.recordDelivery(len(msg.Data))
+	}
+}
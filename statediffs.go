@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"somnia-stream/pkg/streams"
+)
+
+// prestateAccount is an account of a prestateTracer diff. Absent fields are
+// unchanged (in post) or zero.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   *uint64                     `json:"nonce"`
+	Code    *hexutil.Bytes              `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// prestateDiff is a prestateTracer result in diff mode: the changed
+// accounts before and after a transaction. Accounts missing from post were
+// destroyed, and storage slots missing from post were cleared.
+type prestateDiff struct {
+	Pre  map[common.Address]prestateAccount `json:"pre"`
+	Post map[common.Address]prestateAccount `json:"post"`
+}
+
+// stateChange is a value before and after a block
+type stateChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// accountChanges are the changes of an account over a block
+type accountChanges struct {
+	Address   string                  `json:"address"`
+	Balance   *stateChange            `json:"balance,omitempty"` // Wei as decimal strings
+	Nonce     *stateChange            `json:"nonce,omitempty"`
+	Code      *stateChange            `json:"code,omitempty"`
+	Storage   map[string]*stateChange `json:"storage,omitempty"` // By slot
+	Destroyed bool                    `json:"destroyed,omitempty"`
+}
+
+// recordChange applies one transaction's change of a value: the block's change
+// starts at the first transaction's value and ends at the last one's
+func recordChange(change **stateChange, from, to interface{}) {
+	if *change == nil {
+		*change = &stateChange{From: from}
+	}
+	(*change).To = to
+}
+
+// blockStateDiff folds the prestateTracer diffs of a block's transactions,
+// in order, into the net change of every account. Values changed and then
+// restored within the block are left out.
+func blockStateDiff(diffs []prestateDiff) []*accountChanges {
+	accounts := make(map[common.Address]*accountChanges)
+	zero := common.Hash{}
+	for _, diff := range diffs {
+		touched := make(map[common.Address]bool)
+		for addr := range diff.Pre {
+			touched[addr] = true
+		}
+		for addr := range diff.Post {
+			touched[addr] = true
+		}
+		for addr := range touched {
+			pre := diff.Pre[addr]
+			post, alive := diff.Post[addr]
+			account, ok := accounts[addr]
+			if !ok {
+				account = &accountChanges{Address: strings.ToLower(addr.Hex()), Storage: make(map[string]*stateChange)}
+				accounts[addr] = account
+			}
+			account.Destroyed = !alive
+
+			balanceFrom, nonceFrom, codeFrom := "0", uint64(0), "0x"
+			if pre.Balance != nil {
+				balanceFrom = pre.Balance.ToInt().String()
+			}
+			if pre.Nonce != nil {
+				nonceFrom = *pre.Nonce
+			}
+			if pre.Code != nil {
+				codeFrom = pre.Code.String()
+			}
+			switch {
+			case post.Balance != nil:
+				recordChange(&account.Balance, balanceFrom, post.Balance.ToInt().String())
+			case !alive:
+				recordChange(&account.Balance, balanceFrom, "0")
+			}
+			switch {
+			case post.Nonce != nil:
+				recordChange(&account.Nonce, nonceFrom, *post.Nonce)
+			case !alive:
+				recordChange(&account.Nonce, nonceFrom, uint64(0))
+			}
+			switch {
+			case post.Code != nil:
+				recordChange(&account.Code, codeFrom, post.Code.String())
+			case !alive && codeFrom != "0x":
+				recordChange(&account.Code, codeFrom, "0x")
+			}
+
+			for slot, value := range post.Storage {
+				change := account.Storage[slot.Hex()]
+				recordChange(&change, pre.Storage[slot].Hex(), value.Hex())
+				account.Storage[slot.Hex()] = change
+			}
+			for slot, value := range pre.Storage {
+				if _, ok := post.Storage[slot]; !ok {
+					change := account.Storage[slot.Hex()]
+					recordChange(&change, value.Hex(), zero.Hex())
+					account.Storage[slot.Hex()] = change
+				}
+			}
+		}
+	}
+
+	changed := make([]*accountChanges, 0, len(accounts))
+	for _, account := range accounts {
+		for _, field := range []**stateChange{&account.Balance, &account.Nonce, &account.Code} {
+			if *field != nil && fmt.Sprint((*field).From) == fmt.Sprint((*field).To) {
+				*field = nil
+			}
+		}
+		for slot, change := range account.Storage {
+			if change.From == change.To {
+				delete(account.Storage, slot)
+			}
+		}
+		if account.Balance != nil || account.Nonce != nil || account.Code != nil || len(account.Storage) > 0 || account.Destroyed {
+			changed = append(changed, account)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Address < changed[j].Address })
+	return changed
+}
+
+// publishStateDiffs publishes the net account and storage changes of a block
+// on eth.state.diffs
+func (dt *SomniaStream) publishStateDiffs(number uint64, traces []blockTrace, limit int) error {
+	diffs := make([]prestateDiff, 0, len(traces))
+	for _, trace := range traces {
+		var diff prestateDiff
+		if err := json.Unmarshal(trace.Result, &diff); err != nil {
+			return fmt.Errorf("decoding state diff of %s: %w", trace.TxHash, err)
+		}
+		diffs = append(diffs, diff)
+	}
+	changed := blockStateDiff(diffs)
+
+	// publishCapped takes generic maps
+	accounts := make([]map[string]interface{}, 0, len(changed))
+	for _, account := range changed {
+		data, _ := json.Marshal(account)
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err == nil {
+			accounts = append(accounts, fields)
+		}
+	}
+
+	base := map[string]interface{}{
+		"blockNumber":  number,
+		"txCount":      len(traces),
+		"accountCount": len(accounts),
+		"timestamp":    time.Now().Unix(),
+	}
+	if err := dt.publishCapped(streams.StateDiffsSubject, base, "accounts", accounts, limit); err != nil {
+		log.Printf("[STATEDIFF] ERROR: Failed to publish state diff of block %d: %v", number, err)
+		return err
+	}
+	log.Printf("[STATEDIFF] Published changes of %d accounts in block %d", len(accounts), number)
+	return nil
+}
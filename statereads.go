@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/selectors"
+	"somnia-stream/pkg/streams"
+)
+
+// stateReadsBucket stores the registered state reads by name
+const stateReadsBucket = "STATE_READS"
+
+// stateRead is a registered view call published on eth.state.<name>
+type stateRead struct {
+	Name      string        `json:"name"`
+	Address   string        `json:"address"`
+	Method    string        `json:"method"`             // e.g. balanceOf(address)
+	Args      []interface{} `json:"args,omitempty"`     // Addresses, hex bytes, decimal strings or numbers, booleans, strings
+	Returns   []string      `json:"returns"`            // Return types, optionally named, e.g. ["uint112 reserve0", "uint112 reserve1"]
+	Every     uint64        `json:"every,omitempty"`    // Read every N blocks (default 1)
+	OnChange  bool          `json:"onChange,omitempty"` // Only publish results that differ from the previous read
+	CreatedAt int64         `json:"createdAt"`
+
+	target   common.Address
+	calldata []byte
+	outputs  abi.Arguments
+	last     []byte // Return data of the previous read
+}
+
+// compile validates a read and encodes its call data
+func (r *stateRead) compile() error {
+	if !streams.NamePattern.MatchString(r.Name) {
+		return errors.New("name must be 1-64 letters, digits, '-' or '_'")
+	}
+	if streams.StateSubjectPrefix+r.Name == streams.StateDiffsSubject {
+		return fmt.Errorf("name %q is reserved for state diffs", r.Name)
+	}
+	if !common.IsHexAddress(r.Address) {
+		return fmt.Errorf("invalid address %q", r.Address)
+	}
+	sig, err := selectors.Parse(r.Method)
+	if err != nil {
+		return err
+	}
+	if len(r.Args) != len(sig.Args) {
+		return fmt.Errorf("%s takes %d arguments, got %d", sig.Text, len(sig.Args), len(r.Args))
+	}
+	if len(r.Returns) == 0 {
+		return errors.New("at least one return type is required")
+	}
+
+	inputs := make(abi.Arguments, len(sig.Args))
+	values := make([]interface{}, len(sig.Args))
+	for i, text := range sig.Args {
+		typ, err := parseABIType(text)
+		if err != nil {
+			return fmt.Errorf("argument %d: %v", i, err)
+		}
+		value, err := convertArg(typ, r.Args[i])
+		if err != nil {
+			return fmt.Errorf("argument %d: %v", i, err)
+		}
+		inputs[i], values[i] = abi.Argument{Type: typ}, value
+	}
+	packed, err := inputs.Pack(values...)
+	if err != nil {
+		return err
+	}
+
+	r.outputs = make(abi.Arguments, len(r.Returns))
+	for i, ret := range r.Returns {
+		typeText, name := strings.TrimSpace(ret), ""
+		if j := strings.LastIndexAny(typeText, " )"); j >= 0 && typeText[j] == ' ' {
+			typeText, name = strings.TrimSpace(typeText[:j]), typeText[j+1:]
+		}
+		typ, err := parseABIType(typeText)
+		if err != nil {
+			return fmt.Errorf("return %d: %v", i, err)
+		}
+		r.outputs[i] = abi.Argument{Name: name, Type: typ}
+	}
+
+	r.Method = sig.Text
+	r.Address = strings.ToLower(r.Address)
+	r.target = common.HexToAddress(r.Address)
+	r.calldata = append(hexutil.MustDecode(sig.Selector), packed...)
+	if r.Every == 0 {
+		r.Every = 1
+	}
+	return nil
+}
+
+// convertArg converts a JSON argument to the Go value abi packs for a type
+func convertArg(typ abi.Type, value interface{}) (interface{}, error) {
+	switch typ.T {
+	case abi.AddressTy:
+		if s, ok := value.(string); ok && common.IsHexAddress(s) {
+			return common.HexToAddress(s), nil
+		}
+		return nil, fmt.Errorf("expected an address, got %v", value)
+	case abi.BoolTy:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", value)
+	case abi.StringTy:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", value)
+	case abi.BytesTy, abi.FixedBytesTy:
+		s, _ := value.(string)
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected hex bytes, got %v", value)
+		}
+		if typ.T == abi.BytesTy {
+			return b, nil
+		}
+		if len(b) != typ.Size {
+			return nil, fmt.Errorf("expected %d bytes, got %d", typ.Size, len(b))
+		}
+		array := reflect.New(typ.GetType()).Elem()
+		reflect.Copy(array, reflect.ValueOf(b))
+		return array.Interface(), nil
+	case abi.IntTy, abi.UintTy:
+		n, ok := new(big.Int), false
+		switch v := value.(type) {
+		case string:
+			n, ok = n.SetString(v, 0)
+		case float64:
+			var accuracy big.Accuracy
+			n, accuracy = new(big.Float).SetFloat64(v).Int(nil)
+			ok = accuracy == big.Exact
+		}
+		if !ok {
+			return nil, fmt.Errorf("expected an integer, got %v", value)
+		}
+		goType := typ.GetType()
+		if goType == reflect.TypeOf(n) {
+			return n, nil
+		}
+		// Sizes up to 64 bits pack from the matching Go integer type
+		converted := reflect.New(goType).Elem()
+		if typ.T == abi.IntTy {
+			if !n.IsInt64() || converted.OverflowInt(n.Int64()) {
+				return nil, fmt.Errorf("%s out of range for %s", n, typ)
+			}
+			converted.SetInt(n.Int64())
+		} else {
+			if !n.IsUint64() || converted.OverflowUint(n.Uint64()) {
+				return nil, fmt.Errorf("%s out of range for %s", n, typ)
+			}
+			converted.SetUint(n.Uint64())
+		}
+		return converted.Interface(), nil
+	}
+	return nil, fmt.Errorf("arguments of type %s are not supported", typ)
+}
+
+// stateReader batches the registered state reads into one Multicall3 call
+// per block and publishes each result on eth.state.<name>
+type stateReader struct {
+	kv nats.KeyValue // Bound in setupKeyValueStores
+
+	mu     sync.Mutex
+	reads  map[string]*stateRead
+	blocks chan uint64
+}
+
+func newStateReader() *stateReader {
+	return &stateReader{
+		reads:  make(map[string]*stateRead),
+		blocks: make(chan uint64, 16),
+	}
+}
+
+// bind loads the registered reads from the key-value bucket
+func (s *stateReader) bind(kv nats.KeyValue) error {
+	s.kv = kv
+	keys, err := kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		entry, err := kv.Get(key)
+		if err != nil {
+			continue
+		}
+		var read stateRead
+		if err := json.Unmarshal(entry.Value(), &read); err != nil {
+			continue
+		}
+		if err := read.compile(); err != nil {
+			log.Printf("[STATE] WARNING: Skipping state read %s: %v", key, err)
+			continue
+		}
+		s.reads[read.Name] = &read
+	}
+	log.Printf("[STATE] Loaded %d state reads", len(s.reads))
+	return nil
+}
+
+// list returns the registered reads sorted by name
+func (s *stateReader) list() []stateRead {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reads := make([]stateRead, 0, len(s.reads))
+	for _, read := range s.reads {
+		reads = append(reads, *read)
+	}
+	sort.Slice(reads, func(i, j int) bool { return reads[i].Name < reads[j].Name })
+	return reads
+}
+
+// queueStateReads schedules the reads of a new block; when reads fall
+// behind, only the newest block is read
+func (dt *SomniaStream) queueStateReads(block uint64) {
+	select {
+	case dt.state.blocks <- block:
+	default:
+	}
+}
+
+// runStateReads reads the queued blocks until ctx is done
+func (dt *SomniaStream) runStateReads(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case block := <-dt.state.blocks:
+		drain:
+			for {
+				select {
+				case block = <-dt.state.blocks:
+				default:
+					break drain
+				}
+			}
+			if err := dt.publishStateReads(ctx, block); err != nil {
+				log.Printf("[STATE] WARNING: Failed to read state at block %d: %v", block, err)
+			}
+		}
+	}
+}
+
+// publishStateReads performs the reads due at a block and publishes them
+func (dt *SomniaStream) publishStateReads(ctx context.Context, block uint64) error {
+	dt.state.mu.Lock()
+	var due []*stateRead
+	for _, read := range dt.state.reads {
+		if block%read.Every == 0 {
+			due = append(due, read)
+		}
+	}
+	dt.state.mu.Unlock()
+	if len(due) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	at := new(big.Int).SetUint64(block)
+	results := make([][]byte, len(due))
+	failures := make([]error, len(due))
+
+	batched := false
+	if multicall := dt.config().MulticallAddress; common.IsHexAddress(multicall) {
+		calls := make([]multicallCall, len(due))
+		for i, read := range due {
+			calls[i] = multicallCall{Target: read.target, AllowFailure: true, CallData: read.calldata}
+		}
+		batched = aggregate3(ctx, dt.ethClient, common.HexToAddress(multicall), at, calls, results) == nil
+		for i := range due {
+			if batched && results[i] == nil {
+				failures[i] = errors.New("call reverted")
+			}
+		}
+	}
+	if !batched {
+		for i, read := range due {
+			results[i], failures[i] = dt.ethClient.CallContract(ctx, ethereum.CallMsg{To: &read.target, Data: read.calldata}, at)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+	}
+
+	for i, read := range due {
+		payload := map[string]interface{}{
+			"name":        read.Name,
+			"address":     read.Address,
+			"method":      read.Method,
+			"blockNumber": block,
+			"success":     failures[i] == nil,
+			"timestamp":   time.Now().Unix(),
+		}
+		if failures[i] != nil {
+			payload["error"] = failures[i].Error()
+		} else if values, err := read.outputs.Unpack(results[i]); err != nil {
+			payload["success"] = false
+			payload["error"] = fmt.Sprintf("cannot decode result: %v", err)
+		} else {
+			decoded := make([]interface{}, len(values))
+			named := make(map[string]interface{})
+			for j, value := range values {
+				decoded[j] = jsonValue(value)
+				if name := read.outputs[j].Name; name != "" {
+					named[name] = decoded[j]
+				}
+			}
+			payload["values"] = decoded
+			if len(named) > 0 {
+				payload["result"] = named
+			}
+		}
+
+		dt.state.mu.Lock()
+		unchanged := read.OnChange && read.last != nil && bytes.Equal(read.last, results[i])
+		read.last = results[i]
+		dt.state.mu.Unlock()
+		if unchanged {
+			continue
+		}
+
+		data, _ := json.Marshal(payload)
+		if err := dt.publish(streams.StateSubjectPrefix+read.Name, data); err != nil {
+			log.Printf("[STATE] ERROR: Failed to publish state read %s: %v", read.Name, err)
+		}
+	}
+	return nil
+}
+
+// Handle GET /admin/state-reads listing the registered reads
+func (dt *SomniaStream) handleListStateReads(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"reads": dt.state.list()})
+}
+
+// Handle PUT /admin/state-reads/:name registering or replacing a read
+func (dt *SomniaStream) handlePutStateRead(c *gin.Context) {
+	var read stateRead
+	if err := c.ShouldBindJSON(&read); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	read.Name = c.Param("name")
+	if err := read.compile(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	read.CreatedAt = time.Now().Unix()
+
+	data, _ := json.Marshal(read)
+	if _, err := dt.state.kv.Put(read.Name, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	dt.state.mu.Lock()
+	dt.state.reads[read.Name] = &read
+	dt.state.mu.Unlock()
+
+	log.Printf("[STATE] Registered state read %s: %s on %s", read.Name, read.Method, read.Address)
+	c.JSON(http.StatusOK, read)
+}
+
+// Handle DELETE /admin/state-reads/:name
+func (dt *SomniaStream) handleDeleteStateRead(c *gin.Context) {
+	name := c.Param("name")
+	dt.state.mu.Lock()
+	_, ok := dt.state.reads[name]
+	dt.state.mu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown state read"})
+		return
+	}
+	if err := dt.state.kv.Delete(name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	dt.state.mu.Lock()
+	delete(dt.state.reads, name)
+	dt.state.mu.Unlock()
+
+	log.Printf("[STATE] Removed state read %s", name)
+	c.Status(http.StatusNoContent)
+}
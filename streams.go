@@ -0,0 +1,538 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/streams"
+)
+
+// streamCatalog resolves stream names and runs the derived streams
+type streamCatalog struct {
+	mu      sync.RWMutex
+	derived map[string]*derivedStream
+	plugins []streams.Entry // Subjects of the plugin monitors
+}
+
+type derivedStream struct {
+	spec      streams.DerivedSpec
+	subject   string
+	sources   []string // Resolved source subjects
+	transform *streams.Transform
+	subs      []*nats.Subscription
+	received  uint64
+	matched   uint64
+}
+
+func newStreamCatalog() *streamCatalog {
+	return &streamCatalog{derived: make(map[string]*derivedStream)}
+}
+
+// lookup returns the NATS subject of a built-in or derived stream
+func (sc *streamCatalog) lookup(name string) (string, bool) {
+	if subject, ok := streams.LookupBuiltin(name); ok {
+		return subject, true
+	}
+
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	if ds, ok := sc.derived[name]; ok {
+		return ds.subject, true
+	}
+	for _, entry := range sc.plugins {
+		if entry.Name == name {
+			return entry.Subject, true
+		}
+	}
+	return "", false
+}
+
+// setPlugins lists the streams of the plugin monitors
+func (sc *streamCatalog) setPlugins(entries []streams.Entry) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.plugins = entries
+}
+
+// list returns every built-in and plugin stream followed by the derived
+// streams sorted by name
+func (sc *streamCatalog) list() []streams.Entry {
+	entries := append([]streams.Entry(nil), streams.Builtin...)
+
+	sc.mu.RLock()
+	entries = append(entries, sc.plugins...)
+	derived := make([]streams.Entry, 0, len(sc.derived))
+	for _, ds := range sc.derived {
+		spec := ds.spec
+		derived = append(derived, streams.Entry{
+			Name:        spec.Name,
+			Subject:     ds.subject,
+			Description: spec.Description,
+			Derived:     &spec,
+		})
+	}
+	sc.mu.RUnlock()
+
+	sort.Slice(derived, func(i, j int) bool { return derived[i].Name < derived[j].Name })
+	return append(entries, derived...)
+}
+
+// Validate a derived stream spec and resolve its sources to NATS subjects
+func (dt *SomniaStream) validateDerivedStream(spec *streams.DerivedSpec) ([]string, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if _, exists := dt.streams.lookup(spec.Name); exists {
+		return nil, fmt.Errorf("stream %q already exists", spec.Name)
+	}
+
+	own := streams.DerivedSubjectPrefix + spec.Name
+	subjects := make([]string, 0, len(spec.Sources))
+	for _, source := range spec.Sources {
+		subject, ok := dt.streams.lookup(source)
+		if !ok {
+			if !strings.HasPrefix(source, "eth.") && !strings.HasPrefix(source, streams.DerivedSubjectPrefix) {
+				return nil, fmt.Errorf("unknown source %q", source)
+			}
+			subject = source
+		}
+		if strings.HasPrefix(subject, streams.DerivedSubjectPrefix) && strings.ContainsAny(subject, "*>") {
+			return nil, fmt.Errorf("source %q: derived sources can't use wildcards", source)
+		}
+		if subject == own {
+			return nil, fmt.Errorf("source %q is the stream itself", source)
+		}
+		subjects = append(subjects, subject)
+	}
+	if cycle := dt.streams.feeds(subjects, own); cycle != "" {
+		return nil, fmt.Errorf("source %q already reads from %s, which would form a cycle", cycle, spec.Name)
+	}
+	return subjects, nil
+}
+
+// feeds returns the source whose derived streams, followed through their own
+// sources, include subject, or "" when none does
+func (sc *streamCatalog) feeds(sources []string, subject string) string {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	bySubject := make(map[string]*derivedStream, len(sc.derived))
+	for _, ds := range sc.derived {
+		bySubject[ds.subject] = ds
+	}
+	for _, source := range sources {
+		visited := map[string]bool{}
+		pending := []string{source}
+		for len(pending) > 0 {
+			next := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			ds, ok := bySubject[next]
+			if !ok {
+				continue
+			}
+			for _, upstream := range ds.sources {
+				if upstream == subject {
+					return source
+				}
+				pending = append(pending, upstream)
+			}
+		}
+	}
+	return ""
+}
+
+// Create the JetStream stream for a derived stream and start feeding it from its sources
+func (dt *SomniaStream) startDerivedStream(spec streams.DerivedSpec, sources []string) error {
+	subject := streams.DerivedSubjectPrefix + spec.Name
+	streamConfig := spec.StreamConfig(dt.ns)
+
+	if _, err := dt.js.StreamInfo(streamConfig.Name); err != nil {
+		if _, err := dt.js.AddStream(streamConfig); err != nil {
+			return err
+		}
+	} else if _, err := dt.js.UpdateStream(streamConfig); err != nil {
+		return err
+	}
+
+	transform, err := streams.CompileTransform(spec.Transform)
+	if err != nil {
+		return err
+	}
+	ds := &derivedStream{spec: spec, subject: subject, sources: sources, transform: transform}
+	for _, source := range sources {
+		sub, err := dt.natsConn.Subscribe(dt.ns.Subject(source), func(msg *nats.Msg) {
+			dt.forwardDerived(ds, msg)
+		})
+		if err != nil {
+			for _, s := range ds.subs {
+				_ = s.Unsubscribe()
+			}
+			return err
+		}
+		ds.subs = append(ds.subs, sub)
+	}
+
+	dt.streams.mu.Lock()
+	dt.streams.derived[spec.Name] = ds
+	dt.streams.mu.Unlock()
+
+	log.Printf("[STREAMS] Derived stream %s started (%s <- %v)", spec.Name, subject, sources)
+	return nil
+}
+
+// Filter a source message and republish the matching payloads on the derived subject
+func (dt *SomniaStream) forwardDerived(ds *derivedStream, msg *nats.Msg) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(msg.Data, &payload); err != nil {
+		return
+	}
+
+	candidates := []interface{}{payload}
+	if ds.spec.Each != "" {
+		items, _ := streams.LookupField(payload, ds.spec.Each).([]interface{})
+		candidates = items
+	}
+
+	for _, candidate := range candidates {
+		dt.streams.mu.Lock()
+		ds.received++
+		dt.streams.mu.Unlock()
+
+		if !streams.MatchFilters(candidate, ds.spec.Filters) {
+			continue
+		}
+
+		data := msg.Data
+		if ds.spec.Each != "" {
+			data, _ = json.Marshal(map[string]interface{}{
+				"source":    msg.Subject,
+				"item":      candidate,
+				"timestamp": time.Now().Unix(),
+			})
+		}
+		data, ok := ds.transform.ApplyJSON(data)
+		if !ok {
+			continue
+		}
+		if err := dt.publish(ds.subject, data); err != nil {
+			log.Printf("[STREAMS] ERROR: Failed to publish to %s: %v", ds.subject, err)
+			return
+		}
+
+		dt.streams.mu.Lock()
+		ds.matched++
+		dt.streams.mu.Unlock()
+	}
+}
+
+// Stop a derived stream, delete its JetStream storage and forget its definition
+func (dt *SomniaStream) deleteDerivedStream(name string) error {
+	dt.streams.mu.Lock()
+	ds, ok := dt.streams.derived[name]
+	delete(dt.streams.derived, name)
+	dt.streams.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown derived stream %q", name)
+	}
+
+	for _, sub := range ds.subs {
+		_ = sub.Unsubscribe()
+	}
+	if err := dt.js.DeleteStream(dt.ns.Stream(streams.DerivedStreamPrefix + name)); err != nil && !errors.Is(err, nats.ErrStreamNotFound) {
+		log.Printf("[STREAMS] ERROR: Failed to delete stream for %s: %v", name, err)
+	}
+	if dt.streamDefs != nil {
+		if err := dt.streamDefs.Delete(name); err != nil && !errors.Is(err, nats.ErrKeyNotFound) {
+			log.Printf("[STREAMS] ERROR: Failed to delete definition of %s: %v", name, err)
+		}
+	}
+
+	log.Printf("[STREAMS] Derived stream %s deleted", name)
+	return nil
+}
+
+// Restart the derived streams stored in the STREAM_DEFINITIONS bucket
+func (dt *SomniaStream) restoreDerivedStreams() {
+	if dt.streamDefs == nil {
+		return
+	}
+
+	names, err := dt.streamDefs.Keys()
+	if err != nil {
+		if !errors.Is(err, nats.ErrNoKeysFound) {
+			log.Printf("[STREAMS] ERROR: Failed to list stream definitions: %v", err)
+		}
+		return
+	}
+
+	for _, name := range names {
+		entry, err := dt.streamDefs.Get(name)
+		if err != nil {
+			continue
+		}
+		var spec streams.DerivedSpec
+		if err := json.Unmarshal(entry.Value(), &spec); err != nil {
+			log.Printf("[STREAMS] ERROR: Invalid definition for %s: %v", name, err)
+			continue
+		}
+		sources, err := dt.validateDerivedStream(&spec)
+		if err == nil {
+			err = dt.startDerivedStream(spec, sources)
+		}
+		if err != nil {
+			log.Printf("[STREAMS] ERROR: Failed to restore derived stream %s: %v", name, err)
+		}
+	}
+}
+
+// Handle POST /admin/streams declaring a new derived stream
+func (dt *SomniaStream) handleCreateStream(c *gin.Context) {
+	var spec streams.DerivedSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sources, err := dt.validateDerivedStream(&spec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	spec.CreatedAt = time.Now().Unix()
+
+	if err := dt.startDerivedStream(spec, sources); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if dt.streamDefs != nil {
+		data, _ := json.Marshal(spec)
+		if _, err := dt.streamDefs.Put(spec.Name, data); err != nil {
+			log.Printf("[STREAMS] ERROR: Failed to store definition of %s: %v", spec.Name, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name":    spec.Name,
+		"subject": streams.DerivedSubjectPrefix + spec.Name,
+		"sse":     "/sse/" + spec.Name,
+		"spec":    spec,
+	})
+}
+
+// Handle GET /admin/streams listing derived streams with forwarding counters
+func (dt *SomniaStream) handleListDerivedStreams(c *gin.Context) {
+	dt.streams.mu.RLock()
+	derived := make([]gin.H, 0, len(dt.streams.derived))
+	for _, ds := range dt.streams.derived {
+		derived = append(derived, gin.H{
+			"name":     ds.spec.Name,
+			"subject":  ds.subject,
+			"spec":     ds.spec,
+			"received": ds.received,
+			"matched":  ds.matched,
+		})
+	}
+	dt.streams.mu.RUnlock()
+
+	sort.Slice(derived, func(i, j int) bool { return derived[i]["name"].(string) < derived[j]["name"].(string) })
+	c.JSON(http.StatusOK, gin.H{"streams": derived})
+}
+
+func (dt *SomniaStream) handleDeleteStream(c *gin.Context) {
+	if err := dt.deleteDerivedStream(c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Resolve a public stream name to its namespaced subject and the JetStream
+// stream storing it
+func (dt *SomniaStream) backingStream(name string) (string, string, error) {
+	subject, ok := dt.streams.lookup(name)
+	if !ok {
+		return "", "", fmt.Errorf("unknown stream %q", name)
+	}
+	subject = dt.ns.Subject(subject)
+	streamName, err := dt.js.StreamNameBySubject(subject)
+	if err != nil {
+		return "", "", fmt.Errorf("no JetStream stream stores %s", subject)
+	}
+	return subject, streamName, nil
+}
+
+// Handle GET /streams/:name/stats exposing storage and consumer lag figures
+// for the JetStream stream backing a public stream name
+func (dt *SomniaStream) handleStreamStats(c *gin.Context) {
+	// Check the scope first, so callers without it can't probe which streams exist
+	name := c.Param("name")
+	if !dt.streamAllowed(c, name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("access to stream %q denied", name)})
+		return
+	}
+	subject, streamName, err := dt.backingStream(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := dt.js.StreamInfo(streamName, &nats.StreamInfoRequest{SubjectsFilter: subject})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	state := info.State
+
+	stats := gin.H{
+		"name":          name,
+		"subject":       subject,
+		"stream":        streamName,
+		"messages":      state.Msgs,
+		"bytes":         state.Bytes,
+		"firstSeq":      state.FirstSeq,
+		"lastSeq":       state.LastSeq,
+		"subjectMsgs":   state.Subjects[subject],
+		"consumerCount": state.Consumers,
+		"maxAge":        info.Config.MaxAge.String(),
+		"maxMsgs":       info.Config.MaxMsgs,
+		"storage":       info.Config.Storage.String(),
+	}
+	if !state.FirstTime.IsZero() && state.Msgs > 0 {
+		stats["firstTime"] = state.FirstTime.Unix()
+		stats["lastTime"] = state.LastTime.Unix()
+		stats["oldestAgeSeconds"] = int64(time.Since(state.FirstTime).Seconds())
+		stats["newestAgeSeconds"] = int64(time.Since(state.LastTime).Seconds())
+	}
+
+	// Consumers reading this subject (or the whole stream) and how far behind they are
+	consumers := []gin.H{}
+	var maxLag uint64
+	for ci := range dt.js.Consumers(streamName) {
+		if ci.Config.FilterSubject != "" && ci.Config.FilterSubject != subject {
+			continue
+		}
+		lag := ci.NumPending + uint64(ci.NumAckPending)
+		if lag > maxLag {
+			maxLag = lag
+		}
+		consumer := gin.H{
+			"name":           ci.Name,
+			"created":        ci.Created.Unix(),
+			"deliveredSeq":   ci.Delivered.Stream,
+			"ackFloorSeq":    ci.AckFloor.Stream,
+			"numPending":     ci.NumPending,
+			"numAckPending":  ci.NumAckPending,
+			"numRedelivered": ci.NumRedelivered,
+			"lag":            lag,
+			"pushBound":      ci.PushBound,
+		}
+		if ci.Delivered.Last != nil {
+			consumer["lastDelivered"] = ci.Delivered.Last.Unix()
+		}
+		consumers = append(consumers, consumer)
+	}
+	stats["consumers"] = consumers
+	stats["maxConsumerLag"] = maxLag
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// Handle DELETE /admin/streams/:name/messages purging stored messages of a
+// stream's subject: everything, everything before ?before_seq=, or all but the
+// newest ?keep= messages
+func (dt *SomniaStream) handlePurgeStream(c *gin.Context) {
+	name := c.Param("name")
+	subject, streamName, err := dt.backingStream(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	req := &nats.StreamPurgeRequest{Subject: subject}
+	if beforeSeq := c.Query("before_seq"); beforeSeq != "" {
+		if req.Sequence, err = strconv.ParseUint(beforeSeq, 10, 64); err != nil || req.Sequence == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before_seq must be a positive integer"})
+			return
+		}
+	}
+	if keep := c.Query("keep"); keep != "" {
+		if req.Keep, err = strconv.ParseUint(keep, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "keep must be a non-negative integer"})
+			return
+		}
+	}
+	if req.Sequence > 0 && req.Keep > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "before_seq and keep are mutually exclusive"})
+		return
+	}
+
+	before, err := dt.js.StreamInfo(streamName, &nats.StreamInfoRequest{SubjectsFilter: subject})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dt.js.PurgeStream(streamName, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := dt.js.StreamInfo(streamName, &nats.StreamInfoRequest{SubjectsFilter: subject})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	purged := before.State.Subjects[subject] - after.State.Subjects[subject]
+	log.Printf("[STREAMS] Purged %d messages of %s from %s (before_seq=%d keep=%d)", purged, subject, streamName, req.Sequence, req.Keep)
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":        name,
+		"subject":     subject,
+		"stream":      streamName,
+		"purged":      purged,
+		"remaining":   after.State.Subjects[subject],
+		"bytesBefore": before.State.Bytes,
+		"bytesAfter":  after.State.Bytes,
+	})
+}
+
+// List available streams
+func (dt *SomniaStream) listStreams(c *gin.Context) {
+	streams := make(map[string]string)
+	for _, entry := range dt.streams.list() {
+		if !dt.streamAllowed(c, entry.Name) {
+			continue
+		}
+		kind := "JetStream"
+		if entry.Derived != nil {
+			kind = "JetStream, derived"
+		}
+		streams[entry.Name] = fmt.Sprintf("%s - %s (%s)", entry.Subject, entry.Description, kind)
+	}
+
+	c.JSON(200, gin.H{
+		"streams": streams,
+		"usage": map[string]string{
+			"websocket": "/ws (send {\"op\":\"subscribe\",\"stream\":\"blocks\"})",
+			"sse":       "/sse/:stream (e.g., /sse/pending)",
+			"detail":    "/sse/blocks?detail=header|hashes|full",
+			"all_ws":    "/ws commands: subscribe and unsubscribe {\"op\",\"stream\"}, set-filter {\"filters\"}, ack {\"ids\"|\"upTo\"}; one connection can hold several subscriptions",
+			"all_sse":   "/sse?streams=blocks,gasPrice,logs (merged feed)",
+		},
+		"jetstream": "All streams use NATS JetStream for persistence and replay",
+	})
+}
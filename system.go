@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/streams"
+)
+
+// Severities of system events
+const (
+	severityInfo    = "info"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// publishSystemEvent publishes an operational event on somnia.system, e.g.
+// {"type":"monitor_error","severity":"error","message":"...","monitor":"logs"}
+func (dt *SomniaStream) publishSystemEvent(eventType, severity, message string, fields map[string]interface{}) {
+	event := map[string]interface{}{
+		"type":      eventType,
+		"severity":  severity,
+		"message":   message,
+		"timestamp": time.Now().Unix(),
+	}
+	for key, value := range fields {
+		event[key] = value
+	}
+
+	data, _ := json.Marshal(event)
+	data = withChainID(data, dt.chainID)
+	// Async so events raised while NATS reconnects don't block the caller
+	if _, err := dt.js.PublishAsync(dt.ns.Subject(streams.SystemSubject), data); err != nil {
+		log.Printf("[SYSTEM] ERROR: Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// watchNATSConnection reports NATS disconnects and reconnects as system events
+func (dt *SomniaStream) watchNATSConnection() {
+	dt.natsConn.SetDisconnectErrHandler(func(_ *nats.Conn, err error) {
+		message := "disconnected from NATS"
+		if err != nil {
+			message += ": " + err.Error()
+		}
+		log.Printf("[SYSTEM] %s", message)
+		dt.publishSystemEvent("nats_disconnected", severityError, message, nil)
+	})
+	dt.natsConn.SetReconnectHandler(func(nc *nats.Conn) {
+		log.Printf("[SYSTEM] Reconnected to NATS at %s", nc.ConnectedUrlRedacted())
+		dt.publishSystemEvent("nats_reconnected", severityInfo, "reconnected to NATS", map[string]interface{}{
+			"server": nc.ConnectedUrlRedacted(),
+		})
+	})
+}
+
+// clientDropped reports a streaming client closed by the server
+func (dt *SomniaStream) clientDropped(cc *clientConn, reason string) {
+	fields := map[string]interface{}{
+		"client":     cc.id,
+		"stream":     cc.stream,
+		"remoteAddr": cc.remoteAddr,
+		"reason":     reason,
+	}
+	if cc.key != nil {
+		fields["keyId"] = cc.key.ID
+	}
+	dt.publishSystemEvent("client_dropped", severityWarning, "streaming client "+cc.id+" dropped: "+reason, fields)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"somnia-stream/pkg/client"
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// tailFilters collects repeated --filter flags
+type tailFilters []streams.Filter
+
+func (f *tailFilters) String() string {
+	return fmt.Sprint(*f)
+}
+
+// Set parses field=value, field!=value, field>value, field>=value,
+// field<value, field<=value, field~value (contains) or a bare field (exists)
+func (f *tailFilters) Set(expr string) error {
+	for _, op := range []struct{ token, name string }{
+		{">=", "gte"}, {"<=", "lte"}, {"!=", "ne"}, {"~", "contains"}, {"=", "eq"}, {">", "gt"}, {"<", "lt"},
+	} {
+		field, raw, ok := strings.Cut(expr, op.token)
+		if !ok {
+			continue
+		}
+		if field = strings.TrimSpace(field); field == "" {
+			return fmt.Errorf("missing field in filter %q", expr)
+		}
+		// Numbers, booleans and quoted strings are JSON; anything else is a plain string
+		var value interface{}
+		raw = strings.TrimSpace(raw)
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		*f = append(*f, streams.Filter{Field: field, Op: op.name, Value: value})
+		return nil
+	}
+	*f = append(*f, streams.Filter{Field: strings.TrimSpace(expr), Op: "exists"})
+	return nil
+}
+
+const tailUsage = `Usage: somnia-stream tail [flags] <stream>
+
+Print live messages of a stream from a running instance, or straight from
+NATS with --nats.
+
+Examples:
+  somnia-stream tail blocks --detail=header
+  somnia-stream tail pending --format=json | jq .added
+  somnia-stream tail blocks --filter 'txCount>=10' --filter 'miner=0xabc...'
+  somnia-stream tail gasPrice --nats
+  somnia-stream tail blocks --template 'Block #{{.number}} with {{.txCount}} txs'
+
+Flags:
+`
+
+// runTail implements the tail subcommand and returns the process exit code
+func runTail(args []string) int {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), tailUsage)
+		fs.PrintDefaults()
+	}
+	server := fs.String("server", envOr("SOMNIA_STREAM_URL", "http://localhost:8080"), "URL of the running instance (SOMNIA_STREAM_URL)")
+	apiKey := fs.String("api-key", os.Getenv("SOMNIA_API_KEY"), "API key (SOMNIA_API_KEY)")
+	token := fs.String("token", os.Getenv("SOMNIA_TOKEN"), "JWT bearer token (SOMNIA_TOKEN)")
+	direct := fs.Bool("nats", false, "read from NATS JetStream using NATS_URL and the NATS_* settings instead of the HTTP API")
+	format := fs.String("format", "pretty", "output format: pretty or json (one message per line)")
+	tmpl := fs.String("template", "", "Go template rendering each message, e.g. 'Block #{{.number}} with {{.txCount}} txs' (overrides --format)")
+	detail := fs.String("detail", "", "block detail level on the blocks stream: header, hashes or full")
+	fromSeq := fs.Uint64("from-seq", 0, "replay stored messages after this stream sequence")
+	limit := fs.Int("limit", 0, "exit after this many messages (0 = until interrupted)")
+	var filters tailFilters
+	fs.Var(&filters, "filter", "only print messages matching field<op>value, op one of = != > >= < <= ~ (repeatable)")
+
+	// Accept flags after the stream name, e.g. tail blocks --format=json
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	stream := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	if *format != "pretty" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected pretty or json\n", *format)
+		return 2
+	}
+	var render *tailTemplate
+	if *tmpl != "" {
+		var err error
+		if render, err = newTailTemplate(stream, *tmpl); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid template: %v\n", err)
+			return 2
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	printed := 0
+	errLimit := errors.New("limit reached")
+	handler := func(event client.Event) error {
+		var payload interface{}
+		if err := json.Unmarshal(event.Data, &payload); err != nil {
+			return fmt.Errorf("decode message %d: %v", event.ID, err)
+		}
+		if !streams.MatchFilters(payload, filters) {
+			return nil
+		}
+		switch {
+		case render != nil:
+			if err := render.print(os.Stdout, event); err != nil {
+				// One message the template can't render doesn't end the tail
+				fmt.Fprintf(os.Stderr, "! skipping message %d: %v\n", event.ID, err)
+				return nil
+			}
+		case *format == "json":
+			fmt.Println(string(event.Data))
+		default:
+			printPretty(os.Stdout, stream, event, payload)
+		}
+		printed++
+		if *limit > 0 && printed >= *limit {
+			return errLimit
+		}
+		return nil
+	}
+
+	var err error
+	if *direct {
+		err = tailNATS(ctx, stream, *detail, *fromSeq, handler)
+	} else {
+		c := client.New(*server, client.WithAPIKey(*apiKey), client.WithToken(*token))
+		err = c.Subscribe(ctx, stream, client.SubscribeOptions{
+			Detail:     *detail,
+			ResumeFrom: *fromSeq,
+			OnNotice: func(n client.Notice) {
+				fmt.Fprintf(os.Stderr, "! server dropped %d messages (%s policy)\n", n.Dropped, n.Policy)
+			},
+			OnReconnect: func(err error, delay time.Duration) {
+				fmt.Fprintf(os.Stderr, "! disconnected (%v), reconnecting in %s\n", err, delay)
+			},
+		}, handler)
+	}
+	if err == nil || errors.Is(err, errLimit) || errors.Is(err, context.Canceled) {
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "tail %s: %v\n", stream, err)
+	return 1
+}
+
+// tailNATS consumes a stream straight from JetStream
+func tailNATS(ctx context.Context, stream, detail string, fromSeq uint64, handler func(client.Event) error) error {
+	if detail != "" && stream == "blocks" {
+		subject, ok := monitor.BlockDetailSubjects[detail]
+		if !ok {
+			return fmt.Errorf("detail must be one of header, hashes, full")
+		}
+		stream = subject
+	}
+
+	js, ns, closeNATS, err := connectCLI(ctx, "somnia-stream-tail")
+	if err != nil {
+		return err
+	}
+	defer closeNATS()
+	return client.ConsumeNamespace(ctx, js, ns, stream, fromSeq, handler)
+}
+
+// cliNamespace resolves the subject namespace of SUBJECT_NAMESPACE for the
+// command-line tools, fetching the chain ID from RPC_ENDPOINT
+func cliNamespace(ctx context.Context, cfg *config.Config) (streams.Namespace, error) {
+	if cfg.SubjectNamespace == "" {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	eth, err := ethclient.DialContext(ctx, cfg.RPCEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("connect to RPC at %s: %v", endpointHost(cfg.RPCEndpoint), err)
+	}
+	defer eth.Close()
+	chainID, err := eth.ChainID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("fetch chain ID for SUBJECT_NAMESPACE: %v", err)
+	}
+	return streams.NewNamespace(cfg.SubjectNamespace, chainID)
+}
+
+// tailTemplate renders messages with a Go template. Numbers are kept as
+// written, so {{.number}} prints 1234567 rather than 1.234567e+06.
+type tailTemplate struct {
+	tmpl  *template.Template
+	event client.Event // Message being rendered, for the id function
+}
+
+// newTailTemplate parses a template with the json, stream and id functions
+func newTailTemplate(stream, text string) (*tailTemplate, error) {
+	t := &tailTemplate{}
+	tmpl, err := template.New("tail").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"stream": func() string { return stream },
+		"id":     func() uint64 { return t.event.ID },
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// print renders one message on its own line
+func (t *tailTemplate) print(w io.Writer, event client.Event) error {
+	decoder := json.NewDecoder(bytes.NewReader(event.Data))
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return err
+	}
+	t.event = event
+	var out bytes.Buffer
+	if err := t.tmpl.Execute(&out, payload); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// printPretty prints a one-line summary of well-known payloads and indented
+// JSON for everything else
+func printPretty(w io.Writer, stream string, event client.Event, payload interface{}) {
+	prefix := fmt.Sprintf("%s %s #%d", time.Now().Format("15:04:05"), stream, event.ID)
+	field := func(path string) interface{} { return streams.LookupField(payload, path) }
+
+	switch {
+	case strings.HasPrefix(stream, "blocks"):
+		var gasUsed string
+		if used, ok := field("gasUsed").(float64); ok {
+			if gasLimit, ok := field("gasLimit").(float64); ok && gasLimit > 0 {
+				gasUsed = fmt.Sprintf(" gas %.1f%%", used/gasLimit*100)
+			}
+		}
+		fmt.Fprintf(w, "%s block %v %v txs=%v%s\n", prefix, field("number"), field("hash"), field("txCount"), gasUsed)
+		return
+	case stream == "pending" && field("type") == "delta":
+		removed, _ := field("removed").([]interface{})
+		fmt.Fprintf(w, "%s +%v -%d pool=%v\n", prefix, field("added"), len(removed), field("count"))
+		return
+	case stream == "gasPrice" || stream == "gas":
+		if gwei, ok := field("gwei").(float64); ok {
+			fmt.Fprintf(w, "%s %.4f gwei\n", prefix, gwei)
+			return
+		}
+	case stream == "whales":
+		if value, ok := field("value").(string); ok {
+			if wei, ok := new(big.Float).SetString(value); ok {
+				ether, _ := new(big.Float).Quo(wei, big.NewFloat(1e18)).Float64()
+				fmt.Fprintf(w, "%s %v -> %v %.4f\n", prefix, field("from"), field("to"), ether)
+				return
+			}
+		}
+	}
+
+	indented, _ := json.MarshalIndent(payload, "", "  ")
+	fmt.Fprintf(w, "%s\n%s\n", prefix, indented)
+}
+
+// envOr returns an environment variable or a default
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
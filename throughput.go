@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockSample is the per-block data needed for throughput aggregates
+type blockSample struct {
+	number     uint64
+	blockTime  uint64
+	observedAt time.Time
+	txCount    int
+	gasUsed    uint64
+	gasLimit   uint64
+}
+
+// throughputTracker keeps recently observed blocks for rolling aggregates
+type throughputTracker struct {
+	mu        sync.Mutex
+	samples   []blockSample
+	windows   []time.Duration
+	maxWindow time.Duration
+}
+
+func newThroughputTracker(windows []time.Duration) *throughputTracker {
+	if len(windows) == 0 {
+		windows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+	}
+	var maxWindow time.Duration
+	for _, w := range windows {
+		maxWindow = max(maxWindow, w)
+	}
+	return &throughputTracker{windows: windows, maxWindow: maxWindow}
+}
+
+// setWindows replaces the aggregation windows, keeping the collected samples
+func (t *throughputTracker) setWindows(windows []time.Duration) {
+	fresh := newThroughputTracker(windows)
+
+	t.mu.Lock()
+	t.windows = fresh.windows
+	t.maxWindow = fresh.maxWindow
+	t.mu.Unlock()
+}
+
+// currentWindows returns a copy of the configured windows
+func (t *throughputTracker) currentWindows() []time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]time.Duration(nil), t.windows...)
+}
+
+func (t *throughputTracker) observe(block *types.Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.samples = append(t.samples, blockSample{
+		number:     block.NumberU64(),
+		blockTime:  block.Time(),
+		observedAt: now,
+		txCount:    len(block.Transactions()),
+		gasUsed:    block.GasUsed(),
+		gasLimit:   block.GasLimit(),
+	})
+
+	// Drop samples that no window needs anymore
+	cutoff := 0
+	for cutoff < len(t.samples) && now.Sub(t.samples[cutoff].observedAt) > t.maxWindow {
+		cutoff++
+	}
+	t.samples = t.samples[cutoff:]
+}
+
+// aggregate computes throughput stats over the samples observed within window.
+// Polling may skip blocks, so rates are derived from the block number and
+// timestamp span rather than by summing only the sampled blocks.
+func (t *throughputTracker) aggregate(window time.Duration) map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var inWindow []blockSample
+	for _, s := range t.samples {
+		if now.Sub(s.observedAt) <= window {
+			inWindow = append(inWindow, s)
+		}
+	}
+
+	result := map[string]interface{}{
+		"window":        window.String(),
+		"sampledBlocks": len(inWindow),
+	}
+	if len(inWindow) < 2 {
+		return result
+	}
+
+	first, last := inWindow[0], inWindow[len(inWindow)-1]
+	blocks := last.number - first.number
+	span := float64(last.blockTime - first.blockTime)
+	if span <= 0 {
+		// Sub-second blocks can share a timestamp; fall back to wall clock
+		span = last.observedAt.Sub(first.observedAt).Seconds()
+	}
+
+	var txs int
+	var utilization float64
+	for _, s := range inWindow {
+		txs += s.txCount
+		if s.gasLimit > 0 {
+			utilization += float64(s.gasUsed) / float64(s.gasLimit)
+		}
+	}
+	avgTxPerBlock := float64(txs) / float64(len(inWindow))
+
+	result["fromBlock"] = first.number
+	result["toBlock"] = last.number
+	result["blocks"] = blocks
+	result["avgTxPerBlock"] = avgTxPerBlock
+	result["gasUtilization"] = utilization / float64(len(inWindow))
+	result["coverage"] = float64(len(inWindow)) / float64(blocks+1)
+	if span > 0 && blocks > 0 {
+		blocksPerSecond := float64(blocks) / span
+		result["blockIntervalSeconds"] = span / float64(blocks)
+		result["blocksPerSecond"] = blocksPerSecond
+		result["tps"] = avgTxPerBlock * blocksPerSecond
+	}
+
+	return result
+}
+
+// Monitor throughput aggregates
+func (dt *SomniaStream) monitorThroughput(ctx context.Context) {
+	dt.runMonitor(ctx, "throughput", dt.publishThroughput)
+}
+
+// Publish rolling TPS, block interval and gas utilization for every configured window
+func (dt *SomniaStream) publishThroughput() error {
+	configured := dt.throughput.currentWindows()
+	windows := make(map[string]interface{}, len(configured))
+	for _, w := range configured {
+		windows[w.String()] = dt.throughput.aggregate(w)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"windows":   windows,
+		"timestamp": time.Now().Unix(),
+	})
+	err := dt.publish("eth.stats.throughput", data)
+	return err
+}
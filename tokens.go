@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/nats-io/nats.go"
+)
+
+// tokenMetadataBucket caches token metadata by lowercase address
+const tokenMetadataBucket = "TOKEN_METADATA"
+
+// tokenFetchBatch is the most tokens resolved in one multicall
+const tokenFetchBatch = 50
+
+// Topics of the ERC-20, ERC-721 and ERC-1155 events token metadata is added to
+var (
+	topicTransfer       = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	topicApproval       = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+	topicApprovalForAll = crypto.Keccak256Hash([]byte("ApprovalForAll(address,address,bool)"))
+	topicTransferSingle = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	topicTransferBatch  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+)
+
+// Token metadata getters
+var (
+	selectorTokenName     = crypto.Keccak256([]byte("name()"))[:4]
+	selectorTokenSymbol   = crypto.Keccak256([]byte("symbol()"))[:4]
+	selectorTokenDecimals = crypto.Keccak256([]byte("decimals()"))[:4]
+)
+
+// multicall3ABI is the aggregate3 method of Multicall3
+var multicall3ABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(`[{"name":"aggregate3","type":"function","stateMutability":"payable",
+		"inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],
+		"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]}]`))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// multicallCall and multicallResult mirror the aggregate3 tuples
+type multicallCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// tokenMetadata is the cached metadata of a contract. Contracts that answer
+// none of the getters are cached too, with every field empty.
+type tokenMetadata struct {
+	Address   string `json:"address"`
+	Name      string `json:"name,omitempty"`
+	Symbol    string `json:"symbol,omitempty"`
+	Decimals  *uint8 `json:"decimals,omitempty"` // NFTs have none
+	FetchedAt int64  `json:"fetchedAt"`
+}
+
+// known reports whether the contract answered any getter
+func (m *tokenMetadata) known() bool {
+	return m.Name != "" || m.Symbol != "" || m.Decimals != nil
+}
+
+// tokenCache resolves name, symbol and decimals of token contracts the first
+// time they emit a token event. Lookups run in the background, batched into
+// Multicall3 calls, and are cached in the TOKEN_METADATA bucket.
+type tokenCache struct {
+	kv        nats.KeyValue // Bound in setupKeyValueStores
+	client    *ethclient.Client
+	multicall common.Address // Zero to call every getter separately
+	ttl       time.Duration
+
+	mu      sync.RWMutex
+	tokens  *lruCache[common.Address, *tokenMetadata] // Falls back to the bucket when evicted
+	queued  map[common.Address]bool
+	fetches chan common.Address
+}
+
+// newTokenCache returns a token metadata cache, or nil when disabled
+func newTokenCache(enabled bool, client *ethclient.Client, multicall string, ttl time.Duration, size int) *tokenCache {
+	if !enabled {
+		return nil
+	}
+	t := &tokenCache{
+		client:  client,
+		ttl:     ttl,
+		tokens:  newLRUCache[common.Address, *tokenMetadata](max(size, 1)),
+		queued:  make(map[common.Address]bool),
+		fetches: make(chan common.Address, 1024),
+	}
+	if common.IsHexAddress(multicall) {
+		t.multicall = common.HexToAddress(multicall)
+	}
+	return t
+}
+
+// bind loads the cached metadata from the key-value bucket
+func (t *tokenCache) bind(kv nats.KeyValue) error {
+	if t == nil {
+		return nil
+	}
+	t.kv = kv
+	keys, err := kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, key := range keys[:min(len(keys), t.tokens.size)] {
+		if meta := t.load(key); meta != nil {
+			t.tokens.add(common.HexToAddress(meta.Address), meta)
+		}
+	}
+	log.Printf("[TOKENS] Loaded metadata of %d of %d contracts", t.tokens.len(), len(keys))
+	return nil
+}
+
+// load reads the metadata of a contract from the bucket
+func (t *tokenCache) load(key string) *tokenMetadata {
+	if t.kv == nil {
+		return nil
+	}
+	entry, err := t.kv.Get(key)
+	if err != nil {
+		return nil
+	}
+	var meta tokenMetadata
+	if err := json.Unmarshal(entry.Value(), &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+// lookup returns the cached metadata of a contract, from memory or the
+// bucket, and queues a lookup when the contract wasn't seen before or its
+// metadata is older than the TTL
+func (t *tokenCache) lookup(addr common.Address) *tokenMetadata {
+	meta, ok := t.tokens.get(addr)
+	if !ok {
+		if meta = t.load(strings.ToLower(addr.Hex())); meta != nil {
+			t.tokens.add(addr, meta)
+			ok = true
+		}
+	}
+	if ok && (t.ttl <= 0 || time.Since(time.Unix(meta.FetchedAt, 0)) < t.ttl) {
+		return meta
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.queued[addr] {
+		select {
+		case t.fetches <- addr:
+			t.queued[addr] = true
+		default: // Queued again the next time the token emits an event
+		}
+	}
+	return meta // Serve stale metadata until it is refreshed
+}
+
+// tokenStandard recognizes token events; ERC-20 and ERC-721 share the
+// Transfer and Approval signatures but index the amount or token ID
+func tokenStandard(topics []interface{}) string {
+	if len(topics) == 0 {
+		return ""
+	}
+	topic, _ := topics[0].(string)
+	switch common.HexToHash(topic) {
+	case topicTransfer, topicApproval:
+		if len(topics) == 4 {
+			return "erc721"
+		}
+		return "erc20"
+	case topicTransferSingle, topicTransferBatch:
+		return "erc1155"
+	case topicApprovalForAll:
+		return "erc721"
+	}
+	return ""
+}
+
+// annotate adds a token object with the standard and metadata of the
+// emitting contract to token event logs
+func (t *tokenCache) annotate(logs []map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	for _, entry := range logs {
+		topics, _ := entry["topics"].([]interface{})
+		standard := tokenStandard(topics)
+		if standard == "" {
+			continue
+		}
+		addr, ok := addressOf(entry["address"])
+		if !ok {
+			continue
+		}
+		meta := t.lookup(addr)
+		if meta == nil || !meta.known() {
+			continue
+		}
+		token := map[string]interface{}{"standard": standard}
+		if meta.Name != "" {
+			token["name"] = meta.Name
+		}
+		if meta.Symbol != "" {
+			token["symbol"] = meta.Symbol
+		}
+		if meta.Decimals != nil {
+			token["decimals"] = *meta.Decimals
+		}
+		entry["token"] = token
+	}
+}
+
+// run resolves queued contracts in batches until ctx is done
+func (t *tokenCache) run(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case addr := <-t.fetches:
+			batch := []common.Address{addr}
+		drain:
+			for len(batch) < tokenFetchBatch {
+				select {
+				case next := <-t.fetches:
+					batch = append(batch, next)
+				default:
+					break drain
+				}
+			}
+
+			fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			metas, err := t.fetch(fetchCtx, batch)
+			cancel()
+			if err != nil {
+				log.Printf("[TOKENS] WARNING: Failed to fetch metadata of %d contracts: %v", len(batch), err)
+			}
+			for _, meta := range metas {
+				t.store(meta)
+			}
+
+			t.mu.Lock()
+			for _, addr := range batch {
+				delete(t.queued, addr)
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// store caches metadata in memory and in the bucket
+func (t *tokenCache) store(meta *tokenMetadata) {
+	t.tokens.add(common.HexToAddress(meta.Address), meta)
+	if t.kv == nil {
+		return
+	}
+	data, _ := json.Marshal(meta)
+	if _, err := t.kv.Put(meta.Address, data); err != nil {
+		log.Printf("[TOKENS] WARNING: Failed to cache metadata of %s: %v", meta.Address, err)
+	}
+}
+
+// fetch calls name(), symbol() and decimals() of every contract, through
+// Multicall3 when available and one call per getter otherwise
+func (t *tokenCache) fetch(ctx context.Context, batch []common.Address) ([]*tokenMetadata, error) {
+	getters := [][]byte{selectorTokenName, selectorTokenSymbol, selectorTokenDecimals}
+	results := make([][]byte, len(batch)*len(getters)) // nil when the getter failed
+
+	multicallErr := errors.New("multicall disabled")
+	if t.multicall != (common.Address{}) {
+		calls := make([]multicallCall, 0, len(results))
+		for _, addr := range batch {
+			for _, getter := range getters {
+				calls = append(calls, multicallCall{Target: addr, AllowFailure: true, CallData: getter})
+			}
+		}
+		multicallErr = aggregate3(ctx, t.client, t.multicall, nil, calls, results)
+	}
+	if multicallErr != nil {
+		for i, addr := range batch {
+			for j, getter := range getters {
+				to := addr
+				out, err := t.client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: getter}, nil)
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if err == nil {
+					results[i*len(getters)+j] = out
+				}
+			}
+		}
+	}
+
+	metas := make([]*tokenMetadata, len(batch))
+	for i, addr := range batch {
+		meta := &tokenMetadata{Address: strings.ToLower(addr.Hex()), FetchedAt: time.Now().Unix()}
+		meta.Name = decodeTokenString(results[i*len(getters)])
+		meta.Symbol = decodeTokenString(results[i*len(getters)+1])
+		if out := results[i*len(getters)+2]; len(out) == 32 {
+			if decimals := new(big.Int).SetBytes(out); decimals.IsUint64() && decimals.Uint64() <= 255 {
+				d := uint8(decimals.Uint64())
+				meta.Decimals = &d
+			}
+		}
+		metas[i] = meta
+	}
+	return metas, nil
+}
+
+// aggregate3 runs calls through the Multicall3 contract at multicall at a
+// block (nil for the latest), filling results of the calls that succeeded
+func aggregate3(ctx context.Context, client *ethclient.Client, multicall common.Address, block *big.Int, calls []multicallCall, results [][]byte) error {
+	data, err := multicall3ABI.Pack("aggregate3", calls)
+	if err != nil {
+		return err
+	}
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &multicall, Data: data}, block)
+	if err != nil {
+		return err
+	}
+	values, err := multicall3ABI.Unpack("aggregate3", out)
+	if err != nil {
+		return err
+	}
+	returned := *abi.ConvertType(values[0], new([]multicallResult)).(*[]multicallResult)
+	if len(returned) != len(calls) {
+		return errors.New("multicall returned a different number of results")
+	}
+	for i, result := range returned {
+		if result.Success && len(result.ReturnData) > 0 {
+			results[i] = result.ReturnData
+		}
+	}
+	return nil
+}
+
+// decodeTokenString decodes a name() or symbol() result, which older tokens
+// such as MKR return as bytes32
+func decodeTokenString(out []byte) string {
+	if len(out) == 32 {
+		return strings.ToValidUTF8(string(bytes.TrimRight(out, "\x00")), "")
+	}
+	if s, err := unpackString(out); err == nil {
+		return strings.ToValidUTF8(s, "")
+	}
+	return ""
+}
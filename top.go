@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"somnia-stream/pkg/client"
+)
+
+const (
+	topRateWindow = 10 * time.Second // Per-stream rates are averaged over this window
+	topMaxErrors  = 8                // Recent errors kept on screen
+)
+
+// ANSI sequences for the full-screen view
+const (
+	ansiEnterScreen = "\x1b[?1049h\x1b[?25l" // Alternate screen, hidden cursor
+	ansiLeaveScreen = "\x1b[?25h\x1b[?1049l"
+	ansiRedraw      = "\x1b[H\x1b[2J"
+	ansiBold        = "\x1b[1m"
+	ansiDim         = "\x1b[2m"
+	ansiRed         = "\x1b[31m"
+	ansiGreen       = "\x1b[32m"
+	ansiYellow      = "\x1b[33m"
+	ansiReset       = "\x1b[0m"
+)
+
+const topUsage = `Usage: somnia-stream top [flags]
+
+Live terminal view of a running instance: chain head, TPS, gas price,
+pending pool size, per-stream message rates, component health and recent
+errors. Press Ctrl-C to quit.
+
+Flags:
+`
+
+// topStream tracks the messages received on one subscribed stream
+type topStream struct {
+	status   string      // connecting, live or the last error
+	arrivals []time.Time // Within topRateWindow
+	total    uint64
+}
+
+// topError is an entry of the recent errors panel
+type topError struct {
+	at      time.Time
+	source  string
+	message string
+}
+
+// topState is everything the screen shows, updated by the subscriptions
+type topState struct {
+	mu          sync.Mutex
+	started     time.Time
+	head        uint64
+	headTime    uint64
+	blockTime   time.Duration
+	txCount     int
+	gasUsed     float64 // Share of the gas limit used by the head block
+	tps         float64
+	tpsWindow   string
+	gwei        float64
+	pending     int
+	streams     map[string]*topStream
+	errors      []topError
+	health      *client.Health
+	healthError string
+}
+
+func newTopState(names []string) *topState {
+	s := &topState{started: time.Now(), streams: make(map[string]*topStream, len(names))}
+	for _, name := range names {
+		s.streams[name] = &topStream{status: "connecting"}
+	}
+	return s
+}
+
+// record counts a message of a stream and marks it live
+func (s *topState) record(stream string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.streams[stream]
+	st.status = "live"
+	st.total++
+	st.arrivals = append(st.arrivals, time.Now())
+}
+
+// setStatus changes a stream's status, e.g. after a disconnect
+func (s *topState) setStatus(stream, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams[stream].status = status
+}
+
+// addError appends to the recent errors, dropping the oldest
+func (s *topState) addError(source, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendError(source, message)
+}
+
+func (s *topState) appendError(source, message string) {
+	s.errors = append(s.errors, topError{at: time.Now(), source: source, message: message})
+	if len(s.errors) > topMaxErrors {
+		s.errors = s.errors[len(s.errors)-topMaxErrors:]
+	}
+}
+
+// update applies a stream message to the headline figures
+func (s *topState) update(stream string, event client.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch stream {
+	case "blocks":
+		var block client.Block
+		if json.Unmarshal(event.Data, &block) != nil {
+			return
+		}
+		number, ok := new(big.Int).SetString(block.Number, 10)
+		if !ok {
+			return
+		}
+		if s.headTime > 0 && block.Timestamp > s.headTime && number.Uint64() == s.head+1 {
+			s.blockTime = time.Duration(block.Timestamp-s.headTime) * time.Second
+		}
+		s.head, s.headTime, s.txCount = number.Uint64(), block.Timestamp, block.TxCount
+		if block.GasLimit > 0 {
+			s.gasUsed = float64(block.GasUsed) / float64(block.GasLimit)
+		}
+	case "pending":
+		var batch client.PendingBatch
+		if json.Unmarshal(event.Data, &batch) == nil {
+			s.pending = batch.Count
+		}
+	case "gasPrice":
+		var sample struct {
+			Gwei float64 `json:"gwei"`
+		}
+		if json.Unmarshal(event.Data, &sample) == nil {
+			s.gwei = sample.Gwei
+		}
+	case "throughput":
+		// Show the shortest window with a TPS figure
+		var stats struct {
+			Windows map[string]struct {
+				TPS *float64 `json:"tps"`
+			} `json:"windows"`
+		}
+		if json.Unmarshal(event.Data, &stats) != nil {
+			return
+		}
+		var shortest time.Duration
+		for name, window := range stats.Windows {
+			d, err := time.ParseDuration(name)
+			if err != nil || window.TPS == nil || (shortest > 0 && d >= shortest) {
+				continue
+			}
+			shortest, s.tps, s.tpsWindow = d, *window.TPS, name
+		}
+	case "system":
+		var e struct {
+			Type     string `json:"type"`
+			Severity string `json:"severity"`
+			Message  string `json:"message"`
+		}
+		if json.Unmarshal(event.Data, &e) == nil && e.Severity != "info" {
+			s.appendError(e.Type, e.Message)
+		}
+	}
+}
+
+// runTop implements the top subcommand and returns the process exit code
+func runTop(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), topUsage)
+		fs.PrintDefaults()
+	}
+	server := fs.String("server", envOr("SOMNIA_STREAM_URL", "http://localhost:8080"), "URL of the running instance (SOMNIA_STREAM_URL)")
+	apiKey := fs.String("api-key", os.Getenv("SOMNIA_API_KEY"), "API key (SOMNIA_API_KEY)")
+	token := fs.String("token", os.Getenv("SOMNIA_TOKEN"), "JWT bearer token (SOMNIA_TOKEN)")
+	interval := fs.Duration("interval", time.Second, "screen refresh interval")
+	healthInterval := fs.Duration("health-interval", 5*time.Second, "how often /health is polled")
+	streamList := fs.String("streams", "blocks,pending,gasPrice,throughput,logs,lifecycle,failed,whales,system",
+		"comma-separated streams to subscribe to and show rates for")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	if *interval <= 0 || *healthInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "--interval and --health-interval must be positive")
+		return 2
+	}
+
+	var names []string
+	for _, name := range strings.Split(*streamList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(*server, client.WithAPIKey(*apiKey), client.WithToken(*token))
+	state := newTopState(names)
+
+	for _, name := range names {
+		go topSubscribe(ctx, c, name, state)
+	}
+	go topPollHealth(ctx, c, *healthInterval, state)
+
+	// Escape sequences only make sense on a terminal; piped output gets plain frames
+	tty := isTerminal(os.Stdout)
+	if tty {
+		fmt.Print(ansiEnterScreen)
+		defer fmt.Print(ansiLeaveScreen)
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		var frame bytes.Buffer
+		if tty {
+			frame.WriteString(ansiRedraw)
+		}
+		state.render(&frame, *server, tty)
+		os.Stdout.Write(frame.Bytes())
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// topSubscribe follows one stream until ctx is done, recording every message
+func topSubscribe(ctx context.Context, c *client.Client, stream string, state *topState) {
+	opts := client.SubscribeOptions{
+		OnNotice: func(n client.Notice) {
+			state.addError(stream, fmt.Sprintf("server dropped %d messages (%s policy)", n.Dropped, n.Policy))
+		},
+		OnReconnect: func(err error, delay time.Duration) {
+			state.setStatus(stream, "reconnecting")
+			state.addError(stream, fmt.Sprintf("disconnected: %v, retrying in %s", err, delay))
+		},
+	}
+	if stream == "blocks" {
+		opts.Detail = "header" // Only the header is shown
+	}
+
+	err := c.Subscribe(ctx, stream, opts, func(event client.Event) error {
+		state.record(stream)
+		state.update(stream, event)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		// Permanent failures such as an unknown stream or a missing scope
+		state.setStatus(stream, err.Error())
+		state.addError(stream, err.Error())
+	}
+}
+
+// topPollHealth refreshes the health panel every interval
+func topPollHealth(ctx context.Context, c *client.Client, interval time.Duration, state *topState) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		health, err := c.Health(ctx)
+		state.mu.Lock()
+		state.health = health
+		state.healthError = ""
+		if err != nil {
+			state.healthError = err.Error()
+		}
+		state.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// render draws one frame of the screen
+func (s *topState) render(w io.Writer, server string, color bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + ansiReset
+	}
+	statusColor := func(status string) string {
+		switch status {
+		case "ok", "live":
+			return paint(ansiGreen, status)
+		case "degraded", "connecting", "reconnecting", "starting", "paused", "stale":
+			return paint(ansiYellow, status)
+		default:
+			return paint(ansiRed, status)
+		}
+	}
+	now := time.Now()
+
+	overall := "unknown"
+	if s.health != nil {
+		overall = s.health.Status
+	} else if s.healthError != "" {
+		overall = "unreachable"
+	}
+	fmt.Fprintf(w, "%s  %s  %s  %s\n\n", paint(ansiBold, "somnia-stream top"), server, statusColor(overall),
+		paint(ansiDim, now.Format("15:04:05")))
+
+	// Headline figures
+	head, headAge, blockTime, tps, gas, pending := "–", "", "–", "–", "–", "–"
+	if s.head > 0 {
+		head = fmt.Sprintf("#%d", s.head)
+		headAge = fmt.Sprintf(" (%s ago, %d txs, gas %.1f%%)",
+			now.Sub(time.Unix(int64(s.headTime), 0)).Truncate(time.Second), s.txCount, s.gasUsed*100)
+	}
+	if s.blockTime > 0 {
+		blockTime = s.blockTime.String()
+	}
+	if s.tpsWindow != "" {
+		tps = fmt.Sprintf("%.2f (%s)", s.tps, s.tpsWindow)
+	}
+	if s.gwei > 0 {
+		gas = fmt.Sprintf("%.4f gwei", s.gwei)
+	}
+	if st := s.streams["pending"]; st != nil && st.total > 0 {
+		pending = fmt.Sprint(s.pending)
+	}
+	fmt.Fprintf(w, "  Head        %s%s\n", paint(ansiBold, head), headAge)
+	fmt.Fprintf(w, "  Block time  %s\n", blockTime)
+	fmt.Fprintf(w, "  TPS         %s\n", tps)
+	fmt.Fprintf(w, "  Gas price   %s\n", gas)
+	fmt.Fprintf(w, "  Pending     %s\n\n", pending)
+
+	// Per-stream rates
+	fmt.Fprintln(w, paint(ansiBold, fmt.Sprintf("  %-20s %10s %10s  %s", "STREAM", "MSG/S", "TOTAL", "STATUS")))
+	names := make([]string, 0, len(s.streams))
+	for name := range s.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	window := now.Sub(s.started)
+	if window > topRateWindow {
+		window = topRateWindow
+	}
+	for _, name := range names {
+		st := s.streams[name]
+		cutoff := now.Add(-topRateWindow)
+		keep := 0
+		for keep < len(st.arrivals) && st.arrivals[keep].Before(cutoff) {
+			keep++
+		}
+		st.arrivals = st.arrivals[keep:]
+		rate := 0.0
+		if window > 0 {
+			rate = float64(len(st.arrivals)) / window.Seconds()
+		}
+		fmt.Fprintf(w, "  %-20s %10.2f %10d  %s\n", name, rate, st.total, statusColor(st.status))
+	}
+	fmt.Fprintln(w)
+
+	// Component health
+	fmt.Fprintln(w, paint(ansiBold, "  HEALTH"))
+	switch {
+	case s.health != nil:
+		components := make([]string, 0, len(s.health.Components))
+		for name := range s.health.Components {
+			components = append(components, name)
+		}
+		sort.Strings(components)
+		for _, name := range components {
+			component := s.health.Components[name]
+			detail := component.Error
+			switch {
+			case name == "rpc" && component.Head > 0:
+				detail = fmt.Sprintf("head %d, %s old, latency %s", component.Head, component.HeadAge, component.Latency)
+			case name == "jetstream" && len(component.Missing) > 0:
+				detail = "missing " + strings.Join(component.Missing, ", ")
+			case name == "monitors":
+				var unhealthy []string
+				for monitor, m := range component.Monitors {
+					if m.Status != "ok" {
+						unhealthy = append(unhealthy, monitor+" "+m.Status)
+					}
+				}
+				sort.Strings(unhealthy)
+				detail = fmt.Sprintf("%d running", len(component.Monitors))
+				if len(unhealthy) > 0 {
+					detail += ", " + strings.Join(unhealthy, ", ")
+				}
+			}
+			fmt.Fprintf(w, "  %-20s %-10s %s\n", name, statusColor(component.Status), paint(ansiDim, detail))
+		}
+	case s.healthError != "":
+		fmt.Fprintf(w, "  %s\n", paint(ansiRed, s.healthError))
+	default:
+		fmt.Fprintf(w, "  %s\n", paint(ansiDim, "waiting for /health"))
+	}
+	fmt.Fprintln(w)
+
+	// Recent errors, newest first
+	fmt.Fprintln(w, paint(ansiBold, "  RECENT ERRORS"))
+	if len(s.errors) == 0 {
+		fmt.Fprintf(w, "  %s\n", paint(ansiDim, "none"))
+	}
+	for i := len(s.errors) - 1; i >= 0; i-- {
+		e := s.errors[i]
+		fmt.Fprintf(w, "  %s %-14s %s\n", paint(ansiDim, e.at.Format("15:04:05")), e.source, e.message)
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// traceMaxBlocks bounds the blocks traced per tick; tracing is expensive, so
+// a monitor that fell behind skips ahead instead of catching up
+const traceMaxBlocks = 10
+
+// blockTracers are the supported BLOCK_TRACER values
+var blockTracers = map[string]bool{"callTracer": true, "prestateTracer": true}
+
+// blockTrace is one transaction of a debug_traceBlockByNumber result
+type blockTrace struct {
+	TxHash string          `json:"txHash"`
+	Result json.RawMessage `json:"result"`
+}
+
+// Monitor new blocks and publish their traces, internal transactions and
+// state changes
+func (dt *SomniaStream) monitorTraces(ctx context.Context) {
+	dt.runCheckpointed(ctx, "traces", func(lastBlock *uint64) error {
+		return dt.publishBlockTraces(ctx, lastBlock)
+	})
+}
+
+// Trace the blocks since the last traced one, publishing the BLOCK_TRACER
+// traces on eth.traces, with INTERNAL_TXS the internal transactions found in
+// callTracer traces on eth.tx.internal, and with STATE_DIFFS the state
+// changes on eth.state.diffs
+func (dt *SomniaStream) publishBlockTraces(ctx context.Context, lastBlock *uint64) error {
+	cfg := dt.config()
+	if cfg.BlockTracer == "" && !cfg.InternalTxs && !cfg.StateDiffs {
+		return nil
+	}
+	if cfg.BlockTracer != "" && !blockTracers[cfg.BlockTracer] {
+		return fmt.Errorf("unsupported BLOCK_TRACER %q, expected callTracer or prestateTracer", cfg.BlockTracer)
+	}
+
+	headCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	head, err := dt.ethClient.BlockNumber(headCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if head <= *lastBlock {
+		return nil
+	}
+	from := *lastBlock + 1
+	switch {
+	case *lastBlock == 0:
+		from = head // Start with the current block, not the chain's history
+	case head-*lastBlock > traceMaxBlocks:
+		log.Printf("[TRACES] WARNING: Tracing fell behind, skipping blocks %d-%d", from, head-traceMaxBlocks)
+		from = head - traceMaxBlocks + 1
+	}
+
+	for number := from; number <= head; number++ {
+		var calls []blockTrace
+		if cfg.BlockTracer != "" {
+			traces, err := dt.traceBlock(ctx, number, cfg.BlockTracer, nil)
+			if err != nil {
+				return err
+			}
+			if err := dt.publishTraces(number, cfg.BlockTracer, traces, cfg.TraceMaxTxs); err != nil {
+				return err
+			}
+			if cfg.BlockTracer == "callTracer" {
+				calls = traces
+			}
+		}
+		if cfg.InternalTxs {
+			if calls == nil {
+				if calls, err = dt.traceBlock(ctx, number, "callTracer", nil); err != nil {
+					return err
+				}
+			}
+			if err := dt.publishInternalTxs(number, calls, cfg.InternalTxsMax); err != nil {
+				return err
+			}
+		}
+		if cfg.StateDiffs {
+			diffs, err := dt.traceBlock(ctx, number, "prestateTracer", map[string]interface{}{"diffMode": true})
+			if err != nil {
+				return err
+			}
+			if err := dt.publishStateDiffs(number, diffs, cfg.StateDiffsMax); err != nil {
+				return err
+			}
+		}
+		*lastBlock = number
+	}
+	return nil
+}
+
+// traceBlock runs debug_traceBlockByNumber with a tracer and optional config
+func (dt *SomniaStream) traceBlock(ctx context.Context, number uint64, tracer string, tracerConfig map[string]interface{}) ([]blockTrace, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	options := map[string]interface{}{"tracer": tracer}
+	if tracerConfig != nil {
+		options["tracerConfig"] = tracerConfig
+	}
+	var traces []blockTrace
+	err := dt.rpcClient.CallContext(ctx, &traces, "debug_traceBlockByNumber", hexutil.EncodeUint64(number), options)
+	if err != nil {
+		return nil, fmt.Errorf("tracing block %d: %w", number, err)
+	}
+	return traces, nil
+}
+
+// publishTraces publishes the traces of a block on eth.traces
+func (dt *SomniaStream) publishTraces(number uint64, tracer string, traces []blockTrace, limit int) error {
+	items := make([]map[string]interface{}, len(traces))
+	for i, trace := range traces {
+		items[i] = map[string]interface{}{"txHash": trace.TxHash, "result": trace.Result}
+	}
+	base := map[string]interface{}{
+		"blockNumber": number,
+		"tracer":      tracer,
+		"txCount":     len(traces),
+		"timestamp":   time.Now().Unix(),
+	}
+	if err := dt.publishCapped("eth.traces", base, "traces", items, limit); err != nil {
+		log.Printf("[TRACES] ERROR: Failed to publish traces of block %d: %v", number, err)
+		return err
+	}
+	log.Printf("[TRACES] Published %d %s traces of block %d", len(traces), tracer, number)
+	return nil
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/config"
+	"somnia-stream/pkg/streams"
+)
+
+// headerImportedSeq records the stream sequence an imported message had in
+// the instance it was exported from
+const headerImportedSeq = "Somnia-Imported-Seq"
+
+const exportUsage = `Usage: somnia-stream export [flags] <stream>
+
+Dump the stored messages of a stream to NDJSON, one message per line with its
+subject, sequence, publish time, headers and payload, or to a Parquet file
+with the same columns. <stream> is a stream name such as blocks or gasPrice,
+or a JetStream stream such as ETH_BLOCKS to dump every subject it holds.
+Reads NATS_URL and the NATS_* settings.
+
+Examples:
+  somnia-stream export blocks-header --since=24h > blocks.ndjson
+  somnia-stream export ETH_NETWORK --out network.ndjson
+  somnia-stream export logs --from-seq=120000 --limit=5000 | gzip > logs.ndjson.gz
+  somnia-stream export blocks --since=24h --out blocks.parquet
+
+Flags:
+`
+
+const importUsage = `Usage: somnia-stream import [flags] <file>
+
+Publish the messages of an NDJSON export file (- for stdin) or Parquet export
+file to JetStream, on their original subjects or on the subject of --stream. The target instance must
+have created its streams, and the messages get new sequences and publish
+times; their original sequence is kept in the Somnia-Imported-Seq header.
+Reads NATS_URL and the NATS_* settings.
+
+Examples:
+  somnia-stream import blocks.ndjson
+  gunzip -c logs.ndjson.gz | somnia-stream import -
+  somnia-stream import captured.ndjson --stream=replay-blocks
+  somnia-stream import blocks.parquet
+
+Flags:
+`
+
+// dumpRecord is one line of an export file
+type dumpRecord struct {
+	Subject    string              `json:"subject"` // Without the subject namespace
+	Seq        uint64              `json:"seq"`
+	Time       time.Time           `json:"time"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Data       json.RawMessage     `json:"data,omitempty"`
+	DataBase64 []byte              `json:"dataBase64,omitempty"` // Payloads that aren't JSON
+}
+
+// newDumpRecord returns the export file line of a stored message
+func newDumpRecord(msg historyMessage) dumpRecord {
+	record := dumpRecord{
+		Subject: msg.Subject,
+		Seq:     msg.Seq,
+		Time:    msg.Published.UTC(),
+		Headers: msg.Header,
+	}
+	if json.Valid(msg.Data) {
+		record.Data = msg.Data
+	} else {
+		record.DataBase64 = msg.Data
+	}
+	return record
+}
+
+// payload returns the message payload of a record
+func (r dumpRecord) payload() []byte {
+	if r.DataBase64 != nil {
+		return r.DataBase64
+	}
+	return r.Data
+}
+
+// runExportCommand implements the export subcommand and returns the process
+// exit code
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), exportUsage)
+		fs.PrintDefaults()
+	}
+	out := fs.String("out", "-", "file to write, - for stdout")
+	since := fs.Duration("since", 0, "only export messages published within this long, e.g. 24h (0 = everything stored)")
+	fromSeq := fs.Uint64("from-seq", 0, "only export messages after this stream sequence")
+	limit := fs.Int("limit", 0, "stop after this many messages (0 = all)")
+	format := fs.String("format", "", "ndjson or parquet (default: parquet for a .parquet --out, else ndjson)")
+
+	// Accept flags after the stream name, like tail
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	stream := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	if *since > 0 && *fromSeq > 0 {
+		fmt.Fprintln(os.Stderr, "--since and --from-seq are mutually exclusive")
+		return 2
+	}
+	fileFormat, err := transferFormat(*format, *out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	w := os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export %s: %v\n", stream, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	deliver := nats.DeliverAll()
+	switch {
+	case *fromSeq > 0:
+		deliver = nats.StartSequence(*fromSeq + 1)
+	case *since > 0:
+		deliver = nats.StartTime(time.Now().Add(-*since))
+	}
+	count, err := exportStream(ctx, stream, deliver, *limit, newRecordWriter(fileFormat, w))
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "export %s: %v\n", stream, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d messages of %s\n", count, stream)
+	return 0
+}
+
+// exportStream writes the stored messages of a stream name or JetStream
+// stream to w, closing it
+func exportStream(ctx context.Context, stream string, deliver nats.SubOpt, limit int, w recordWriter) (int, error) {
+	js, ns, closeNATS, err := connectCLI(ctx, "somnia-stream-export")
+	if err != nil {
+		return 0, err
+	}
+	defer closeNATS()
+
+	subject, opts := "", []nats.SubOpt{nats.OrderedConsumer(), deliver}
+	if strings.ToUpper(stream) == stream {
+		opts = append(opts, nats.BindStream(ns.Stream(stream)))
+	} else if s, ok := streams.LookupBuiltin(stream); ok {
+		subject = ns.Subject(s)
+	} else if streams.NamePattern.MatchString(stream) {
+		subject = ns.Subject(streams.DerivedSubjectPrefix + stream)
+	} else {
+		return 0, fmt.Errorf("unknown stream %q", stream)
+	}
+	sub, err := js.SubscribeSync(subject, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer sub.Unsubscribe()
+
+	count := 0
+	for limit <= 0 || count < limit {
+		if err := ctx.Err(); err != nil {
+			return count, errors.Join(err, w.Close())
+		}
+		msg, err := sub.NextMsg(2 * time.Second)
+		if errors.Is(err, nats.ErrTimeout) {
+			break // Nothing (more) stored
+		}
+		if err != nil {
+			return count, err
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return count, err
+		}
+
+		record := newDumpRecord(historyMessage{
+			Subject:   ns.TrimSubject(msg.Subject),
+			Seq:       meta.Sequence.Stream,
+			Published: meta.Timestamp,
+			Header:    msg.Header,
+			Data:      msg.Data,
+		})
+		if err := w.Write(record); err != nil {
+			return count, err
+		}
+		count++
+		if meta.NumPending == 0 {
+			break
+		}
+	}
+	return count, w.Close()
+}
+
+// runImportCommand implements the import subcommand and returns the process
+// exit code
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), importUsage)
+		fs.PrintDefaults()
+	}
+	target := fs.String("stream", "", "publish every message on the subject of this stream instead of its original subject")
+	format := fs.String("format", "", "ndjson or parquet (default: parquet for a .parquet file, else ndjson)")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	file := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+
+	subject := ""
+	if *target != "" {
+		s, ok := streams.LookupBuiltin(*target)
+		if !ok && !streams.NamePattern.MatchString(*target) {
+			fmt.Fprintf(os.Stderr, "unknown stream %q\n", *target)
+			return 2
+		}
+		if !ok {
+			s = streams.DerivedSubjectPrefix + *target
+		}
+		subject = s
+	}
+	fileFormat, err := transferFormat(*format, file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	r := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "import %s: %v\n", file, err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	records, err := newRecordReader(fileFormat, r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import %s: %v\n", file, err)
+		return 1
+	}
+	defer records.Close()
+
+	count, err := importMessages(ctx, records, subject)
+	fmt.Fprintf(os.Stderr, "imported %d messages\n", count)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "import %s: %v\n", file, err)
+		return 1
+	}
+	return 0
+}
+
+// importMessages publishes the records of an export file, on subject when set
+func importMessages(ctx context.Context, records recordReader, subject string) (int, error) {
+	js, ns, closeNATS, err := connectCLI(ctx, "somnia-stream-import")
+	if err != nil {
+		return 0, err
+	}
+	defer closeNATS()
+
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		record, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		msg := &nats.Msg{Subject: record.Subject, Header: nats.Header(record.Headers), Data: record.payload()}
+		if subject != "" {
+			msg.Subject = subject
+		}
+		if msg.Subject == "" {
+			return count, fmt.Errorf("message %d: no subject", count+1)
+		}
+		msg.Subject = ns.Subject(msg.Subject)
+		if msg.Header == nil {
+			msg.Header = nats.Header{}
+		}
+		msg.Header.Set(headerImportedSeq, fmt.Sprint(record.Seq))
+		if _, err := js.PublishMsg(msg, nats.Context(ctx)); err != nil {
+			return count, fmt.Errorf("message %d: publish on %s: %v", count+1, msg.Subject, err)
+		}
+		count++
+	}
+}
+
+// connectCLI connects a command-line tool to JetStream with NATS_URL and the
+// NATS_* settings, and resolves the subject namespace
+func connectCLI(ctx context.Context, name string) (nats.JetStreamContext, streams.Namespace, func(), error) {
+	_ = godotenv.Load()
+	cfg := config.Load()
+
+	opts, err := natsOptions(cfg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	nc, err := nats.Connect(cfg.NATSUrl, append(opts, nats.Name(name))...)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("connect to NATS at %s: %v", cfg.NATSUrl, err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, "", nil, err
+	}
+	ns, err := cliNamespace(ctx, cfg)
+	if err != nil {
+		nc.Close()
+		return nil, "", nil, err
+	}
+	return js, ns, nc.Close, nil
+}
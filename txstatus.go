@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+)
+
+// Transaction status values returned by GET /tx/:hash
+const (
+	txStatusPending   = "pending"
+	txStatusMined     = "mined"
+	txStatusFailed    = "failed"
+	txStatusFinalized = "finalized"
+	txStatusDropped   = "dropped"
+	txStatusUnknown   = "unknown"
+)
+
+// Merge fields into the stored status record of a transaction
+func (dt *SomniaStream) updateTxStatus(hash string, fields map[string]interface{}) {
+	if dt.txStatus == nil {
+		return
+	}
+
+	record := map[string]interface{}{}
+	if entry, err := dt.txStatus.Get(hash); err == nil {
+		_ = json.Unmarshal(entry.Value(), &record)
+	}
+	previous, _ := record["status"].(string)
+	for k, v := range fields {
+		record[k] = v
+	}
+	// A reverted transaction stays failed when it is later mined or finalized
+	if previous == txStatusFailed {
+		record["status"] = txStatusFailed
+	}
+	record["updatedAt"] = time.Now().Unix()
+
+	data, _ := json.Marshal(record)
+	if _, err := dt.txStatus.Put(hash, data); err != nil {
+		log.Printf("[TXSTATUS] ERROR: Failed to store status for %s: %v", hash, err)
+	}
+}
+
+// Load the stored status record of a transaction, if any
+func (dt *SomniaStream) loadTxStatus(hash string) (map[string]interface{}, error) {
+	if dt.txStatus == nil {
+		return nil, nats.ErrKeyNotFound
+	}
+
+	entry, err := dt.txStatus.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Handle GET /tx/:hash returning the latest known state of a transaction
+func (dt *SomniaStream) handleTxStatus(c *gin.Context) {
+	hashParam := c.Param("hash")
+	if !strings.HasPrefix(hashParam, "0x") || len(hashParam) != 66 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction hash"})
+		return
+	}
+	hash := common.HexToHash(hashParam)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	response := gin.H{
+		"hash":   hash.Hex(),
+		"status": txStatusUnknown,
+	}
+
+	// Stored state from the lifecycle and failed transaction streams
+	record, err := dt.loadTxStatus(hash.Hex())
+	if err == nil {
+		response["stored"] = record
+		if status, ok := record["status"].(string); ok {
+			response["status"] = status
+		}
+	} else if !errors.Is(err, nats.ErrKeyNotFound) {
+		log.Printf("[TXSTATUS] ERROR: Failed to load status for %s: %v", hash.Hex(), err)
+	}
+
+	// In-memory lifecycle state is fresher than the KV record
+	if tracked, ok := dt.lifecycle.get(hash.Hex()); ok {
+		response["lifecycle"] = tracked
+		if tracked.State == txStateSeen {
+			response["status"] = txStatusPending
+		}
+	}
+
+	// Fill in transaction and receipt details from the node
+	tx, isPending, err := dt.ethClient.TransactionByHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, ethereum.NotFound) {
+			if response["status"] == txStatusUnknown {
+				c.JSON(http.StatusNotFound, response)
+				return
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		log.Printf("[TXSTATUS] ERROR: Failed to fetch transaction %s: %v", hash.Hex(), err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	response["transaction"] = tx
+
+	if isPending {
+		response["status"] = txStatusPending
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	receipt, cached := dt.receipts.get(hash)
+	if !cached {
+		if receipt, err = dt.ethClient.TransactionReceipt(ctx, hash); err != nil {
+			log.Printf("[TXSTATUS] ERROR: Failed to fetch receipt for %s: %v", hash.Hex(), err)
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		dt.receipts.add(hash, receipt)
+	}
+	response["receipt"] = receipt
+	response["blockNumber"] = receipt.BlockNumber.Uint64()
+	response["blockHash"] = receipt.BlockHash.Hex()
+	logs := logMaps(receipt.Logs)
+	dt.names.annotate(logs, "address")
+	dt.abis.decode(logs)
+	dt.tokens.annotate(logs)
+	response["logs"] = logs
+
+	switch {
+	case receipt.Status == types.ReceiptStatusFailed:
+		response["status"] = txStatusFailed
+	default:
+		response["status"] = txStatusMined
+		if head, err := dt.ethClient.BlockNumber(ctx); err == nil {
+			confirmations := head - receipt.BlockNumber.Uint64() + 1
+			response["confirmations"] = confirmations
+			if confirmations > dt.lifecycle.depth() {
+				response["status"] = txStatusFinalized
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// logMaps converts receipt logs to the eth_getLogs form the eth.logs stream
+// publishes, so they can be decoded and annotated like streamed logs
+func logMaps(logs []*types.Log) []map[string]interface{} {
+	data, _ := json.Marshal(logs)
+	var maps []map[string]interface{}
+	json.Unmarshal(data, &maps)
+	return maps
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// orphanWindow is how many recent blocks are remembered to detect blocks
+// that were replaced by another at the same height
+const orphanWindow = 64
+
+// blockRef is a published block as remembered for orphan detection
+type blockRef struct {
+	hash       common.Hash
+	parentHash common.Hash
+	miner      common.Address
+	timestamp  uint64
+}
+
+// blockHistory remembers the hashes of recently published blocks by number
+type blockHistory struct {
+	mu     sync.Mutex
+	blocks map[uint64]blockRef
+}
+
+func newBlockHistory() *blockHistory {
+	return &blockHistory{blocks: make(map[uint64]blockRef)}
+}
+
+// Publish the uncles of a new block and the previously published blocks it
+// shows to be non-canonical on eth.blocks.uncles. A published block is
+// non-canonical when the new block's ancestry no longer goes through it;
+// ancestry is followed back while it differs from what was published.
+func (dt *SomniaStream) publishAlternativeBlocks(block *types.Block) {
+	for i, uncle := range block.Uncles() {
+		dt.publishAlternativeBlock("uncle", uncle.Number.Uint64(), blockRef{
+			hash:       uncle.Hash(),
+			parentHash: uncle.ParentHash,
+			miner:      uncle.Coinbase,
+			timestamp:  uncle.Time,
+		}, map[string]interface{}{
+			"index":      i,
+			"includedIn": map[string]interface{}{"number": block.NumberU64(), "hash": block.Hash().Hex()},
+		})
+	}
+
+	number := block.NumberU64()
+	history := dt.history
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	// Only the last published block below this one needs checking; the
+	// parent hash covers it without an RPC call when no block was skipped
+	checked := uint64(0)
+	for n := range history.blocks {
+		if n < number && n > checked {
+			checked = n
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for n := checked; n > 0; n-- {
+		published, ok := history.blocks[n]
+		if !ok {
+			break
+		}
+		canonical := block.ParentHash()
+		if n != number-1 {
+			header, err := dt.ethClient.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+			if err != nil {
+				log.Printf("[UNCLES] WARNING: Failed to fetch canonical block %d: %v", n, err)
+				break
+			}
+			canonical = header.Hash()
+		}
+		if published.hash == canonical {
+			break
+		}
+		dt.publishAlternativeBlock("orphan", n, published, map[string]interface{}{
+			"replacedBy": map[string]interface{}{"number": n, "hash": canonical.Hex()},
+			"observedAt": map[string]interface{}{"number": number, "hash": block.Hash().Hex()},
+		})
+		delete(history.blocks, n)
+		dt.forgetBlock(n)
+	}
+
+	history.blocks[number] = blockRef{
+		hash:       block.Hash(),
+		parentHash: block.ParentHash(),
+		miner:      block.Coinbase(),
+		timestamp:  block.Time(),
+	}
+	for n := range history.blocks {
+		if n+orphanWindow <= number {
+			delete(history.blocks, n)
+		}
+	}
+}
+
+func (dt *SomniaStream) publishAlternativeBlock(kind string, number uint64, ref blockRef, extra map[string]interface{}) {
+	payload := map[string]interface{}{
+		"type":       kind,
+		"number":     number,
+		"hash":       ref.hash.Hex(),
+		"parentHash": ref.parentHash.Hex(),
+		"miner":      ref.miner.Hex(),
+		"timestamp":  ref.timestamp,
+	}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	log.Printf("[UNCLES] %s block #%d %s", kind, number, ref.hash.Hex())
+
+	data, _ := json.Marshal(payload)
+	if err := dt.publish("eth.blocks.uncles", data); err != nil {
+		log.Printf("[UNCLES] ERROR: Failed to publish %s block %s: %v", kind, ref.hash.Hex(), err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"somnia-stream/pkg/streams"
+)
+
+// keyUsage is the metered usage of one API key
+type keyUsage struct {
+	KeyID          string `json:"keyId"`
+	Name           string `json:"name"`
+	Requests       uint64 `json:"requests"`
+	Messages       uint64 `json:"messages"`
+	Bytes          uint64 `json:"bytes"`
+	ConnectSeconds int64  `json:"connectSeconds"`
+	LastSeen       int64  `json:"lastSeen,omitempty"`
+}
+
+func (u *keyUsage) add(other keyUsage) {
+	u.Requests += other.Requests
+	u.Messages += other.Messages
+	u.Bytes += other.Bytes
+	u.ConnectSeconds += other.ConnectSeconds
+	if other.LastSeen > u.LastSeen {
+		u.LastSeen = other.LastSeen
+	}
+}
+
+// usageMeter accumulates usage per API key. The current interval is published
+// on somnia.usage and folded into the totals on every flush.
+type usageMeter struct {
+	mu            sync.Mutex
+	intervalStart time.Time
+	current       map[string]*keyUsage
+	totals        map[string]*keyUsage
+	since         time.Time
+}
+
+func newUsageMeter() *usageMeter {
+	now := time.Now()
+	return &usageMeter{
+		intervalStart: now,
+		current:       make(map[string]*keyUsage),
+		totals:        make(map[string]*keyUsage),
+		since:         now,
+	}
+}
+
+// entry returns the current-interval record of a key; must be called with mu held
+func (m *usageMeter) entry(key *apiKey) *keyUsage {
+	u, ok := m.current[key.ID]
+	if !ok {
+		u = &keyUsage{KeyID: key.ID, Name: key.Name}
+		m.current[key.ID] = u
+	}
+	u.LastSeen = time.Now().Unix()
+	return u
+}
+
+func (m *usageMeter) request(key *apiKey) {
+	m.mu.Lock()
+	m.entry(key).Requests++
+	m.mu.Unlock()
+}
+
+func (m *usageMeter) delivered(key *apiKey, bytes int) {
+	m.mu.Lock()
+	u := m.entry(key)
+	u.Messages++
+	u.Bytes += uint64(bytes)
+	m.mu.Unlock()
+}
+
+func (m *usageMeter) connected(key *apiKey, d time.Duration) {
+	m.mu.Lock()
+	m.entry(key).ConnectSeconds += int64(d.Seconds())
+	m.mu.Unlock()
+}
+
+// rotate closes the current interval and returns its usage
+func (m *usageMeter) rotate() (time.Time, time.Time, []keyUsage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start, end := m.intervalStart, time.Now()
+	interval := make([]keyUsage, 0, len(m.current))
+	for id, u := range m.current {
+		interval = append(interval, *u)
+		total, ok := m.totals[id]
+		if !ok {
+			total = &keyUsage{KeyID: u.KeyID, Name: u.Name}
+			m.totals[id] = total
+		}
+		total.add(*u)
+	}
+	m.current = make(map[string]*keyUsage)
+	m.intervalStart = end
+	return start, end, interval
+}
+
+// snapshot returns the totals including the open interval, sorted by key ID
+func (m *usageMeter) snapshot() []keyUsage {
+	m.mu.Lock()
+	merged := make(map[string]*keyUsage, len(m.totals))
+	for id, u := range m.totals {
+		copied := *u
+		merged[id] = &copied
+	}
+	for id, u := range m.current {
+		if total, ok := merged[id]; ok {
+			total.add(*u)
+		} else {
+			copied := *u
+			merged[id] = &copied
+		}
+	}
+	m.mu.Unlock()
+
+	usage := make([]keyUsage, 0, len(merged))
+	for _, u := range merged {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].KeyID < usage[j].KeyID })
+	return usage
+}
+
+// Periodically charge connect time of open connections and publish the
+// usage of the elapsed interval on somnia.usage
+func (dt *SomniaStream) runUsageMeter(ctx context.Context) {
+	ticker := time.NewTicker(dt.config().UsageInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dt.clients.chargeConnectTime()
+			dt.publishUsage()
+		}
+	}
+}
+
+func (dt *SomniaStream) publishUsage() {
+	start, end, interval := dt.usage.rotate()
+	for _, u := range interval {
+		event := map[string]interface{}{
+			"keyId":          u.KeyID,
+			"name":           u.Name,
+			"requests":       u.Requests,
+			"messages":       u.Messages,
+			"bytes":          u.Bytes,
+			"connectSeconds": u.ConnectSeconds,
+			"intervalStart":  start.Unix(),
+			"intervalEnd":    end.Unix(),
+			"timestamp":      time.Now().Unix(),
+		}
+		data, _ := json.Marshal(event)
+		if err := dt.publish(streams.UsageSubject, data); err != nil {
+			log.Printf("[USAGE] ERROR: Failed to publish usage for %s: %v", u.KeyID, err)
+		}
+	}
+}
+
+// Handle GET /admin/usage returning per-key totals since startup
+func (dt *SomniaStream) handleUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"since": dt.usage.since.Unix(),
+		"keys":  dt.usage.snapshot(),
+	})
+}
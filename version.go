@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build information, injected at build time:
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo returns the version, commit and build date, falling back to the VCS
+// stamp Go embeds in binaries built from a checkout
+func buildInfo() gin.H {
+	rev, built, tags := commit, buildDate, ""
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && rev == "":
+				rev = setting.Value
+			case setting.Key == "vcs.time" && built == "":
+				built = setting.Value
+			case setting.Key == "-tags":
+				tags = setting.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+
+	return gin.H{
+		"version":   version,
+		"commit":    rev,
+		"buildDate": built,
+		"goVersion": runtime.Version(),
+		"platform":  runtime.GOOS + "/" + runtime.GOARCH,
+		"buildTags": tags,
+	}
+}
+
+// features lists the optional capabilities compiled in or enabled by the current configuration
+func (dt *SomniaStream) features() []string {
+	cfg := dt.config()
+	enabled := map[string]bool{
+		"embedded-nats":     cfg.EmbeddedNATS,
+		"admin-api":         cfg.AdminToken != "" || dt.oidcEnabled(),
+		"api-keys":          cfg.APIKeyAuth,
+		"jwt":               dt.jwtEnabled(),
+		"oidc":              dt.oidcEnabled(),
+		"tls":               cfg.TLSCertFile != "" || len(cfg.TLSAutocertDomains) > 0,
+		"autocert":          len(cfg.TLSAutocertDomains) > 0,
+		"mtls":              cfg.TLSClientCAFile != "",
+		"nats-tls":          cfg.NATSTLS || cfg.NATSTLSCAFile != "" || cfg.NATSTLSCertFile != "",
+		"pending-subscribe": cfg.PendingSubscription,
+		"failed-txs":        cfg.TrackFailedTxs,
+		"base-fee":          cfg.TrackBaseFee,
+		"http-rate-limit":   cfg.HTTPRateLimit > 0,
+		"client-rate-limit": cfg.ClientRateLimit > 0,
+		"consistency-check": dt.verifier != nil,
+		"name-resolution":   dt.names != nil,
+		"selector-decoding": dt.selectors != nil,
+		"abi-fetch":         dt.abis.fetching(),
+		"token-metadata":    dt.tokens != nil,
+		"bridge-monitor":    len(cfg.BridgeContracts) > 0,
+		"pool-tracking":     len(cfg.PoolContracts) > 0,
+		"balance-watch":     len(cfg.BalanceWatchlist) > 0,
+		"stuck-tx-alerts":   len(cfg.NonceWatchlist) > 0,
+		"blob-txs":          true,
+		"orphan-blocks":     true,
+		"consensus-stats":   cfg.ConsensusStats,
+		"adaptive-polling":  cfg.AdaptivePolling,
+		"checkpoints":       cfg.Checkpoints,
+		"at-least-once":     true,
+		"pull-consumers":    true,
+		"queue-groups":      true,
+		"merged-streams":    true,
+		"websocket":         true,
+		"transforms":        true,
+		"publish-hooks":     len(cfg.PublishWasmHooks) > 0,
+		"plugin-monitors":   len(dt.plugins) > 0,
+		"exports":           len(cfg.Exports) > 0,
+		"archive":           len(cfg.ArchiveStreams) > 0,
+		"block-traces":      cfg.BlockTracer != "",
+		"internal-txs":      cfg.InternalTxs,
+		"state-diffs":       cfg.StateDiffs,
+		"state-reads":       true,
+		"call-proxy":        true,
+		"tx-relay":          true,
+		"simulation":        true,
+		"dashboard":         cfg.Dashboard,
+		"mock-rpc":          cfg.MockRPC,
+		"rpc-record":        cfg.RPCRecordFile != "",
+		"rpc-replay":        cfg.RPCReplayFile != "",
+		"chaos":             cfg.Chaos,
+		"multi-chain":       len(cfg.Chains) > 0,
+		"subject-namespace": cfg.SubjectNamespace != "",
+	}
+
+	var features []string
+	for name, on := range enabled {
+		if on {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// Handle GET /version
+func (dt *SomniaStream) handleVersion(c *gin.Context) {
+	info := buildInfo()
+	info["features"] = dt.features()
+	c.JSON(http.StatusOK, info)
+}
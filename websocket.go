@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+
+	"somnia-stream/pkg/api"
+	"somnia-stream/pkg/monitor"
+	"somnia-stream/pkg/streams"
+)
+
+// wsReadLimit caps the size of a command frame
+const wsReadLimit = 64 << 10
+
+// wsPingInterval is how often idle WebSocket connections are pinged when
+// SSE_HEARTBEAT_INTERVAL is off
+const wsPingInterval = 30 * time.Second
+
+// wsCommand is a command a WebSocket client sends to change what it receives
+type wsCommand struct {
+	Op          string           `json:"op"`                    // subscribe, unsubscribe, set-filter or ack
+	Ref         string           `json:"ref,omitempty"`         // Echoed in the reply
+	Stream      string           `json:"stream"`                // Stream name
+	Detail      string           `json:"detail,omitempty"`      // Block detail level, blocks stream only
+	Filters     []streams.Filter `json:"filters,omitempty"`     // subscribe and set-filter: all must match
+	Fields      []string         `json:"fields,omitempty"`      // subscribe: (dotted) fields to keep of every event
+	Transform   string           `json:"transform,omitempty"`   // subscribe: JMESPath-style expression applied to every event
+	LastEventID uint64           `json:"lastEventId,omitempty"` // subscribe: resume after this event ID
+	Delivery    string           `json:"delivery,omitempty"`    // subscribe: at-most-once or at-least-once
+	Consumer    string           `json:"consumer,omitempty"`    // subscribe: at-least-once consumer name
+	AckToken    string           `json:"ackToken,omitempty"`    // subscribe: ack token of an anonymous at-least-once consumer to resume
+	Group       string           `json:"group,omitempty"`       // subscribe: queue group to share the stream with
+	GroupToken  string           `json:"groupToken,omitempty"`  // subscribe: token shared by an anonymous caller's group members
+	IDs         []uint64         `json:"ids,omitempty"`         // ack: event IDs to acknowledge
+	UpTo        uint64           `json:"upTo,omitempty"`        // ack: acknowledge every event up to this ID
+}
+
+// wsFrame is a frame sent to a WebSocket client: an event, a command reply
+// (ok or error), or a gap or slow-consumer notice
+type wsFrame struct {
+	Type   string          `json:"type"`
+	Op     string          `json:"op,omitempty"`
+	Ref    string          `json:"ref,omitempty"`
+	Stream string          `json:"stream,omitempty"`
+	ID     uint64          `json:"id,omitempty"` // JetStream stream sequence of an event
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// wsSubscription is one stream a WebSocket client subscribed to
+type wsSubscription struct {
+	sub      *nats.Subscription
+	session  *ackSession // At-least-once subscriptions only
+	ackKey   string      // Key of session in the ack sessions
+	ackToken string      // Ack token issued to an anonymous at-least-once caller
+
+	mu      sync.Mutex
+	filters []streams.Filter
+}
+
+func (s *wsSubscription) setFilters(filters []streams.Filter) {
+	s.mu.Lock()
+	s.filters = filters
+	s.mu.Unlock()
+}
+
+// match reports whether a message passes the subscription's filters
+func (s *wsSubscription) match(data []byte) bool {
+	s.mu.Lock()
+	filters := s.filters
+	s.mu.Unlock()
+	if len(filters) == 0 {
+		return true
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return false
+	}
+	return streams.MatchFilters(value, filters)
+}
+
+// wsConn is a connected WebSocket client. Command replies are written by the
+// reader and events by the writer, so writes are serialized.
+type wsConn struct {
+	conn    *websocket.Conn
+	client  *clientConn
+	queue   *api.Queue
+	timeout time.Duration
+
+	writeMu sync.Mutex
+	subs    map[string]*wsSubscription // Touched by the reader only
+}
+
+func (w *wsConn) write(frame wsFrame) error {
+	data, _ := json.Marshal(frame)
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	if w.timeout > 0 {
+		_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	}
+	return w.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (w *wsConn) ping() error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+}
+
+// reply answers a command
+func (w *wsConn) reply(cmd wsCommand, data interface{}, err error) error {
+	frame := wsFrame{Type: "ok", Op: cmd.Op, Ref: cmd.Ref, Stream: cmd.Stream}
+	if err != nil {
+		frame.Type, frame.Error = "error", err.Error()
+	} else if data != nil {
+		frame.Data, _ = json.Marshal(data)
+	}
+	return w.write(frame)
+}
+
+// push queues a frame for the writer. Notices such as gaps are kept apart
+// from the events of their subject when the queue conflates.
+func (w *wsConn) push(subject string, frame wsFrame) {
+	data, _ := json.Marshal(frame)
+	msg := api.Message{Subject: subject, Data: data}
+	if frame.Type != "event" {
+		msg.Event = frame.Type
+	}
+	if dropped := w.queue.Push(msg); dropped > 0 {
+		w.client.dropped.Add(uint64(dropped))
+	}
+}
+
+// Handle GET /ws, a WebSocket connection whose subscriptions are managed with
+// JSON commands: subscribe, unsubscribe, set-filter and ack
+func (dt *SomniaStream) handleWebSocket(c *gin.Context) {
+	// Each subscribe command counts against its stream's limit
+	client, ctx, err := dt.clients.connectStreams(c, "ws", "*", "", nil, dt.connectionLimits())
+	if err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(connectionRetryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer dt.clients.disconnect(client)
+
+	conn, err := dt.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // The upgrader already responded
+	}
+	defer conn.Close()
+	conn.SetReadLimit(wsReadLimit)
+
+	cfg := dt.config()
+	w := &wsConn{
+		conn:    conn,
+		client:  client,
+		queue:   dt.newClientQueue(""),
+		timeout: cfg.SSEWriteTimeout,
+		subs:    make(map[string]*wsSubscription),
+	}
+	defer func() {
+		for _, s := range w.subs {
+			dt.wsUnsubscribe(s)
+		}
+	}()
+
+	// Closing the connection unblocks the reader once the client is
+	// disconnected by the writer or an admin
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer cancel()
+		dt.writeWebSocket(ctx, w)
+	}()
+
+	for {
+		var cmd wsCommand
+		if err := conn.ReadJSON(&cmd); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				if w.reply(cmd, nil, fmt.Errorf("invalid command: %v", err)) == nil {
+					continue
+				}
+			}
+			return
+		}
+		data, err := dt.wsCommand(c, w, cmd)
+		if err := w.reply(cmd, data, err); err != nil {
+			return
+		}
+	}
+}
+
+// wsCommand runs a command and returns the data of its reply
+func (dt *SomniaStream) wsCommand(c *gin.Context, w *wsConn, cmd wsCommand) (interface{}, error) {
+	if err := streams.ValidateFilters(cmd.Filters); err != nil {
+		return nil, err
+	}
+
+	s, subscribed := w.subs[cmd.Stream]
+	switch cmd.Op {
+	case "subscribe":
+		if subscribed {
+			return nil, fmt.Errorf("already subscribed to %q, use set-filter to change its filters", cmd.Stream)
+		}
+		if len(w.subs) >= maxMergedStreams {
+			return nil, fmt.Errorf("at most %d subscriptions per connection", maxMergedStreams)
+		}
+		if err := dt.clients.join(w.client, cmd.Stream, dt.connectionLimits()); err != nil {
+			return nil, err
+		}
+		s, err := dt.wsSubscribe(c, w, cmd)
+		if err != nil {
+			dt.clients.leave(w.client, cmd.Stream)
+			return nil, err
+		}
+		w.subs[cmd.Stream] = s
+		if s.ackToken != "" {
+			return gin.H{"ackToken": s.ackToken}, nil
+		}
+		return nil, nil
+	case "unsubscribe", "set-filter", "ack":
+		if !subscribed {
+			return nil, fmt.Errorf("not subscribed to %q", cmd.Stream)
+		}
+	default:
+		return nil, fmt.Errorf("unknown op %q, expected subscribe, unsubscribe, set-filter or ack", cmd.Op)
+	}
+
+	switch cmd.Op {
+	case "unsubscribe":
+		delete(w.subs, cmd.Stream)
+		dt.clients.leave(w.client, cmd.Stream)
+		return nil, dt.wsUnsubscribe(s) // Unacknowledged at-least-once events are redelivered on the next subscribe
+	case "set-filter":
+		s.setFilters(cmd.Filters)
+		return nil, nil
+	}
+	if s.session == nil {
+		return nil, fmt.Errorf("%q is not an at-least-once subscription", cmd.Stream)
+	}
+	if len(cmd.IDs) == 0 && cmd.UpTo == 0 {
+		return nil, errors.New("ids or upTo is required")
+	}
+	acked, pending := s.session.ack(cmd.IDs, cmd.UpTo)
+	return ackResponse{Acked: acked, Pending: pending}, nil
+}
+
+// wsUnsubscribe ends a subscription and releases its at-least-once consumer
+func (dt *SomniaStream) wsUnsubscribe(s *wsSubscription) error {
+	if s.session != nil {
+		defer dt.acks.close(s.ackKey)
+	}
+	return s.sub.Unsubscribe()
+}
+
+// wsSubscribe subscribes a WebSocket client to a stream with the delivery
+// mode, resume point and filters of a subscribe command
+func (dt *SomniaStream) wsSubscribe(c *gin.Context, w *wsConn, cmd wsCommand) (*wsSubscription, error) {
+	stream := cmd.Stream
+	subject, ok := dt.streams.lookup(stream)
+	if !ok {
+		return nil, fmt.Errorf("unknown stream %q", stream)
+	}
+	if !dt.streamAllowed(c, stream) {
+		return nil, fmt.Errorf("access to stream %q denied", stream)
+	}
+	if cmd.Detail != "" && stream == "blocks" {
+		if subject, ok = monitor.BlockDetailSubjects[cmd.Detail]; !ok {
+			return nil, errors.New("detail must be one of header, hashes, full")
+		}
+	}
+
+	shape, err := newMessageShape(strings.Join(cmd.Fields, ","), cmd.Transform)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := dt.config()
+	mode := cfg.DeliveryMode
+	if m, ok := cfg.DeliveryModes[stream]; ok {
+		mode = m
+	}
+	if cmd.Delivery != "" {
+		mode = cmd.Delivery
+	}
+	// Members of a queue group share a consumer, as on SSE
+	var groupPrincipal string
+	if cmd.Group != "" {
+		if !consumerNamePattern.MatchString(cmd.Group) {
+			return nil, errors.New("group must be 1-64 letters, digits, '-' or '_'")
+		}
+		if cmd.Delivery == deliveryAtLeastOnce {
+			return nil, errors.New("group can't be combined with delivery at-least-once")
+		}
+		if groupPrincipal, err = groupCaller(callerID(c), cmd.GroupToken); err != nil {
+			return nil, err
+		}
+		mode = deliveryAtMostOnce
+	}
+	var startSeq uint64
+	if cmd.LastEventID > 0 {
+		startSeq = cmd.LastEventID + 1
+	}
+
+	s := &wsSubscription{filters: cmd.Filters}
+	gaps := gapDetector{lastStream: max(startSeq, 1) - 1}
+	handler := func(msg *nats.Msg) {
+		frame := wsFrame{Type: "event", Stream: stream}
+		if meta, err := msg.Metadata(); err == nil {
+			frame.ID = meta.Sequence.Stream
+			if s.session == nil && cmd.Group == "" {
+				if notice := dt.detectGap(&gaps, meta); notice != nil {
+					w.client.gaps.Add(1)
+					w.push(msg.Subject, wsFrame{Type: "gap", Stream: stream, Data: notice})
+				}
+			}
+		}
+		data, ok := shape.apply(msg.Data)
+		if !ok || !s.match(msg.Data) {
+			msg.Ack() // Skipped on purpose, never redelivered
+			return
+		}
+		frame.Data = data
+		if s.session != nil {
+			s.session.track(frame.ID, msg)
+		} else if cmd.Group != "" {
+			msg.Ack()
+		}
+		if !json.Valid(frame.Data) {
+			frame.Data, _ = json.Marshal(string(msg.Data))
+		}
+		w.push(msg.Subject, frame)
+	}
+
+	switch {
+	case cmd.Group != "":
+		durable := durableConsumerName("group", groupPrincipal, dt.ns.Subject(subject), cmd.Group)
+		s.sub, err = dt.subscribeGroup(dt.ns.Subject(subject), durable, cmd.Group, handler)
+	case mode == "" || mode == deliveryAtMostOnce:
+		deliver := nats.DeliverNew()
+		if startSeq > 0 {
+			deliver = nats.StartSequence(startSeq)
+		}
+		s.sub, err = dt.js.Subscribe(dt.ns.Subject(subject), handler, deliver, nats.OrderedConsumer())
+	case mode == deliveryAtLeastOnce:
+		consumer := cmd.Consumer
+		if consumer == "" {
+			consumer = "default"
+		}
+		if !consumerNamePattern.MatchString(consumer) {
+			return nil, errors.New("consumer must be 1-64 letters, digits, '-' or '_'")
+		}
+		// Anonymous callers are told apart by an ack token, as on SSE, and
+		// resume their consumer by subscribing with it
+		caller := callerID(c)
+		if anonymousCaller(caller) {
+			if s.ackToken, err = ackToken(cmd.AckToken); err != nil {
+				return nil, err
+			}
+			caller = "token:" + s.ackToken
+		}
+		s.ackKey = ackSessionKey(caller, subject, consumer)
+		if s.session, err = dt.acks.open(s.ackKey, durableConsumerName("ws", caller, dt.ns.Subject(subject), consumer)); err != nil {
+			return nil, err
+		}
+		if s.sub, err = dt.subscribeDurable(dt.ns.Subject(subject), s.session.durable, startSeq, handler); err != nil {
+			dt.acks.close(s.ackKey)
+		}
+	default:
+		return nil, fmt.Errorf("delivery must be %s or %s", deliveryAtMostOnce, deliveryAtLeastOnce)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// writeWebSocket writes queued frames to a WebSocket client until ctx is done
+// or a write fails, pinging idle connections and sending slow-consumer notices
+func (dt *SomniaStream) writeWebSocket(ctx context.Context, w *wsConn) {
+	cfg := dt.config()
+	heartbeat := cfg.SSEHeartbeatInterval
+	if heartbeat <= 0 {
+		heartbeat = wsPingInterval
+	}
+	var notified uint64
+	var lastNotice time.Time
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, heartbeat)
+		msg, err := w.queue.Next(waitCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Tell lagging clients what they lost, at most once per notice interval
+		if dropped := w.client.dropped.Load(); dropped > notified && (err != nil || time.Since(lastNotice) >= slowNoticeInterval) {
+			notice := dt.slowConsumerNotice(w.client, w.queue.Policy(), dropped-notified)
+			notified, lastNotice = dropped, time.Now()
+			if err := w.write(wsFrame{Type: "notice", Data: notice}); err != nil {
+				return
+			}
+		}
+
+		if errors.Is(err, api.ErrSlowConsumer) {
+			log.Printf("Disconnecting slow WebSocket client %s", w.client.id)
+			dt.clientDropped(w.client, "slow_consumer")
+			return
+		}
+		if err != nil {
+			if err := w.ping(); err != nil {
+				return
+			}
+			continue
+		}
+
+		w.writeMu.Lock()
+		if w.timeout > 0 {
+			_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+		}
+		err = w.conn.WriteMessage(websocket.TextMessage, msg.Data)
+		w.writeMu.Unlock()
+		if err != nil {
+			return
+		}
+		w.client.recordDelivery(len(msg.Data))
+	}
+}